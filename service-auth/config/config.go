@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -15,12 +17,17 @@ import (
 
 var (
 	JWTPrivateKey     string
+	JWTPublicKey      string
 	JWTAdminPublicKey string
 	JWTDuration       int
 
 	RSAPrivateKey string
 	RSAPublicKey  string
 
+	CAPrivateKey           string
+	CACertificate          string
+	SigningCertificateDays int
+
 	TimestampSkew int
 )
 
@@ -51,6 +58,9 @@ type Config struct {
 	RSAPrivateKey string `envconfig:"RSA_PRIVATE_KEY" default:""`
 	RSAPublicKey  string `envconfig:"RSA_PUBLIC_KEY" default:""`
 
+	CAPrivateKey           string `envconfig:"CA_PRIVATE_KEY" default:""` // key of the ca issuing signing certificates
+	SigningCertificateDays int    `envconfig:"SIGNING_CERTIFICATE_DAYS" default:"365"`
+
 	TimestampSkew int `envconfig:"TIMESTAMP_SKEW" default:"5000"` //ms
 }
 
@@ -61,10 +71,14 @@ func Get() Config {
 
 	JWTPrivateKey = strings.ReplaceAll(cfg.JWTPrivateKey, "\\n", "\n")
 	RSAPrivateKey = strings.ReplaceAll(cfg.RSAPrivateKey, "\\n", "\n")
+	CAPrivateKey = strings.ReplaceAll(cfg.CAPrivateKey, "\\n", "\n")
+	SigningCertificateDays = cfg.SigningCertificateDays
 	JWTDuration = cfg.JWTDuration
 
 	RSAPublicKey = AccessKeyFromFile("rsa_sign.pub")
+	JWTPublicKey = AccessKeyFromFile("jwt_public.pem")
 	JWTAdminPublicKey = AccessKeyFromFile("admin_public.pem")
+	CACertificate = OptionalKeyFromFile("signing_ca.crt")
 
 	TimestampSkew = cfg.TimestampSkew
 	cfg.DBUser = url.QueryEscape(cfg.DBUser)
@@ -99,6 +113,16 @@ func AccessSecret(cfg *Config) {
 		logger.LogFatal.Fatalf("failed to access rsa secret: %v", err)
 	}
 
+	// the signing ca is optional, signing stays disabled without it
+	if cfg.CAPrivateKey != "" {
+		secretCaPrivate, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.CAPrivateKey, cfg.SecretVersion).
+			AccessSecretResource(client)
+		if err != nil {
+			logger.LogFatal.Fatalf("failed to access ca secret: %v", err)
+		}
+		cfg.CAPrivateKey = string(secretCaPrivate.Payload.Data)
+	}
+
 	secretDbPrivate, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.DBPassword, cfg.SecretVersion).
 		AccessSecretResource(client)
 	if err != nil {
@@ -120,3 +144,18 @@ func AccessKeyFromFile(keyName string) string {
 
 	return string(file)
 }
+
+// OptionalKeyFromFile reads a key file that may not be mounted, returning
+// an empty string when it is missing.
+func OptionalKeyFromFile(keyName string) string {
+	path, _ := filepath.Rel("..", fmt.Sprintf("../key/%s", keyName))
+	file, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.LogError.Fatalf("fail to open local key file: %s", keyName)
+		}
+		return ""
+	}
+
+	return string(file)
+}
@@ -0,0 +1,599 @@
+package user_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-auth/config"
+	"service-auth/datastruct"
+	"service-auth/datastruct/user"
+	"service-auth/db/csfle"
+	"service-auth/logger"
+	"service-auth/signing"
+	"service-auth/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const replacedKeyReason = "Diganti dengan kunci baru"
+
+type SigningController struct {
+	Collection *mongo.Collection
+
+	Users *UserController
+	CA    *signing.CA
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+}
+
+func InitSigningController(client *mongo.Client, csfle *csfle.CSFLE, users *UserController) *SigningController {
+	// without a ca the service runs with signing disabled
+	var ca *signing.CA
+	if config.CACertificate == "" || config.CAPrivateKey == "" {
+		logger.LogWarning.Println("Signing CA is not configured, signing is disabled")
+	} else {
+		var err error
+		ca, err = signing.LoadCA(config.CACertificate, config.CAPrivateKey)
+		if err != nil {
+			logger.LogFatal.Fatalf("failed to load signing ca: %v", err)
+		}
+	}
+
+	return &SigningController{
+		Collection: client.Database("user").Collection("signing_keys"),
+
+		Users: users,
+		CA:    ca,
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+	}
+}
+
+// Available refuses the signing routes while no signing ca is configured.
+func (sc *SigningController) Available() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sc.CA == nil {
+			utils.AbortWithStatusJSON(c, http.StatusServiceUnavailable, gin.H{"error": user.SigningDisabledError.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func sealSigningKey(signingKey *user.SigningKey) error {
+	id := signingKey.ID
+	signingKey.ID = primitive.NilObjectID
+	signingKey.Signature = nil
+
+	dataByte, err := json.Marshal(signingKey)
+	signingKey.ID = id
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(dataByte))
+	signingKey.Signature = &signature
+
+	return nil
+}
+
+func verifiedSigningKey(signingKey *user.SigningKey) bool {
+	if signingKey.Signature == nil {
+		return false
+	}
+
+	id := signingKey.ID
+	signature := signingKey.Signature
+	signingKey.ID = primitive.NilObjectID
+	signingKey.Signature = nil
+
+	dataByte, err := json.Marshal(signingKey)
+	signingKey.ID = id
+	signingKey.Signature = signature
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// authenticate asks the clinician for their password again, so a signature
+// cannot be made with a borrowed or stolen token alone.
+func (sc *SigningController) authenticate(c *gin.Context, password string) (*user.CreateUserData, bool) {
+	userdata, err := sc.Users.GetUserByEmail(c.GetString("userIdentification"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": user.UserNotFoundError.Error()})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	id := userdata.ID
+	signature := userdata.Signature
+	userdata.Signature = nil
+	userdata.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(userdata)
+	if err != nil {
+		logger.LogPanic.Panicf("Failed to marshall json data")
+	}
+	userdata.ID = id
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	if err != nil {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+		utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		userdata.PasswordEncrypted,
+		sc.ClientEncryption,
+	).Unmarshal(&userdata.Password)
+
+	err = userdata.CheckPassword(password)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			utils.JSON(c, http.StatusUnauthorized, gin.H{"error": user.IncorrectCredentialError.Error()})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		userdata.NameEncrypted,
+		sc.ClientEncryption,
+	).Unmarshal(&userdata.Name)
+
+	email := c.GetString("userIdentification")
+	userdata.Email = &email
+
+	return userdata, true
+}
+
+// activeKey finds the key the user currently signs with. Keys failing their
+// signature are reported as tampered rather than skipped.
+func (sc *SigningController) activeKey(userID primitive.ObjectID) (*user.SigningKey, error) {
+	filter := bson.M{
+		"user_id": userID,
+		"status":  datastruct.KUNCI_AKTIF,
+	}
+
+	var signingKey user.SigningKey
+	err := sc.Collection.FindOne(
+		context.Background(),
+		filter,
+		options.FindOne().SetSort(bson.M{"created_at": -1}),
+	).Decode(&signingKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, user.SigningKeyNotFoundError
+		}
+		return nil, err
+	}
+
+	if !verifiedSigningKey(&signingKey) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", signingKey.ID.Hex())
+		return nil, user.SigningKeyTamperedError
+	}
+
+	return &signingKey, nil
+}
+
+func (sc *SigningController) certificateInfo(signingKey *user.SigningKey) (*user.CertificateInfo, error) {
+	certificate, err := signing.ParseCertificate(signingKey.Sertifikat)
+	if err != nil {
+		return nil, err
+	}
+
+	info := user.CertificateInfo{
+		NoSeri:        signingKey.NoSeri,
+		Penandatangan: certificate.Subject.CommonName,
+		Penerbit:      certificate.Issuer.CommonName,
+		Status:        signingKey.Status,
+		BerlakuDari:   signingKey.BerlakuDari,
+		BerlakuSampai: signingKey.BerlakuSampai,
+		DicabutPada:   signingKey.DicabutPada,
+		Sertifikat:    signingKey.Sertifikat,
+	}
+	if len(certificate.EmailAddresses) > 0 {
+		info.Surel = certificate.EmailAddresses[0]
+	}
+	if len(certificate.Subject.OrganizationalUnit) > 0 {
+		info.Peran = certificate.Subject.OrganizationalUnit[0]
+	}
+
+	return &info, nil
+}
+
+func (sc *SigningController) CAHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.JSON(c, http.StatusOK, gin.H{
+			"penerbit":       sc.CA.Certificate.Subject.CommonName,
+			"berlaku_sampai": sc.CA.Certificate.NotAfter,
+			"sertifikat":     signing.EncodeCertificate(sc.CA.Certificate),
+		})
+	}
+}
+
+// EnrollHandler issues the user a new signing key. A key enrolled before is
+// revoked, so a user signs with one key at a time.
+func (sc *SigningController) EnrollHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body user.PasswordBody
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userdata, ok := sc.authenticate(c, body.Password)
+		if !ok {
+			return
+		}
+
+		privateKey, err := signing.GenerateKey()
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Second)
+
+		certificate, err := sc.CA.Issue(
+			signing.Subject{
+				UserID: userdata.ID.Hex(),
+				Name:   *userdata.Name,
+				Email:  *userdata.Email,
+				Role:   string(userdata.Role),
+			},
+			&privateKey.PublicKey,
+			now,
+			now.AddDate(0, 0, config.SigningCertificateDays),
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		der, err := signing.MarshalKey(privateKey)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		previous, err := sc.activeKey(userdata.ID)
+		if err != nil && !errors.Is(err, user.SigningKeyNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if previous != nil {
+			previous.Revoke(replacedKeyReason, now)
+
+			if err := sealSigningKey(previous); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			_, err = sc.Collection.ReplaceOne(context.Background(), bson.M{"_id": previous.ID}, previous)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		signingKey := user.SigningKey{
+			UserID:              userdata.ID,
+			NoSeri:              signing.SerialString(certificate),
+			Sertifikat:          signing.EncodeCertificate(certificate),
+			PrivateKeyEncrypted: utils.EncryptRandom(der, sc.ClientEncryption, sc.EncryptionOpts),
+			Status:              datastruct.KUNCI_AKTIF,
+			BerlakuDari:         certificate.NotBefore,
+			BerlakuSampai:       certificate.NotAfter,
+			CreatedAt:           &now,
+			UpdatedAt:           &now,
+		}
+
+		if err := sealSigningKey(&signingKey); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = sc.Collection.InsertOne(context.Background(), signingKey)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		info, err := sc.certificateInfo(&signingKey)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, info)
+	}
+}
+
+// GetKeyHandler shows the certificate of the latest key of the user.
+func (sc *SigningController) GetKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userdata, err := sc.Users.GetUserByEmail(c.GetString("userIdentification"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": user.UserNotFoundError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var signingKey user.SigningKey
+		err = sc.Collection.FindOne(
+			context.Background(),
+			bson.M{"user_id": userdata.ID},
+			options.FindOne().SetSort(bson.M{"created_at": -1}),
+		).Decode(&signingKey)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": user.SigningKeyNotFoundError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verifiedSigningKey(&signingKey) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", signingKey.ID.Hex())
+			utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": user.SigningKeyTamperedError.Error()})
+			return
+		}
+
+		info, err := sc.certificateInfo(&signingKey)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, info)
+	}
+}
+
+// SignHandler signs the digest of a document with the key of the user. The
+// services compute the digest, the document itself never reaches this
+// service.
+func (sc *SigningController) SignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body user.SignBody
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !signing.ValidDigest(body.Digest) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": signing.DigestError.Error()})
+			return
+		}
+
+		userdata, ok := sc.authenticate(c, body.Password)
+		if !ok {
+			return
+		}
+
+		signingKey, err := sc.activeKey(userdata.ID)
+		if err != nil {
+			if errors.Is(err, user.SigningKeyNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, user.SigningKeyTamperedError) {
+				utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Second)
+		if !signingKey.Active(now) {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": user.SigningKeyExpiredError.Error()})
+			return
+		}
+
+		var der []byte
+		utils.Decrypt(
+			signingKey.PrivateKeyEncrypted,
+			sc.ClientEncryption,
+		).Unmarshal(&der)
+
+		privateKey, err := signing.UnmarshalKey(der)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		value, err := signing.Sign(privateKey, body.Digest, now)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		logger.LogInfo.Printf("Subject: %s | Serial: %s | Signing document digest %s",
+			*userdata.Email,
+			signingKey.NoSeri,
+			body.Digest,
+		)
+
+		utils.JSON(c, http.StatusOK, user.DocumentSignature{
+			Algoritma:     signing.Algorithm,
+			Digest:        body.Digest,
+			Nilai:         value,
+			Sertifikat:    signingKey.Sertifikat,
+			NoSeri:        signingKey.NoSeri,
+			Penandatangan: *userdata.Name,
+			Peran:         string(userdata.Role),
+			Waktu:         now,
+		})
+	}
+}
+
+// verifySignature checks a signature in the order a reader would doubt it:
+// whether the certificate is one the CA issued, whether it was revoked by
+// the time of signing, then whether the signature matches the digest. The
+// identity shown is read from the certificate, never from the request.
+func (sc *SigningController) verifySignature(signature *user.DocumentSignature) (*user.SignatureVerification, error) {
+	result := user.SignatureVerification{
+		Status: datastruct.TTD_SERTIFIKAT_TIDAK_VALID,
+		Waktu:  signature.Waktu,
+	}
+
+	certificate, err := signing.ParseCertificate(signature.Sertifikat)
+	if err != nil {
+		result.Keterangan = result.StatusString()
+		return &result, nil
+	}
+
+	result.Penandatangan = certificate.Subject.CommonName
+	if len(certificate.EmailAddresses) > 0 {
+		result.Surel = certificate.EmailAddresses[0]
+	}
+	if len(certificate.Subject.OrganizationalUnit) > 0 {
+		result.Peran = certificate.Subject.OrganizationalUnit[0]
+	}
+	result.NoSeri = signing.SerialString(certificate)
+	result.Penerbit = certificate.Issuer.CommonName
+	result.BerlakuDari = certificate.NotBefore
+	result.BerlakuSampai = certificate.NotAfter
+
+	if signature.Algoritma != signing.Algorithm || sc.CA.Verify(certificate, signature.Waktu) != nil {
+		result.Keterangan = result.StatusString()
+		return &result, nil
+	}
+
+	var signingKey user.SigningKey
+	err = sc.Collection.FindOne(context.Background(), bson.M{"no_seri": result.NoSeri}).Decode(&signingKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			result.Keterangan = result.StatusString()
+			return &result, nil
+		}
+		return nil, err
+	}
+
+	if !verifiedSigningKey(&signingKey) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", signingKey.ID.Hex())
+		return nil, user.SigningKeyTamperedError
+	}
+
+	result.DicabutPada = signingKey.DicabutPada
+	if signingKey.RevokedAt(signature.Waktu) {
+		result.Status = datastruct.TTD_SERTIFIKAT_DICABUT
+		result.Keterangan = result.StatusString()
+		return &result, nil
+	}
+
+	if signing.Verify(certificate, signature.Digest, signature.Nilai, signature.Waktu) != nil {
+		result.Status = datastruct.TTD_TIDAK_SESUAI
+		result.Keterangan = result.StatusString()
+		return &result, nil
+	}
+
+	result.Status = datastruct.TTD_VALID
+	result.Valid = true
+	result.Keterangan = result.StatusString()
+
+	return &result, nil
+}
+
+func (sc *SigningController) VerifyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body user.DocumentSignature
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := sc.verifySignature(&body)
+		if err != nil {
+			if errors.Is(err, user.SigningKeyTamperedError) {
+				utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, result)
+	}
+}
+
+// RevokeHandler revokes a signing key, e.g. when the clinician leaves or the
+// password was compromised. Documents signed before stay valid.
+func (sc *SigningController) RevokeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body user.RevokeBody
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var signingKey user.SigningKey
+		err := sc.Collection.FindOne(context.Background(), bson.M{"no_seri": c.Param("serial")}).Decode(&signingKey)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verifiedSigningKey(&signingKey) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", signingKey.ID.Hex())
+			utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": user.SigningKeyTamperedError.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Second)
+		if err := signingKey.Revoke(body.Alasan, now); err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sealSigningKey(&signingKey); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = sc.Collection.ReplaceOne(context.Background(), bson.M{"_id": signingKey.ID}, signingKey)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		logger.LogInfo.Printf("Subject: %s | Serial: %s | Revoking signing key",
+			c.GetString("userIdentification"),
+			signingKey.NoSeri,
+		)
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": "Signing key revoked successfully"})
+	}
+}
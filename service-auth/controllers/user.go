@@ -182,7 +182,7 @@ func (uc *UserController) Login() gin.HandlerFunc {
 		}
 
 		jwt := utils.JWTPayload{
-			Issuer:   "13519220@auth.std.stei.itb.ac.id",
+			Issuer:   utils.UserIssuer,
 			Role:     userdata.Role,
 			Subject:  data.Email,
 			Audience: []string{data.ClientID},
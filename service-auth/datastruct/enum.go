@@ -1,6 +1,8 @@
 package datastruct
 
 type RoleType string
+type SigningKeyStatus uint8
+type SignatureStatus uint8
 
 const (
 	DOKTER       RoleType = "Dokter"
@@ -9,3 +11,15 @@ const (
 	RADIOLOGI    RoleType = "Radiologi"
 	ADMIN        RoleType = "Admin"
 )
+
+const (
+	KUNCI_AKTIF SigningKeyStatus = iota + 1
+	KUNCI_DICABUT
+)
+
+const (
+	TTD_VALID SignatureStatus = iota + 1
+	TTD_TIDAK_SESUAI
+	TTD_SERTIFIKAT_TIDAK_VALID
+	TTD_SERTIFIKAT_DICABUT
+)
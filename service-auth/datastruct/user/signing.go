@@ -0,0 +1,138 @@
+package user
+
+import (
+	"errors"
+	"service-auth/datastruct"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	SigningKeyNotFoundError = errors.New("no active signing key, enroll one first")
+	SigningKeyExpiredError  = errors.New("the certificate of the signing key has expired, enroll a new key")
+	SigningKeyRevokedError  = errors.New("the signing key has already been revoked")
+	SigningKeyTamperedError = errors.New("the signing key record was tampered")
+	SigningDisabledError    = errors.New("signing is not available, the signing ca is not configured")
+)
+
+// SigningKey is the key a clinician signs documents with, along with the
+// certificate issued for it by the local CA. The private key never leaves
+// the service and is stored encrypted.
+type SigningKey struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	Signature *string            `json:"signature" bson:"signature"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+
+	NoSeri              string            `json:"no_seri" bson:"no_seri"`
+	Sertifikat          string            `json:"sertifikat" bson:"sertifikat"`
+	PrivateKeyEncrypted *primitive.Binary `json:"encrypted_private_key" bson:"encrypted_private_key"`
+
+	Status           datastruct.SigningKeyStatus `json:"status" bson:"status"`
+	BerlakuDari      time.Time                   `json:"berlaku_dari" bson:"berlaku_dari"`
+	BerlakuSampai    time.Time                   `json:"berlaku_sampai" bson:"berlaku_sampai"`
+	DicabutPada      *time.Time                  `json:"dicabut_pada" bson:"dicabut_pada,omitempty"`
+	AlasanPencabutan string                      `json:"alasan_pencabutan" bson:"alasan_pencabutan"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+type PasswordBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type SignBody struct {
+	Password string `json:"password" binding:"required"`
+	Digest   string `json:"digest" binding:"required"`
+}
+
+type RevokeBody struct {
+	Alasan string `json:"alasan" binding:"required"`
+}
+
+// DocumentSignature is the signature of a clinician over the digest of a
+// document. The services keep it along the signed document.
+type DocumentSignature struct {
+	Algoritma     string    `json:"algoritma" binding:"required"`
+	Digest        string    `json:"digest" binding:"required"`
+	Nilai         string    `json:"nilai" binding:"required"`
+	Sertifikat    string    `json:"sertifikat" binding:"required"`
+	NoSeri        string    `json:"no_seri"`
+	Penandatangan string    `json:"penandatangan"`
+	Peran         string    `json:"peran"`
+	Waktu         time.Time `json:"waktu" binding:"required"`
+}
+
+type CertificateInfo struct {
+	NoSeri        string                      `json:"no_seri"`
+	Penandatangan string                      `json:"penandatangan"`
+	Surel         string                      `json:"surel"`
+	Peran         string                      `json:"peran"`
+	Penerbit      string                      `json:"penerbit"`
+	Status        datastruct.SigningKeyStatus `json:"status"`
+	BerlakuDari   time.Time                   `json:"berlaku_dari"`
+	BerlakuSampai time.Time                   `json:"berlaku_sampai"`
+	DicabutPada   *time.Time                  `json:"dicabut_pada,omitempty"`
+	Sertifikat    string                      `json:"sertifikat"`
+}
+
+// SignatureVerification tells who signed a document and whether the
+// signature holds.
+type SignatureVerification struct {
+	Status     datastruct.SignatureStatus `json:"status"`
+	Valid      bool                       `json:"valid"`
+	Keterangan string                     `json:"keterangan"`
+
+	Penandatangan string     `json:"penandatangan"`
+	Surel         string     `json:"surel"`
+	Peran         string     `json:"peran"`
+	NoSeri        string     `json:"no_seri"`
+	Penerbit      string     `json:"penerbit"`
+	Waktu         time.Time  `json:"waktu"`
+	BerlakuDari   time.Time  `json:"berlaku_dari"`
+	BerlakuSampai time.Time  `json:"berlaku_sampai"`
+	DicabutPada   *time.Time `json:"dicabut_pada,omitempty"`
+}
+
+// Active reports whether the key can still sign at the given time.
+func (signingKey *SigningKey) Active(at time.Time) bool {
+	return signingKey.Status == datastruct.KUNCI_AKTIF && at.Before(signingKey.BerlakuSampai)
+}
+
+// Revoke ends the key. Signatures made before remain valid.
+func (signingKey *SigningKey) Revoke(reason string, at time.Time) error {
+	if signingKey.Status == datastruct.KUNCI_DICABUT {
+		return SigningKeyRevokedError
+	}
+
+	signingKey.Status = datastruct.KUNCI_DICABUT
+	signingKey.DicabutPada = &at
+	signingKey.AlasanPencabutan = reason
+	signingKey.UpdatedAt = &at
+
+	return nil
+}
+
+// RevokedAt reports whether the key was revoked by the given time.
+func (signingKey *SigningKey) RevokedAt(at time.Time) bool {
+	return signingKey.Status == datastruct.KUNCI_DICABUT &&
+		signingKey.DicabutPada != nil &&
+		!signingKey.DicabutPada.After(at)
+}
+
+func (verification *SignatureVerification) StatusString() string {
+	switch verification.Status {
+	case datastruct.TTD_VALID:
+		return "Tanda tangan valid"
+	case datastruct.TTD_TIDAK_SESUAI:
+		return "Tanda tangan tidak sesuai dengan dokumen"
+	case datastruct.TTD_SERTIFIKAT_TIDAK_VALID:
+		return "Sertifikat penanda tangan tidak valid"
+	case datastruct.TTD_SERTIFIKAT_DICABUT:
+		return "Sertifikat penanda tangan telah dicabut sebelum dokumen ditandatangani"
+	default:
+		return ""
+	}
+}
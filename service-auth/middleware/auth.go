@@ -11,7 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Authentication(jwtPublicKey string) gin.HandlerFunc {
+func Authentication(jwtPublicKey, issuer string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		sentToken, err := utils.ExtractBearerToken(c.GetHeader("Authorization"))
 		if err != nil {
@@ -19,7 +19,7 @@ func Authentication(jwtPublicKey string) gin.HandlerFunc {
 			return
 		}
 
-		claim, err := utils.VerifyToken(sentToken, jwtPublicKey)
+		claim, err := utils.VerifyToken(sentToken, jwtPublicKey, issuer)
 		if errors.Is(err, user.UnauthorizedIssuerError) {
 			logger.LogWarning.Printf("Subject: %s | ClientID: %s | Issuer: %s | Trying to access system using unverified token",
 				claim.Subject,
@@ -9,14 +9,19 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func HealthCheck(client *mongo.Client) gin.HandlerFunc {
+func LivenessCheck() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.JSON(c, http.StatusOK, gin.H{"message": "service is live"})
+	}
+}
+
+func ReadinessCheck(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := context.Background()
 		if err := client.Ping(ctx, nil); err != nil {
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "service is healthy"})
+		utils.JSON(c, http.StatusOK, gin.H{"message": "service is ready"})
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"service-auth/datastruct"
 	"service-auth/db/csfle"
 	"service-auth/middleware"
+	"service-auth/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,14 +14,18 @@ import (
 )
 
 type RouterConfig struct {
-	Client         *mongo.Client
-	UserController *user_controllers.UserController
+	Client            *mongo.Client
+	UserController    *user_controllers.UserController
+	SigningController *user_controllers.SigningController
 }
 
 func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
+	userController := user_controllers.InitUserController(client, csfle)
+
 	routerConfig := RouterConfig{
-		Client:         client,
-		UserController: user_controllers.InitUserController(client, csfle),
+		Client:            client,
+		UserController:    userController,
+		SigningController: user_controllers.InitSigningController(client, csfle, userController),
 	}
 
 	return routerConfig.SetRouter()
@@ -45,9 +50,23 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	user := v1.Group("/users")
 	user.POST("/login", routerConfig.UserController.Login())
 
+	v1.GET("/signing/ca", routerConfig.SigningController.Available(), routerConfig.SigningController.CAHandler())
+
+	signing := v1.Group("/signing")
+	signing.Use(
+		routerConfig.SigningController.Available(),
+		middleware.Authentication(config.JWTPublicKey, utils.UserIssuer),
+		middleware.Authorization(datastruct.DOKTER, datastruct.APOTEK, datastruct.LABORATORIUM, datastruct.RADIOLOGI),
+	)
+	signing.POST("/key", routerConfig.SigningController.EnrollHandler())
+	signing.GET("/key", routerConfig.SigningController.GetKeyHandler())
+	signing.POST("/sign", routerConfig.SigningController.SignHandler())
+	signing.POST("/verify", routerConfig.SigningController.VerifyHandler())
+
 	admin := v1.Group("/admin")
-	admin.Use(middleware.Authentication(config.JWTAdminPublicKey))
+	admin.Use(middleware.Authentication(config.JWTAdminPublicKey, utils.AdminIssuer))
 	admin.POST("/registeruser", middleware.Authorization(datastruct.ADMIN), routerConfig.UserController.Register())
+	admin.POST("/signing/:serial/revoke", routerConfig.SigningController.Available(), middleware.Authorization(datastruct.ADMIN), routerConfig.SigningController.RevokeHandler())
 
 	return router
 }
@@ -0,0 +1,151 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	CertificateError   = errors.New("certificate could not be read")
+	CAKeyError         = errors.New("the key of the signing ca does not match its certificate")
+	NotSigningKeyError = errors.New("the certificate was not issued for signing documents")
+)
+
+// CA is the local certificate authority issuing the certificates of the
+// signing keys of clinicians.
+type CA struct {
+	Certificate *x509.Certificate
+	key         crypto.Signer
+	roots       *x509.CertPool
+}
+
+// LoadCA reads the certificate and the PKCS #8 private key of the CA, both
+// PEM encoded.
+func LoadCA(certificatePEM, privateKeyPEM string) (*CA, error) {
+	certificate, err := ParseCertificate(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, CAKeyError
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok || !publicKeyEqual(signer.Public(), certificate.PublicKey) {
+		return nil, CAKeyError
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+
+	return &CA{
+		Certificate: certificate,
+		key:         signer,
+		roots:       roots,
+	}, nil
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+func ParseCertificate(certificatePEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificatePEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, CertificateError
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func EncodeCertificate(certificate *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+}
+
+// Subject is who a signing certificate is issued to.
+type Subject struct {
+	UserID string
+	Name   string
+	Email  string
+	Role   string
+}
+
+// GenerateKey creates the signing key of a clinician on a P-256 curve.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Issue certifies the public key of a clinician for signing documents only.
+func (ca *CA) Issue(subject Subject, publicKey *ecdsa.PublicKey, notBefore, notAfter time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	if notAfter.After(ca.Certificate.NotAfter) {
+		notAfter = ca.Certificate.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         subject.Name,
+			OrganizationalUnit: []string{subject.Role},
+			Organization:       ca.Certificate.Subject.Organization,
+			SerialNumber:       subject.UserID,
+		},
+		EmailAddresses:        []string{subject.Email},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, publicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// Verify checks that the certificate was issued by the CA for signing and
+// was valid at the given time.
+func (ca *CA) Verify(certificate *x509.Certificate, at time.Time) error {
+	if certificate.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return NotSigningKeyError
+	}
+
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:       ca.roots,
+		CurrentTime: at,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), CertificateError)
+	}
+
+	return nil
+}
+
+func SerialString(certificate *x509.Certificate) string {
+	return certificate.SerialNumber.Text(16)
+}
@@ -0,0 +1,89 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const Algorithm = "ECDSA-P256-SHA256"
+
+var (
+	DigestError    = errors.New("digest must be the hex encoded sha-256 of the document")
+	SignatureError = errors.New("the signature does not match the document")
+)
+
+func ValidDigest(digest string) bool {
+	decoded, err := hex.DecodeString(digest)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// payload binds the time of signing to the digest of the document, so a
+// signature cannot be moved to another time, e.g. before its certificate
+// was revoked.
+func payload(digest string, at time.Time) []byte {
+	sum := sha256.Sum256([]byte(digest + "\n" + at.UTC().Format(time.RFC3339)))
+	return sum[:]
+}
+
+// Sign signs the digest of a document at the given time, which is kept to
+// the second.
+func Sign(key *ecdsa.PrivateKey, digest string, at time.Time) (string, error) {
+	if !ValidDigest(digest) {
+		return "", DigestError
+	}
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, payload(digest, at))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature against the key of the certificate. Whether
+// the certificate itself is trusted is checked by the CA.
+func Verify(certificate *x509.Certificate, digest, signature string, at time.Time) error {
+	if !ValidDigest(digest) {
+		return DigestError
+	}
+
+	key, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return NotSigningKeyError
+	}
+
+	signatureByte, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return SignatureError
+	}
+
+	if !ecdsa.VerifyASN1(key, payload(digest, at), signatureByte) {
+		return SignatureError
+	}
+
+	return nil
+}
+
+func MarshalKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+func UnmarshalKey(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, NotSigningKeyError
+	}
+
+	return ecdsaKey, nil
+}
@@ -9,6 +9,13 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
+const (
+	// UserIssuer signs the tokens of users logging in to the services,
+	// AdminIssuer those of the administrators of the auth client.
+	UserIssuer  = "13519220@auth.std.stei.itb.ac.id"
+	AdminIssuer = "13519220@oauth.std.stei.itb.ac.id"
+)
+
 type JWTPayload struct {
 	Subject  string
 	Audience []string
@@ -42,7 +49,7 @@ func (j *JWTPayload) GenerateToken(jwtPrivateKey string, duration time.Duration)
 	return tokenString, nil
 }
 
-func VerifyToken(tokenString, jwtPublicKey string) (*user.Claim, error) {
+func VerifyToken(tokenString, jwtPublicKey, issuer string) (*user.Claim, error) {
 	publicKey, err := jwt.ParseEdPublicKeyFromPEM([]byte(jwtPublicKey))
 	if err != nil {
 		return nil, err
@@ -60,7 +67,7 @@ func VerifyToken(tokenString, jwtPublicKey string) (*user.Claim, error) {
 
 	// note: possibly need error checking
 	claim, _ := token.Claims.(*user.Claim)
-	if claim.Issuer != "13519220@oauth.std.stei.itb.ac.id" {
+	if claim.Issuer != issuer {
 		return claim, user.UnauthorizedIssuerError
 	}
 
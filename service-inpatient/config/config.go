@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"service-inpatient/logger"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/kelseyhightower/envconfig"
+)
+
+var (
+	JWTPublicKey string
+
+	LabServiceURL        string
+	RadiologyServiceURL  string
+	PharmacyServiceURL   string
+	OutpatientServiceURL string
+
+	RSAPrivateKey string
+	RSAPublicKey  string
+
+	TimestampSkew int
+)
+
+type Config struct {
+	RESTHost string `envconfig:"REST_HOST" default:"localhost"`
+	RESTPort int    `envconfig:"REST_PORT" default:"8085"`
+
+	DBUser       string `envconfig:"DB_USER" default:""`
+	DBPassword   string `envconfig:"DB_PASSWORD" default:""` //aws
+	DBClusterURL string `envconfig:"DB_CLUSTER_URL" default:""`
+
+	SAEmail      string `envconfig:"SA_EMAIL" default:""`
+	SAPrivateKey string `envconfig:"SA_PRIVATE_KEY" default:""`
+
+	KMSProjectId string `envconfig:"KMS_PROJECT_ID" default:""`
+	KMSLocation  string `envconfig:"KMS_LOCATION" default:""`
+	KMSKeyRing   string `envconfig:"KMS_KEY_RING" default:""`
+	KMSKeyName   string `envconfig:"KMS_KEY_NAME" default:""`
+
+	JWTPublicKey string `envconfig:"JWT_PUBLIC_KEY" default:""` // base64 format
+
+	LabServiceURL        string `envconfig:"LAB_SERVICE_URL" default:"http://localhost:8081"`
+	RadiologyServiceURL  string `envconfig:"RADIOLOGY_SERVICE_URL" default:"http://localhost:8084"`
+	PharmacyServiceURL   string `envconfig:"PHARMACY_SERVICE_URL" default:"http://localhost:8083"`
+	OutpatientServiceURL string `envconfig:"OUTPATIENT_SERVICE_URL" default:"http://localhost:8082"`
+
+	SMProjectId   string `envconfig:"SM_PROJECT_ID" default:""`
+	SecretVersion string `envconfig:"SECRET_VERSION" default:"1"`
+
+	RSAPrivateKey string `envconfig:"RSA_PRIVATE_KEY" default:""`
+	RSAPublicKey  string `envconfig:"RSA_PUBLIC_KEY" default:""`
+
+	TimestampSkew int `envconfig:"TIMESTAMP_SKEW" default:"5000"` //ms
+}
+
+func Get() Config {
+	cfg := Config{}
+	envconfig.MustProcess("", &cfg)
+	AccessSecret(&cfg)
+
+	JWTPublicKey = AccessKeyFromFile("jwt_public.pem")
+	RSAPublicKey = AccessKeyFromFile("rsa_sign.pub")
+	RSAPrivateKey = strings.ReplaceAll(cfg.RSAPrivateKey, "\\n", "\n")
+
+	TimestampSkew = cfg.TimestampSkew
+
+	LabServiceURL = cfg.LabServiceURL
+	RadiologyServiceURL = cfg.RadiologyServiceURL
+	PharmacyServiceURL = cfg.PharmacyServiceURL
+	OutpatientServiceURL = cfg.OutpatientServiceURL
+
+	cfg.DBUser = url.QueryEscape(cfg.DBUser)
+	cfg.DBPassword = url.QueryEscape(cfg.DBPassword)
+
+	return cfg
+}
+
+func AccessSecret(cfg *Config) {
+	ctx := context.Background()
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to setup client: %v", err)
+	}
+	defer client.Close()
+
+	secretSaPrivate, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.SAPrivateKey, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access sa secret: %v", err)
+	}
+
+	secretRsaPrivate, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.RSAPrivateKey, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access rsa secret: %v", err)
+	}
+
+	secretDbPrivate, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.DBPassword, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access db secret: %v", err)
+	}
+
+	cfg.SAPrivateKey = string(secretSaPrivate.Payload.Data)
+	cfg.RSAPrivateKey = string(secretRsaPrivate.Payload.Data)
+	cfg.DBPassword = string(secretDbPrivate.Payload.Data)
+}
+
+func AccessKeyFromFile(keyName string) string {
+	path, _ := filepath.Rel("..", fmt.Sprintf("../key/%s", keyName))
+	file, err := os.ReadFile(path)
+	if err != nil {
+		logger.LogError.Fatalf("fail to open local key file: %s", keyName)
+	}
+
+	return string(file)
+}
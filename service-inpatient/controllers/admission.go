@@ -0,0 +1,557 @@
+package emr_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"service-inpatient/datastruct"
+	"service-inpatient/datastruct/inpatient"
+	"service-inpatient/datastruct/user"
+	"service-inpatient/db/csfle"
+	"service-inpatient/logger"
+	"service-inpatient/pagination"
+	"service-inpatient/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdmissionController keeps the stays of the patients, from their
+// admission to their discharge. A stay is changed only by the client that
+// admitted the patient, and read by others the patient consented to.
+type AdmissionController struct {
+	AdmissionCollection    *mongo.Collection
+	ProgressNoteCollection *mongo.Collection
+	WardCollection         *mongo.Collection
+	BedCollection          *mongo.Collection
+	ConsentCollection      *mongo.Collection
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+}
+
+func InitAdmissionController(client *mongo.Client, csfle *csfle.CSFLE) *AdmissionController {
+	return &AdmissionController{
+		AdmissionCollection:    client.Database("emr").Collection("rawat_inap"),
+		ProgressNoteCollection: client.Database("emr").Collection("catatan_perkembangan"),
+		WardCollection:         client.Database("emr").Collection("bangsal"),
+		BedCollection:          client.Database("emr").Collection("bed"),
+		ConsentCollection:      client.Database("emr").Collection("consent"),
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+	}
+}
+
+func (admissionController *AdmissionController) GetPatientConsent(noihs string) (*user.PatientConsent, error) {
+	filter := bson.M{}
+
+	filter["no_ihs"] = noihs
+
+	var result user.PatientConsent
+	err := admissionController.ConsentCollection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func admissionErrorStatus(err error) int {
+	// the outpatient service refused or failed the change of an encounter
+	var serviceError *utils.ServiceError
+	if errors.As(err, &serviceError) {
+		if serviceError.StatusCode >= http.StatusInternalServerError {
+			return http.StatusBadGateway
+		}
+		return serviceError.StatusCode
+	}
+
+	var urlError *url.Error
+	if errors.As(err, &urlError) {
+		return http.StatusBadGateway
+	}
+
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound
+	case errors.Is(err, inpatient.NotAdmittedError),
+		errors.Is(err, inpatient.OriginMismatchError),
+		errors.Is(err, inpatient.OriginNotInProgressError),
+		errors.Is(err, inpatient.OriginElsewhereError),
+		errors.Is(err, inpatient.BedUnavailableError),
+		errors.Is(err, inpatient.SameBedError),
+		errors.Is(err, inpatient.ConcurrentUpdateError),
+		errors.Is(err, inpatient.TamperedError):
+		return http.StatusConflict
+	case errors.Is(err, inpatient.InvalidOriginError),
+		errors.Is(err, inpatient.InvalidDayError),
+		errors.Is(err, inpatient.OutsideStayError),
+		errors.Is(err, primitive.ErrInvalidHex):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sealAdmission encrypts why the patient was admitted and the discharge
+// summary, and signs the admission.
+func (admissionController *AdmissionController) sealAdmission(data *inpatient.Admission) error {
+	id := data.ID
+
+	data.ConfidentialEncrypted = utils.EncryptRandom(
+		data.ConfidentialData,
+		admissionController.ClientEncryption,
+		admissionController.EncryptionOpts,
+	)
+	data.ConfidentialData = nil
+
+	if data.RingkasanPulang != nil {
+		data.RingkasanPulangEncrypted = utils.EncryptRandom(
+			data.RingkasanPulang,
+			admissionController.ClientEncryption,
+			admissionController.EncryptionOpts,
+		)
+		data.RingkasanPulang = nil
+	}
+
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// verifiedAdmission tells whether the stored admission still carries a
+// valid signature.
+func verifiedAdmission(data *inpatient.Admission) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// revealAdmission decrypts a sealed admission for a response.
+func (admissionController *AdmissionController) revealAdmission(data *inpatient.Admission) {
+	if data.ConfidentialEncrypted != nil {
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			admissionController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+	}
+
+	if data.RingkasanPulangEncrypted != nil {
+		utils.Decrypt(
+			data.RingkasanPulangEncrypted,
+			admissionController.ClientEncryption,
+		).Unmarshal(&data.RingkasanPulang)
+	}
+
+	data.ConfidentialEncrypted = nil
+	data.RingkasanPulangEncrypted = nil
+}
+
+// findAdmission loads the admission of the path. Only the client that
+// admitted the patient finds it, unless owned is false and the patient
+// consented. Admissions failing their seal are refused.
+func (admissionController *AdmissionController) findAdmission(c *gin.Context, owned bool) (*inpatient.Admission, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("admissionId"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":        id,
+		"no_ihs":     c.Param("noIHS"),
+		"deleted_at": nil,
+	}
+	if owned || !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var data inpatient.Admission
+	if err := admissionController.AdmissionCollection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if !verifiedAdmission(&data) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+		return nil, inpatient.TamperedError
+	}
+
+	return &data, nil
+}
+
+// admittedAdmission loads the admission of the path to be changed, which
+// the patient must still be admitted for.
+func (admissionController *AdmissionController) admittedAdmission(c *gin.Context) (*inpatient.Admission, error) {
+	data, err := admissionController.findAdmission(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := data.Admitted(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// updateAdmission seals and replaces the admission unless it was changed
+// since it was read.
+func (admissionController *AdmissionController) updateAdmission(data *inpatient.Admission, previousUpdate *time.Time) error {
+	if err := admissionController.sealAdmission(data); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":        data.ID,
+		"updated_at": previousUpdate,
+	}
+
+	result, err := admissionController.AdmissionCollection.ReplaceOne(context.Background(), filter, data)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return inpatient.ConcurrentUpdateError
+	}
+
+	return nil
+}
+
+// CreateAdmissionHandler admits a patient from the IGD or outpatient
+// encounter they are being seen in. The bed is taken first, so two patients
+// cannot be admitted to it, then the encounter of the stay is opened and
+// the encounter the patient came from is finished, both with the outpatient
+// service.
+func (admissionController *AdmissionController) CreateAdmissionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.AdmissionBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientID := c.GetString("userClient")
+
+		origin, err := findEncounter(c, body.NoIHS, body.IDKunjunganAsal)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.CheckOrigin(origin, clientID); err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		bed, ward, err := findBed(admissionController.BedCollection, admissionController.WardCollection, body.IDBed, clientID)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		placement := ward.Placement(bed)
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		admissionID := primitive.NewObjectID()
+
+		if err := occupyBed(admissionController.BedCollection, bed.ID, admissionID, body.NoIHS, now); err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		stay, err := openEncounter(c, body.StayEncounter(placement))
+		if err != nil {
+			admissionController.undoAdmission(c, bed.ID, admissionID, body.NoIHS, nil, now)
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		data := inpatient.NewAdmission(body, placement, stay.ID, now)
+		data.ID = admissionID
+		data.ClientID = clientID
+		data.CreatedAt = &now
+		data.UpdatedAt = &now
+
+		if err := admissionController.sealAdmission(&data); err != nil {
+			admissionController.undoAdmission(c, bed.ID, admissionID, body.NoIHS, &stay.ID, now)
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := admissionController.AdmissionCollection.InsertOne(context.Background(), data); err != nil {
+			admissionController.undoAdmission(c, bed.ID, admissionID, body.NoIHS, &stay.ID, now)
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the admission is saved, so failures from here on are only logged
+		if err := transitionEncounter(c, stay.NoIHS, stay.ID, encounterInProgress, ""); err != nil {
+			logger.LogError.Printf("Failed to start encounter [%s] of admission [%s]: %v\n", stay.ID.Hex(), admissionID.Hex(), err)
+		}
+
+		// the patient has left the IGD or the poli for the ward
+		if err := transitionEncounter(c, origin.NoIHS, origin.ID, encounterFinished, "Dirawat inap"); err != nil {
+			logger.LogError.Printf("Failed to finish encounter [%s] of admission [%s]: %v\n", origin.ID.Hex(), admissionID.Hex(), err)
+		}
+
+		admissionController.revealAdmission(&data)
+		utils.JSON(c, http.StatusCreated, data)
+	}
+}
+
+// undoAdmission frees the bed and cancels the encounter of an admission
+// that could not be saved.
+func (admissionController *AdmissionController) undoAdmission(c *gin.Context, bedID, admissionID primitive.ObjectID, noIHS string, stayID *primitive.ObjectID, now time.Time) {
+	if err := releaseBed(admissionController.BedCollection, bedID, admissionID, datastruct.BED_TERSEDIA, now); err != nil {
+		logger.LogError.Printf("Failed to free bed [%s] of admission [%s]: %v\n", bedID.Hex(), admissionID.Hex(), err)
+	}
+
+	if stayID == nil {
+		return
+	}
+
+	if err := transitionEncounter(c, noIHS, *stayID, encounterCancelled, "Rawat inap gagal disimpan"); err != nil {
+		logger.LogError.Printf("Failed to cancel encounter [%s] of admission [%s]: %v\n", stayID.Hex(), admissionID.Hex(), err)
+	}
+}
+
+// GetPatientAdmissionHandler lists the stays of a patient, narrowed down by
+// status if given.
+func (admissionController *AdmissionController) GetPatientAdmissionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"no_ihs":     c.Param("noIHS"),
+			"deleted_at": nil,
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		if status := c.Query("status"); status != "" {
+			value, err := inpatient.ParseAdmissionStatus(status)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = value
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := admissionController.AdmissionCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := admissionController.AdmissionCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		admissions := []inpatient.Admission{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var data inpatient.Admission
+			if err := cursor.Decode(&data); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = data.ID
+
+			if !verifiedAdmission(&data) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+				continue
+			}
+
+			admissionController.revealAdmission(&data)
+			admissions = append(admissions, data)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(admissions, total, last, more))
+	}
+}
+
+func (admissionController *AdmissionController) GetAdmissionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := admissionController.findAdmission(c, false)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		admissionController.revealAdmission(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
+
+// TransferAdmissionHandler moves the patient to another bed, in the same
+// ward or another. The new bed is taken before the old one is left to be
+// cleaned.
+func (admissionController *AdmissionController) TransferAdmissionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.TransferBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := admissionController.admittedAdmission(c)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if body.IDBed == data.Bed.IDBed {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.SameBedError.Error()})
+			return
+		}
+
+		bed, ward, err := findBed(admissionController.BedCollection, admissionController.WardCollection, body.IDBed, data.ClientID)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		placement := ward.Placement(bed)
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		by := c.GetString("userIdentification")
+
+		if err := occupyBed(admissionController.BedCollection, bed.ID, data.ID, data.NoIHS, now); err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		admissionController.revealAdmission(data)
+		previousUpdate := data.UpdatedAt
+		previousBed := data.Bed.IDBed
+
+		data.MoveTo(placement, body.Alasan, by, now)
+		data.UpdatedAt = &now
+
+		if err := admissionController.updateAdmission(data, previousUpdate); err != nil {
+			if err := releaseBed(admissionController.BedCollection, bed.ID, data.ID, datastruct.BED_TERSEDIA, now); err != nil {
+				logger.LogError.Printf("Failed to free bed [%s] of admission [%s]: %v\n", bed.ID.Hex(), data.ID.Hex(), err)
+			}
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := releaseBed(admissionController.BedCollection, previousBed, data.ID, datastruct.BED_DIBERSIHKAN, now); err != nil {
+			logger.LogError.Printf("Failed to leave bed [%s] of admission [%s]: %v\n", previousBed.Hex(), data.ID.Hex(), err)
+		}
+
+		// the admission is saved, so a failure is only logged
+		if err := moveEncounter(c, data.NoIHS, data.IDKunjungan, placement.Location()); err != nil {
+			logger.LogError.Printf("Failed to update the encounter of admission [%s]: %v\n", data.ID.Hex(), err)
+		}
+
+		admissionController.revealAdmission(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
+
+// DischargeAdmissionHandler discharges the patient with the discharge
+// summary. The bed is left to be cleaned and the encounter of the stay is
+// finished.
+func (admissionController *AdmissionController) DischargeAdmissionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.DischargeBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := admissionController.admittedAdmission(c)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		admissionController.revealAdmission(data)
+		previousUpdate := data.UpdatedAt
+
+		data.Discharge(body, now)
+		data.UpdatedAt = &now
+
+		if err := admissionController.updateAdmission(data, previousUpdate); err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := releaseBed(admissionController.BedCollection, data.Bed.IDBed, data.ID, datastruct.BED_DIBERSIHKAN, now); err != nil {
+			logger.LogError.Printf("Failed to leave bed [%s] of admission [%s]: %v\n", data.Bed.IDBed.Hex(), data.ID.Hex(), err)
+		}
+
+		// the admission is saved, so a failure is only logged
+		if err := transitionEncounter(c, data.NoIHS, data.IDKunjungan, encounterFinished, data.DischargeString()); err != nil {
+			logger.LogError.Printf("Failed to update the encounter of admission [%s]: %v\n", data.ID.Hex(), err)
+		}
+
+		admissionController.revealAdmission(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
@@ -0,0 +1,85 @@
+package emr_controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"service-inpatient/datastruct/encounter"
+	"service-inpatient/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The encounters of the stays are kept by the outpatient service with every
+// other encounter of the patient. They are opened, moved and ended through
+// its API, on behalf of the doctor making the change.
+
+const (
+	encounterInProgress = "in-progress"
+	encounterFinished   = "finished"
+	encounterCancelled  = "cancelled"
+)
+
+func encounterPath(noIHS string, id primitive.ObjectID) string {
+	return fmt.Sprintf("/encounter/%s/%s", url.PathEscape(noIHS), id.Hex())
+}
+
+// findEncounter gets an encounter of the patient.
+func findEncounter(c *gin.Context, noIHS string, id primitive.ObjectID) (*encounter.Encounter, error) {
+	respBody, err := utils.EncounterRequest(c, http.MethodGet, encounterPath(noIHS, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var data encounter.Encounter
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// openEncounter opens an encounter and returns it as it was saved.
+func openEncounter(c *gin.Context, body encounter.EncounterBody) (*encounter.Encounter, error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := utils.EncounterRequest(c, http.MethodPost, "/encounter", reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var data encounter.Encounter
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// transitionEncounter moves the encounter on, step being the status as the
+// outpatient service names it, e.g. finished.
+func transitionEncounter(c *gin.Context, noIHS string, id primitive.ObjectID, step, reason string) error {
+	reqBody, err := json.Marshal(encounter.StatusBody{Alasan: reason})
+	if err != nil {
+		return err
+	}
+
+	_, err = utils.EncounterRequest(c, http.MethodPost, encounterPath(noIHS, id)+"/"+step, reqBody)
+	return err
+}
+
+// moveEncounter puts the patient of the encounter at the location.
+func moveEncounter(c *gin.Context, noIHS string, id primitive.ObjectID, location encounter.Location) error {
+	reqBody, err := json.Marshal(encounter.UpdateBody{Lokasi: &location})
+	if err != nil {
+		return err
+	}
+
+	_, err = utils.EncounterRequest(c, http.MethodPut, encounterPath(noIHS, id), reqBody)
+	return err
+}
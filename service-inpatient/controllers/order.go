@@ -0,0 +1,100 @@
+package emr_controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"service-inpatient/datastruct"
+	"service-inpatient/logger"
+	"service-inpatient/pagination"
+	"service-inpatient/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderHandler places an order of the stay, a lab or radiology request or a
+// prescription, with the service that serves it. The body is the request as
+// the service takes it; it is made out to the patient and the encounter of
+// the stay, so the service lists it with the stay.
+func (admissionController *AdmissionController) OrderHandler(serviceName datastruct.ServiceName) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var order map[string]json.RawMessage
+		if err := c.ShouldBindJSON(&order); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		admission, err := admissionController.admittedAdmission(c)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		noIHS, _ := json.Marshal(admission.NoIHS)
+		stayID, _ := json.Marshal(admission.IDKunjungan)
+		order["no_ihs"] = noIHS
+		order["id_kunjungan"] = stayID
+
+		orderJson, err := json.Marshal(order)
+		if err != nil {
+			logger.LogError.Printf("Error marshalling %s data\n", serviceName)
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sb, err := utils.PostRequest(c, serviceName, orderJson)
+		if err != nil {
+			var serviceError *utils.ServiceError
+			if errors.As(err, &serviceError) && serviceError.StatusCode == http.StatusConflict {
+				// e.g. clinical warnings the prescriber has to acknowledge first
+				utils.JSON(c, http.StatusConflict, gin.H{
+					"error":             fmt.Sprintf("%s: the order was refused", serviceName),
+					string(serviceName): json.RawMessage(serviceError.Body),
+				})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", serviceName, err.Error())})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{
+			"id":           sb,
+			"id_kunjungan": admission.IDKunjungan,
+		})
+	}
+}
+
+// GetOrderHandler lists the orders of the stay the service keeps, as the
+// doctor sees them there.
+func (admissionController *AdmissionController) GetOrderHandler(serviceName datastruct.ServiceName) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admission, err := admissionController.findAdmission(c, false)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		query := url.Values{}
+		for _, key := range pagination.Queries {
+			if value := c.Query(key); value != "" {
+				query.Set(key, value)
+			}
+		}
+		query.Set("id_kunjungan", admission.IDKunjungan.Hex())
+
+		body, err := utils.ListRequest(c, serviceName, admission.NoIHS, query)
+		if err != nil {
+			var serviceError *utils.ServiceError
+			if errors.As(err, &serviceError) {
+				utils.JSON(c, serviceError.StatusCode, gin.H{"error": fmt.Sprintf("%s: %s", serviceName, serviceError.Body)})
+				return
+			}
+			utils.JSON(c, http.StatusBadGateway, gin.H{"error": fmt.Sprintf("%s: %s", serviceName, err.Error())})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, json.RawMessage(body))
+	}
+}
@@ -0,0 +1,199 @@
+package emr_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"service-inpatient/datastruct/inpatient"
+	"service-inpatient/logger"
+	"service-inpatient/pagination"
+	"service-inpatient/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sealProgressNote encrypts the note and signs it.
+func (admissionController *AdmissionController) sealProgressNote(data *inpatient.ProgressNote) error {
+	id := data.ID
+
+	data.ConfidentialEncrypted = utils.EncryptRandom(
+		data.ConfidentialData,
+		admissionController.ClientEncryption,
+		admissionController.EncryptionOpts,
+	)
+	data.ConfidentialData = nil
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// verifiedProgressNote tells whether the stored note still carries a valid
+// signature.
+func verifiedProgressNote(data *inpatient.ProgressNote) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// revealProgressNote decrypts a sealed note for a response.
+func (admissionController *AdmissionController) revealProgressNote(data *inpatient.ProgressNote) {
+	if data.ConfidentialEncrypted != nil {
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			admissionController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+	}
+
+	data.ConfidentialEncrypted = nil
+}
+
+// CreateProgressNoteHandler writes a progress note of a day of the stay,
+// while the patient is admitted.
+func (admissionController *AdmissionController) CreateProgressNoteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.ProgressNoteBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		admission, err := admissionController.admittedAdmission(c)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		data, err := inpatient.NewProgressNote(body, admission, c.GetString("userIdentification"), now)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		data.ID = primitive.NewObjectID()
+		data.ClientID = admission.ClientID
+		data.CreatedAt = &now
+		data.UpdatedAt = &now
+
+		if err := admissionController.sealProgressNote(&data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := admissionController.ProgressNoteCollection.InsertOne(context.Background(), data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		admissionController.revealProgressNote(&data)
+		utils.JSON(c, http.StatusCreated, data)
+	}
+}
+
+// GetProgressNoteHandler lists the progress notes of a stay, of a day if
+// tanggal is given.
+func (admissionController *AdmissionController) GetProgressNoteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admission, err := admissionController.findAdmission(c, false)
+		if err != nil {
+			utils.JSON(c, admissionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"id_rawat_inap": admission.ID,
+			"deleted_at":    nil,
+		}
+
+		if tanggal := c.Query("tanggal"); tanggal != "" {
+			day, err := inpatient.ParseDay(tanggal)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["tanggal"] = day
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := admissionController.ProgressNoteCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := admissionController.ProgressNoteCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		notes := []inpatient.ProgressNote{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var data inpatient.ProgressNote
+			if err := cursor.Decode(&data); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = data.ID
+
+			if !verifiedProgressNote(&data) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+				continue
+			}
+
+			admissionController.revealProgressNote(&data)
+			notes = append(notes, data)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(notes, total, last, more))
+	}
+}
@@ -0,0 +1,541 @@
+package emr_controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"service-inpatient/datastruct"
+	"service-inpatient/datastruct/inpatient"
+	"service-inpatient/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WardController keeps the wards, rooms and beds of a client and which of
+// the beds are occupied. Every ward and bed belongs to the client that made
+// it.
+type WardController struct {
+	WardCollection *mongo.Collection
+	BedCollection  *mongo.Collection
+}
+
+func InitWardController(client *mongo.Client) *WardController {
+	return &WardController{
+		WardCollection: client.Database("emr").Collection("bangsal"),
+		BedCollection:  client.Database("emr").Collection("bed"),
+	}
+}
+
+func findWard(collection *mongo.Collection, id primitive.ObjectID, clientID string) (*inpatient.Ward, error) {
+	filter := bson.M{
+		"_id":        id,
+		"client_id":  clientID,
+		"deleted_at": nil,
+	}
+
+	var ward inpatient.Ward
+	if err := collection.FindOne(context.Background(), filter).Decode(&ward); err != nil {
+		return nil, err
+	}
+
+	return &ward, nil
+}
+
+// findBed loads a bed of the client with the ward it stands in.
+func findBed(bedCollection, wardCollection *mongo.Collection, id primitive.ObjectID, clientID string) (*inpatient.Bed, *inpatient.Ward, error) {
+	filter := bson.M{
+		"_id":        id,
+		"client_id":  clientID,
+		"deleted_at": nil,
+	}
+
+	var bed inpatient.Bed
+	if err := bedCollection.FindOne(context.Background(), filter).Decode(&bed); err != nil {
+		return nil, nil, err
+	}
+
+	ward, err := findWard(wardCollection, bed.IDBangsal, clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &bed, ward, nil
+}
+
+// occupyBed lays the patient of the admission in the bed. The bed only
+// matches while it is available, so two admissions cannot take it at once.
+func occupyBed(collection *mongo.Collection, bedID, admissionID primitive.ObjectID, noIHS string, now time.Time) error {
+	filter := bson.M{
+		"_id":        bedID,
+		"status":     datastruct.BED_TERSEDIA,
+		"deleted_at": nil,
+	}
+	update := bson.M{"$set": bson.M{
+		"status":        datastruct.BED_TERISI,
+		"id_rawat_inap": admissionID,
+		"no_ihs":        noIHS,
+		"updated_at":    now,
+	}}
+
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return inpatient.BedUnavailableError
+	}
+
+	return nil
+}
+
+// releaseBed takes the patient of the admission out of the bed. It is left
+// to be cleaned, or made available again when the admission never took
+// place.
+func releaseBed(collection *mongo.Collection, bedID, admissionID primitive.ObjectID, to datastruct.BedStatus, now time.Time) error {
+	filter := bson.M{
+		"_id":           bedID,
+		"id_rawat_inap": admissionID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     to,
+			"updated_at": now,
+		},
+		"$unset": bson.M{
+			"id_rawat_inap": "",
+			"no_ihs":        "",
+		},
+	}
+
+	_, err := collection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func (wardController *WardController) CreateWardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.WardBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		ward := inpatient.Ward{
+			ID:        primitive.NewObjectID(),
+			ClientID:  c.GetString("userClient"),
+			Kode:      body.Kode,
+			Nama:      body.Nama,
+			Kelas:     body.Kelas,
+			Kamar:     body.Kamar,
+			CreatedAt: &now,
+			UpdatedAt: &now,
+		}
+
+		if _, err := wardController.WardCollection.InsertOne(context.Background(), ward); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.DuplicateWardError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, ward)
+	}
+}
+
+func (wardController *WardController) GetAllWardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"deleted_at": nil,
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "kode", Value: 1}})
+		cursor, err := wardController.WardCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		wards := []inpatient.Ward{}
+		if err := cursor.All(context.Background(), &wards); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, wards)
+	}
+}
+
+func (wardController *WardController) GetWardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("wardId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ward, err := findWard(wardController.WardCollection, id, c.GetString("userClient"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, ward)
+	}
+}
+
+// UpdateWardHandler changes a ward and its rooms. A room can only be
+// removed once it has no beds left.
+func (wardController *WardController) UpdateWardHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("wardId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var body inpatient.WardBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ward, err := findWard(wardController.WardCollection, id, c.GetString("userClient"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		newWard := inpatient.Ward{
+			ID:        ward.ID,
+			ClientID:  ward.ClientID,
+			Kode:      body.Kode,
+			Nama:      body.Nama,
+			Kelas:     body.Kelas,
+			Kamar:     body.Kamar,
+			CreatedAt: ward.CreatedAt,
+		}
+
+		removed := bson.A{}
+		for _, room := range ward.Kamar {
+			if _, err := newWard.Room(room.Kode); err != nil {
+				removed = append(removed, room.Kode)
+			}
+		}
+
+		if len(removed) > 0 {
+			count, err := wardController.BedCollection.CountDocuments(context.Background(), bson.M{
+				"id_bangsal": ward.ID,
+				"kode_kamar": bson.M{"$in": removed},
+				"deleted_at": nil,
+			}, options.Count().SetLimit(1))
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if count > 0 {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.RoomInUseError.Error()})
+				return
+			}
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		newWard.UpdatedAt = &now
+
+		filter := bson.M{
+			"_id":        id,
+			"updated_at": ward.UpdatedAt,
+		}
+
+		result, err := wardController.WardCollection.ReplaceOne(context.Background(), filter, newWard)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.DuplicateWardError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "the ward was changed in the meantime, please try again"})
+			return
+		}
+
+		if newWard.Kode != ward.Kode {
+			// the beds show the kode of their ward
+			_, err := wardController.BedCollection.UpdateMany(context.Background(),
+				bson.M{"id_bangsal": ward.ID},
+				bson.M{"$set": bson.M{"kode_bangsal": newWard.Kode}})
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		utils.JSON(c, http.StatusOK, newWard)
+	}
+}
+
+// WardOccupancyHandler counts the beds of every ward of the client by
+// status.
+func (wardController *WardController) WardOccupancyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID := c.GetString("userClient")
+
+		opts := options.Find().SetSort(bson.D{{Key: "kode", Value: 1}})
+		cursor, err := wardController.WardCollection.Find(context.Background(), bson.M{
+			"client_id":  clientID,
+			"deleted_at": nil,
+		}, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		wards := []inpatient.Ward{}
+		if err := cursor.All(context.Background(), &wards); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"client_id": clientID, "deleted_at": nil}}},
+			{{Key: "$group", Value: bson.M{
+				"_id":    bson.M{"id_bangsal": "$id_bangsal", "status": "$status"},
+				"jumlah": bson.M{"$sum": 1},
+			}}},
+		}
+
+		counts, err := wardController.BedCollection.Aggregate(context.Background(), pipeline)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer counts.Close(context.Background())
+
+		occupancies := make([]inpatient.WardOccupancy, len(wards))
+		byWard := map[primitive.ObjectID]*inpatient.WardOccupancy{}
+		for i, ward := range wards {
+			occupancies[i] = inpatient.WardOccupancy{
+				IDBangsal: ward.ID,
+				Kode:      ward.Kode,
+				Nama:      ward.Nama,
+				Kelas:     ward.Kelas,
+			}
+			byWard[ward.ID] = &occupancies[i]
+		}
+
+		for counts.Next(context.Background()) {
+			var count struct {
+				ID struct {
+					IDBangsal primitive.ObjectID   `bson:"id_bangsal"`
+					Status    datastruct.BedStatus `bson:"status"`
+				} `bson:"_id"`
+				Jumlah int64 `bson:"jumlah"`
+			}
+			if err := counts.Decode(&count); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if occupancy, ok := byWard[count.ID.IDBangsal]; ok {
+				occupancy.Count(count.ID.Status, count.Jumlah)
+			}
+		}
+
+		if err := counts.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, occupancies)
+	}
+}
+
+func (wardController *WardController) CreateBedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inpatient.BedBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ward, err := findWard(wardController.WardCollection, body.IDBangsal, c.GetString("userClient"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := ward.Room(body.KodeKamar); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		bed := inpatient.Bed{
+			ID:          primitive.NewObjectID(),
+			ClientID:    ward.ClientID,
+			IDBangsal:   ward.ID,
+			KodeBangsal: ward.Kode,
+			KodeKamar:   body.KodeKamar,
+			Kode:        body.Kode,
+			Status:      datastruct.BED_TERSEDIA,
+			CreatedAt:   &now,
+			UpdatedAt:   &now,
+		}
+
+		if _, err := wardController.BedCollection.InsertOne(context.Background(), bed); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.DuplicateBedError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, bed)
+	}
+}
+
+// GetAllBedHandler lists the beds of the client by ward, room and kode,
+// optionally of a ward, a room or a status.
+func (wardController *WardController) GetAllBedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"deleted_at": nil,
+		}
+
+		if wardID := c.Query("id_bangsal"); wardID != "" {
+			id, err := primitive.ObjectIDFromHex(wardID)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["id_bangsal"] = id
+		}
+
+		if room := c.Query("kode_kamar"); room != "" {
+			filter["kode_kamar"] = room
+		}
+
+		if status := c.Query("status"); status != "" {
+			value, err := inpatient.ParseBedStatus(status)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = value
+		}
+
+		opts := options.Find().SetSort(bson.D{
+			{Key: "kode_bangsal", Value: 1},
+			{Key: "kode_kamar", Value: 1},
+			{Key: "kode", Value: 1},
+		})
+		cursor, err := wardController.BedCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		beds := []inpatient.Bed{}
+		if err := cursor.All(context.Background(), &beds); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, beds)
+	}
+}
+
+// TransitionBedHandler makes a bed available again once it is cleaned or
+// repaired, or takes it out of use. Beds are occupied and left only by
+// admissions, transfers and discharges.
+func (wardController *WardController) TransitionBedHandler(to datastruct.BedStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("bedId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		bed, _, err := findBed(wardController.BedCollection, wardController.WardCollection, id, c.GetString("userClient"))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := inpatient.CheckBedTransition(bed.Status, to); err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		filter := bson.M{
+			"_id":    bed.ID,
+			"status": bed.Status,
+		}
+		update := bson.M{"$set": bson.M{
+			"status":     to,
+			"updated_at": now,
+		}}
+
+		result, err := wardController.BedCollection.UpdateOne(context.Background(), filter, update)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": inpatient.BedChangedError.Error()})
+			return
+		}
+
+		bed.Status = to
+		bed.UpdatedAt = &now
+		utils.JSON(c, http.StatusOK, bed)
+	}
+}
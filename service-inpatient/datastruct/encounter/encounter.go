@@ -0,0 +1,54 @@
+package encounter
+
+import (
+	"service-inpatient/datastruct"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Encounter is an encounter as the outpatient service, which keeps the
+// encounters of every treatment type, returns it. Only what an admission
+// needs to know of it is read.
+type Encounter struct {
+	ID       primitive.ObjectID         `json:"_id"`
+	ClientID string                     `json:"client_id"`
+	NoIHS    string                     `json:"no_ihs"`
+	Jenis    datastruct.TreatmentType   `json:"jenis"`
+	Status   datastruct.EncounterStatus `json:"status"`
+}
+
+// Location is the unit the patient is at, for a stay the ward, room and
+// bed.
+type Location struct {
+	Unit  string `json:"unit"`
+	Ruang string `json:"ruang,omitempty"`
+	Bed   string `json:"bed,omitempty"`
+}
+
+// Payer is who pays for the encounter. The outpatient service checks it
+// when the encounter is opened.
+type Payer struct {
+	Jenis        datastruct.PayerType `json:"jenis" binding:"required,min=1,max=4"`
+	NamaPenjamin string               `json:"nama_penjamin,omitempty"`
+	NoPeserta    string               `json:"no_peserta,omitempty"`
+	NoSEP        string               `json:"no_sep,omitempty"`
+}
+
+// EncounterBody opens an encounter with the outpatient service.
+type EncounterBody struct {
+	NoIHS                 string                     `json:"no_ihs"`
+	Jenis                 datastruct.TreatmentType   `json:"jenis"`
+	Status                datastruct.EncounterStatus `json:"status"`
+	Lokasi                Location                   `json:"lokasi"`
+	DokterPenanggungJawab string                     `json:"dokter_penanggung_jawab"`
+	Penjamin              Payer                      `json:"penjamin"`
+}
+
+// UpdateBody moves the patient of an encounter to another location.
+type UpdateBody struct {
+	Lokasi *Location `json:"lokasi,omitempty"`
+}
+
+type StatusBody struct {
+	Alasan string `json:"alasan,omitempty"`
+}
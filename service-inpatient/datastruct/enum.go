@@ -0,0 +1,80 @@
+package datastruct
+
+type TreatmentType uint8
+type RoleType string
+type ServiceName string
+type PatientConsent bool
+type EncounterStatus uint8
+type PayerType uint8
+type BedStatus uint8
+type AdmissionStatus uint8
+type DischargeType uint8
+type CareProvider uint8
+
+const (
+	IGD TreatmentType = iota
+	RAWAT_INAP
+	RAWAT_JALAN
+)
+
+const (
+	DOKTER       RoleType = "Dokter"
+	APOTEK       RoleType = "Apotek"
+	LABORATORIUM RoleType = "Laboratorium"
+	RADIOLOGI    RoleType = "Radiologi"
+)
+
+const (
+	LABORATORY ServiceName = "laboratory"
+	RADIOLOGY  ServiceName = "radiology"
+	PHARMACY   ServiceName = "pharmacy"
+)
+
+const (
+	OPTIN  PatientConsent = true
+	OPTOUT PatientConsent = false
+)
+
+const (
+	KUNJUNGAN_DIRENCANAKAN EncounterStatus = iota + 1
+	KUNJUNGAN_TIBA
+	KUNJUNGAN_BERLANGSUNG
+	KUNJUNGAN_SELESAI
+	KUNJUNGAN_DIBATALKAN
+)
+
+const (
+	PENJAMIN_UMUM PayerType = iota + 1
+	PENJAMIN_BPJS
+	PENJAMIN_ASURANSI
+	PENJAMIN_PERUSAHAAN
+)
+
+const (
+	BED_TERSEDIA BedStatus = iota + 1
+	BED_TERISI
+	BED_DIBERSIHKAN
+	BED_TIDAK_AKTIF
+)
+
+const (
+	RAWAT_INAP_DIRAWAT AdmissionStatus = iota + 1
+	RAWAT_INAP_PULANG
+)
+
+const (
+	PULANG_ATAS_PERSETUJUAN DischargeType = iota + 1
+	PULANG_ATAS_PERMINTAAN_SENDIRI
+	PULANG_DIRUJUK
+	PULANG_MENINGGAL
+)
+
+// CareProvider is the profession of whoever writes a progress note, the
+// PPA (profesional pemberi asuhan) of the integrated notes.
+const (
+	PPA_DOKTER CareProvider = iota + 1
+	PPA_PERAWAT
+	PPA_BIDAN
+	PPA_APOTEKER
+	PPA_NUTRISIONIS
+)
@@ -0,0 +1,234 @@
+package inpatient
+
+import (
+	"errors"
+	"service-inpatient/datastruct"
+	"service-inpatient/datastruct/encounter"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InvalidOriginError       = errors.New("asal must be 0 (IGD) or 2 (rawat jalan)")
+	OriginMismatchError      = errors.New("id_kunjungan_asal must be an encounter of the asal given")
+	OriginNotInProgressError = errors.New("patients can only be admitted from an encounter in progress")
+	OriginElsewhereError     = errors.New("id_kunjungan_asal must be an encounter at the facility admitting the patient")
+	NotAdmittedError         = errors.New("the patient has been discharged and the admission can no longer be changed")
+	SameBedError             = errors.New("the patient already lies in that bed")
+	MissingReferralError     = errors.New("tujuan_rujukan is required when the patient is referred")
+	InvalidStatusError       = errors.New("status must be 1 (dirawat) or 2 (pulang)")
+	ConcurrentUpdateError    = errors.New("the admission was changed in the meantime, please try again")
+	TamperedError            = errors.New("the admission does not match its signature")
+)
+
+// Admission is an inpatient stay, from the encounter the patient was
+// admitted from to their discharge. The stay is an encounter of its own,
+// IDKunjungan, which the orders and prescriptions of the stay refer to.
+type Admission struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID  string  `json:"client_id" bson:"client_id"`
+	Signature *string `json:"signature" bson:"signature"`
+	NoIHS     string  `json:"no_ihs" bson:"no_ihs"`
+
+	IDKunjungan     primitive.ObjectID       `json:"id_kunjungan" bson:"id_kunjungan"`
+	Asal            datastruct.TreatmentType `json:"asal" bson:"asal"`
+	IDKunjunganAsal primitive.ObjectID       `json:"id_kunjungan_asal" bson:"id_kunjungan_asal"`
+
+	Status                datastruct.AdmissionStatus `json:"status" bson:"status"`
+	DokterPenanggungJawab string                     `json:"dokter_penanggung_jawab" bson:"dokter_penanggung_jawab"`
+	WaktuMasuk            time.Time                  `json:"waktu_masuk" bson:"waktu_masuk"`
+
+	// Bed is where the patient lies now, RiwayatPindah every transfer
+	// between beds.
+	Bed           BedPlacement `json:"bed" bson:"bed"`
+	RiwayatPindah []Transfer   `json:"riwayat_pindah" bson:"riwayat_pindah"`
+
+	ConfidentialData      *AdmissionData    `json:"confidential_data" bson:"confidential_data,omitempty"`
+	ConfidentialEncrypted *primitive.Binary `json:"encrypted_confidential" bson:"encrypted_confidential"`
+
+	WaktuPulang              *time.Time               `json:"waktu_pulang,omitempty" bson:"waktu_pulang,omitempty"`
+	CaraPulang               datastruct.DischargeType `json:"cara_pulang,omitempty" bson:"cara_pulang,omitempty"`
+	RingkasanPulang          *DischargeSummary        `json:"ringkasan_pulang,omitempty" bson:"ringkasan_pulang,omitempty"`
+	RingkasanPulangEncrypted *primitive.Binary        `json:"encrypted_ringkasan_pulang,omitempty" bson:"encrypted_ringkasan_pulang,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+// AdmissionData is why the patient was admitted.
+type AdmissionData struct {
+	DiagnosisMasuk string `json:"diagnosis_masuk" binding:"required" bson:"diagnosis_masuk"`
+	IndikasiRawat  string `json:"indikasi_rawat" binding:"required" bson:"indikasi_rawat"`
+	Catatan        string `json:"catatan" bson:"catatan"`
+}
+
+type Transfer struct {
+	Dari    BedPlacement `json:"dari" bson:"dari"`
+	Ke      BedPlacement `json:"ke" bson:"ke"`
+	Alasan  string       `json:"alasan" bson:"alasan"`
+	Petugas string       `json:"petugas" bson:"petugas"`
+	Waktu   time.Time    `json:"waktu" bson:"waktu"`
+}
+
+// DischargeSummary is the resume medis of the stay, given to the patient
+// and to whoever cares for them next.
+type DischargeSummary struct {
+	DiagnosisAkhir        string `json:"diagnosis_akhir" binding:"required" bson:"diagnosis_akhir"`
+	DiagnosisSekunder     string `json:"diagnosis_sekunder" bson:"diagnosis_sekunder"`
+	RingkasanPerawatan    string `json:"ringkasan_perawatan" binding:"required" bson:"ringkasan_perawatan"`
+	Tindakan              string `json:"tindakan" bson:"tindakan"`
+	KondisiPulang         string `json:"kondisi_pulang" binding:"required" bson:"kondisi_pulang"`
+	TerapiPulang          string `json:"terapi_pulang" bson:"terapi_pulang"`
+	InstruksiTindakLanjut string `json:"instruksi_tindak_lanjut" bson:"instruksi_tindak_lanjut"`
+	JadwalKontrol         string `json:"jadwal_kontrol,omitempty" bson:"jadwal_kontrol,omitempty"`
+	TujuanRujukan         string `json:"tujuan_rujukan,omitempty" bson:"tujuan_rujukan,omitempty"`
+}
+
+// AdmissionBody admits a patient from the encounter, IGD or outpatient,
+// they are being seen in to the bed.
+type AdmissionBody struct {
+	NoIHS                 string                   `json:"no_ihs" binding:"required"`
+	Asal                  datastruct.TreatmentType `json:"asal"`
+	IDKunjunganAsal       primitive.ObjectID       `json:"id_kunjungan_asal" binding:"required"`
+	IDBed                 primitive.ObjectID       `json:"id_bed" binding:"required"`
+	DokterPenanggungJawab string                   `json:"dokter_penanggung_jawab" binding:"required"`
+	Penjamin              encounter.Payer          `json:"penjamin" binding:"required"`
+	DataMasuk             AdmissionData            `json:"data_masuk" binding:"required"`
+}
+
+type TransferBody struct {
+	IDBed  primitive.ObjectID `json:"id_bed" binding:"required"`
+	Alasan string             `json:"alasan" binding:"required"`
+}
+
+type DischargeBody struct {
+	CaraPulang      datastruct.DischargeType `json:"cara_pulang" binding:"required,min=1,max=4"`
+	RingkasanPulang DischargeSummary         `json:"ringkasan_pulang" binding:"required"`
+}
+
+func (body *AdmissionBody) Validate() error {
+	if body.Asal != datastruct.IGD && body.Asal != datastruct.RAWAT_JALAN {
+		return InvalidOriginError
+	}
+
+	return nil
+}
+
+func (body *DischargeBody) Validate() error {
+	if body.CaraPulang == datastruct.PULANG_DIRUJUK && body.RingkasanPulang.TujuanRujukan == "" {
+		return MissingReferralError
+	}
+
+	return nil
+}
+
+// CheckOrigin tells whether the patient can be admitted by the client from
+// the encounter, which ends with the admission.
+func (body *AdmissionBody) CheckOrigin(origin *encounter.Encounter, clientID string) error {
+	if origin.ClientID != clientID {
+		return OriginElsewhereError
+	}
+
+	if origin.Jenis != body.Asal {
+		return OriginMismatchError
+	}
+
+	if origin.Status != datastruct.KUNJUNGAN_BERLANGSUNG {
+		return OriginNotInProgressError
+	}
+
+	return nil
+}
+
+// StayEncounter opens the encounter of the stay. The patient has arrived;
+// the stay is in progress once the admission is saved, and can still be
+// cancelled until then.
+func (body *AdmissionBody) StayEncounter(placement BedPlacement) encounter.EncounterBody {
+	return encounter.EncounterBody{
+		NoIHS:                 body.NoIHS,
+		Jenis:                 datastruct.RAWAT_INAP,
+		Status:                datastruct.KUNJUNGAN_TIBA,
+		Lokasi:                placement.Location(),
+		DokterPenanggungJawab: body.DokterPenanggungJawab,
+		Penjamin:              body.Penjamin,
+	}
+}
+
+func NewAdmission(body AdmissionBody, placement BedPlacement, stayID primitive.ObjectID, now time.Time) Admission {
+	data := body.DataMasuk
+
+	return Admission{
+		NoIHS:                 body.NoIHS,
+		IDKunjungan:           stayID,
+		Asal:                  body.Asal,
+		IDKunjunganAsal:       body.IDKunjunganAsal,
+		Status:                datastruct.RAWAT_INAP_DIRAWAT,
+		DokterPenanggungJawab: body.DokterPenanggungJawab,
+		WaktuMasuk:            now,
+		Bed:                   placement,
+		RiwayatPindah:         []Transfer{},
+		ConfidentialData:      &data,
+	}
+}
+
+// Admitted tells whether the patient is still admitted, which the
+// admission can only be changed while.
+func (admission *Admission) Admitted() error {
+	if admission.Status != datastruct.RAWAT_INAP_DIRAWAT {
+		return NotAdmittedError
+	}
+
+	return nil
+}
+
+// MoveTo transfers the patient to another bed.
+func (admission *Admission) MoveTo(placement BedPlacement, reason, by string, now time.Time) {
+	admission.RiwayatPindah = append(admission.RiwayatPindah, Transfer{
+		Dari:    admission.Bed,
+		Ke:      placement,
+		Alasan:  reason,
+		Petugas: by,
+		Waktu:   now,
+	})
+	admission.Bed = placement
+}
+
+// Discharge ends the stay with the discharge summary.
+func (admission *Admission) Discharge(body DischargeBody, now time.Time) {
+	summary := body.RingkasanPulang
+
+	admission.Status = datastruct.RAWAT_INAP_PULANG
+	admission.WaktuPulang = &now
+	admission.CaraPulang = body.CaraPulang
+	admission.RingkasanPulang = &summary
+}
+
+// DischargeString is how the patient left, as it is recorded on the
+// encounter of the stay.
+func (admission *Admission) DischargeString() string {
+	switch admission.CaraPulang {
+	case datastruct.PULANG_ATAS_PERSETUJUAN:
+		return "Pulang atas persetujuan dokter"
+	case datastruct.PULANG_ATAS_PERMINTAAN_SENDIRI:
+		return "Pulang atas permintaan sendiri"
+	case datastruct.PULANG_DIRUJUK:
+		return "Dirujuk"
+	case datastruct.PULANG_MENINGGAL:
+		return "Meninggal"
+	default:
+		return ""
+	}
+}
+
+func ParseAdmissionStatus(value string) (datastruct.AdmissionStatus, error) {
+	status, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || status < uint64(datastruct.RAWAT_INAP_DIRAWAT) || status > uint64(datastruct.RAWAT_INAP_PULANG) {
+		return 0, InvalidStatusError
+	}
+
+	return datastruct.AdmissionStatus(status), nil
+}
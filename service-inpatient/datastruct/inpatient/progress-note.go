@@ -0,0 +1,93 @@
+package inpatient
+
+import (
+	"errors"
+	"service-inpatient/datastruct"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InvalidDayError  = errors.New("tanggal must be a date in the YYYY-MM-DD format")
+	OutsideStayError = errors.New("tanggal must be a day of the stay up to today")
+)
+
+// ProgressNote is an entry of the integrated progress notes (CPPT) of a
+// stay, written in the SOAP format by any profession caring for the
+// patient. Tanggal is the day of care it is written for.
+type ProgressNote struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID    string                  `json:"client_id" bson:"client_id"`
+	Signature   *string                 `json:"signature" bson:"signature"`
+	NoIHS       string                  `json:"no_ihs" bson:"no_ihs"`
+	IDRawatInap primitive.ObjectID      `json:"id_rawat_inap" bson:"id_rawat_inap"`
+	Tanggal     string                  `json:"tanggal" bson:"tanggal"` // YYYY-MM-DD
+	Petugas     string                  `json:"petugas" bson:"petugas"`
+	Profesi     datastruct.CareProvider `json:"profesi" bson:"profesi"`
+
+	ConfidentialData      *ProgressNoteData `json:"confidential_data" bson:"confidential_data,omitempty"`
+	ConfidentialEncrypted *primitive.Binary `json:"encrypted_confidential" bson:"encrypted_confidential"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+type ProgressNoteData struct {
+	Subjektif string `json:"subjektif" binding:"required" bson:"subjektif"`
+	Objektif  string `json:"objektif" binding:"required" bson:"objektif"`
+	Asesmen   string `json:"asesmen" binding:"required" bson:"asesmen"`
+	Plan      string `json:"plan" binding:"required" bson:"plan"`
+	Instruksi string `json:"instruksi" bson:"instruksi"`
+}
+
+// ProgressNoteBody writes a note for the day of tanggal, today if left
+// out.
+type ProgressNoteBody struct {
+	Tanggal string                  `json:"tanggal"`
+	Profesi datastruct.CareProvider `json:"profesi" binding:"required,min=1,max=5"`
+	Catatan ProgressNoteData        `json:"catatan" binding:"required"`
+}
+
+// Today is the day of the time, in the format progress notes are written
+// for.
+func Today(now time.Time) string {
+	return now.In(time.Local).Format(time.DateOnly)
+}
+
+func ParseDay(value string) (string, error) {
+	if _, err := time.Parse(time.DateOnly, value); err != nil {
+		return "", InvalidDayError
+	}
+
+	return value, nil
+}
+
+func NewProgressNote(body ProgressNoteBody, admission *Admission, by string, now time.Time) (ProgressNote, error) {
+	day := Today(now)
+	if body.Tanggal != "" {
+		parsed, err := ParseDay(body.Tanggal)
+		if err != nil {
+			return ProgressNote{}, err
+		}
+		day = parsed
+	}
+
+	// the dates compare in the order of their days
+	if day < Today(admission.WaktuMasuk) || day > Today(now) {
+		return ProgressNote{}, OutsideStayError
+	}
+
+	data := body.Catatan
+
+	return ProgressNote{
+		NoIHS:            admission.NoIHS,
+		IDRawatInap:      admission.ID,
+		Tanggal:          day,
+		Petugas:          by,
+		Profesi:          body.Profesi,
+		ConfidentialData: &data,
+	}, nil
+}
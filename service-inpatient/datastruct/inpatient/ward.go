@@ -0,0 +1,203 @@
+package inpatient
+
+import (
+	"errors"
+	"service-inpatient/datastruct"
+	"service-inpatient/datastruct/encounter"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	DuplicateWardError        = errors.New("a ward with that kode already exists")
+	DuplicateRoomError        = errors.New("a room is listed more than once in the ward")
+	DuplicateBedError         = errors.New("a bed with that kode already exists in the room")
+	UnknownRoomError          = errors.New("kode_kamar must be the kode of a room of the ward")
+	RoomInUseError            = errors.New("a room that still has beds cannot be removed from the ward")
+	BedUnavailableError       = errors.New("the bed is not available")
+	BedChangedError           = errors.New("the bed was changed in the meantime, please try again")
+	InvalidBedTransitionError = errors.New("bed status transition is not allowed")
+	InvalidBedStatusError     = errors.New("status must be a number from 1 to 4")
+)
+
+// BedTransitions maps every target status to the statuses it may be reached
+// from. A bed is occupied by an admission or a transfer, and left to be
+// cleaned when the patient leaves it.
+var BedTransitions = map[datastruct.BedStatus][]datastruct.BedStatus{
+	datastruct.BED_TERSEDIA:    {datastruct.BED_DIBERSIHKAN, datastruct.BED_TIDAK_AKTIF},
+	datastruct.BED_TERISI:      {datastruct.BED_TERSEDIA},
+	datastruct.BED_DIBERSIHKAN: {datastruct.BED_TERISI},
+	datastruct.BED_TIDAK_AKTIF: {datastruct.BED_TERSEDIA, datastruct.BED_DIBERSIHKAN},
+}
+
+// Ward is a bangsal of the facility and its rooms. A room takes the class
+// of the ward unless it has its own.
+type Ward struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+	Kode     string `json:"kode" bson:"kode"`
+	Nama     string `json:"nama" bson:"nama"`
+	Kelas    string `json:"kelas" bson:"kelas"`
+	Kamar    []Room `json:"kamar" bson:"kamar"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+type Room struct {
+	Kode  string `json:"kode" binding:"required" bson:"kode"`
+	Nama  string `json:"nama" binding:"required" bson:"nama"`
+	Kelas string `json:"kelas,omitempty" bson:"kelas,omitempty"`
+}
+
+// Bed is a bed in a room of a ward. An occupied bed holds the admission
+// lying in it.
+type Bed struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID    string             `json:"client_id" bson:"client_id"`
+	IDBangsal   primitive.ObjectID `json:"id_bangsal" bson:"id_bangsal"`
+	KodeBangsal string             `json:"kode_bangsal" bson:"kode_bangsal"`
+	KodeKamar   string             `json:"kode_kamar" bson:"kode_kamar"`
+	Kode        string             `json:"kode" bson:"kode"`
+
+	Status      datastruct.BedStatus `json:"status" bson:"status"`
+	IDRawatInap *primitive.ObjectID  `json:"id_rawat_inap,omitempty" bson:"id_rawat_inap,omitempty"`
+	NoIHS       string               `json:"no_ihs,omitempty" bson:"no_ihs,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+// BedPlacement is the bed an admitted patient lies in, as it is shown on
+// the admission.
+type BedPlacement struct {
+	IDBed       primitive.ObjectID `json:"id_bed" bson:"id_bed"`
+	KodeBangsal string             `json:"kode_bangsal" bson:"kode_bangsal"`
+	NamaBangsal string             `json:"nama_bangsal" bson:"nama_bangsal"`
+	KodeKamar   string             `json:"kode_kamar" bson:"kode_kamar"`
+	KodeBed     string             `json:"kode_bed" bson:"kode_bed"`
+	Kelas       string             `json:"kelas" bson:"kelas"`
+}
+
+// WardOccupancy counts the beds of a ward by status. BOR, the bed occupancy
+// rate, is the percentage of the beds in use that are occupied.
+type WardOccupancy struct {
+	IDBangsal   primitive.ObjectID `json:"id_bangsal"`
+	Kode        string             `json:"kode"`
+	Nama        string             `json:"nama"`
+	Kelas       string             `json:"kelas"`
+	Total       int64              `json:"total"`
+	Tersedia    int64              `json:"tersedia"`
+	Terisi      int64              `json:"terisi"`
+	Dibersihkan int64              `json:"dibersihkan"`
+	TidakAktif  int64              `json:"tidak_aktif"`
+	BOR         float64            `json:"bor"`
+}
+
+type WardBody struct {
+	Kode  string `json:"kode" binding:"required"`
+	Nama  string `json:"nama" binding:"required"`
+	Kelas string `json:"kelas" binding:"required"`
+	Kamar []Room `json:"kamar" binding:"required,min=1,dive"`
+}
+
+type BedBody struct {
+	IDBangsal primitive.ObjectID `json:"id_bangsal" binding:"required"`
+	KodeKamar string             `json:"kode_kamar" binding:"required"`
+	Kode      string             `json:"kode" binding:"required"`
+}
+
+func (body *WardBody) Validate() error {
+	seen := map[string]bool{}
+	for _, room := range body.Kamar {
+		if seen[room.Kode] {
+			return DuplicateRoomError
+		}
+		seen[room.Kode] = true
+	}
+
+	return nil
+}
+
+// Room finds the room of the ward by its kode.
+func (ward *Ward) Room(kode string) (*Room, error) {
+	for i := 0; i < len(ward.Kamar); i++ {
+		if ward.Kamar[i].Kode == kode {
+			return &ward.Kamar[i], nil
+		}
+	}
+
+	return nil, UnknownRoomError
+}
+
+// Placement is where a patient lies in the bed of the ward.
+func (ward *Ward) Placement(bed *Bed) BedPlacement {
+	placement := BedPlacement{
+		IDBed:       bed.ID,
+		KodeBangsal: ward.Kode,
+		NamaBangsal: ward.Nama,
+		KodeKamar:   bed.KodeKamar,
+		KodeBed:     bed.Kode,
+		Kelas:       ward.Kelas,
+	}
+
+	if room, err := ward.Room(bed.KodeKamar); err == nil && room.Kelas != "" {
+		placement.Kelas = room.Kelas
+	}
+
+	return placement
+}
+
+// Location is the bed as the location of the encounter of the stay.
+func (placement *BedPlacement) Location() encounter.Location {
+	return encounter.Location{
+		Unit:  placement.NamaBangsal,
+		Ruang: placement.KodeKamar,
+		Bed:   placement.KodeBed,
+	}
+}
+
+// Count adds beds of the status to the occupancy of the ward.
+func (occupancy *WardOccupancy) Count(status datastruct.BedStatus, count int64) {
+	occupancy.Total += count
+
+	switch status {
+	case datastruct.BED_TERSEDIA:
+		occupancy.Tersedia += count
+	case datastruct.BED_TERISI:
+		occupancy.Terisi += count
+	case datastruct.BED_DIBERSIHKAN:
+		occupancy.Dibersihkan += count
+	case datastruct.BED_TIDAK_AKTIF:
+		occupancy.TidakAktif += count
+	}
+
+	if inUse := occupancy.Total - occupancy.TidakAktif; inUse > 0 {
+		occupancy.BOR = float64(occupancy.Terisi) * 100 / float64(inUse)
+	}
+}
+
+func CheckBedTransition(from, to datastruct.BedStatus) error {
+	for _, status := range BedTransitions[to] {
+		if status == from {
+			return nil
+		}
+	}
+
+	return InvalidBedTransitionError
+}
+
+func ParseBedStatus(value string) (datastruct.BedStatus, error) {
+	status, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || status < uint64(datastruct.BED_TERSEDIA) || status > uint64(datastruct.BED_TIDAK_AKTIF) {
+		return 0, InvalidBedStatusError
+	}
+
+	return datastruct.BedStatus(status), nil
+}
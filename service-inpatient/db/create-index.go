@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"service-inpatient/logger"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateKeyVaultIndex(keyVaultClient *mongo.Client, keyVaultNamespace string) error {
+	keyVaultComp := strings.Split(keyVaultNamespace, ".")
+	keyVaultDb := keyVaultComp[0]
+	keyVaultColl := keyVaultComp[1]
+
+	logger.LogInfo.Println("Checking index for key vault collection...")
+
+	cursor, err := keyVaultClient.Database(keyVaultDb).Collection(keyVaultColl).Indexes().List(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get index list: %v", err)
+	}
+
+	var results []bson.M
+	if err = cursor.All(context.TODO(), &results); err != nil {
+		return fmt.Errorf("failed to decode index list: %v", err)
+	}
+
+	if results != nil {
+		logger.LogInfo.Println("Index has already exist")
+		return nil
+	}
+
+	logger.LogInfo.Println("Create index for key vault collection")
+
+	keyVaultIndex := mongo.IndexModel{
+		Keys: bson.D{{"keyAltNames", 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{"keyAltNames", bson.D{
+					{"$exists", true},
+				}},
+			}),
+	}
+
+	_, err = keyVaultClient.Database(keyVaultDb).Collection(keyVaultColl).Indexes().CreateOne(context.TODO(), keyVaultIndex)
+	if err != nil {
+		logger.LogPanic.Panicf("failed to create key vault index: %v", err)
+	}
+	return nil
+
+}
+
+// CreateWardIndex keeps the kode of a ward unique at a client, and of a bed
+// in its room, and serves the beds of a ward.
+func CreateWardIndex(client *mongo.Client) error {
+	wardIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "kode", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("emr").Collection("bangsal").Indexes().CreateOne(context.TODO(), wardIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create ward index: %v", err)
+	}
+
+	bedIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "client_id", Value: 1},
+			{Key: "id_bangsal", Value: 1},
+			{Key: "kode_kamar", Value: 1},
+			{Key: "kode", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err = client.Database("emr").Collection("bed").Indexes().CreateOne(context.TODO(), bedIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create ward index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateAdmissionIndex serves the stays of a patient and the progress notes
+// of a stay, which are paged in the order of the IDs.
+func CreateAdmissionIndex(client *mongo.Client) error {
+	admissionIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("emr").Collection("rawat_inap").Indexes().CreateOne(context.TODO(), admissionIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create admission index: %v", err)
+	}
+
+	noteIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "id_rawat_inap", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err = client.Database("emr").Collection("catatan_perkembangan").Indexes().CreateOne(context.TODO(), noteIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create admission index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"service-inpatient/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Timekeep(skew time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sentTs, err := strconv.ParseInt(c.GetHeader("X-Timestamp"), 10, 64)
+		if err != nil {
+			utils.AbortWithStatusJSON(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to parse timestamp from header: %s", err.Error())})
+			return
+		}
+
+		receiveTs := time.Now().UnixMilli()
+
+		timeDiff := receiveTs - sentTs
+		if timeDiff < 0 {
+			timeDiff = -timeDiff
+		}
+
+		if timeDiff > skew.Milliseconds() {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"error": "timestamp exceed tolerance"})
+			return
+		}
+		c.Next()
+	}
+}
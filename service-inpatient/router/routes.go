@@ -0,0 +1,142 @@
+package router
+
+import (
+	"service-inpatient/config"
+	emr_controllers "service-inpatient/controllers"
+	"service-inpatient/datastruct"
+	"service-inpatient/db/csfle"
+	"service-inpatient/middleware"
+	"service-inpatient/pagination"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RouterConfig struct {
+	Client *mongo.Client
+
+	Ward      *emr_controllers.WardController
+	Admission *emr_controllers.AdmissionController
+}
+
+func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
+	routerConfig := RouterConfig{
+		Client:    client,
+		Ward:      emr_controllers.InitWardController(client),
+		Admission: emr_controllers.InitAdmissionController(client, csfle),
+	}
+
+	return routerConfig.SetRouter()
+}
+
+func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
+	// Set up the Gin router
+	router := gin.New()
+
+	router.GET("/live", LivenessCheck())
+	router.GET("/ready", ReadinessCheck(routerConfig.Client))
+
+	router.Use(middleware.CORS(), middleware.Timekeep(time.Duration(config.TimestampSkew)*time.Millisecond))
+
+	// Define routes
+	v1 := router.Group("/api/v1")
+	v1.Use(gin.Logger(), gin.Recovery())
+	v1.Use(middleware.Authentication(config.JWTPublicKey))
+
+	resource := v1.Group("/resource")
+	consentGetter := routerConfig.Admission.GetPatientConsent
+	resource.Use(middleware.Authorization(datastruct.DOKTER))
+
+	inpatient := resource.Group("/inpatient")
+
+	ap := middleware.AcceptableParams{
+		Queries: []string{},
+	}
+
+	inpatient.POST("/ward",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.CreateWardHandler())
+
+	inpatient.GET("/ward",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.GetAllWardHandler())
+
+	inpatient.GET("/ward/occupancy",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.WardOccupancyHandler())
+
+	inpatient.GET("/ward/:wardId",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.GetWardHandler())
+
+	inpatient.PUT("/ward/:wardId",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.UpdateWardHandler())
+
+	inpatient.POST("/bed",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.CreateBedHandler())
+
+	inpatient.GET("/bed",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"id_bangsal", "kode_kamar", "status"}}),
+		routerConfig.Ward.GetAllBedHandler())
+
+	inpatient.POST("/bed/:bedId/available",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.TransitionBedHandler(datastruct.BED_TERSEDIA))
+
+	inpatient.POST("/bed/:bedId/inactive",
+		middleware.Sanitize(ap),
+		routerConfig.Ward.TransitionBedHandler(datastruct.BED_TIDAK_AKTIF))
+
+	inpatient.POST("/admission",
+		middleware.Sanitize(ap),
+		routerConfig.Admission.CreateAdmissionHandler())
+
+	inpatient.GET("/admission/patient/:noIHS",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(middleware.AcceptableParams{Queries: append([]string{"status"}, pagination.Queries...)}),
+		routerConfig.Admission.GetPatientAdmissionHandler())
+
+	inpatient.GET("/admission/:noIHS/:admissionId",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.Admission.GetAdmissionHandler())
+
+	inpatient.POST("/admission/:noIHS/:admissionId/transfer",
+		middleware.Sanitize(ap),
+		routerConfig.Admission.TransferAdmissionHandler())
+
+	inpatient.POST("/admission/:noIHS/:admissionId/discharge",
+		middleware.Sanitize(ap),
+		routerConfig.Admission.DischargeAdmissionHandler())
+
+	inpatient.POST("/admission/:noIHS/:admissionId/progress-note",
+		middleware.Sanitize(ap),
+		routerConfig.Admission.CreateProgressNoteHandler())
+
+	inpatient.GET("/admission/:noIHS/:admissionId/progress-note",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(middleware.AcceptableParams{Queries: append([]string{"tanggal"}, pagination.Queries...)}),
+		routerConfig.Admission.GetProgressNoteHandler())
+
+	ap2 := middleware.AcceptableParams{
+		Queries: pagination.Queries,
+	}
+
+	for _, serviceName := range []datastruct.ServiceName{datastruct.LABORATORY, datastruct.RADIOLOGY, datastruct.PHARMACY} {
+		path := "/admission/:noIHS/:admissionId/order/" + string(serviceName)
+
+		inpatient.POST(path,
+			middleware.Sanitize(ap),
+			routerConfig.Admission.OrderHandler(serviceName))
+
+		inpatient.GET(path,
+			middleware.GetConsent(consentGetter),
+			middleware.Sanitize(ap2),
+			routerConfig.Admission.GetOrderHandler(serviceName))
+	}
+
+	return router
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"service-inpatient/config"
+	"service-inpatient/datastruct"
+	"service-inpatient/logger"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceError is returned when another service answered with an error
+// status, so callers can act on the status and body it sent.
+type ServiceError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (serviceError *ServiceError) Error() string {
+	return fmt.Sprintf("error creating request | %s - %s", serviceError.Status, serviceError.Body)
+}
+
+type Getter struct {
+	NoIHS       string
+	RefID       string
+	ServiceName datastruct.ServiceName
+}
+
+func serviceURL(serviceName datastruct.ServiceName) (string, error) {
+	switch serviceName {
+	case datastruct.LABORATORY:
+		return config.LabServiceURL, nil
+	case datastruct.RADIOLOGY:
+		return config.RadiologyServiceURL, nil
+	case datastruct.PHARMACY:
+		return config.PharmacyServiceURL, nil
+	default:
+		return "", fmt.Errorf("service %s undefined", serviceName)
+	}
+}
+
+func PostRequest(c *gin.Context, serviceName datastruct.ServiceName, body []byte) (string, error) {
+	bufferBytes := bytes.NewBuffer(body)
+
+	serviceUrl, err := serviceURL(serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := http.NewRequest(
+		"POST",
+		fmt.Sprintf("%s/api/v1/request/%s", serviceUrl, serviceName),
+		bufferBytes,
+	)
+	req.Header.Add("Authorization", c.GetHeader("Authorization"))
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.LogError.Println("Failed to find EOF in response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", GenerateError(resp, string(respBody))
+	}
+
+	sb := strings.Trim(string(respBody), "\\\"")
+	return sb, nil
+}
+
+func (g *Getter) GetRequest(c *gin.Context) ([]byte, error) {
+	serviceUrl, err := serviceURL(g.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/api/v1/request/%s/%s/%s", serviceUrl, g.ServiceName, g.NoIHS, g.RefID),
+		nil,
+	)
+	req.Header.Add("Authorization", c.GetHeader("Authorization"))
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.LogPanic.Panicln("Failed to find EOF in response")
+	}
+
+	return respBody, nil
+}
+
+// ListRequest gets a page of the records the service keeps on the patient,
+// as the doctor sees them.
+func ListRequest(c *gin.Context, serviceName datastruct.ServiceName, noIHS string, query url.Values) ([]byte, error) {
+	serviceUrl, err := serviceURL(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/api/v1/request/%s/%s?%s", serviceUrl, serviceName, url.PathEscape(noIHS), query.Encode()),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", c.GetHeader("Authorization"))
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, GenerateError(resp, string(respBody))
+	}
+
+	return respBody, nil
+}
+
+// EncounterRequest calls the encounter API of the outpatient service, which
+// keeps the encounters of the stays, as the doctor making the change.
+func EncounterRequest(c *gin.Context, method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(
+		method,
+		fmt.Sprintf("%s/api/v1/resource%s", config.OutpatientServiceURL, path),
+		bytes.NewBuffer(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", c.GetHeader("Authorization"))
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, GenerateError(resp, string(respBody))
+	}
+
+	return respBody, nil
+}
+
+func GenerateError(response *http.Response, respBody string) error {
+	return &ServiceError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Body:       respBody,
+	}
+}
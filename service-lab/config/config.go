@@ -19,6 +19,25 @@ var (
 	RSAPublicKey  string
 
 	TimestampSkew int
+
+	CriticalAlertNotifier          string
+	CriticalAlertWebhookURL        string
+	CriticalAlertAckTimeout        int
+	CriticalAlertCheckInterval     int
+	CriticalAlertMaxEscalation     int
+	CriticalAlertEscalationContact string
+
+	FacilityName      string
+	FacilityAddress   string
+	FacilityPhone     string
+	FacilityEmail     string
+	FacilityLogo      string
+	DocumentVerifyURL string
+
+	AuthServiceURL     string
+	AuthServiceTimeout int
+
+	BlindIndexKey string
 )
 
 type Config struct {
@@ -46,6 +65,25 @@ type Config struct {
 	RSAPublicKey  string `envconfig:"RSA_PUBLIC_KEY" default:""`
 
 	TimestampSkew int `envconfig:"TIMESTAMP_SKEW" default:"5000"` //ms
+
+	CriticalAlertNotifier          string `envconfig:"CRITICAL_ALERT_NOTIFIER" default:"log"`      // log | webhook
+	CriticalAlertWebhookURL        string `envconfig:"CRITICAL_ALERT_WEBHOOK_URL" default:""`      // may contain {client_id}
+	CriticalAlertAckTimeout        int    `envconfig:"CRITICAL_ALERT_ACK_TIMEOUT" default:"900"`   //s
+	CriticalAlertCheckInterval     int    `envconfig:"CRITICAL_ALERT_CHECK_INTERVAL" default:"60"` //s
+	CriticalAlertMaxEscalation     int    `envconfig:"CRITICAL_ALERT_MAX_ESCALATION" default:"3"`
+	CriticalAlertEscalationContact string `envconfig:"CRITICAL_ALERT_ESCALATION_CONTACT" default:""`
+
+	FacilityName      string `envconfig:"FACILITY_NAME" default:"Fasilitas Pelayanan Kesehatan"`
+	FacilityAddress   string `envconfig:"FACILITY_ADDRESS" default:""`
+	FacilityPhone     string `envconfig:"FACILITY_PHONE" default:""`
+	FacilityEmail     string `envconfig:"FACILITY_EMAIL" default:""`
+	FacilityLogo      string `envconfig:"FACILITY_LOGO" default:""` // png or jpeg file
+	DocumentVerifyURL string `envconfig:"DOCUMENT_VERIFY_URL" default:"http://localhost:8081/verify"`
+
+	AuthServiceURL     string `envconfig:"AUTH_SERVICE_URL" default:"http://localhost:8080"` // signs documents with the keys of clinicians
+	AuthServiceTimeout int    `envconfig:"AUTH_SERVICE_TIMEOUT" default:"10"`                //s
+
+	BlindIndexKey string `envconfig:"BLIND_INDEX_KEY" default:""` // secret, base64 format, searches encrypted fields
 }
 
 func Get() Config {
@@ -59,6 +97,25 @@ func Get() Config {
 
 	TimestampSkew = cfg.TimestampSkew
 
+	CriticalAlertNotifier = cfg.CriticalAlertNotifier
+	CriticalAlertWebhookURL = cfg.CriticalAlertWebhookURL
+	CriticalAlertAckTimeout = cfg.CriticalAlertAckTimeout
+	CriticalAlertCheckInterval = cfg.CriticalAlertCheckInterval
+	CriticalAlertMaxEscalation = cfg.CriticalAlertMaxEscalation
+	CriticalAlertEscalationContact = cfg.CriticalAlertEscalationContact
+
+	FacilityName = cfg.FacilityName
+	FacilityAddress = cfg.FacilityAddress
+	FacilityPhone = cfg.FacilityPhone
+	FacilityEmail = cfg.FacilityEmail
+	FacilityLogo = cfg.FacilityLogo
+	DocumentVerifyURL = cfg.DocumentVerifyURL
+
+	AuthServiceURL = cfg.AuthServiceURL
+	AuthServiceTimeout = cfg.AuthServiceTimeout
+
+	BlindIndexKey = cfg.BlindIndexKey
+
 	cfg.DBUser = url.QueryEscape(cfg.DBUser)
 	cfg.DBPassword = url.QueryEscape(cfg.DBPassword)
 
@@ -94,6 +151,16 @@ func AccessSecret(cfg *Config) {
 	cfg.SAPrivateKey = string(secretSaPrivate.Payload.Data)
 	cfg.RSAPrivateKey = string(secretRsaPrivate.Payload.Data)
 	cfg.DBPassword = string(secretDbPrivate.Payload.Data)
+
+	// without the key encrypted fields are not searchable
+	if cfg.BlindIndexKey != "" {
+		secretBlindIndex, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.BlindIndexKey, cfg.SecretVersion).
+			AccessSecretResource(client)
+		if err != nil {
+			logger.LogFatal.Fatalf("failed to access blind index key secret: %v", err)
+		}
+		cfg.BlindIndexKey = string(secretBlindIndex.Payload.Data)
+	}
 }
 
 func AccessKeyFromFile(keyName string) string {
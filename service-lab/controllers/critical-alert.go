@@ -0,0 +1,455 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"service-lab/config"
+	"service-lab/datastruct"
+	"service-lab/datastruct/laboratory"
+	"service-lab/db/csfle"
+	"service-lab/logger"
+	"service-lab/notifier"
+	"service-lab/pagination"
+	"service-lab/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AlertController struct {
+	AlertCollection *mongo.Collection
+	Notifier        notifier.Notifier
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+}
+
+func InitAlertController(client *mongo.Client, csfle *csfle.CSFLE) *AlertController {
+	return &AlertController{
+		AlertCollection: client.Database("fasyankes").Collection("lab_alert"),
+		Notifier:        notifier.New(config.CriticalAlertNotifier, config.CriticalAlertWebhookURL),
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+	}
+}
+
+func ackTimeout() time.Duration {
+	return time.Duration(config.CriticalAlertAckTimeout) * time.Second
+}
+
+// sealAlert encrypts the confidential part of the alert, when present, and
+// signs the document.
+func (alertController *AlertController) sealAlert(alert *laboratory.CriticalAlert) error {
+	id := alert.ID
+
+	if alert.ConfidentialData != nil {
+		alert.ConfidentialEncrypted = utils.EncryptRandom(
+			alert.ConfidentialData,
+			alertController.ClientEncryption,
+			alertController.EncryptionOpts,
+		)
+		alert.ConfidentialData = nil
+	}
+	alert.Signature = nil
+	alert.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	alert.Signature = &signature
+	alert.ID = id
+
+	return nil
+}
+
+// deliver sends the alert to the given client and records the attempt.
+func (alertController *AlertController) deliver(alert *laboratory.CriticalAlert, data *laboratory.ConfidentialAlertData, clientID string, now time.Time) {
+	msg := notifier.Message{
+		AlertID:         alert.ID.Hex(),
+		NoIHS:           alert.NoIHS,
+		ClientID:        clientID,
+		Penerima:        data.DokterPengirim,
+		NoTelpPenerima:  data.NoTelpDokterPengirim,
+		Judul:           fmt.Sprintf("Nilai kritis: %s", alert.NamaPemeriksaan),
+		Isi:             data.Summary(),
+		TingkatEskalasi: alert.TingkatEskalasi,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	delivery := laboratory.AlertDelivery{
+		TingkatEskalasi: alert.TingkatEskalasi,
+		Penerima:        clientID,
+		Notifier:        alertController.Notifier.Name(),
+		Berhasil:        true,
+		Waktu:           now,
+	}
+
+	if err := alertController.Notifier.Notify(ctx, msg); err != nil {
+		logger.LogError.Printf("Failed to deliver critical alert [%s] to %s: %v\n", alert.ID.Hex(), clientID, err)
+		delivery.Berhasil = false
+		delivery.Galat = err.Error()
+	}
+
+	alert.RiwayatPengiriman = append(alert.RiwayatPengiriman, delivery)
+}
+
+// NewCriticalAlert builds the sealed alert for a validated critical result,
+// so it can be stored together with the status change. It is delivered
+// once stored, see Dispatch.
+func (alertController *AlertController) NewCriticalAlert(c *gin.Context, order *laboratory.LaboratoryData, data *laboratory.ConfidentialLabData, now time.Time) (*laboratory.CriticalAlert, error) {
+	alert := laboratory.CriticalAlert{
+		ID:              primitive.NewObjectID(),
+		ClientID:        order.RequestingClient(),
+		ClientPemeriksa: c.GetString("userClient"),
+		NoIHS:           order.NoIHS,
+		IDPemeriksaan:   order.ID,
+		NamaPemeriksaan: order.NamaPemeriksaan,
+		Status:          datastruct.ALERT_SENT,
+		BatasKonfirmasi: now.Add(ackTimeout()),
+		CreatedAt:       &now,
+		UpdatedAt:       &now,
+		ConfidentialData: &laboratory.ConfidentialAlertData{
+			DokterPengirim:       data.DokterPengirim,
+			NoTelpDokterPengirim: data.NoTelpDokterPengirim,
+			HasilPemeriksaan:     data.HasilPemeriksaan,
+			InterpretasiHasil:    data.InterpretasiHasil,
+		},
+	}
+
+	for i := 0; i < len(data.HasilAnalit); i++ {
+		if data.HasilAnalit[i].Kritis {
+			alert.ConfidentialData.HasilAnalitKritis = append(alert.ConfidentialData.HasilAnalitKritis, data.HasilAnalit[i])
+		}
+	}
+
+	if err := alertController.sealAlert(&alert); err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+// notify delivers a stored alert to the ordering client, without raising
+// its escalation level, and records the attempt.
+func (alertController *AlertController) notify(alert *laboratory.CriticalAlert, now time.Time) error {
+	var data laboratory.ConfidentialAlertData
+	utils.Decrypt(
+		alert.ConfidentialEncrypted,
+		alertController.ClientEncryption,
+	).Unmarshal(&data)
+
+	previousUpdate := alert.UpdatedAt
+	alertController.deliver(alert, &data, alert.ClientID, now)
+	alert.UpdatedAt = &now
+
+	if err := alertController.sealAlert(alert); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":        alert.ID,
+		"status":     bson.M{"$ne": datastruct.ALERT_ACKNOWLEDGED},
+		"updated_at": previousUpdate,
+	}
+
+	alert.ID = primitive.NilObjectID
+	_, err := alertController.AlertCollection.UpdateOne(context.Background(), filter, bson.M{"$set": alert})
+	return err
+}
+
+// Dispatch delivers a newly stored alert in the background. An alert that
+// could not be delivered is sent again by RunEscalation.
+func (alertController *AlertController) Dispatch(alert laboratory.CriticalAlert) {
+	go func() {
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		id := alert.ID
+		if err := alertController.notify(&alert, now); err != nil {
+			logger.LogError.Printf("Failed to record delivery of critical alert [%s]: %v\n", id.Hex(), err)
+		}
+	}()
+}
+
+func (alertController *AlertController) getAlerts(c *gin.Context, filter bson.M) {
+	if status := c.Query("status"); status != "" {
+		var alertStatus datastruct.CriticalAlertStatus
+		if _, err := fmt.Sscan(status, &alertStatus); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter["status"] = alertStatus
+	}
+
+	params, err := pagination.Parse(c.Request.URL.Query())
+	if err != nil {
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params.Filter(filter)
+
+	total, err := alertController.AlertCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	params.PageFilter(filter)
+
+	cursor, err := alertController.AlertCollection.Find(context.Background(), filter, params.FindOptions())
+	if err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	alerts := []laboratory.CriticalAlert{}
+	var last primitive.ObjectID
+	read, more := int64(0), false
+	for cursor.Next(context.Background()) {
+		if read == params.Limit {
+			more = true
+			break
+		}
+		read++
+
+		var alert laboratory.CriticalAlert
+		if err := cursor.Decode(&alert); err != nil {
+			logger.LogError.Printf("Failed to decode critical alert: %v\n", err)
+			continue
+		}
+		last = alert.ID
+
+		id := alert.ID
+		signature := alert.Signature
+		alert.Signature = nil
+		alert.ID = primitive.NilObjectID
+
+		dataByte, err := json.Marshal(alert)
+		if err != nil {
+			logger.LogPanic.Panicf("Failed to marshal json data")
+		}
+
+		_, err = utils.VerifySignature(string(dataByte), *signature)
+		if err != nil {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+		}
+
+		utils.Decrypt(
+			alert.ConfidentialEncrypted,
+			alertController.ClientEncryption,
+		).Unmarshal(&alert.ConfidentialData)
+
+		alert.ConfidentialEncrypted = nil
+		alert.Signature = signature
+		alert.ID = id
+
+		alerts = append(alerts, alert)
+	}
+
+	if err := cursor.Err(); err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, params.Page(alerts, total, last, more))
+}
+
+// GetClinicianAlertsHandler lists the alerts routed to the caller's client.
+func (alertController *AlertController) GetClinicianAlertsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alertController.getAlerts(c, bson.M{"client_id": c.GetString("userClient")})
+	}
+}
+
+// GetLaboratoryAlertsHandler lists the alerts raised by the caller's laboratory.
+func (alertController *AlertController) GetLaboratoryAlertsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alertController.getAlerts(c, bson.M{"client_pemeriksa": c.GetString("userClient")})
+	}
+}
+
+func (alertController *AlertController) AcknowledgeAlertHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body laboratory.AlertAcknowledgementBody
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(c.Param("alertId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":       id,
+			"client_id": c.GetString("userClient"),
+		}
+
+		var alert laboratory.CriticalAlert
+		err = alertController.AlertCollection.FindOne(context.Background(), filter).Decode(&alert)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if alert.Status == datastruct.ALERT_ACKNOWLEDGED {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": laboratory.AlertAcknowledgedError.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previous := alert.Status
+
+		alert.Status = datastruct.ALERT_ACKNOWLEDGED
+		alert.DikonfirmasiOleh = c.GetString("userIdentification")
+		alert.WaktuKonfirmasi = &now
+		alert.CatatanKonfirmasi = body.Catatan
+		alert.UpdatedAt = &now
+
+		if err := alertController.sealAlert(&alert); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter["status"] = previous
+		alert.ID = primitive.NilObjectID
+		result, err := alertController.AlertCollection.UpdateOne(context.Background(), filter, bson.M{"$set": alert})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "critical alert was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": "critical alert acknowledged"})
+	}
+}
+
+// escalate re-sends an overdue alert to the ordering client and, when
+// configured, to the escalation contact, then pushes the deadline back.
+func (alertController *AlertController) escalate(alert *laboratory.CriticalAlert, now time.Time) error {
+	var data laboratory.ConfidentialAlertData
+	utils.Decrypt(
+		alert.ConfidentialEncrypted,
+		alertController.ClientEncryption,
+	).Unmarshal(&data)
+
+	previousLevel := alert.TingkatEskalasi
+	alert.TingkatEskalasi++
+	alert.Status = datastruct.ALERT_ESCALATED
+
+	alertController.deliver(alert, &data, alert.ClientID, now)
+	if config.CriticalAlertEscalationContact != "" {
+		alertController.deliver(alert, &data, config.CriticalAlertEscalationContact, now)
+	}
+
+	alert.BatasKonfirmasi = now.Add(ackTimeout())
+	alert.UpdatedAt = &now
+
+	if err := alertController.sealAlert(alert); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":              alert.ID,
+		"status":           bson.M{"$ne": datastruct.ALERT_ACKNOWLEDGED},
+		"tingkat_eskalasi": previousLevel,
+	}
+
+	alert.ID = primitive.NilObjectID
+	_, err := alertController.AlertCollection.UpdateOne(context.Background(), filter, bson.M{"$set": alert})
+	return err
+}
+
+// redeliver sends again the alerts that were stored at least one interval
+// ago but never reached the ordering client.
+func (alertController *AlertController) redeliver(interval time.Duration, now time.Time) {
+	filter := bson.M{
+		"status":                      datastruct.ALERT_SENT,
+		"tingkat_eskalasi":            0,
+		"riwayat_pengiriman.berhasil": bson.M{"$ne": true},
+		"created_at":                  bson.M{"$lte": now.Add(-interval)},
+	}
+
+	cursor, err := alertController.AlertCollection.Find(context.Background(), filter)
+	if err != nil {
+		logger.LogError.Printf("Failed to find undelivered critical alerts: %v\n", err)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var alert laboratory.CriticalAlert
+		if err := cursor.Decode(&alert); err != nil {
+			logger.LogError.Printf("Failed to decode critical alert: %v\n", err)
+			continue
+		}
+
+		id := alert.ID
+		if err := alertController.notify(&alert, now); err != nil {
+			logger.LogError.Printf("Failed to redeliver critical alert [%s]: %v\n", id.Hex(), err)
+		}
+	}
+}
+
+// RunEscalation periodically sends again the alerts that could not be
+// delivered and escalates those that passed their acknowledgement deadline,
+// up to the configured number of times.
+func (alertController *AlertController) RunEscalation(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		alertController.redeliver(interval, now)
+
+		filter := bson.M{
+			"status":           bson.M{"$in": bson.A{datastruct.ALERT_SENT, datastruct.ALERT_ESCALATED}},
+			"batas_konfirmasi": bson.M{"$lte": now},
+			"tingkat_eskalasi": bson.M{"$lt": config.CriticalAlertMaxEscalation},
+		}
+
+		cursor, err := alertController.AlertCollection.Find(context.Background(), filter)
+		if err != nil {
+			logger.LogError.Printf("Failed to find overdue critical alerts: %v\n", err)
+			continue
+		}
+
+		for cursor.Next(context.Background()) {
+			var alert laboratory.CriticalAlert
+			if err := cursor.Decode(&alert); err != nil {
+				logger.LogError.Printf("Failed to decode critical alert: %v\n", err)
+				continue
+			}
+
+			id := alert.ID
+			if err := alertController.escalate(&alert, now); err != nil {
+				logger.LogError.Printf("Failed to escalate critical alert [%s]: %v\n", id.Hex(), err)
+			}
+		}
+
+		cursor.Close(context.Background())
+	}
+}
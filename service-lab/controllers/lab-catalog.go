@@ -0,0 +1,406 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"service-lab/datastruct/laboratory"
+	"service-lab/pagination"
+	"service-lab/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (labController *LabController) findLabTest(code string) (*laboratory.LabTest, error) {
+	var labTest laboratory.LabTest
+	err := labController.CatalogCollection.FindOne(context.Background(), bson.M{"kode_loinc": code}).Decode(&labTest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, laboratory.LabTestNotFoundError
+		}
+		return nil, err
+	}
+
+	return &labTest, nil
+}
+
+func (labController *LabController) findLabTests(codes []string) (map[string]*laboratory.LabTest, error) {
+	cursor, err := labController.CatalogCollection.Find(context.Background(), bson.M{"kode_loinc": bson.M{"$in": codes}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var labTests []laboratory.LabTest
+	if err := cursor.All(context.Background(), &labTests); err != nil {
+		return nil, err
+	}
+
+	result := map[string]*laboratory.LabTest{}
+	for i := 0; i < len(labTests); i++ {
+		result[labTests[i].KodeLOINC] = &labTests[i]
+	}
+
+	for i := 0; i < len(codes); i++ {
+		if _, ok := result[codes[i]]; !ok {
+			return nil, fmt.Errorf("%w: %s", laboratory.LabTestNotFoundError, codes[i])
+		}
+	}
+
+	return result, nil
+}
+
+// resolveLabTest makes sure a coded order points to a catalog entry, takes
+// the examination name from it and lays out the analytes of a panel. It
+// returns the analyte codes to be stored alongside the order.
+func (labController *LabController) resolveLabTest(code string, name *string, analytes *[]laboratory.AnalyteResult) ([]string, error) {
+	if code != "" {
+		labTest, err := labController.findLabTest(code)
+		if err != nil {
+			return nil, err
+		}
+
+		*name = labTest.NamaPemeriksaan
+
+		if labTest.IsPanel() && len(*analytes) == 0 {
+			components, err := labController.findLabTests(labTest.Komponen)
+			if err != nil {
+				return nil, err
+			}
+
+			for i := 0; i < len(labTest.Komponen); i++ {
+				*analytes = append(*analytes, laboratory.NewAnalyteResult(components[labTest.Komponen[i]]))
+			}
+		}
+	}
+
+	if len(*analytes) == 0 {
+		return nil, nil
+	}
+
+	return laboratory.AnalyteCodes(*analytes)
+}
+
+// evaluateResult computes the normality of entered results from the catalog.
+// Uncoded single results keep the manually entered values. A final
+// evaluation, done when the order is validated, requires every result.
+func (labController *LabController) evaluateResult(code string, data *laboratory.ConfidentialLabData, final bool) error {
+	at := data.WaktuPermintaan
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	if len(data.HasilAnalit) > 0 {
+		codes, err := laboratory.AnalyteCodes(data.HasilAnalit)
+		if err != nil {
+			return err
+		}
+
+		labTests, err := labController.findLabTests(codes)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(data.HasilAnalit); i++ {
+			analyte := &data.HasilAnalit[i]
+			if !analyte.HasValue() {
+				if final {
+					return laboratory.PanelIncompleteError
+				}
+				continue
+			}
+
+			if final && analyte.Validator == "" {
+				return laboratory.PanelIncompleteError
+			}
+
+			if err := analyte.Evaluate(labTests[analyte.KodeLOINC], data.JenisKelamin, data.TanggalLahir, at); err != nil {
+				return fmt.Errorf("%s: %w", analyte.KodeLOINC, err)
+			}
+		}
+
+		return nil
+	}
+
+	result := &data.HasilPemeriksaan
+	if result.NilaiHasil == "" {
+		if final {
+			return laboratory.ResultRequiredError
+		}
+		return nil
+	}
+
+	if code == "" {
+		if result.NilaiNormal == 0 {
+			return laboratory.NormalityRequiredError
+		}
+		return nil
+	}
+
+	labTest, err := labController.findLabTest(code)
+	if err != nil {
+		return err
+	}
+
+	return labTest.Evaluate(result, data.JenisKelamin, data.TanggalLahir, at)
+}
+
+// validatePanel makes sure the components of a panel are registered single
+// analytes.
+func (labController *LabController) validatePanel(labTest *laboratory.LabTest) error {
+	if !labTest.IsPanel() {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < len(labTest.Komponen); i++ {
+		if seen[labTest.Komponen[i]] {
+			return laboratory.AnalyteDuplicateError
+		}
+		seen[labTest.Komponen[i]] = true
+	}
+
+	components, err := labController.findLabTests(labTest.Komponen)
+	if err != nil {
+		return err
+	}
+
+	for code, component := range components {
+		if component.IsPanel() || code == labTest.KodeLOINC {
+			return laboratory.NestedPanelError
+		}
+	}
+
+	return nil
+}
+
+func (labController *LabController) GetLabCatalogHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{}
+
+		if q := c.Query("q"); q != "" {
+			regex := primitive.Regex{
+				Pattern: regexp.QuoteMeta(q),
+				Options: "i",
+			}
+
+			filter["$or"] = bson.A{
+				bson.M{"nama_pemeriksaan": regex},
+				bson.M{"kode_loinc": regex},
+			}
+		}
+
+		if specimen := c.Query("jenis_spesimen"); specimen != "" {
+			filter["jenis_spesimen"] = specimen
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := labController.CatalogCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := labController.CatalogCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		labTests := []laboratory.LabTest{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var labTest laboratory.LabTest
+			if err := cursor.Decode(&labTest); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = labTest.ID
+			labTests = append(labTests, labTest)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(labTests, total, last, more))
+	}
+}
+
+func (labController *LabController) GetLabTestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		labTest, err := labController.findLabTest(c.Param("kode"))
+		if err != nil {
+			if errors.Is(err, laboratory.LabTestNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, labTest)
+	}
+}
+
+func (labController *LabController) CreateLabTestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var labTest laboratory.LabTest
+		if err := c.ShouldBindJSON(&labTest); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := labTest.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := labController.validatePanel(&labTest); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := labController.findLabTest(labTest.KodeLOINC)
+		if err == nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": laboratory.LabTestDuplicateError.Error()})
+			return
+		} else if !errors.Is(err, laboratory.LabTestNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		labTest.ID = primitive.NilObjectID
+		labTest.ClientID = c.GetString("userClient")
+		labTest.CreatedAt = &now
+		labTest.UpdatedAt = &now
+
+		if _, err := labController.CatalogCollection.InsertOne(context.Background(), labTest); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": laboratory.LabTestDuplicateError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{"message": "Lab test created successfully"})
+	}
+}
+
+func (labController *LabController) UpdateLabTestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var labTest laboratory.LabTest
+		if err := c.ShouldBindJSON(&labTest); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := labTest.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := labController.validatePanel(&labTest); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		code := c.Param("kode")
+		if labTest.KodeLOINC != code {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "kode_loinc cannot be changed"})
+			return
+		}
+
+		existing, err := labController.findLabTest(code)
+		if err != nil {
+			if errors.Is(err, laboratory.LabTestNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		labTest.ID = primitive.NilObjectID
+		labTest.ClientID = existing.ClientID
+		labTest.CreatedAt = existing.CreatedAt
+		labTest.UpdatedAt = &now
+
+		result, err := labController.CatalogCollection.UpdateOne(context.Background(), bson.M{"_id": existing.ID}, bson.M{"$set": labTest})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d lab test updated successfully", result.ModifiedCount)})
+	}
+}
+
+func (labController *LabController) DeleteLabTestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Param("kode")
+
+		// orders refer to a test as the examination or as one of its analytes
+		inUse, err := labController.FaskesCollection.CountDocuments(context.Background(), bson.M{
+			"$or": bson.A{
+				bson.M{"kode_pemeriksaan": code},
+				bson.M{"kode_analit": code},
+			},
+		})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if inUse > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "lab test is still referenced by lab orders"})
+			return
+		}
+
+		inPanel, err := labController.CatalogCollection.CountDocuments(context.Background(), bson.M{"komponen": code})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if inPanel > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "lab test is still a component of a panel"})
+			return
+		}
+
+		result, err := labController.CatalogCollection.DeleteOne(context.Background(), bson.M{"kode_loinc": code})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d lab test deleted successfully", result.DeletedCount)})
+	}
+}
@@ -0,0 +1,511 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"service-lab/datastruct"
+	"service-lab/datastruct/laboratory"
+	"service-lab/logger"
+	"service-lab/signing"
+	"service-lab/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var labOrderModifiedError = errors.New("lab order was modified by another request")
+
+type LabTurnaroundReport struct {
+	JumlahPesanan           int      `json:"jumlah_pesanan"`
+	RerataPermintaanKeHasil *float64 `json:"rerata_permintaan_ke_hasil"`
+	RerataPenerimaanKeHasil *float64 `json:"rerata_penerimaan_ke_hasil"`
+	RerataHasilKeKonfirmasi *float64 `json:"rerata_hasil_ke_konfirmasi"`
+}
+
+func NewStatusHistory(c *gin.Context, status datastruct.LabOrderStatus, reason string, now time.Time) laboratory.LabStatusHistory {
+	return laboratory.LabStatusHistory{
+		Status:   status,
+		Petugas:  c.GetString("userIdentification"),
+		Peran:    datastruct.RoleType(c.GetString("userRole")),
+		ClientID: c.GetString("userClient"),
+		Alasan:   reason,
+		Waktu:    now,
+	}
+}
+
+// findLabOrder loads a lab order the caller may act on, either through
+// patient consent or because the order belongs to (or is open to) its client.
+func (labController *LabController) findLabOrder(c *gin.Context) (*laboratory.LaboratoryData, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("Id"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":    id,
+		"no_ihs": c.Param("noIHS"),
+	}
+
+	if !c.GetBool("patientConsent") {
+		filter["$or"] = bson.A{
+			bson.M{"client_id": c.GetString("userClient")},
+			bson.M{"client_id": ""},
+		}
+	}
+
+	var data laboratory.LaboratoryData
+	if err := labController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// sealLabData encrypts the confidential part of the document and signs it.
+// NIK is left untouched since it is stored with deterministic encryption.
+func (labController *LabController) sealLabData(data *laboratory.LaboratoryData) error {
+	id := data.ID
+
+	data.Index(labController.BlindIndex)
+	data.ConfidentialEncrypted = utils.EncryptRandom(
+		data.ConfidentialData,
+		labController.ClientEncryption,
+		labController.EncryptionOpts,
+	)
+	data.ConfidentialData = nil
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// commitTransition writes the new status of the order and, when the result
+// is critical, its alert in one transaction.
+func (labController *LabController) commitTransition(filter bson.M, data *laboratory.LaboratoryData, alert *laboratory.CriticalAlert) error {
+	session, err := labController.FaskesCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(ctx mongo.SessionContext) (interface{}, error) {
+		result, err := labController.FaskesCollection.UpdateOne(ctx, filter, bson.M{"$set": data})
+		if err != nil {
+			return nil, err
+		}
+
+		if result.MatchedCount == 0 {
+			return nil, labOrderModifiedError
+		}
+
+		if alert != nil {
+			if _, err := labController.AlertController.AlertCollection.InsertOne(ctx, alert); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (labController *LabController) TransitionLabOrderHandler(target datastruct.LabOrderStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body laboratory.LabOrderTransitionBody
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(target); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := labController.findLabOrder(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		current := data.CurrentStatus()
+		err = laboratory.CheckTransition(current, target, datastruct.RoleType(c.GetString("userRole")))
+		if errors.Is(err, laboratory.TransitionRoleError) {
+			utils.JSON(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": fmt.Sprintf("%s: %s -> %s", err.Error(),
+				laboratory.LabOrderStatusString(current),
+				laboratory.LabOrderStatusString(target),
+			)})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			labController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+
+		body.Apply(target, data.ConfidentialData, now)
+
+		if target == datastruct.VALIDATED {
+			if err := labController.evaluateResult(data.KodePemeriksaan, data.ConfidentialData, true); err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if len(data.ConfidentialData.HasilAnalit) > 0 {
+				data.KodeAnalit, _ = laboratory.AnalyteCodes(data.ConfidentialData.HasilAnalit)
+			}
+		}
+
+		data.StatusPemeriksaan = target
+		data.RiwayatStatus = append(data.RiwayatStatus, NewStatusHistory(c, target, body.Alasan, now))
+		data.UpdatedAt = &now
+
+		// a critical result is stored with its alert, so it cannot be
+		// validated without one
+		var alert *laboratory.CriticalAlert
+		if target == datastruct.VALIDATED && data.ConfidentialData.HasCriticalResult() {
+			alert, err = labController.AlertController.NewCriticalAlert(c, data, data.ConfidentialData, now)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := labController.sealLabData(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// guard against a concurrent transition on the same order
+		filter := bson.M{"_id": data.ID}
+		if current == datastruct.REQUESTED {
+			filter["status_pemeriksaan"] = bson.M{"$in": bson.A{nil, datastruct.REQUESTED}}
+		} else {
+			filter["status_pemeriksaan"] = current
+		}
+
+		data.ID = primitive.NilObjectID
+		if err := labController.commitTransition(filter, data, alert); err != nil {
+			if errors.Is(err, labOrderModifiedError) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := gin.H{
+			"message":            fmt.Sprintf("lab order status changed to %s", laboratory.LabOrderStatusString(target)),
+			"status_pemeriksaan": target,
+		}
+
+		if alert != nil {
+			labController.AlertController.Dispatch(*alert)
+			response["id_peringatan_kritis"] = alert.ID.Hex()
+		}
+
+		utils.JSON(c, http.StatusOK, response)
+	}
+}
+
+func (labController *LabController) GetLabOrderTurnaroundHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := labController.findLabOrder(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{
+			"status_pemeriksaan": data.CurrentStatus(),
+			"riwayat_status":     data.RiwayatStatus,
+			"turnaround":         data.Turnaround(),
+		})
+	}
+}
+
+// GetTurnaroundReportHandler averages turnaround times over the orders the
+// caller's laboratory has worked on within the requested period.
+func (labController *LabController) GetTurnaroundReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"riwayat_status.client_id": c.GetString("userClient")}
+
+		createdAt := bson.M{}
+		if from := c.Query("from"); from != "" {
+			fromTime, err := time.Parse(time.DateOnly, from)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			createdAt["$gte"] = fromTime
+		}
+
+		if to := c.Query("to"); to != "" {
+			toTime, err := time.Parse(time.DateOnly, to)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			createdAt["$lt"] = toTime.AddDate(0, 0, 1)
+		}
+
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+
+		cursor, err := labController.FaskesCollection.Find(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		var report LabTurnaroundReport
+		var totalToResult, totalReceiptToResult, totalToAcknowledge float64
+		var countToResult, countReceiptToResult, countToAcknowledge int
+
+		for cursor.Next(context.Background()) {
+			var data laboratory.LaboratoryData
+			if err := cursor.Decode(&data); err != nil {
+				logger.LogError.Printf("Failed to decode lab order: %v\n", err)
+				continue
+			}
+
+			report.JumlahPesanan++
+			tat := data.Turnaround()
+
+			if tat.PermintaanKePelaporan != nil {
+				totalToResult += *tat.PermintaanKePelaporan
+				countToResult++
+			}
+
+			if tat.PenerimaanKeValidasi != nil && tat.ValidasiKePelaporan != nil {
+				totalReceiptToResult += *tat.PenerimaanKeValidasi + *tat.ValidasiKePelaporan
+				countReceiptToResult++
+			}
+
+			if tat.PelaporanKeKonfirmasi != nil {
+				totalToAcknowledge += *tat.PelaporanKeKonfirmasi
+				countToAcknowledge++
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		average := func(total float64, count int) *float64 {
+			if count == 0 {
+				return nil
+			}
+
+			avg := total / float64(count)
+			return &avg
+		}
+
+		report.RerataPermintaanKeHasil = average(totalToResult, countToResult)
+		report.RerataPenerimaanKeHasil = average(totalReceiptToResult, countReceiptToResult)
+		report.RerataHasilKeKonfirmasi = average(totalToAcknowledge, countToAcknowledge)
+
+		utils.JSON(c, http.StatusOK, report)
+	}
+}
+
+// lockedByLifecycle rejects generic edits once the result has been validated
+// and carries the lifecycle fields, the signature and the encounter over so
+// they survive the overwrite. Results entered for another test are dropped.
+func (labController *LabController) lockedByLifecycle(c *gin.Context, newData *laboratory.LaboratoryData) bool {
+	existing, err := labController.findLabOrder(c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+			return true
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	if existing.IsLocked() {
+		utils.AbortWithStatusJSON(c, http.StatusConflict, gin.H{"error": laboratory.OrderLockedError.Error()})
+		return true
+	}
+
+	utils.Decrypt(
+		existing.ConfidentialEncrypted,
+		labController.ClientEncryption,
+	).Unmarshal(&existing.ConfidentialData)
+
+	newData.ConfidentialData.KeepLifecycle(existing.ConfidentialData)
+	if newData.KodePemeriksaan != existing.KodePemeriksaan {
+		newData.ConfidentialData.HasilAnalit = nil
+	}
+
+	newData.StatusPemeriksaan = existing.StatusPemeriksaan
+	newData.RiwayatStatus = existing.RiwayatStatus
+	newData.IDKunjungan = existing.IDKunjungan
+	newData.TandaTanganDigital = existing.TandaTanganDigital
+
+	return false
+}
+
+// findSignedLabOrder loads a lab order for its digital signature. Orders
+// failing their seal are refused, as the signature would cover content the
+// service can no longer vouch for.
+func (labController *LabController) findSignedLabOrder(c *gin.Context, tampered error) (*laboratory.LaboratoryData, bool) {
+	data, err := labController.findLabOrder(c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !verifiedLabData(data) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+		utils.JSON(c, http.StatusConflict, gin.H{"error": tampered.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		data.ConfidentialEncrypted,
+		labController.ClientEncryption,
+	).Unmarshal(&data.ConfidentialData)
+
+	return data, true
+}
+
+// SignLabResultHandler signs the validated result with the key of the
+// analyst who validated it, who confirms with their password. Only the
+// digest of the result is sent to the auth service.
+func (labController *LabController) SignLabResultHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body laboratory.SignBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, ok := labController.findSignedLabOrder(c, signTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": alreadySignedError.Error()})
+			return
+		}
+
+		err := data.CanBeSignedBy(c.GetString("userIdentification"))
+		if errors.Is(err, laboratory.NotValidatorError) {
+			utils.JSON(c, http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		digest, err := signing.Digest(data.SignedContent())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		signature, err := labController.Signing.Sign(context.Background(), c.GetHeader("Authorization"), body.Password, digest)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		// guard against a concurrent change on the same order
+		filter := bson.M{
+			"_id":        data.ID,
+			"updated_at": data.UpdatedAt,
+		}
+
+		data.TandaTanganDigital = signature
+		data.UpdatedAt = &now
+
+		if err := labController.sealLabData(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data.ID = primitive.NilObjectID
+		result, err := labController.FaskesCollection.UpdateOne(context.Background(), filter, bson.M{"$set": data})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "lab order was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, signature)
+	}
+}
+
+// LabResultSignatureHandler shows who signed the result and whether the
+// signature still holds for the result on record.
+func (labController *LabController) LabResultSignatureHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, ok := labController.findSignedLabOrder(c, checkTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": notSignedError.Error()})
+			return
+		}
+
+		check, err := labController.Signing.Check(
+			context.Background(),
+			c.GetHeader("Authorization"),
+			data.TandaTanganDigital,
+			data.SignedContent(),
+		)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, check)
+	}
+}
@@ -0,0 +1,220 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-lab/config"
+	"service-lab/datastruct/laboratory"
+	"service-lab/document"
+	"service-lab/logger"
+	"service-lab/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const labReportTitle = "Hasil Pemeriksaan Laboratorium"
+
+// verifiedLabData tells whether the stored document still carries a valid
+// signature.
+func verifiedLabData(data *laboratory.LaboratoryData) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+func analyteValue(analyte *laboratory.AnalyteResult) string {
+	switch {
+	case analyte.NilaiNumerik != nil:
+		return strconv.FormatFloat(*analyte.NilaiNumerik, 'f', -1, 64)
+	case analyte.NilaiKode != "":
+		return analyte.NilaiKode
+	default:
+		return analyte.NilaiTeks
+	}
+}
+
+// renderLabReport lays the order out as a result report. Panels list every
+// analyte, single tests only their one result.
+func renderLabReport(letterhead document.Letterhead, data *laboratory.LaboratoryData, now time.Time) (*document.Document, error) {
+	confidential := data.ConfidentialData
+	result := &confidential.HasilPemeriksaan
+
+	pdf := document.New(letterhead, labReportTitle, data.NoRegistrasiLab, now)
+
+	pdf.Section("Identitas Pasien")
+	pdf.Field("No. IHS", data.NoIHS)
+	pdf.Field("Tanggal lahir", document.FormatDate(confidential.TanggalLahir))
+	pdf.Field("Jenis kelamin", confidential.SexString())
+
+	pdf.Section("Permintaan Pemeriksaan")
+	pdf.Field("Dokter pengirim", confidential.DokterPengirim)
+	pdf.Field("Fasyankes pengirim", confidential.NamaFasyankesPengirimPermintaan)
+	pdf.Field("Unit pengirim", confidential.UnitPengirimPermintaan)
+	pdf.Field("Waktu permintaan", document.FormatTime(confidential.WaktuPermintaan))
+	pdf.Field("Prioritas", data.PriorityString())
+	pdf.Field("Diagnosis", confidential.Diagnosis)
+	pdf.Field("Catatan", confidential.CatatanPermintaan)
+
+	pdf.Section("Spesimen")
+	pdf.Field("Sumber spesimen", confidential.SumberSpesimen)
+	pdf.Field("Lokasi pengambilan", confidential.LokasiPengambilanSpesimen)
+	pdf.Field("Waktu pengambilan", document.FormatTime(confidential.WaktuPengambilanSpesimen))
+	pdf.Field("Kondisi spesimen", confidential.KondisiSpesimen)
+
+	pdf.Section("Hasil Pemeriksaan")
+	pdf.Field("Pemeriksaan", data.NamaPemeriksaan)
+	pdf.Field("Fasyankes pemeriksa", data.NamaFasyankesPemeriksa)
+	pdf.Field("Status", data.StatusString())
+
+	if len(confidential.HasilAnalit) > 0 {
+		rows := [][]string{}
+		for i := 0; i < len(confidential.HasilAnalit); i++ {
+			analyte := &confidential.HasilAnalit[i]
+			rows = append(rows, []string{
+				analyte.NamaAnalit,
+				analyteValue(analyte),
+				analyte.Satuan,
+				analyte.NilaiRujukan,
+				laboratory.FlagString(analyte.Flag),
+			})
+		}
+
+		pdf.Table([]document.Column{
+			{Judul: "Pemeriksaan", Lebar: 60},
+			{Judul: "Hasil", Lebar: 30},
+			{Judul: "Satuan", Lebar: 25},
+			{Judul: "Nilai rujukan", Lebar: 50},
+			{Judul: "Flag", Lebar: 15},
+		}, rows)
+		pdf.Paragraph("Flag: N normal, L rendah, H tinggi, LL kritis rendah, HH kritis tinggi, A abnormal.")
+	} else {
+		pdf.Field("Nilai hasil", result.NilaiHasil)
+		pdf.Field("Nilai rujukan", result.NilaiRujukan)
+		pdf.Field("Keterangan", result.NormalResultString())
+	}
+
+	pdf.Section("Interpretasi")
+	pdf.Paragraph(confidential.InterpretasiHasil)
+	pdf.Field("Dokter penginterpretasi", confidential.DokterPenginterpretasiPemeriksaan)
+	pdf.Field("Waktu hasil keluar", document.FormatTime(confidential.WaktuHasilKeluarLab))
+
+	signer := confidential.DokterValidatorPemeriksaan
+	signedAt := resultTime(data)
+	if signature := data.TandaTanganDigital; signature != nil {
+		printDigitalSignature(pdf, signature)
+		signer = signature.Penandatangan
+		signedAt = signature.Waktu
+	}
+
+	if err := pdf.Sign(
+		"Dokter Validator",
+		signer,
+		signedAt,
+		document.VerificationURL(config.DocumentVerifyURL, data.ID.Hex(), *data.Signature),
+	); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
+
+// LabReportHandler prints the result report of an order. Documents failing
+// their signature are not printed, as the printout would claim a signature
+// the document no longer has.
+func (labController *LabController) LabReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := labController.findLabOrder(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verifiedLabData(data) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+			utils.JSON(c, http.StatusConflict, gin.H{"error": documentTamperedError.Error()})
+			return
+		}
+
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			labController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+
+		pdf, err := renderLabReport(labController.Letterhead, data, time.Now())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sendPDF(c, pdf, fmt.Sprintf("hasil-lab-%s", data.ID.Hex()))
+	}
+}
+
+// VerifyLabReportHandler tells the holder of a printed result report whether
+// it is genuine and still the document on record.
+func (labController *LabController) VerifyLabReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint := c.Query("fingerprint")
+		if fingerprint == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fingerprintRequiredError.Error()})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var data laboratory.LaboratoryData
+		err = labController.FaskesCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&data)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		valid := verifiedLabData(&data)
+		if !valid {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		}
+
+		utils.JSON(c, http.StatusOK, document.NewVerification(
+			objID.Hex(),
+			labReportTitle,
+			labController.Letterhead.Nama,
+			document.Check(data.Signature, valid, fingerprint),
+			data.UpdatedAt,
+		))
+	}
+}
@@ -0,0 +1,262 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"service-lab/datastruct"
+	"service-lab/datastruct/laboratory"
+	"service-lab/logger"
+	"service-lab/utils"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AnalyteTrend struct {
+	KodeLOINC  string                         `json:"kode_loinc"`
+	NamaAnalit string                         `json:"nama_analit"`
+	Data       []laboratory.AnalyteTrendPoint `json:"data"`
+}
+
+// RecordAnalyteHandler enters and validates the result of a single analyte
+// while the order is being analysed.
+func (labController *LabController) RecordAnalyteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body laboratory.AnalyteResultBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := labController.findLabOrder(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if data.CurrentStatus() != datastruct.IN_ANALYSIS {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "analyte results can only be recorded while the order is in analysis"})
+			return
+		}
+
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			labController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+
+		analyte := laboratory.FindAnalyte(data.ConfidentialData.HasilAnalit, c.Param("kode"))
+		if analyte == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": laboratory.AnalyteNotFoundError.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		analyte.Record(body, c.GetString("userIdentification"), now)
+
+		labTest, err := labController.findLabTest(analyte.KodeLOINC)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		at := data.ConfidentialData.WaktuPermintaan
+		if at.IsZero() {
+			at = now
+		}
+
+		if err := analyte.Evaluate(labTest, data.ConfidentialData.JenisKelamin, data.ConfidentialData.TanggalLahir, at); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recorded := *analyte
+
+		previousUpdate := data.UpdatedAt
+		data.UpdatedAt = &now
+
+		if err := labController.sealLabData(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// guard against a concurrent edit of the same order
+		filter := bson.M{
+			"_id":                data.ID,
+			"status_pemeriksaan": datastruct.IN_ANALYSIS,
+			"updated_at":         previousUpdate,
+		}
+
+		data.ID = primitive.NilObjectID
+		result, err := labController.FaskesCollection.UpdateOne(context.Background(), filter, bson.M{"$set": data})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "lab order was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, recorded)
+	}
+}
+
+// GetAnalyteTrendHandler collects the validated results of one analyte for a
+// patient across orders, oldest first. Orders failing their signature are
+// left out.
+func (labController *LabController) GetAnalyteTrendHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Param("kode")
+
+		filter := bson.M{
+			"no_ihs": c.Param("noIHS"),
+			"status_pemeriksaan": bson.M{"$in": bson.A{
+				datastruct.VALIDATED,
+				datastruct.REPORTED,
+				datastruct.ACKNOWLEDGED,
+			}},
+		}
+
+		conditions := bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"kode_analit": code},
+				bson.M{"kode_pemeriksaan": code},
+			}},
+		}
+
+		if !c.GetBool("patientConsent") {
+			conditions = append(conditions, bson.M{"$or": bson.A{
+				bson.M{"client_id": c.GetString("userClient")},
+				bson.M{"client_id": ""},
+			}})
+		}
+		filter["$and"] = conditions
+
+		createdAt := bson.M{}
+		if from := c.Query("from"); from != "" {
+			fromTime, err := time.Parse(time.DateOnly, from)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			createdAt["$gte"] = fromTime
+		}
+
+		if to := c.Query("to"); to != "" {
+			toTime, err := time.Parse(time.DateOnly, to)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			createdAt["$lt"] = toTime.AddDate(0, 0, 1)
+		}
+
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+
+		cursor, err := labController.FaskesCollection.Find(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		trend := AnalyteTrend{
+			KodeLOINC: code,
+			Data:      []laboratory.AnalyteTrendPoint{},
+		}
+
+		for cursor.Next(context.Background()) {
+			var data laboratory.LaboratoryData
+			if err := cursor.Decode(&data); err != nil {
+				logger.LogError.Printf("Failed to decode lab order: %v\n", err)
+				continue
+			}
+
+			// a tampered order does not belong in the trend
+			if !verifiedLabData(&data) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+				continue
+			}
+
+			utils.Decrypt(
+				data.ConfidentialEncrypted,
+				labController.ClientEncryption,
+			).Unmarshal(&data.ConfidentialData)
+
+			if data.ConfidentialData == nil {
+				continue
+			}
+
+			at := resultTime(&data)
+
+			if analyte := laboratory.FindAnalyte(data.ConfidentialData.HasilAnalit, code); analyte != nil {
+				if !analyte.HasValue() {
+					continue
+				}
+
+				trend.NamaAnalit = analyte.NamaAnalit
+				trend.Data = append(trend.Data, analyte.TrendPoint(&data, at))
+				continue
+			}
+
+			if data.KodePemeriksaan == code {
+				result := data.ConfidentialData.HasilPemeriksaan
+				analyte := laboratory.AnalyteResult{
+					NilaiTeks: result.NilaiHasil,
+					Kritis:    result.IsCritical(),
+				}
+				switch result.NilaiNormal {
+				case datastruct.NORMAL:
+					analyte.Flag = datastruct.FLAG_NORMAL
+				case datastruct.TIDAK_NORMAL:
+					analyte.Flag = datastruct.FLAG_ABNORMAL
+				}
+				if value, err := result.NumericValue(); err == nil {
+					analyte.NilaiNumerik = &value
+					analyte.NilaiTeks = ""
+				}
+
+				trend.NamaAnalit = data.NamaPemeriksaan
+				trend.Data = append(trend.Data, analyte.TrendPoint(&data, at))
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sort.Slice(trend.Data, func(i, j int) bool {
+			return trend.Data[i].Waktu.Before(trend.Data[j].Waktu)
+		})
+
+		utils.JSON(c, http.StatusOK, trend)
+	}
+}
+
+// resultTime is when the result of the order was validated, falling back to
+// its creation time for orders that predate the status history.
+func resultTime(data *laboratory.LaboratoryData) time.Time {
+	for i := 0; i < len(data.RiwayatStatus); i++ {
+		if data.RiwayatStatus[i].Status == datastruct.VALIDATED {
+			return data.RiwayatStatus[i].Waktu
+		}
+	}
+
+	if data.CreatedAt != nil {
+		return *data.CreatedAt
+	}
+
+	return time.Time{}
+}
@@ -6,11 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"service-lab/blindindex"
+	"service-lab/config"
+	"service-lab/datastruct"
 	"service-lab/datastruct/laboratory"
 	specialityexamination "service-lab/datastruct/outpatient"
 	"service-lab/datastruct/user"
 	"service-lab/db/csfle"
+	"service-lab/document"
 	"service-lab/logger"
+	"service-lab/pagination"
+	"service-lab/signing"
 	"service-lab/utils"
 	"time"
 
@@ -24,18 +31,33 @@ import (
 type LabController struct {
 	FaskesCollection  *mongo.Collection
 	ConsentCollection *mongo.Collection
+	CatalogCollection *mongo.Collection
+	AlertController   *AlertController
+	Letterhead        document.Letterhead
 
 	ClientEncryption *mongo.ClientEncryption
 	EncryptionOpts   *options.EncryptOptions
+
+	Signing    *signing.Client
+	BlindIndex *blindindex.Index
 }
 
 func InitLabController(client *mongo.Client, csfle *csfle.CSFLE) *LabController {
 	return &LabController{
 		FaskesCollection:  client.Database("fasyankes").Collection("laboratorium"),
 		ConsentCollection: client.Database("emr").Collection("consent"),
+		CatalogCollection: client.Database("fasyankes").Collection("katalog_lab"),
+		AlertController:   InitAlertController(client, csfle),
+		Letterhead:        loadLetterhead(),
 
 		ClientEncryption: csfle.ClientEncryption,
 		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+
+		Signing: signing.New(
+			config.AuthServiceURL,
+			time.Duration(config.AuthServiceTimeout)*time.Second,
+		),
+		BlindIndex: loadBlindIndex(),
 	}
 }
 
@@ -125,11 +147,28 @@ func (labController *LabController) CreateLabRequest() gin.HandlerFunc {
 			return
 		}
 
+		kodeAnalit, err := labController.resolveLabTest(
+			labrequest.KodePemeriksaan,
+			&labrequest.NamaPemeriksaan,
+			&labrequest.ConfidentialData.HasilAnalit,
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		labrequest.KodeAnalit = kodeAnalit
+
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 
 		labrequest.CreatedAt = &now
 		labrequest.UpdatedAt = &now
 
+		labrequest.StatusPemeriksaan = datastruct.REQUESTED
+		labrequest.RiwayatStatus = []laboratory.LabStatusHistory{
+			NewStatusHistory(c, datastruct.REQUESTED, "", now),
+		}
+
+		labrequest.Index(labController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			labrequest.ConfidentialData,
 			labController.ClientEncryption,
@@ -173,23 +212,37 @@ func (labController *LabController) GetAllLabDataHandler() gin.HandlerFunc {
 		noIHS := c.Param("noIHS")
 		noRegLab := c.Query("no_registrasi_lab")
 		nik := c.Query("nik")
+		kodePemeriksaan := c.Query("kode_pemeriksaan")
 
 		filter := bson.M{}
 		filter["no_ihs"] = noIHS
 
 		if namaPemeriksaan != "" {
 			regex := primitive.Regex{
-				Pattern: fmt.Sprintf(".*%s.*", namaPemeriksaan),
-				Options: "",
+				Pattern: regexp.QuoteMeta(namaPemeriksaan),
+				Options: "i",
 			}
 
 			filter["nama_pemeriksaan"] = regex
 		}
 
+		if kodePemeriksaan != "" {
+			filter["kode_pemeriksaan"] = kodePemeriksaan
+		}
+
 		if noRegLab != "" {
 			filter["no_registrasi_lab"] = noRegLab
 		}
 
+		if idKunjungan := c.Query("id_kunjungan"); idKunjungan != "" {
+			encounterID, err := primitive.ObjectIDFromHex(idKunjungan)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": laboratory.InvalidEncounterError.Error()})
+				return
+			}
+			filter["id_kunjungan"] = encounterID
+		}
+
 		if nik != "" {
 			filter["encrypted_nik"] = utils.EncryptDeterministic(
 				nik,
@@ -205,21 +258,62 @@ func (labController *LabController) GetAllLabDataHandler() gin.HandlerFunc {
 			}
 		}
 
-		// Query all laboratory data
-		cursor, err := labController.FaskesCollection.Find(context.Background(), filter)
+		// the specimen collection time is encrypted, its range is searched
+		// by its tokens
+		from, to := c.Query("spesimen_from"), c.Query("spesimen_to")
+		if from != "" || to != "" {
+			start, end, err := blindindex.ParseRange(from, to, time.Now())
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			tokens, err := labController.BlindIndex.DateQuery(laboratory.SpecimenTimeField, start, end)
+			if err != nil {
+				utils.JSON(c, searchErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			filter["indeks_waktu_spesimen"] = bson.M{"$in": tokens}
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := labController.FaskesCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		// Query a page of laboratory data
+		cursor, err := labController.FaskesCollection.Find(context.Background(), filter, params.FindOptions())
 		if err != nil {
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer cursor.Close(context.Background())
 
-		var labData []laboratory.LaboratoryData
+		labData := []laboratory.LaboratoryData{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
 		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
 			var data laboratory.LaboratoryData
 			if err := cursor.Decode(&data); err != nil {
 				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			last = data.ID
 
 			signature := data.Signature
 			id := data.ID
@@ -260,7 +354,7 @@ func (labController *LabController) GetAllLabDataHandler() gin.HandlerFunc {
 			return
 		}
 
-		utils.JSON(c, http.StatusOK, labData)
+		utils.JSON(c, http.StatusOK, params.Page(labData, total, last, more))
 	}
 }
 
@@ -274,6 +368,22 @@ func (labController *LabController) CreateLabDataHandler() gin.HandlerFunc {
 			return
 		}
 
+		kodeAnalit, err := labController.resolveLabTest(
+			labdata.KodePemeriksaan,
+			&labdata.NamaPemeriksaan,
+			&labdata.ConfidentialData.HasilAnalit,
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		labdata.KodeAnalit = kodeAnalit
+
+		if err := labController.evaluateResult(labdata.KodePemeriksaan, labdata.ConfidentialData, false); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 
 		labdata.CreatedAt = &now
@@ -281,6 +391,12 @@ func (labController *LabController) CreateLabDataHandler() gin.HandlerFunc {
 
 		labdata.ClientID = c.GetString("userClient")
 
+		labdata.StatusPemeriksaan = datastruct.REQUESTED
+		labdata.RiwayatStatus = []laboratory.LabStatusHistory{
+			NewStatusHistory(c, datastruct.REQUESTED, "", now),
+		}
+
+		labdata.Index(labController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			labdata.ConfidentialData,
 			labController.ClientEncryption,
@@ -347,6 +463,26 @@ func (labController *LabController) UpdateLabDataHandler() gin.HandlerFunc {
 			return
 		}
 
+		if labController.lockedByLifecycle(c, &newData) {
+			return
+		}
+
+		kodeAnalit, err := labController.resolveLabTest(
+			newData.KodePemeriksaan,
+			&newData.NamaPemeriksaan,
+			&newData.ConfidentialData.HasilAnalit,
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		newData.KodeAnalit = kodeAnalit
+
+		if err := labController.evaluateResult(newData.KodePemeriksaan, newData.ConfidentialData, false); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Define a filter to find the document by noPermintaan
 		filter := bson.M{
 			"_id":    id,
@@ -356,6 +492,7 @@ func (labController *LabController) UpdateLabDataHandler() gin.HandlerFunc {
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 		newData.UpdatedAt = &now
 
+		newData.Index(labController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			newData.ConfidentialData,
 			labController.ClientEncryption,
@@ -4,8 +4,13 @@ type SexType uint8
 type ExaminationPriority uint8
 type SendingMethod uint8
 type AbnormalitiesEnum uint8
+type LabOrderStatus uint8
+type ResultValueType uint8
+type ResultFlag uint8
+type CriticalAlertStatus uint8
 type RoleType string
 type PatientConsent bool
+type VerificationStatus uint8
 
 const (
 	UNKNOWN SexType = iota
@@ -30,6 +35,39 @@ const (
 	TIDAK_NORMAL
 )
 
+const (
+	REQUESTED LabOrderStatus = iota + 1
+	SPECIMEN_COLLECTED
+	RECEIVED
+	IN_ANALYSIS
+	VALIDATED
+	REPORTED
+	ACKNOWLEDGED
+	CANCELLED
+	REJECTED
+)
+
+const (
+	NUMERIC ResultValueType = iota + 1
+	CODED
+	TEXT
+)
+
+const (
+	FLAG_NORMAL ResultFlag = iota + 1
+	FLAG_LOW
+	FLAG_HIGH
+	FLAG_CRITICAL_LOW
+	FLAG_CRITICAL_HIGH
+	FLAG_ABNORMAL
+)
+
+const (
+	ALERT_SENT CriticalAlertStatus = iota + 1
+	ALERT_ESCALATED
+	ALERT_ACKNOWLEDGED
+)
+
 const (
 	DOKTER       RoleType = "Dokter"
 	APOTEK       RoleType = "Apotek"
@@ -41,3 +79,9 @@ const (
 	OPTIN  PatientConsent = true
 	OPTOUT PatientConsent = false
 )
+
+const (
+	DOKUMEN_ASLI VerificationStatus = iota + 1
+	DOKUMEN_DIPERBARUI
+	DOKUMEN_TIDAK_VALID
+)
@@ -0,0 +1,229 @@
+package laboratory
+
+import (
+	"errors"
+	"service-lab/datastruct"
+	"strings"
+	"time"
+)
+
+var (
+	AnalyteValueError     = errors.New("analyte value does not match its value type")
+	AnalyteCodeError      = errors.New("analyte code is not one of the allowed codes")
+	AnalyteUnitError      = errors.New("analyte unit differs from the catalog unit")
+	AnalyteNotFoundError  = errors.New("analyte is not part of this lab order")
+	PanelIncompleteError  = errors.New("every analyte of the panel must have a validated result")
+	ResultRequiredError   = errors.New("hasil_pemeriksaan is required to validate the lab order")
+	AnalyteDuplicateError = errors.New("analyte is listed more than once")
+	NestedPanelError      = errors.New("panel components must be single analytes")
+)
+
+// AnalyteResult is one measured component of a panel, e.g. hemoglobin
+// within a complete blood count.
+type AnalyteResult struct {
+	KodeLOINC  string                     `json:"kode_loinc" binding:"required" bson:"kode_loinc"`
+	NamaAnalit string                     `json:"nama_analit" bson:"nama_analit"`
+	TipeNilai  datastruct.ResultValueType `json:"tipe_nilai" bson:"tipe_nilai"`
+
+	NilaiNumerik *float64 `json:"nilai_numerik" bson:"nilai_numerik,omitempty"`
+	NilaiKode    string   `json:"nilai_kode" bson:"nilai_kode,omitempty"`
+	NilaiTeks    string   `json:"nilai_teks" bson:"nilai_teks,omitempty"`
+	Satuan       string   `json:"satuan" bson:"satuan"` // UCUM
+
+	NilaiRujukan string                       `json:"nilai_rujukan" bson:"nilai_rujukan"`
+	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" bson:"nilai_normal"`
+	Flag         datastruct.ResultFlag        `json:"flag" bson:"flag"`
+	Kritis       bool                         `json:"kritis" bson:"kritis"`
+
+	Validator     string     `json:"validator" bson:"validator"`
+	WaktuValidasi *time.Time `json:"waktu_validasi" bson:"waktu_validasi,omitempty"`
+	Catatan       string     `json:"catatan" bson:"catatan"`
+}
+
+type AnalyteResultBody struct {
+	NilaiNumerik *float64                     `json:"nilai_numerik"`
+	NilaiKode    string                       `json:"nilai_kode"`
+	NilaiTeks    string                       `json:"nilai_teks"`
+	Satuan       string                       `json:"satuan"`
+	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal"`
+	Kritis       bool                         `json:"kritis"`
+	Catatan      string                       `json:"catatan"`
+}
+
+type AnalyteTrendPoint struct {
+	IDPemeriksaan   string                `json:"id_pemeriksaan"`
+	NoRegistrasiLab string                `json:"no_registrasi_lab"`
+	Waktu           time.Time             `json:"waktu"`
+	NilaiNumerik    *float64              `json:"nilai_numerik"`
+	NilaiKode       string                `json:"nilai_kode,omitempty"`
+	NilaiTeks       string                `json:"nilai_teks,omitempty"`
+	Satuan          string                `json:"satuan"`
+	Flag            datastruct.ResultFlag `json:"flag"`
+	Kritis          bool                  `json:"kritis"`
+}
+
+func NewAnalyteResult(labTest *LabTest) AnalyteResult {
+	return AnalyteResult{
+		KodeLOINC:  labTest.KodeLOINC,
+		NamaAnalit: labTest.NamaPemeriksaan,
+		TipeNilai:  labTest.ValueType(),
+		Satuan:     labTest.Satuan,
+	}
+}
+
+func (analyte *AnalyteResult) HasValue() bool {
+	return analyte.NilaiNumerik != nil || analyte.NilaiKode != "" || analyte.NilaiTeks != ""
+}
+
+// Record stores a value entered by the laboratory along with the officer
+// who validated it. Computed fields are reset so they get evaluated again.
+func (analyte *AnalyteResult) Record(body AnalyteResultBody, validator string, now time.Time) {
+	analyte.NilaiNumerik = body.NilaiNumerik
+	analyte.NilaiKode = body.NilaiKode
+	analyte.NilaiTeks = body.NilaiTeks
+	if body.Satuan != "" {
+		analyte.Satuan = body.Satuan
+	}
+	analyte.NilaiNormal = body.NilaiNormal
+	analyte.Kritis = body.Kritis
+	analyte.Catatan = body.Catatan
+	analyte.Flag = 0
+
+	analyte.Validator = validator
+	analyte.WaktuValidasi = &now
+}
+
+// Evaluate checks the value against the catalog entry of the analyte and
+// derives the reference text, the flags and the normality from it.
+func (analyte *AnalyteResult) Evaluate(labTest *LabTest, sex *datastruct.SexType, birth, at time.Time) error {
+	analyte.NamaAnalit = labTest.NamaPemeriksaan
+	analyte.TipeNilai = labTest.ValueType()
+
+	if analyte.Satuan == "" {
+		analyte.Satuan = labTest.Satuan
+	} else if labTest.Satuan != "" && analyte.Satuan != labTest.Satuan {
+		return AnalyteUnitError
+	}
+
+	if !ValidUnit(analyte.Satuan) {
+		return InvalidUnitError
+	}
+
+	switch analyte.TipeNilai {
+	case datastruct.NUMERIC:
+		if analyte.NilaiNumerik == nil || analyte.NilaiKode != "" {
+			return AnalyteValueError
+		}
+
+		if referenceRange := labTest.MatchRange(sex, birth, at); referenceRange != nil {
+			analyte.NilaiRujukan = referenceRange.String(labTest.Satuan)
+			analyte.Flag = referenceRange.Flag(*analyte.NilaiNumerik)
+		}
+	case datastruct.CODED:
+		if analyte.NilaiKode == "" || analyte.NilaiNumerik != nil {
+			return AnalyteValueError
+		}
+
+		if len(labTest.PilihanKode) > 0 && !containsCode(labTest.PilihanKode, analyte.NilaiKode) {
+			return AnalyteCodeError
+		}
+
+		if len(labTest.KodeNormal) > 0 {
+			analyte.NilaiRujukan = strings.Join(labTest.KodeNormal, ", ")
+			analyte.Flag = datastruct.FLAG_ABNORMAL
+			if containsCode(labTest.KodeNormal, analyte.NilaiKode) {
+				analyte.Flag = datastruct.FLAG_NORMAL
+			}
+		}
+	case datastruct.TEXT:
+		if analyte.NilaiTeks == "" || analyte.NilaiNumerik != nil {
+			return AnalyteValueError
+		}
+	}
+
+	if analyte.Flag != 0 {
+		analyte.NilaiNormal = NormalityOf(analyte.Flag)
+	}
+
+	if analyte.Flag == datastruct.FLAG_CRITICAL_LOW || analyte.Flag == datastruct.FLAG_CRITICAL_HIGH {
+		analyte.Kritis = true
+	}
+
+	if analyte.NilaiNormal == 0 {
+		return NormalityRequiredError
+	}
+
+	return nil
+}
+
+// TrendPoint flattens the analyte into a point of the patient's trend.
+func (analyte *AnalyteResult) TrendPoint(order *LaboratoryData, at time.Time) AnalyteTrendPoint {
+	return AnalyteTrendPoint{
+		IDPemeriksaan:   order.ID.Hex(),
+		NoRegistrasiLab: order.NoRegistrasiLab,
+		Waktu:           at,
+		NilaiNumerik:    analyte.NilaiNumerik,
+		NilaiKode:       analyte.NilaiKode,
+		NilaiTeks:       analyte.NilaiTeks,
+		Satuan:          analyte.Satuan,
+		Flag:            analyte.Flag,
+		Kritis:          analyte.Kritis,
+	}
+}
+
+func FlagString(flag datastruct.ResultFlag) string {
+	switch flag {
+	case datastruct.FLAG_NORMAL:
+		return "N"
+	case datastruct.FLAG_LOW:
+		return "L"
+	case datastruct.FLAG_HIGH:
+		return "H"
+	case datastruct.FLAG_CRITICAL_LOW:
+		return "LL"
+	case datastruct.FLAG_CRITICAL_HIGH:
+		return "HH"
+	case datastruct.FLAG_ABNORMAL:
+		return "A"
+	default:
+		return ""
+	}
+}
+
+// AnalyteCodes lists the LOINC codes of the analytes, kept in plaintext on
+// the order so trends can be queried without decrypting every document.
+func AnalyteCodes(analytes []AnalyteResult) ([]string, error) {
+	seen := map[string]bool{}
+	codes := []string{}
+	for i := 0; i < len(analytes); i++ {
+		code := analytes[i].KodeLOINC
+		if seen[code] {
+			return nil, AnalyteDuplicateError
+		}
+
+		seen[code] = true
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func FindAnalyte(analytes []AnalyteResult, code string) *AnalyteResult {
+	for i := 0; i < len(analytes); i++ {
+		if analytes[i].KodeLOINC == code {
+			return &analytes[i]
+		}
+	}
+
+	return nil
+}
+
+func containsCode(codes []string, code string) bool {
+	for i := 0; i < len(codes); i++ {
+		if codes[i] == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package laboratory
+
+import (
+	"errors"
+	"fmt"
+	"service-lab/datastruct"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	AlertAcknowledgedError = errors.New("critical alert has already been acknowledged")
+)
+
+type ConfidentialAlertData struct {
+	DokterPengirim       string               `json:"dokter_pengirim" bson:"dokter_pengirim"`
+	NoTelpDokterPengirim string               `json:"no_telp_dokter_pengirim" bson:"no_telp_dokter_pengirim"`
+	HasilPemeriksaan     LabExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+	HasilAnalitKritis    []AnalyteResult      `json:"hasil_analit_kritis" bson:"hasil_analit_kritis,omitempty"`
+	InterpretasiHasil    string               `json:"interpretasi_hasil" bson:"interpretasi_hasil"`
+}
+
+type AlertDelivery struct {
+	TingkatEskalasi int       `json:"tingkat_eskalasi" bson:"tingkat_eskalasi"`
+	Penerima        string    `json:"penerima" bson:"penerima"`
+	Notifier        string    `json:"notifier" bson:"notifier"`
+	Berhasil        bool      `json:"berhasil" bson:"berhasil"`
+	Galat           string    `json:"galat" bson:"galat"`
+	Waktu           time.Time `json:"waktu" bson:"waktu"`
+}
+
+type AlertAcknowledgementBody struct {
+	Catatan string `json:"catatan"`
+}
+
+// CriticalAlert tracks a critical result from the moment it is validated
+// until the ordering clinician confirms having read it.
+type CriticalAlert struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID        string  `json:"client_id" bson:"client_id"`
+	ClientPemeriksa string  `json:"client_pemeriksa" bson:"client_pemeriksa"`
+	Signature       *string `json:"signature" bson:"signature"`
+
+	NoIHS           string             `json:"no_ihs" bson:"no_ihs"`
+	IDPemeriksaan   primitive.ObjectID `json:"id_pemeriksaan" bson:"id_pemeriksaan"`
+	NamaPemeriksaan string             `json:"nama_pemeriksaan" bson:"nama_pemeriksaan"`
+
+	Status            datastruct.CriticalAlertStatus `json:"status" bson:"status"`
+	TingkatEskalasi   int                            `json:"tingkat_eskalasi" bson:"tingkat_eskalasi"`
+	BatasKonfirmasi   time.Time                      `json:"batas_konfirmasi" bson:"batas_konfirmasi"`
+	DikonfirmasiOleh  string                         `json:"dikonfirmasi_oleh" bson:"dikonfirmasi_oleh"`
+	WaktuKonfirmasi   *time.Time                     `json:"waktu_konfirmasi" bson:"waktu_konfirmasi"`
+	CatatanKonfirmasi string                         `json:"catatan_konfirmasi" bson:"catatan_konfirmasi"`
+	RiwayatPengiriman []AlertDelivery                `json:"riwayat_pengiriman" bson:"riwayat_pengiriman"`
+
+	ConfidentialData      *ConfidentialAlertData `json:"confidential_data" bson:"confidential_data,omitempty"`
+	ConfidentialEncrypted *primitive.Binary      `json:"encrypted_confidential,omitempty" bson:"encrypted_confidential"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+func (criticalAlert *CriticalAlert) StatusString() string {
+	switch criticalAlert.Status {
+	case datastruct.ALERT_SENT:
+		return "Terkirim"
+	case datastruct.ALERT_ESCALATED:
+		return "Dieskalasi"
+	case datastruct.ALERT_ACKNOWLEDGED:
+		return "Dikonfirmasi"
+	default:
+		return ""
+	}
+}
+
+// Summary describes the critical values in a single line for the notifier.
+func (data *ConfidentialAlertData) Summary() string {
+	if len(data.HasilAnalitKritis) == 0 {
+		return fmt.Sprintf("Hasil %s (rujukan %s)", data.HasilPemeriksaan.NilaiHasil, data.HasilPemeriksaan.NilaiRujukan)
+	}
+
+	values := []string{}
+	for i := 0; i < len(data.HasilAnalitKritis); i++ {
+		analyte := data.HasilAnalitKritis[i]
+		value := analyte.NilaiKode
+		if analyte.NilaiNumerik != nil {
+			value = strconv.FormatFloat(*analyte.NilaiNumerik, 'f', -1, 64)
+		}
+
+		values = append(values, fmt.Sprintf("%s %s %s [%s] (rujukan %s)",
+			analyte.NamaAnalit,
+			value,
+			analyte.Satuan,
+			FlagString(analyte.Flag),
+			analyte.NilaiRujukan,
+		))
+	}
+
+	return strings.Join(values, "; ")
+}
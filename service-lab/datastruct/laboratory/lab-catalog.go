@@ -0,0 +1,235 @@
+package laboratory
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"service-lab/datastruct"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	LabTestNotFoundError     = errors.New("lab test is not registered in the catalog")
+	LabTestDuplicateError    = errors.New("lab test with the same LOINC code already exists")
+	NormalityRequiredError   = errors.New("nilai_normal is required when it cannot be computed from the catalog")
+	InvalidReferenceAgeError = errors.New("reference range minimum age must be lower than its maximum age")
+	InvalidUnitError         = errors.New("unit is not a valid UCUM expression")
+)
+
+// ReferenceRange is the expected result of a test for a patient group.
+// Ages are in days so neonatal ranges can be expressed; a nil sex, age or
+// bound means the range is not limited on that side.
+type ReferenceRange struct {
+	JenisKelamin     *datastruct.SexType `json:"jenis_kelamin" bson:"jenis_kelamin,omitempty"`
+	UsiaMinHari      *int                `json:"usia_min_hari" bson:"usia_min_hari,omitempty"`
+	UsiaMaksHari     *int                `json:"usia_maks_hari" bson:"usia_maks_hari,omitempty"`
+	NilaiMin         *float64            `json:"nilai_min" bson:"nilai_min,omitempty"`
+	NilaiMaks        *float64            `json:"nilai_maks" bson:"nilai_maks,omitempty"`
+	BatasKritisBawah *float64            `json:"batas_kritis_bawah" bson:"batas_kritis_bawah,omitempty"`
+	BatasKritisAtas  *float64            `json:"batas_kritis_atas" bson:"batas_kritis_atas,omitempty"`
+	Keterangan       string              `json:"keterangan" bson:"keterangan"`
+}
+
+type LabTest struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	KodeLOINC       string                     `json:"kode_loinc" binding:"required" bson:"kode_loinc"`
+	NamaPemeriksaan string                     `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
+	JenisSpesimen   string                     `json:"jenis_spesimen" binding:"required" bson:"jenis_spesimen"`
+	TipeNilai       datastruct.ResultValueType `json:"tipe_nilai" bson:"tipe_nilai"`
+	Satuan          string                     `json:"satuan" bson:"satuan"` // UCUM
+	Metode          string                     `json:"metode" bson:"metode"`
+	NilaiRujukan    []ReferenceRange           `json:"nilai_rujukan" bson:"nilai_rujukan"`
+
+	// coded results only
+	PilihanKode []string `json:"pilihan_kode" bson:"pilihan_kode,omitempty"`
+	KodeNormal  []string `json:"kode_normal" bson:"kode_normal,omitempty"`
+
+	// LOINC codes of the analytes reported under this panel
+	Komponen []string `json:"komponen" bson:"komponen,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// ucumPattern accepts the printable characters UCUM case sensitive units
+// are built from, e.g. "mg/dL", "10*3/uL", "mmol/L", "%" or "{ratio}".
+var ucumPattern = regexp.MustCompile(`^[A-Za-z0-9%.\/*^\-+'\[\]{}()]+$`)
+
+func ValidUnit(unit string) bool {
+	return unit == "" || ucumPattern.MatchString(unit)
+}
+
+func (labTest *LabTest) IsPanel() bool {
+	return len(labTest.Komponen) > 0
+}
+
+// ValueType defaults entries without an explicit type to numeric results.
+func (labTest *LabTest) ValueType() datastruct.ResultValueType {
+	if labTest.TipeNilai == 0 {
+		return datastruct.NUMERIC
+	}
+
+	return labTest.TipeNilai
+}
+
+func (labTest *LabTest) Validate() error {
+	if !ValidUnit(labTest.Satuan) {
+		return InvalidUnitError
+	}
+
+	for i := 0; i < len(labTest.NilaiRujukan); i++ {
+		r := labTest.NilaiRujukan[i]
+		if r.UsiaMinHari != nil && r.UsiaMaksHari != nil && *r.UsiaMinHari >= *r.UsiaMaksHari {
+			return InvalidReferenceAgeError
+		}
+	}
+
+	return nil
+}
+
+// AgeInDays counts the full days between birth and the given moment.
+func AgeInDays(birth, at time.Time) int {
+	return int(at.Sub(birth).Hours() / 24)
+}
+
+func (referenceRange *ReferenceRange) matches(sex *datastruct.SexType, ageDays int) bool {
+	if referenceRange.JenisKelamin != nil && (sex == nil || *sex != *referenceRange.JenisKelamin) {
+		return false
+	}
+
+	if referenceRange.UsiaMinHari != nil && ageDays < *referenceRange.UsiaMinHari {
+		return false
+	}
+
+	if referenceRange.UsiaMaksHari != nil && ageDays >= *referenceRange.UsiaMaksHari {
+		return false
+	}
+
+	return true
+}
+
+// specificity prefers ranges restricted to the patient's sex and age over
+// the general ones.
+func (referenceRange *ReferenceRange) specificity() int {
+	score := 0
+	if referenceRange.JenisKelamin != nil {
+		score++
+	}
+	if referenceRange.UsiaMinHari != nil || referenceRange.UsiaMaksHari != nil {
+		score++
+	}
+
+	return score
+}
+
+// MatchRange returns the most specific reference range for the patient, or
+// nil when none of the ranges apply.
+func (labTest *LabTest) MatchRange(sex *datastruct.SexType, birth, at time.Time) *ReferenceRange {
+	ageDays := AgeInDays(birth, at)
+
+	var match *ReferenceRange
+	for i := 0; i < len(labTest.NilaiRujukan); i++ {
+		candidate := &labTest.NilaiRujukan[i]
+		if !candidate.matches(sex, ageDays) {
+			continue
+		}
+
+		if match == nil || candidate.specificity() > match.specificity() {
+			match = candidate
+		}
+	}
+
+	return match
+}
+
+// Flag compares a numeric value against the range, critical bounds first.
+// Zero is returned when the range has no bound to compare against.
+func (referenceRange *ReferenceRange) Flag(value float64) datastruct.ResultFlag {
+	switch {
+	case referenceRange.BatasKritisBawah != nil && value <= *referenceRange.BatasKritisBawah:
+		return datastruct.FLAG_CRITICAL_LOW
+	case referenceRange.BatasKritisAtas != nil && value >= *referenceRange.BatasKritisAtas:
+		return datastruct.FLAG_CRITICAL_HIGH
+	case referenceRange.NilaiMin != nil && value < *referenceRange.NilaiMin:
+		return datastruct.FLAG_LOW
+	case referenceRange.NilaiMaks != nil && value > *referenceRange.NilaiMaks:
+		return datastruct.FLAG_HIGH
+	case referenceRange.NilaiMin != nil || referenceRange.NilaiMaks != nil:
+		return datastruct.FLAG_NORMAL
+	default:
+		return 0
+	}
+}
+
+func formatBound(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (referenceRange *ReferenceRange) String(unit string) string {
+	var text string
+	switch {
+	case referenceRange.NilaiMin != nil && referenceRange.NilaiMaks != nil:
+		text = fmt.Sprintf("%s - %s", formatBound(*referenceRange.NilaiMin), formatBound(*referenceRange.NilaiMaks))
+	case referenceRange.NilaiMin != nil:
+		text = fmt.Sprintf(">= %s", formatBound(*referenceRange.NilaiMin))
+	case referenceRange.NilaiMaks != nil:
+		text = fmt.Sprintf("<= %s", formatBound(*referenceRange.NilaiMaks))
+	default:
+		return referenceRange.Keterangan
+	}
+
+	if unit != "" {
+		text = fmt.Sprintf("%s %s", text, unit)
+	}
+
+	return text
+}
+
+func NormalityOf(flag datastruct.ResultFlag) datastruct.AbnormalitiesEnum {
+	if flag == datastruct.FLAG_NORMAL {
+		return datastruct.NORMAL
+	}
+
+	return datastruct.TIDAK_NORMAL
+}
+
+func parseResultValue(value string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", "."), 64)
+}
+
+// Evaluate fills in the reference text, the normality flag and the critical
+// bounds of a result from the matching reference range. Values entered by
+// the laboratory are kept when the catalog has nothing to compare against.
+func (labTest *LabTest) Evaluate(result *LabExaminationResult, sex *datastruct.SexType, birth, at time.Time) error {
+	referenceRange := labTest.MatchRange(sex, birth, at)
+
+	if referenceRange != nil {
+		result.NilaiRujukan = referenceRange.String(labTest.Satuan)
+
+		if result.BatasKritisBawah == nil {
+			result.BatasKritisBawah = referenceRange.BatasKritisBawah
+		}
+		if result.BatasKritisAtas == nil {
+			result.BatasKritisAtas = referenceRange.BatasKritisAtas
+		}
+
+		if value, err := parseResultValue(result.NilaiHasil); err == nil {
+			if flag := referenceRange.Flag(value); flag != 0 {
+				result.NilaiNormal = NormalityOf(flag)
+			}
+		}
+	}
+
+	if result.NilaiNormal == 0 {
+		return NormalityRequiredError
+	}
+
+	return nil
+}
@@ -0,0 +1,352 @@
+package laboratory
+
+import (
+	"errors"
+	"service-lab/datastruct"
+	"time"
+)
+
+var (
+	InvalidTransitionError = errors.New("lab order status transition is not allowed")
+	TransitionRoleError    = errors.New("role is not allowed to perform this transition")
+	TransitionPayloadError = errors.New("transition payload is incomplete")
+	OrderLockedError       = errors.New("lab order has been validated and can no longer be edited")
+	NotValidatedError      = errors.New("lab order must be validated before its result is signed")
+	NotValidatorError      = errors.New("only the analyst who validated the result can sign it")
+)
+
+type LabOrderTransitionRule struct {
+	From []datastruct.LabOrderStatus
+	Role datastruct.RoleType
+}
+
+// LabOrderTransitions maps every target status to the statuses it may be
+// reached from and the role allowed to perform the transition.
+var LabOrderTransitions = map[datastruct.LabOrderStatus]LabOrderTransitionRule{
+	datastruct.SPECIMEN_COLLECTED: {
+		From: []datastruct.LabOrderStatus{datastruct.REQUESTED},
+		Role: datastruct.LABORATORIUM,
+	},
+	datastruct.RECEIVED: {
+		From: []datastruct.LabOrderStatus{datastruct.SPECIMEN_COLLECTED},
+		Role: datastruct.LABORATORIUM,
+	},
+	datastruct.IN_ANALYSIS: {
+		From: []datastruct.LabOrderStatus{datastruct.RECEIVED},
+		Role: datastruct.LABORATORIUM,
+	},
+	datastruct.VALIDATED: {
+		From: []datastruct.LabOrderStatus{datastruct.IN_ANALYSIS},
+		Role: datastruct.LABORATORIUM,
+	},
+	datastruct.REPORTED: {
+		From: []datastruct.LabOrderStatus{datastruct.VALIDATED},
+		Role: datastruct.LABORATORIUM,
+	},
+	datastruct.ACKNOWLEDGED: {
+		From: []datastruct.LabOrderStatus{datastruct.REPORTED},
+		Role: datastruct.DOKTER,
+	},
+	datastruct.CANCELLED: {
+		From: []datastruct.LabOrderStatus{datastruct.REQUESTED, datastruct.SPECIMEN_COLLECTED},
+		Role: datastruct.DOKTER,
+	},
+	datastruct.REJECTED: {
+		From: []datastruct.LabOrderStatus{datastruct.REQUESTED, datastruct.SPECIMEN_COLLECTED, datastruct.RECEIVED},
+		Role: datastruct.LABORATORIUM,
+	},
+}
+
+type LabStatusHistory struct {
+	Status   datastruct.LabOrderStatus `json:"status" bson:"status"`
+	Petugas  string                    `json:"petugas" bson:"petugas"`
+	Peran    datastruct.RoleType       `json:"peran" bson:"peran"`
+	ClientID string                    `json:"client_id" bson:"client_id"`
+	Alasan   string                    `json:"alasan" bson:"alasan"`
+	Waktu    time.Time                 `json:"waktu" bson:"waktu"`
+}
+
+type SpecimenCollection struct {
+	SumberSpesimen            string    `json:"sumber_spesimen" binding:"required" bson:"sumber_spesimen"`
+	LokasiPengambilanSpesimen string    `json:"lokasi_pengambilan_spesimen" binding:"required" bson:"lokasi_pengambilan_spesimen"`
+	JumlahSpesimen            uint8     `json:"jumlah_spesimen" binding:"required" bson:"jumlah_spesimen"`
+	VolumeSpesimen            uint16    `json:"volume_spesimen" binding:"required" bson:"volume_spesimen"`
+	MetodePengambilanSpesimen string    `json:"metode_pengambilan_spesimen" binding:"required" bson:"metode_pengambilan_spesimen"`
+	KondisiSpesimen           string    `json:"kondisi_spesimen" binding:"required" bson:"kondisi_spesimen"`
+	WaktuFiksasi              time.Time `json:"waktu_fiksasi" bson:"waktu_fiksasi"`
+	CairanFiksasi             string    `json:"cairan_fiksasi" bson:"cairan_fiksasi"`
+	VolumeCairan              uint16    `json:"volume_cairan" bson:"volume_cairan"`
+	PetugasPengambilSpesimen  string    `json:"petugas_pengambil_spesimen" binding:"required" bson:"petugas_pengambil_spesimen"`
+	PetugasPengantarSpesimen  string    `json:"petugas_pengantar_spesimen" binding:"required" bson:"petugas_pengantar_spesimen"`
+}
+
+type SpecimenReceipt struct {
+	PetugasPenerimaSpesimen string `json:"petugas_penerima_spesimen" binding:"required" bson:"petugas_penerima_spesimen"`
+	KondisiSpesimen         string `json:"kondisi_spesimen" binding:"required" bson:"kondisi_spesimen"`
+}
+
+type ResultValidation struct {
+	PetugasPenganalisisSpesimen       string                `json:"petugas_penganalisis_spesimen" binding:"required" bson:"petugas_penganalisis_spesimen"`
+	HasilPemeriksaan                  *LabExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+	HasilAnalit                       []AnalyteResult       `json:"hasil_analit" bson:"hasil_analit"`
+	InterpretasiHasil                 string                `json:"interpretasi_hasil" binding:"required" bson:"interpretasi_hasil"`
+	DokterValidatorPemeriksaan        string                `json:"dokter_validator_pemeriksaan" binding:"required" bson:"dokter_validator_pemeriksaan"`
+	DokterPenginterpretasiPemeriksaan string                `json:"dokter_penginterpretasi_pemeriksaan" binding:"required" bson:"dokter_penginterpretasi_pemeriksaan"`
+}
+
+type LabOrderTransitionBody struct {
+	Alasan              string              `json:"alasan"`
+	PengambilanSpesimen *SpecimenCollection `json:"pengambilan_spesimen"`
+	PenerimaanSpesimen  *SpecimenReceipt    `json:"penerimaan_spesimen"`
+	Validasi            *ResultValidation   `json:"validasi"`
+}
+
+// LabTurnaround holds the elapsed minutes between lifecycle milestones.
+// A nil value means one of the milestones has not been reached yet.
+type LabTurnaround struct {
+	PermintaanKePengambilan *float64 `json:"permintaan_ke_pengambilan"`
+	PengambilanKePenerimaan *float64 `json:"pengambilan_ke_penerimaan"`
+	PenerimaanKeValidasi    *float64 `json:"penerimaan_ke_validasi"`
+	ValidasiKePelaporan     *float64 `json:"validasi_ke_pelaporan"`
+	PermintaanKePelaporan   *float64 `json:"permintaan_ke_pelaporan"`
+	PelaporanKeKonfirmasi   *float64 `json:"pelaporan_ke_konfirmasi"`
+}
+
+func CheckTransition(from, to datastruct.LabOrderStatus, role datastruct.RoleType) error {
+	rule, ok := LabOrderTransitions[to]
+	if !ok {
+		return InvalidTransitionError
+	}
+
+	if rule.Role != role {
+		return TransitionRoleError
+	}
+
+	for i := 0; i < len(rule.From); i++ {
+		if rule.From[i] == from {
+			return nil
+		}
+	}
+
+	return InvalidTransitionError
+}
+
+func (body *LabOrderTransitionBody) Validate(target datastruct.LabOrderStatus) error {
+	switch target {
+	case datastruct.SPECIMEN_COLLECTED:
+		if body.PengambilanSpesimen == nil {
+			return TransitionPayloadError
+		}
+	case datastruct.RECEIVED:
+		if body.PenerimaanSpesimen == nil {
+			return TransitionPayloadError
+		}
+	case datastruct.VALIDATED:
+		if body.Validasi == nil {
+			return TransitionPayloadError
+		}
+	case datastruct.CANCELLED, datastruct.REJECTED:
+		if body.Alasan == "" {
+			return TransitionPayloadError
+		}
+	}
+
+	return nil
+}
+
+// Apply copies the part of the transition payload relevant to the target
+// status into the confidential data and stamps the matching timestamp.
+func (body *LabOrderTransitionBody) Apply(target datastruct.LabOrderStatus, data *ConfidentialLabData, now time.Time) {
+	switch target {
+	case datastruct.SPECIMEN_COLLECTED:
+		spesimen := body.PengambilanSpesimen
+		data.SumberSpesimen = spesimen.SumberSpesimen
+		data.LokasiPengambilanSpesimen = spesimen.LokasiPengambilanSpesimen
+		data.JumlahSpesimen = spesimen.JumlahSpesimen
+		data.VolumeSpesimen = spesimen.VolumeSpesimen
+		data.MetodePengambilanSpesimen = spesimen.MetodePengambilanSpesimen
+		data.KondisiSpesimen = spesimen.KondisiSpesimen
+		data.WaktuFiksasi = spesimen.WaktuFiksasi
+		data.CairanFiksasi = spesimen.CairanFiksasi
+		data.VolumeCairan = spesimen.VolumeCairan
+		data.PetugasPengambilSpesimen = spesimen.PetugasPengambilSpesimen
+		data.PetugasPengantarSpesimen = spesimen.PetugasPengantarSpesimen
+		data.WaktuPengambilanSpesimen = now
+	case datastruct.RECEIVED:
+		data.PetugasPenerimaSpesimen = body.PenerimaanSpesimen.PetugasPenerimaSpesimen
+		data.KondisiSpesimen = body.PenerimaanSpesimen.KondisiSpesimen
+	case datastruct.IN_ANALYSIS:
+		data.WaktuPengolahanSpesimen = now
+	case datastruct.VALIDATED:
+		validasi := body.Validasi
+		data.PetugasPenganalisisSpesimen = validasi.PetugasPenganalisisSpesimen
+		if validasi.HasilPemeriksaan != nil {
+			data.HasilPemeriksaan = *validasi.HasilPemeriksaan
+		}
+		for i := 0; i < len(validasi.HasilAnalit); i++ {
+			submitted := validasi.HasilAnalit[i]
+			analyte := FindAnalyte(data.HasilAnalit, submitted.KodeLOINC)
+			if analyte == nil {
+				data.HasilAnalit = append(data.HasilAnalit, AnalyteResult{KodeLOINC: submitted.KodeLOINC})
+				analyte = &data.HasilAnalit[len(data.HasilAnalit)-1]
+			}
+
+			analyte.Record(AnalyteResultBody{
+				NilaiNumerik: submitted.NilaiNumerik,
+				NilaiKode:    submitted.NilaiKode,
+				NilaiTeks:    submitted.NilaiTeks,
+				Satuan:       submitted.Satuan,
+				NilaiNormal:  submitted.NilaiNormal,
+				Kritis:       submitted.Kritis,
+				Catatan:      submitted.Catatan,
+			}, validasi.DokterValidatorPemeriksaan, now)
+		}
+		data.InterpretasiHasil = validasi.InterpretasiHasil
+		data.DokterValidatorPemeriksaan = validasi.DokterValidatorPemeriksaan
+		data.DokterPenginterpretasiPemeriksaan = validasi.DokterPenginterpretasiPemeriksaan
+	case datastruct.REPORTED:
+		data.WaktuHasilKeluarLab = now
+	case datastruct.ACKNOWLEDGED:
+		data.WaktuHasilDiterimaUnitPengirim = now
+	}
+}
+
+// KeepLifecycle copies the specimen, the result and its acknowledgement
+// from the stored version, so an update only changes the request.
+func (data *ConfidentialLabData) KeepLifecycle(previous *ConfidentialLabData) {
+	data.SumberSpesimen = previous.SumberSpesimen
+	data.LokasiPengambilanSpesimen = previous.LokasiPengambilanSpesimen
+	data.JumlahSpesimen = previous.JumlahSpesimen
+	data.VolumeSpesimen = previous.VolumeSpesimen
+	data.MetodePengambilanSpesimen = previous.MetodePengambilanSpesimen
+	data.WaktuPengambilanSpesimen = previous.WaktuPengambilanSpesimen
+	data.KondisiSpesimen = previous.KondisiSpesimen
+	data.WaktuFiksasi = previous.WaktuFiksasi
+	data.CairanFiksasi = previous.CairanFiksasi
+	data.VolumeCairan = previous.VolumeCairan
+	data.PetugasPengambilSpesimen = previous.PetugasPengambilSpesimen
+	data.PetugasPengantarSpesimen = previous.PetugasPengantarSpesimen
+	data.PetugasPenerimaSpesimen = previous.PetugasPenerimaSpesimen
+	data.PetugasPenganalisisSpesimen = previous.PetugasPenganalisisSpesimen
+
+	data.WaktuPengolahanSpesimen = previous.WaktuPengolahanSpesimen
+	data.HasilPemeriksaan = previous.HasilPemeriksaan
+	data.HasilAnalit = previous.HasilAnalit
+	data.InterpretasiHasil = previous.InterpretasiHasil
+	data.DokterValidatorPemeriksaan = previous.DokterValidatorPemeriksaan
+	data.DokterPenginterpretasiPemeriksaan = previous.DokterPenginterpretasiPemeriksaan
+
+	data.WaktuHasilKeluarLab = previous.WaktuHasilKeluarLab
+	data.WaktuHasilDiterimaUnitPengirim = previous.WaktuHasilDiterimaUnitPengirim
+}
+
+// CurrentStatus treats documents created before the lifecycle was introduced
+// as freshly requested orders.
+func (laboratoryData *LaboratoryData) CurrentStatus() datastruct.LabOrderStatus {
+	if laboratoryData.StatusPemeriksaan == 0 {
+		return datastruct.REQUESTED
+	}
+
+	return laboratoryData.StatusPemeriksaan
+}
+
+// IsLocked reports whether the result part of the order is frozen.
+func (laboratoryData *LaboratoryData) IsLocked() bool {
+	return laboratoryData.CurrentStatus() >= datastruct.VALIDATED
+}
+
+// CanBeSignedBy checks the result was validated, and by the user signing it.
+// Cancelled and rejected orders have no result to sign.
+func (laboratoryData *LaboratoryData) CanBeSignedBy(by string) error {
+	status := laboratoryData.CurrentStatus()
+	if status < datastruct.VALIDATED || status > datastruct.ACKNOWLEDGED {
+		return NotValidatedError
+	}
+
+	for i := 0; i < len(laboratoryData.RiwayatStatus); i++ {
+		history := laboratoryData.RiwayatStatus[i]
+		if history.Status == datastruct.VALIDATED {
+			if history.Petugas != by {
+				return NotValidatorError
+			}
+			return nil
+		}
+	}
+
+	return NotValidatedError
+}
+
+func (laboratoryData *LaboratoryData) Turnaround() LabTurnaround {
+	reached := map[datastruct.LabOrderStatus]time.Time{}
+	for i := 0; i < len(laboratoryData.RiwayatStatus); i++ {
+		history := laboratoryData.RiwayatStatus[i]
+		if _, ok := reached[history.Status]; !ok {
+			reached[history.Status] = history.Waktu
+		}
+	}
+
+	if _, ok := reached[datastruct.REQUESTED]; !ok && laboratoryData.CreatedAt != nil {
+		reached[datastruct.REQUESTED] = *laboratoryData.CreatedAt
+	}
+
+	elapsed := func(from, to datastruct.LabOrderStatus) *float64 {
+		start, okStart := reached[from]
+		end, okEnd := reached[to]
+		if !okStart || !okEnd {
+			return nil
+		}
+
+		minutes := end.Sub(start).Minutes()
+		return &minutes
+	}
+
+	return LabTurnaround{
+		PermintaanKePengambilan: elapsed(datastruct.REQUESTED, datastruct.SPECIMEN_COLLECTED),
+		PengambilanKePenerimaan: elapsed(datastruct.SPECIMEN_COLLECTED, datastruct.RECEIVED),
+		PenerimaanKeValidasi:    elapsed(datastruct.RECEIVED, datastruct.VALIDATED),
+		ValidasiKePelaporan:     elapsed(datastruct.VALIDATED, datastruct.REPORTED),
+		PermintaanKePelaporan:   elapsed(datastruct.REQUESTED, datastruct.REPORTED),
+		PelaporanKeKonfirmasi:   elapsed(datastruct.REPORTED, datastruct.ACKNOWLEDGED),
+	}
+}
+
+// RequestingClient returns the client that placed the order, taken from the
+// first entry of the status history.
+func (laboratoryData *LaboratoryData) RequestingClient() string {
+	for i := 0; i < len(laboratoryData.RiwayatStatus); i++ {
+		if laboratoryData.RiwayatStatus[i].Status == datastruct.REQUESTED {
+			return laboratoryData.RiwayatStatus[i].ClientID
+		}
+	}
+
+	return laboratoryData.ClientID
+}
+
+func (laboratoryData *LaboratoryData) StatusString() string {
+	return LabOrderStatusString(laboratoryData.CurrentStatus())
+}
+
+func LabOrderStatusString(status datastruct.LabOrderStatus) string {
+	switch status {
+	case datastruct.REQUESTED:
+		return "Diminta"
+	case datastruct.SPECIMEN_COLLECTED:
+		return "Spesimen diambil"
+	case datastruct.RECEIVED:
+		return "Spesimen diterima"
+	case datastruct.IN_ANALYSIS:
+		return "Dalam analisis"
+	case datastruct.VALIDATED:
+		return "Tervalidasi"
+	case datastruct.REPORTED:
+		return "Dilaporkan"
+	case datastruct.ACKNOWLEDGED:
+		return "Diterima pengirim"
+	case datastruct.CANCELLED:
+		return "Dibatalkan"
+	case datastruct.REJECTED:
+		return "Ditolak"
+	default:
+		return ""
+	}
+}
@@ -1,17 +1,26 @@
 package laboratory
 
 import (
+	"errors"
+	"service-lab/blindindex"
 	"service-lab/datastruct"
+	"service-lab/signing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var InvalidEncounterError = errors.New("id_kunjungan must be the ID of an encounter")
+
 type LabExaminationResult struct {
-	NilaiHasil   string                       `json:"nilai_hasil" binding:"required" bson:"nilai_hasil"`
-	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" binding:"required" bson:"nilai_normal"`
-	NilaiRujukan string                       `json:"nilai_rujukan" binding:"required" bson:"nilai_rujukan"`
-	NilaiKritis  string                       `json:"nilai_kritis" binding:"required" bson:"nilai_kritis"`
+	NilaiHasil   string                       `json:"nilai_hasil" bson:"nilai_hasil"`
+	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" bson:"nilai_normal"`
+	NilaiRujukan string                       `json:"nilai_rujukan" bson:"nilai_rujukan"`
+	NilaiKritis  string                       `json:"nilai_kritis" bson:"nilai_kritis"`
+
+	BatasKritisBawah *float64 `json:"batas_kritis_bawah" bson:"batas_kritis_bawah,omitempty"`
+	BatasKritisAtas  *float64 `json:"batas_kritis_atas" bson:"batas_kritis_atas,omitempty"`
+	TandaiKritis     bool     `json:"tandai_kritis" bson:"tandai_kritis,omitempty"`
 }
 
 type ConfidentialLabData struct {
@@ -27,35 +36,43 @@ type ConfidentialLabData struct {
 	Diagnosis                       string                         `json:"diagnosis" bson:"diagnosis"`
 	CatatanPermintaan               string                         `json:"catatan_permintaan" bson:"catatan_permintaan"`
 
-	MetodePengiriman          datastruct.SendingMethod `json:"metode_pengiriman" binding:"required" bson:"metode_pengiriman"`
-	SumberSpesimen            string                   `json:"sumber_spesimen" binding:"required" bson:"sumber_spesimen"`
-	LokasiPengambilanSpesimen string                   `json:"lokasi_pengambilan_spesimen" binding:"required" bson:"lokasi_pengambilan_spesimen"`
-	JumlahSpesimen            uint8                    `json:"jumlah_spesimen" binding:"required" bson:"jumlah_spesimen"`
-	VolumeSpesimen            uint16                   `json:"volume_spesimen" binding:"required" bson:"volume_spesimen"`
-	MetodePengambilanSpesimen string                   `json:"metode_pengambilan_spesimen" binding:"required" bson:"metode_pengambilan_spesimen"`
-	WaktuPengambilanSpesimen  time.Time                `json:"waktu_pengambilan_spesimen" binding:"required" bson:"waktu_pengambilan_spesimen"`
-	KondisiSpesimen           string                   `json:"kondisi_spesimen" binding:"required" bson:"kondisi_spesimen"`
-
-	WaktuFiksasi  time.Time `json:"waktu_fiksasi" binding:"required" bson:"waktu_fiksasi"`
-	CairanFiksasi string    `json:"cairan_fiksasi" binding:"required" bson:"cairan_fiksasi"`
-	VolumeCairan  uint16    `json:"volume_cairan" binding:"required" bson:"volume_cairan"`
-
-	PetugasPengambilSpesimen    string `json:"petugas_pengambil_spesimen" binding:"required" bson:"petugas_pengambil_spesimen"`
-	PetugasPengantarSpesimen    string `json:"petugas_pengantar_spesimen" binding:"required" bson:"petugas_pengantar_spesimen"`
-	PetugasPenerimaSpesimen     string `json:"petugas_penerima_spesimen" binding:"required" bson:"petugas_penerima_spesimen"`
-	PetugasPenganalisisSpesimen string `json:"petugas_penganalisis_spesimen" binding:"required" bson:"petugas_penganalisis_spesimen"`
-
-	WaktuPengolahanSpesimen time.Time            `json:"waktu_pengolahan_spesimen" binding:"required" bson:"waktu_pengolahan_spesimen"`
-	HasilPemeriksaan        LabExaminationResult `json:"hasil_pemeriksaan" binding:"required" bson:"hasil_pemeriksaan"`
-	InterpretasiHasil       string               `json:"interpretasi_hasil" binding:"required" bson:"interpretasi_hasil"`
-
-	DokterValidatorPemeriksaan        string `json:"dokter_validator_pemeriksaan" binding:"required" bson:"dokter_validator_pemeriksaan"`
-	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" binding:"required" bson:"dokter_penginterpretasi_pemeriksaan"`
-
-	WaktuHasilKeluarLab            time.Time `json:"waktu_hasil_keluar_lab" binding:"required" bson:"waktu_hasil_keluar_lab"`
-	WaktuHasilDiterimaUnitPengirim time.Time `json:"waktu_hasil_diterima_unit_pengirim" binding:"required" bson:"waktu_hasil_diterima_unit_pengirim"`
+	MetodePengiriman datastruct.SendingMethod `json:"metode_pengiriman" binding:"required" bson:"metode_pengiriman"`
+
+	// written by the lifecycle transitions, an update keeps them as they
+	// were stored
+	SumberSpesimen            string    `json:"sumber_spesimen" bson:"sumber_spesimen"`
+	LokasiPengambilanSpesimen string    `json:"lokasi_pengambilan_spesimen" bson:"lokasi_pengambilan_spesimen"`
+	JumlahSpesimen            uint8     `json:"jumlah_spesimen" bson:"jumlah_spesimen"`
+	VolumeSpesimen            uint16    `json:"volume_spesimen" bson:"volume_spesimen"`
+	MetodePengambilanSpesimen string    `json:"metode_pengambilan_spesimen" bson:"metode_pengambilan_spesimen"`
+	WaktuPengambilanSpesimen  time.Time `json:"waktu_pengambilan_spesimen" bson:"waktu_pengambilan_spesimen"`
+	KondisiSpesimen           string    `json:"kondisi_spesimen" bson:"kondisi_spesimen"`
+
+	WaktuFiksasi  time.Time `json:"waktu_fiksasi" bson:"waktu_fiksasi"`
+	CairanFiksasi string    `json:"cairan_fiksasi" bson:"cairan_fiksasi"`
+	VolumeCairan  uint16    `json:"volume_cairan" bson:"volume_cairan"`
+
+	PetugasPengambilSpesimen    string `json:"petugas_pengambil_spesimen" bson:"petugas_pengambil_spesimen"`
+	PetugasPengantarSpesimen    string `json:"petugas_pengantar_spesimen" bson:"petugas_pengantar_spesimen"`
+	PetugasPenerimaSpesimen     string `json:"petugas_penerima_spesimen" bson:"petugas_penerima_spesimen"`
+	PetugasPenganalisisSpesimen string `json:"petugas_penganalisis_spesimen" bson:"petugas_penganalisis_spesimen"`
+
+	WaktuPengolahanSpesimen time.Time            `json:"waktu_pengolahan_spesimen" bson:"waktu_pengolahan_spesimen"`
+	HasilPemeriksaan        LabExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+	HasilAnalit             []AnalyteResult      `json:"hasil_analit" bson:"hasil_analit,omitempty"`
+	InterpretasiHasil       string               `json:"interpretasi_hasil" bson:"interpretasi_hasil"`
+
+	DokterValidatorPemeriksaan        string `json:"dokter_validator_pemeriksaan" bson:"dokter_validator_pemeriksaan"`
+	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" bson:"dokter_penginterpretasi_pemeriksaan"`
+
+	WaktuHasilKeluarLab            time.Time `json:"waktu_hasil_keluar_lab" bson:"waktu_hasil_keluar_lab"`
+	WaktuHasilDiterimaUnitPengirim time.Time `json:"waktu_hasil_diterima_unit_pengirim" bson:"waktu_hasil_diterima_unit_pengirim"`
 }
 
+// SpecimenTimeField is the field of the blind index of the specimen
+// collection time.
+const SpecimenTimeField = "waktu_pengambilan_spesimen"
+
 type LaboratoryData struct {
 	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 
@@ -68,18 +85,76 @@ type LaboratoryData struct {
 
 	// IDPelanggan string `json:"id_pelanggan" binding:"required" bson:"id_pelanggan"`
 	// NoPermintaan           *string `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
-	NamaPemeriksaan        string `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
-	NoIHS                  string `json:"no_ihs" binding:"required" bson:"no_ihs"`
-	NamaFasyankesPemeriksa string `json:"nama_fasyankes_pemeriksa" binding:"required" bson:"nama_fasyankes_pemeriksa"`
+	KodePemeriksaan        string   `json:"kode_pemeriksaan" bson:"kode_pemeriksaan,omitempty"`
+	KodeAnalit             []string `json:"kode_analit" bson:"kode_analit,omitempty"`
+	NamaPemeriksaan        string   `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
+	NoIHS                  string   `json:"no_ihs" binding:"required" bson:"no_ihs"`
+	NamaFasyankesPemeriksa string   `json:"nama_fasyankes_pemeriksa" binding:"required" bson:"nama_fasyankes_pemeriksa"`
+
+	// IDKunjungan is the encounter the order was placed in, if any.
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	StatusPemeriksaan datastruct.LabOrderStatus `json:"status_pemeriksaan" bson:"status_pemeriksaan,omitempty"`
+	RiwayatStatus     []LabStatusHistory        `json:"riwayat_status" bson:"riwayat_status,omitempty"`
 
 	ConfidentialData      *ConfidentialLabData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary    `json:"encrypted_confidential,omitempty" bson:"encrypted_confidential"`
 
+	// IndeksWaktuSpesimen searches the encrypted specimen collection time by
+	// its tokens.
+	IndeksWaktuSpesimen []string `json:"-" bson:"indeks_waktu_spesimen,omitempty"`
+
+	// TandaTanganDigital is the signature of the validator over the
+	// validated result, made with their own key.
+	TandaTanganDigital *signing.Signature `json:"tanda_tangan_digital,omitempty" bson:"tanda_tangan_digital,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
 }
 
+// SignedLabResult is what the validator signs: the result as it was
+// validated, without the reporting and acknowledgement that follow.
+type SignedLabResult struct {
+	ID                       string    `json:"_id"`
+	NoRegistrasiLab          string    `json:"no_registrasi_lab"`
+	NoIHS                    string    `json:"no_ihs"`
+	KodePemeriksaan          string    `json:"kode_pemeriksaan"`
+	NamaPemeriksaan          string    `json:"nama_pemeriksaan"`
+	WaktuPengambilanSpesimen time.Time `json:"waktu_pengambilan_spesimen"`
+
+	HasilPemeriksaan                  LabExaminationResult `json:"hasil_pemeriksaan"`
+	HasilAnalit                       []AnalyteResult      `json:"hasil_analit"`
+	InterpretasiHasil                 string               `json:"interpretasi_hasil"`
+	DokterValidatorPemeriksaan        string               `json:"dokter_validator_pemeriksaan"`
+	DokterPenginterpretasiPemeriksaan string               `json:"dokter_penginterpretasi_pemeriksaan"`
+}
+
+type SignBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SignedContent returns the part of the document the validator signs. The
+// confidential data must be decrypted.
+func (laboratoryData *LaboratoryData) SignedContent() SignedLabResult {
+	confidential := laboratoryData.ConfidentialData
+
+	return SignedLabResult{
+		ID:                       laboratoryData.ID.Hex(),
+		NoRegistrasiLab:          laboratoryData.NoRegistrasiLab,
+		NoIHS:                    laboratoryData.NoIHS,
+		KodePemeriksaan:          laboratoryData.KodePemeriksaan,
+		NamaPemeriksaan:          laboratoryData.NamaPemeriksaan,
+		WaktuPengambilanSpesimen: confidential.WaktuPengambilanSpesimen,
+
+		HasilPemeriksaan:                  confidential.HasilPemeriksaan,
+		HasilAnalit:                       confidential.HasilAnalit,
+		InterpretasiHasil:                 confidential.InterpretasiHasil,
+		DokterValidatorPemeriksaan:        confidential.DokterValidatorPemeriksaan,
+		DokterPenginterpretasiPemeriksaan: confidential.DokterPenginterpretasiPemeriksaan,
+	}
+}
+
 func (laboratoryData *LaboratoryData) PriorityString() string {
 	switch laboratoryData.ConfidentialData.PrioritasPemeriksaan {
 	case datastruct.CITO:
@@ -112,3 +187,77 @@ func (examinationResult *LabExaminationResult) NormalResultString() string {
 		return ""
 	}
 }
+
+func (examinationResult *LabExaminationResult) NumericValue() (float64, error) {
+	return parseResultValue(examinationResult.NilaiHasil)
+}
+
+// IsCritical reports whether the result falls in the critical range, either
+// because the validator flagged it or because the value crosses a bound.
+func (examinationResult *LabExaminationResult) IsCritical() bool {
+	if examinationResult.TandaiKritis {
+		return true
+	}
+
+	value, err := examinationResult.NumericValue()
+	if err != nil {
+		return false
+	}
+
+	if examinationResult.BatasKritisBawah != nil && value <= *examinationResult.BatasKritisBawah {
+		return true
+	}
+
+	if examinationResult.BatasKritisAtas != nil && value >= *examinationResult.BatasKritisAtas {
+		return true
+	}
+
+	return false
+}
+
+// HasCriticalResult reports whether the single result or any analyte of the
+// panel is in the critical range.
+func (data *ConfidentialLabData) HasCriticalResult() bool {
+	if data.HasilPemeriksaan.IsCritical() {
+		return true
+	}
+
+	for i := 0; i < len(data.HasilAnalit); i++ {
+		if data.HasilAnalit[i].Kritis {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (data *ConfidentialLabData) SexString() string {
+	if data.JenisKelamin == nil {
+		return ""
+	}
+
+	switch *data.JenisKelamin {
+	case datastruct.UNKNOWN:
+		return "Tidak diketahui"
+	case datastruct.MALE:
+		return "Laki-laki"
+	case datastruct.FEMALE:
+		return "Perempuan"
+	case datastruct.UNDEFINED:
+		return "Tidak dapat ditentukan"
+	case datastruct.NOTFILLED:
+		return "Tidak mengisi"
+	default:
+		return ""
+	}
+}
+
+// Index makes the tokens of the specimen collection time. It must be called
+// before the confidential data is encrypted.
+func (laboratoryData *LaboratoryData) Index(index *blindindex.Index) {
+	if laboratoryData.ConfidentialData == nil {
+		return
+	}
+
+	laboratoryData.IndeksWaktuSpesimen = index.DateTokens(SpecimenTimeField, laboratoryData.ConfidentialData.WaktuPengambilanSpesimen)
+}
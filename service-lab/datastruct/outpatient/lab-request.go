@@ -1,7 +1,9 @@
 package specialityexamination
 
 import (
+	"service-lab/blindindex"
 	"service-lab/datastruct"
+	"service-lab/datastruct/laboratory"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,6 +14,10 @@ type LabExaminationResult struct {
 	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" bson:"nilai_normal"`
 	NilaiRujukan string                       `json:"nilai_rujukan" bson:"nilai_rujukan"`
 	NilaiKritis  string                       `json:"nilai_kritis" bson:"nilai_kritis"`
+
+	BatasKritisBawah *float64 `json:"batas_kritis_bawah" bson:"batas_kritis_bawah,omitempty"`
+	BatasKritisAtas  *float64 `json:"batas_kritis_atas" bson:"batas_kritis_atas,omitempty"`
+	TandaiKritis     bool     `json:"tandai_kritis" bson:"tandai_kritis,omitempty"`
 }
 
 type ConfidentialLabRequestData struct {
@@ -44,9 +50,10 @@ type ConfidentialLabRequestData struct {
 	PetugasPenerimaSpesimen     string `json:"petugas_penerima_spesimen" bson:"petugas_penerima_spesimen"`
 	PetugasPenganalisisSpesimen string `json:"petugas_penganalisis_spesimen" bson:"petugas_penganalisis_spesimen"`
 
-	WaktuPengolahanSpesimen time.Time            `json:"waktu_pengolahan_spesimen" bson:"waktu_pengolahan_spesimen"`
-	HasilPemeriksaan        LabExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
-	InterpretasiHasil       string               `json:"interpretasi_hasil" bson:"interpretasi_hasil"`
+	WaktuPengolahanSpesimen time.Time                  `json:"waktu_pengolahan_spesimen" bson:"waktu_pengolahan_spesimen"`
+	HasilPemeriksaan        LabExaminationResult       `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+	HasilAnalit             []laboratory.AnalyteResult `json:"hasil_analit" bson:"hasil_analit,omitempty"`
+	InterpretasiHasil       string                     `json:"interpretasi_hasil" bson:"interpretasi_hasil"`
 
 	DokterValidatorPemeriksaan        string `json:"dokter_validator_pemeriksaan" bson:"dokter_validator_pemeriksaan"`
 	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" bson:"dokter_penginterpretasi_pemeriksaan"`
@@ -67,13 +74,22 @@ type LaboratoryRequest struct {
 
 	// IDPelanggan string `json:"id_pelanggan" bson:"id_pelanggan"`
 	// NoPermintaan           string `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
-	NamaPemeriksaan        string `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
-	NoIHS                  string `json:"no_ihs" binding:"required" bson:"no_ihs"`
-	NamaFasyankesPemeriksa string `json:"nama_fasyankes_pemeriksa" bson:"nama_fasyankes_pemeriksa"`
+	KodePemeriksaan        string   `json:"kode_pemeriksaan" bson:"kode_pemeriksaan,omitempty"`
+	KodeAnalit             []string `json:"kode_analit" bson:"kode_analit,omitempty"`
+	NamaPemeriksaan        string   `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
+	NoIHS                  string   `json:"no_ihs" binding:"required" bson:"no_ihs"`
+	NamaFasyankesPemeriksa string   `json:"nama_fasyankes_pemeriksa" bson:"nama_fasyankes_pemeriksa"`
+
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	StatusPemeriksaan datastruct.LabOrderStatus     `json:"status_pemeriksaan" bson:"status_pemeriksaan,omitempty"`
+	RiwayatStatus     []laboratory.LabStatusHistory `json:"riwayat_status" bson:"riwayat_status,omitempty"`
 
 	ConfidentialData      *ConfidentialLabRequestData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary           `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
+	IndeksWaktuSpesimen []string `json:"-" bson:"indeks_waktu_spesimen,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
@@ -111,3 +127,13 @@ func (examinationResult *LabExaminationResult) NormalResultString() string {
 		return ""
 	}
 }
+
+// Index makes the tokens of the specimen collection time, the same as
+// laboratory.LaboratoryData does.
+func (laboratoryRequest *LaboratoryRequest) Index(index *blindindex.Index) {
+	if laboratoryRequest.ConfidentialData == nil {
+		return
+	}
+
+	laboratoryRequest.IndeksWaktuSpesimen = index.DateTokens(laboratory.SpecimenTimeField, laboratoryRequest.ConfidentialData.WaktuPengambilanSpesimen)
+}
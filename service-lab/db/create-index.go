@@ -53,3 +53,34 @@ func CreateKeyVaultIndex(keyVaultClient *mongo.Client, keyVaultNamespace string)
 	return nil
 
 }
+
+// CreatePatientListIndex serves the list of a patient, which is paged in
+// the order of the IDs.
+func CreatePatientListIndex(client *mongo.Client) error {
+	listIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("fasyankes").Collection("laboratorium").Indexes().CreateOne(context.TODO(), listIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create patient list index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateLabCatalogIndex keeps a LOINC code registered once. The catalog is
+// shared by every facility, so the code is unique across clients.
+func CreateLabCatalogIndex(client *mongo.Client) error {
+	catalogIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "kode_loinc", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("katalog_lab").Indexes().CreateOne(context.TODO(), catalogIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create lab catalog index: %v", err)
+	}
+
+	return nil
+}
@@ -21,6 +21,16 @@ func main() {
 		return
 	}
 
+	if err := db.CreatePatientListIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateLabCatalogIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
 	csfle := csfle.InitCSFLE(&cfg, client)
 
 	err := csfle.CreateClientEncryption(keyVaultNamespace).GetKey()
@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"service-lab/logger"
+	"service-lab/utils"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	AlertID         string `json:"alert_id"`
+	NoIHS           string `json:"no_ihs"`
+	ClientID        string `json:"client_id"`
+	Penerima        string `json:"penerima"`
+	NoTelpPenerima  string `json:"no_telp_penerima"`
+	Judul           string `json:"judul"`
+	Isi             string `json:"isi"`
+	TingkatEskalasi int    `json:"tingkat_eskalasi"`
+}
+
+// Notifier delivers a critical result alert to the clinician's client.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, msg Message) error
+}
+
+type LogNotifier struct{}
+
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func New(kind, webhookURL string) Notifier {
+	switch kind {
+	case "webhook":
+		return &WebhookNotifier{
+			URL:    webhookURL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return &LogNotifier{}
+	}
+}
+
+func (n *LogNotifier) Name() string {
+	return "log"
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	logger.LogWarning.Printf("CRITICAL ALERT [%s] | ClientID: %s | Penerima: %s | Eskalasi: %d | %s\n",
+		msg.AlertID,
+		msg.ClientID,
+		msg.Penerima,
+		msg.TingkatEskalasi,
+		msg.Judul,
+	)
+
+	return nil
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify posts the alert as JSON, signed with the service key so the
+// receiving client can check where the alert came from.
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Message) error {
+	if n.URL == "" {
+		return fmt.Errorf("webhook url is not configured")
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	url := strings.ReplaceAll(n.URL, "{client_id}", msg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+	req.Header.Add("X-Signature", utils.GenerateSignature(string(body)))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"service-lab/datastruct"
 	"service-lab/db/csfle"
 	"service-lab/middleware"
+	"service-lab/pagination"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,6 +24,10 @@ func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
 		LabController: fasyankes_controllers.InitLabController(client, csfle),
 	}
 
+	go routerConfig.LabController.AlertController.RunEscalation(
+		time.Duration(config.CriticalAlertCheckInterval) * time.Second,
+	)
+
 	return routerConfig.SetRouter()
 }
 
@@ -32,6 +37,12 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 
 	router.GET("/live", LivenessCheck())
 	router.GET("/ready", ReadinessCheck(routerConfig.Client))
+
+	// printed documents are verified by scanning their QR code
+	router.GET(fasyankes_controllers.DocumentVerifyPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"fingerprint"}}),
+		routerConfig.LabController.VerifyLabReportHandler())
+
 	router.Use(middleware.CORS(), middleware.Timekeep(time.Duration(config.TimestampSkew)*time.Millisecond))
 
 	// Define routes
@@ -53,7 +64,7 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	}
 
 	ap2 := middleware.AcceptableParams{
-		Queries: []string{"nama_pemeriksaan", "noIHS", "no_registrasi_lab", "nik"},
+		Queries: append([]string{"nama_pemeriksaan", "noIHS", "no_registrasi_lab", "nik", "kode_pemeriksaan", "spesimen_from", "spesimen_to", "id_kunjungan"}, pagination.Queries...),
 	}
 	resource.GET("/laboratory/:noIHS",
 		middleware.GetConsent(consentGetter),
@@ -79,9 +90,122 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		middleware.Sanitize(ap),
 		fasyankes_controllers.ConsentHandler(routerConfig.LabController.ConsentCollection))
 
+	ap3 := middleware.AcceptableParams{
+		Queries: []string{"from", "to"},
+	}
+
+	resource.GET("/laboratory/turnaround",
+		middleware.Sanitize(ap3),
+		routerConfig.LabController.GetTurnaroundReportHandler())
+
+	ap5 := middleware.AcceptableParams{
+		Queries: append([]string{"q", "jenis_spesimen"}, pagination.Queries...),
+	}
+
+	catalogUpdateConfig := map[string]string{
+		"filterKey": "kode_loinc",
+		"paramKey":  "kode",
+	}
+
+	resource.GET("/laboratory/catalog",
+		middleware.Sanitize(ap5),
+		routerConfig.LabController.GetLabCatalogHandler())
+
+	resource.GET("/laboratory/catalog/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.LabController.GetLabTestHandler())
+
+	resource.POST("/laboratory/catalog",
+		middleware.Sanitize(ap),
+		routerConfig.LabController.CreateLabTestHandler())
+
+	resource.PUT("/laboratory/catalog/:kode",
+		middleware.AuthorizationUpdate(catalogUpdateConfig, routerConfig.LabController.CatalogCollection),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.UpdateLabTestHandler())
+
+	resource.DELETE("/laboratory/catalog/:kode",
+		middleware.AuthorizationDelete(catalogUpdateConfig, routerConfig.LabController.CatalogCollection),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.DeleteLabTestHandler())
+
+	ap4 := middleware.AcceptableParams{
+		Queries: append([]string{"status"}, pagination.Queries...),
+	}
+
+	resource.GET("/laboratory/alert",
+		middleware.Sanitize(ap4),
+		routerConfig.LabController.AlertController.GetLaboratoryAlertsHandler())
+
+	resource.GET("/laboratory/:noIHS/:Id/turnaround",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.GetLabOrderTurnaroundHandler())
+
+	resource.GET("/laboratory/:noIHS/:Id/pdf",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.LabReportHandler())
+
+	resource.GET("/laboratory/:noIHS/trend/:kode",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap3),
+		routerConfig.LabController.GetAnalyteTrendHandler())
+
+	resource.PUT("/laboratory/:noIHS/:Id/analyte/:kode",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.RecordAnalyteHandler())
+
+	resource.POST("/laboratory/:noIHS/:Id/specimen-collected",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.SPECIMEN_COLLECTED))
+
+	resource.POST("/laboratory/:noIHS/:Id/received",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.RECEIVED))
+
+	resource.POST("/laboratory/:noIHS/:Id/in-analysis",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.IN_ANALYSIS))
+
+	resource.POST("/laboratory/:noIHS/:Id/validated",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.VALIDATED))
+
+	resource.POST("/laboratory/:noIHS/:Id/reported",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.REPORTED))
+
+	resource.POST("/laboratory/:noIHS/:Id/rejected",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.REJECTED))
+
+	resource.POST("/laboratory/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.SignLabResultHandler())
+
+	resource.GET("/laboratory/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.LabResultSignatureHandler())
+
 	request := v1.Group("/request")
 	request.Use(middleware.Authorization(datastruct.DOKTER))
 
+	// the list of a patient, e.g. for the timeline of the outpatient service
+	request.GET("/laboratory/:noIHS",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap2),
+		routerConfig.LabController.GetAllLabDataHandler())
+
 	request.GET("/laboratory/:noIHS/:Id",
 		middleware.GetConsent(consentGetter),
 		routerConfig.LabController.GetLabDataById())
@@ -89,5 +213,46 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	request.POST("/laboratory",
 		routerConfig.LabController.CreateLabRequest())
 
+	request.GET("/laboratory/catalog",
+		middleware.Sanitize(ap5),
+		routerConfig.LabController.GetLabCatalogHandler())
+
+	request.GET("/laboratory/catalog/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.LabController.GetLabTestHandler())
+
+	request.GET("/laboratory/alert",
+		middleware.Sanitize(ap4),
+		routerConfig.LabController.AlertController.GetClinicianAlertsHandler())
+
+	request.POST("/laboratory/alert/:alertId/acknowledge",
+		middleware.Sanitize(ap),
+		routerConfig.LabController.AlertController.AcknowledgeAlertHandler())
+
+	request.GET("/laboratory/:noIHS/:Id/pdf",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.LabReportHandler())
+
+	request.GET("/laboratory/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.LabResultSignatureHandler())
+
+	request.GET("/laboratory/:noIHS/trend/:kode",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap3),
+		routerConfig.LabController.GetAnalyteTrendHandler())
+
+	request.POST("/laboratory/:noIHS/:Id/acknowledged",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.ACKNOWLEDGED))
+
+	request.POST("/laboratory/:noIHS/:Id/cancelled",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.LabController.TransitionLabOrderHandler(datastruct.CANCELLED))
+
 	return router
 }
@@ -0,0 +1,212 @@
+package blindindex
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// MinPrefix is the shortest part of a name that can be searched. Shorter
+	// prefixes match too many patients to be of use and tell too much about
+	// the names stored.
+	MinPrefix = 3
+	MaxPrefix = 16
+)
+
+var (
+	DisabledError     = errors.New("searching encrypted fields is not set up on this service")
+	PrefixShortError  = errors.New("every word searched must have at least 3 letters")
+	InvalidRangeError = errors.New("the end of the range must not be before its start")
+)
+
+// earliest is where a range without a start begins.
+var earliest = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Index turns the values of encrypted fields into tokens that are stored
+// along the document and can be searched for, while the values themselves
+// stay encrypted. A token is the keyed hash of the field and a value, so
+// the same value makes different tokens in different fields and without
+// the key the tokens cannot be guessed from the values.
+type Index struct {
+	key []byte
+}
+
+// New makes the index with the key. An index without a key is disabled:
+// it makes no tokens and cannot be searched.
+func New(key []byte) *Index {
+	return &Index{key: key}
+}
+
+func (index *Index) Enabled() bool {
+	return len(index.key) > 0
+}
+
+// Fingerprint tells the key tokens are made with, so the documents indexed
+// with an earlier key or before the key was set can be found and indexed
+// again. It is empty while the index is disabled.
+func (index *Index) Fingerprint() string {
+	if !index.Enabled() {
+		return ""
+	}
+
+	return index.token("", "")
+}
+
+func (index *Index) token(field, value string) string {
+	mac := hmac.New(sha256.New, index.key)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// words splits a name into its words, in lower case and without the marks
+// between them, e.g. "Ni Made O'Neil" into "ni", "made" and "oneil".
+func words(name string) []string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		case r == '\'' || r == '.' || r == '`':
+			return -1
+		default:
+			return ' '
+		}
+	}, name)
+
+	return strings.Fields(name)
+}
+
+// NameTokens makes a token of every prefix of every word of the name, so
+// the name can be found by the start of any of its words.
+func (index *Index) NameTokens(field, name string) []string {
+	if !index.Enabled() {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	tokens := []string{}
+	for _, word := range words(name) {
+		letters := []rune(word)
+		for length := MinPrefix; length <= len(letters) && length <= MaxPrefix; length++ {
+			prefix := string(letters[:length])
+			if seen[prefix] {
+				continue
+			}
+			seen[prefix] = true
+			tokens = append(tokens, index.token(field, prefix))
+		}
+	}
+
+	return tokens
+}
+
+// NameQuery makes the tokens a name must all have to match the query, one
+// for every word searched.
+func (index *Index) NameQuery(field, query string) ([]string, error) {
+	if !index.Enabled() {
+		return nil, DisabledError
+	}
+
+	tokens := []string{}
+	for _, word := range words(query) {
+		letters := []rune(word)
+		if len(letters) < MinPrefix {
+			return nil, PrefixShortError
+		}
+		if len(letters) > MaxPrefix {
+			letters = letters[:MaxPrefix]
+		}
+		tokens = append(tokens, index.token(field, string(letters)))
+	}
+
+	if len(tokens) == 0 {
+		return nil, PrefixShortError
+	}
+
+	return tokens, nil
+}
+
+func yearValue(date time.Time) string  { return date.Format("2006") }
+func monthValue(date time.Time) string { return date.Format("2006-01") }
+func dayValue(date time.Time) string   { return date.Format(time.DateOnly) }
+
+// DateTokens makes a token of the year, the month and the day of the date,
+// taken in UTC. A zero date makes none.
+func (index *Index) DateTokens(field string, date time.Time) []string {
+	if !index.Enabled() || date.IsZero() {
+		return nil
+	}
+
+	date = date.UTC()
+	return []string{
+		index.token(field, yearValue(date)),
+		index.token(field, monthValue(date)),
+		index.token(field, dayValue(date)),
+	}
+}
+
+// DateQuery makes the tokens of which a date in the range has one, the
+// last day included. The range is covered by whole years and months where
+// it can, so a range of decades still takes only a few dozen tokens.
+func (index *Index) DateQuery(field string, from, to time.Time) ([]string, error) {
+	if !index.Enabled() {
+		return nil, DisabledError
+	}
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if to.Before(from) {
+		return nil, InvalidRangeError
+	}
+
+	tokens := []string{}
+	for day := from; !day.After(to); {
+		if day.YearDay() == 1 && !day.AddDate(1, 0, -1).After(to) {
+			tokens = append(tokens, index.token(field, yearValue(day)))
+			day = day.AddDate(1, 0, 0)
+		} else if day.Day() == 1 && !day.AddDate(0, 1, -1).After(to) {
+			tokens = append(tokens, index.token(field, monthValue(day)))
+			day = day.AddDate(0, 1, 0)
+		} else {
+			tokens = append(tokens, index.token(field, dayValue(day)))
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	return tokens, nil
+}
+
+// ParseRange reads a range of dates given as YYYY-MM-DD. A range without a
+// start begins in 1900 and one without an end ends today.
+func ParseRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start, end := earliest, now.UTC()
+
+	if from != "" {
+		date, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return start, end, err
+		}
+		start = date
+	}
+
+	if to != "" {
+		date, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return start, end, err
+		}
+		end = date
+	}
+
+	if end.Before(start) {
+		return start, end, InvalidRangeError
+	}
+
+	return start, end, nil
+}
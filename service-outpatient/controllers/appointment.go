@@ -0,0 +1,797 @@
+package emr_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-outpatient/datastruct"
+	"service-outpatient/datastruct/outpatient/scheduling"
+	"service-outpatient/logger"
+	"service-outpatient/pagination"
+	"service-outpatient/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newAppointmentHistory(c *gin.Context, status datastruct.AppointmentStatus, reason string, now time.Time) scheduling.AppointmentStatusHistory {
+	return scheduling.AppointmentStatusHistory{
+		Status:  status,
+		Petugas: c.GetString("userIdentification"),
+		Alasan:  reason,
+		Waktu:   now,
+	}
+}
+
+// signAppointment signs the appointment as it is stored.
+func signAppointment(appointment *scheduling.Appointment) error {
+	id := appointment.ID
+	appointment.Signature = nil
+	appointment.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(appointment)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	appointment.Signature = &signature
+	appointment.ID = id
+
+	return nil
+}
+
+// sealAppointment encrypts the chief complaint of a new or revealed
+// appointment and signs it. An appointment read from the collection keeps
+// the complaint it was stored with.
+func (schedulingController *SchedulingController) sealAppointment(appointment *scheduling.Appointment) error {
+	if appointment.KeluhanEncrypted == nil {
+		appointment.KeluhanEncrypted = utils.EncryptRandom(
+			appointment.Keluhan,
+			schedulingController.ClientEncryption,
+			schedulingController.EncryptionOpts,
+		)
+	}
+	appointment.Keluhan = ""
+
+	return signAppointment(appointment)
+}
+
+// verifiedAppointment tells whether the stored appointment still carries a
+// valid signature.
+func verifiedAppointment(appointment *scheduling.Appointment) bool {
+	if appointment.Signature == nil {
+		return false
+	}
+
+	signature := appointment.Signature
+	id := appointment.ID
+	appointment.Signature = nil
+	appointment.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(appointment)
+	appointment.Signature = signature
+	appointment.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// revealAppointment decrypts the chief complaint of a sealed appointment
+// for a response.
+func (schedulingController *SchedulingController) revealAppointment(appointment *scheduling.Appointment) {
+	if appointment.KeluhanEncrypted != nil {
+		utils.Decrypt(
+			appointment.KeluhanEncrypted,
+			schedulingController.ClientEncryption,
+		).Unmarshal(&appointment.Keluhan)
+	}
+
+	appointment.KeluhanEncrypted = nil
+}
+
+// verifiedAppointments leaves out the appointments failing their seal and
+// reveals the others.
+func (schedulingController *SchedulingController) verifiedAppointments(appointments []scheduling.Appointment) []scheduling.Appointment {
+	verified := []scheduling.Appointment{}
+	for i := 0; i < len(appointments); i++ {
+		if !verifiedAppointment(&appointments[i]) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointments[i].ID.Hex())
+			continue
+		}
+
+		schedulingController.revealAppointment(&appointments[i])
+		verified = append(verified, appointments[i])
+	}
+
+	return verified
+}
+
+// findAppointment loads the appointment of the path. Appointments failing
+// their seal are refused.
+func (schedulingController *SchedulingController) findAppointment(c *gin.Context) (*scheduling.Appointment, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("appointmentId"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":        id,
+		"client_id":  c.GetString("userClient"),
+		"deleted_at": nil,
+	}
+
+	var appointment scheduling.Appointment
+	if err := schedulingController.AppointmentCollection.FindOne(context.Background(), filter).Decode(&appointment); err != nil {
+		return nil, err
+	}
+
+	if !verifiedAppointment(&appointment) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointment.ID.Hex())
+		return nil, scheduling.TamperedError
+	}
+
+	return &appointment, nil
+}
+
+// storeAppointment replaces a sealed appointment unless it was changed
+// since it was read.
+func storeAppointment(collection *mongo.Collection, appointment *scheduling.Appointment, previousUpdate *time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":        appointment.ID,
+		"updated_at": previousUpdate,
+	}
+
+	result, err := collection.ReplaceOne(context.Background(), filter, appointment)
+	if mongo.IsDuplicateKeyError(err) {
+		// the booking index holds one upcoming appointment of the patient
+		// per schedule and day
+		return false, scheduling.AlreadyBookedError
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// updateAppointment seals and replaces the appointment unless it was
+// changed since it was read.
+func (schedulingController *SchedulingController) updateAppointment(appointment *scheduling.Appointment, previousUpdate *time.Time) (bool, error) {
+	if err := schedulingController.sealAppointment(appointment); err != nil {
+		return false, err
+	}
+
+	return storeAppointment(schedulingController.AppointmentCollection, appointment, previousUpdate)
+}
+
+func appointmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound
+	case errors.Is(err, scheduling.ScheduleFullError),
+		errors.Is(err, scheduling.AlreadyBookedError),
+		errors.Is(err, scheduling.InvalidTransitionError),
+		errors.Is(err, scheduling.AppointmentOpenError),
+		errors.Is(err, scheduling.TamperedError):
+		return http.StatusConflict
+	case errors.Is(err, scheduling.InvalidDayError),
+		errors.Is(err, scheduling.PastDayError),
+		errors.Is(err, scheduling.NoPracticeError),
+		errors.Is(err, scheduling.NotTodayError),
+		errors.Is(err, primitive.ErrInvalidHex):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// bookSlot checks the patient can be booked on the schedule on the day and
+// takes one of its slots.
+func (schedulingController *SchedulingController) bookSlot(c *gin.Context, noIHS string, scheduleID primitive.ObjectID, day string, now time.Time) (*scheduling.PractitionerSchedule, error) {
+	if err := scheduling.Bookable(day, now); err != nil {
+		return nil, err
+	}
+
+	schedule, err := schedulingController.findSchedule(c, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := schedule.PracticesOn(day); err != nil {
+		return nil, err
+	}
+
+	booked, err := schedulingController.AppointmentCollection.CountDocuments(context.Background(), bson.M{
+		"no_ihs":     noIHS,
+		"id_jadwal":  schedule.ID,
+		"tanggal":    day,
+		"status":     bson.M{"$in": upcoming},
+		"deleted_at": nil,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if booked > 0 {
+		return nil, scheduling.AlreadyBookedError
+	}
+
+	if err := schedulingController.takeSlot(schedule, day); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// CreateAppointmentHandler books a patient on a schedule for a day.
+func (schedulingController *SchedulingController) CreateAppointmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body scheduling.AppointmentBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		schedule, err := schedulingController.bookSlot(c, body.NoIHS, body.IDJadwal, body.Tanggal, now)
+		if err != nil {
+			utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		appointment := scheduling.NewAppointment(body, schedule)
+		appointment.ID = primitive.NewObjectID()
+		appointment.ClientID = c.GetString("userClient")
+		appointment.RiwayatStatus = []scheduling.AppointmentStatusHistory{
+			newAppointmentHistory(c, datastruct.JANJI_DIJADWALKAN, "", now),
+		}
+		appointment.CreatedAt = &now
+		appointment.UpdatedAt = &now
+
+		if err := schedulingController.sealAppointment(&appointment); err != nil {
+			if err := schedulingController.releaseSlot(schedule.ID, body.Tanggal); err != nil {
+				logger.LogError.Printf("Failed to release the slot of schedule [%s]: %v\n", schedule.ID.Hex(), err)
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := schedulingController.AppointmentCollection.InsertOne(context.Background(), appointment); err != nil {
+			if err := schedulingController.releaseSlot(schedule.ID, body.Tanggal); err != nil {
+				logger.LogError.Printf("Failed to release the slot of schedule [%s]: %v\n", schedule.ID.Hex(), err)
+			}
+
+			// another booking of the patient got in after the check
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": scheduling.AlreadyBookedError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		schedulingController.revealAppointment(&appointment)
+		utils.JSON(c, http.StatusCreated, appointment)
+	}
+}
+
+// GetAllAppointmentHandler lists the appointments of the client on a day,
+// today unless tanggal is given, by hour and queue number.
+func (schedulingController *SchedulingController) GetAllAppointmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day := c.DefaultQuery("tanggal", scheduling.Today(time.Now()))
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": scheduling.InvalidDayError.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"tanggal":    day,
+			"deleted_at": nil,
+		}
+
+		if poli := c.Query("poli"); poli != "" {
+			filter["poli"] = poli
+		}
+
+		if dokter := c.Query("dokter"); dokter != "" {
+			filter["dokter"] = dokter
+		}
+
+		if status := c.Query("status"); status != "" {
+			value, err := scheduling.ParseAppointmentStatus(status)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = value
+		}
+
+		opts := options.Find().SetSort(bson.D{
+			{Key: "jam_mulai", Value: 1},
+			{Key: "no_antrian", Value: 1},
+			{Key: "_id", Value: 1},
+		})
+
+		cursor, err := schedulingController.AppointmentCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		appointments := []scheduling.Appointment{}
+		if err := cursor.All(context.Background(), &appointments); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, schedulingController.verifiedAppointments(appointments))
+	}
+}
+
+// GetPatientAppointmentHandler lists the appointments of a patient at the
+// client, e.g. with status 6 to see how often they did not show up.
+func (schedulingController *SchedulingController) GetPatientAppointmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"no_ihs":     c.Param("noIHS"),
+			"client_id":  c.GetString("userClient"),
+			"deleted_at": nil,
+		}
+
+		if status := c.Query("status"); status != "" {
+			value, err := scheduling.ParseAppointmentStatus(status)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = value
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := schedulingController.AppointmentCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := schedulingController.AppointmentCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		appointments := []scheduling.Appointment{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var appointment scheduling.Appointment
+			if err := cursor.Decode(&appointment); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = appointment.ID
+
+			if !verifiedAppointment(&appointment) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointment.ID.Hex())
+				continue
+			}
+
+			schedulingController.revealAppointment(&appointment)
+			appointments = append(appointments, appointment)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(appointments, total, last, more))
+	}
+}
+
+func (schedulingController *SchedulingController) GetAppointmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appointment, err := schedulingController.findAppointment(c)
+		if err != nil {
+			utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		schedulingController.revealAppointment(appointment)
+		utils.JSON(c, http.StatusOK, appointment)
+	}
+}
+
+// RescheduleAppointmentHandler moves an appointment to another schedule or
+// day, as long as it could still be cancelled. The slot it held is given
+// back once the new one is taken.
+func (schedulingController *SchedulingController) RescheduleAppointmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body scheduling.RescheduleBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		appointment, err := schedulingController.findAppointment(c)
+		if err != nil {
+			utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := scheduling.CheckTransition(appointment.Status, datastruct.JANJI_DIBATALKAN); err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		schedule, err := schedulingController.bookSlot(c, appointment.NoIHS, body.IDJadwal, body.Tanggal, now)
+		if err != nil {
+			utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		previousSchedule, previousDay, previousUpdate := appointment.IDJadwal, appointment.Tanggal, appointment.UpdatedAt
+
+		appointment.Reschedule(body, schedule)
+		appointment.RiwayatStatus = append(appointment.RiwayatStatus, newAppointmentHistory(c, datastruct.JANJI_DIJADWALKAN, body.Alasan, now))
+		appointment.UpdatedAt = &now
+
+		updated, err := schedulingController.updateAppointment(appointment, previousUpdate)
+		if err != nil || !updated {
+			if err := schedulingController.releaseSlot(schedule.ID, body.Tanggal); err != nil {
+				logger.LogError.Printf("Failed to release the slot of schedule [%s]: %v\n", schedule.ID.Hex(), err)
+			}
+
+			if err != nil {
+				utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusConflict, gin.H{"error": scheduling.ConcurrentUpdateError.Error()})
+			return
+		}
+
+		if err := schedulingController.releaseSlot(previousSchedule, previousDay); err != nil {
+			logger.LogError.Printf("Failed to release the slot of schedule [%s]: %v\n", previousSchedule.Hex(), err)
+		}
+
+		schedulingController.revealAppointment(appointment)
+		utils.JSON(c, http.StatusOK, appointment)
+	}
+}
+
+// TransitionAppointmentHandler moves an appointment to the status. Patients
+// check in on the day of their appointment and are given their queue
+// number then; a cancelled appointment gives its slot back.
+func (schedulingController *SchedulingController) TransitionAppointmentHandler(to datastruct.AppointmentStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body scheduling.StatusBody
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		appointment, err := schedulingController.findAppointment(c)
+		if err != nil {
+			utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := scheduling.CheckTransition(appointment.Status, to); err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previousUpdate := appointment.UpdatedAt
+
+		if to == datastruct.JANJI_CHECK_IN {
+			if appointment.Tanggal != scheduling.Today(now) {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": scheduling.NotTodayError.Error()})
+				return
+			}
+
+			number, err := schedulingController.nextQueueNumber(appointment.ClientID, appointment.Poli, appointment.Tanggal)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			appointment.NoAntrian = number
+		}
+
+		appointment.Status = to
+		appointment.RiwayatStatus = append(appointment.RiwayatStatus, newAppointmentHistory(c, to, body.Alasan, now))
+		appointment.UpdatedAt = &now
+
+		updated, err := schedulingController.updateAppointment(appointment, previousUpdate)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !updated {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": scheduling.ConcurrentUpdateError.Error()})
+			return
+		}
+
+		if to == datastruct.JANJI_DIBATALKAN {
+			if err := schedulingController.releaseSlot(appointment.IDJadwal, appointment.Tanggal); err != nil {
+				logger.LogError.Printf("Failed to release the slot of schedule [%s]: %v\n", appointment.IDJadwal.Hex(), err)
+			}
+		}
+
+		schedulingController.revealAppointment(appointment)
+		utils.JSON(c, http.StatusOK, appointment)
+	}
+}
+
+// MarkNoShowHandler marks the appointments of a day that has passed whose
+// patient never checked in, or was called and never came, as no-shows.
+func (schedulingController *SchedulingController) MarkNoShowHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		day := c.Query("tanggal")
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": scheduling.InvalidDayError.Error()})
+			return
+		}
+
+		// the dates compare in the order of their days
+		if day >= scheduling.Today(now) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "tanggal must be a day that has passed"})
+			return
+		}
+
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"tanggal":    day,
+			"status":     bson.M{"$in": scheduling.AppointmentTransitions[datastruct.JANJI_TIDAK_HADIR]},
+			"deleted_at": nil,
+		}
+
+		cursor, err := schedulingController.AppointmentCollection.Find(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		// every appointment is signed again, so they are marked one by one;
+		// one changed in the meantime is left for the next run
+		marked := int64(0)
+		for cursor.Next(context.Background()) {
+			var appointment scheduling.Appointment
+			if err := cursor.Decode(&appointment); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if !verifiedAppointment(&appointment) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointment.ID.Hex())
+				continue
+			}
+
+			previousUpdate := appointment.UpdatedAt
+			appointment.Status = datastruct.JANJI_TIDAK_HADIR
+			appointment.RiwayatStatus = append(appointment.RiwayatStatus, newAppointmentHistory(c, datastruct.JANJI_TIDAK_HADIR, "", now))
+			appointment.UpdatedAt = &now
+
+			updated, err := schedulingController.updateAppointment(&appointment, previousUpdate)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if updated {
+				marked++
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, scheduling.NoShowResult{
+			Tanggal:    day,
+			TidakHadir: marked,
+		})
+	}
+}
+
+// GetQueueHandler lists the patients of a poli who checked in today, in
+// the order of their queue numbers.
+func (schedulingController *SchedulingController) GetQueueHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		poli := c.Query("poli")
+		if poli == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "poli is required"})
+			return
+		}
+
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"poli":       poli,
+			"tanggal":    scheduling.Today(time.Now()),
+			"no_antrian": bson.M{"$exists": true},
+			"deleted_at": nil,
+		}
+
+		if dokter := c.Query("dokter"); dokter != "" {
+			filter["dokter"] = dokter
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "no_antrian", Value: 1}})
+		cursor, err := schedulingController.AppointmentCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		appointments := []scheduling.Appointment{}
+		if err := cursor.All(context.Background(), &appointments); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, schedulingController.verifiedAppointments(appointments))
+	}
+}
+
+// CallNextHandler calls the patient of the poli with the lowest queue
+// number who is still waiting, optionally only those of one practitioner.
+func (schedulingController *SchedulingController) CallNextHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		poli := c.Query("poli")
+		if poli == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "poli is required"})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"poli":       poli,
+			"tanggal":    scheduling.Today(now),
+			"status":     datastruct.JANJI_CHECK_IN,
+			"deleted_at": nil,
+		}
+
+		if dokter := c.Query("dokter"); dokter != "" {
+			filter["dokter"] = dokter
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "no_antrian", Value: 1}})
+		cursor, err := schedulingController.AppointmentCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		// the first waiting patient is called; one called by another desk in
+		// the meantime no longer matches and the next one is tried
+		for cursor.Next(context.Background()) {
+			var appointment scheduling.Appointment
+			if err := cursor.Decode(&appointment); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if !verifiedAppointment(&appointment) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointment.ID.Hex())
+				continue
+			}
+
+			previousUpdate := appointment.UpdatedAt
+			appointment.Status = datastruct.JANJI_DIPANGGIL
+			appointment.RiwayatStatus = append(appointment.RiwayatStatus, newAppointmentHistory(c, datastruct.JANJI_DIPANGGIL, "", now))
+			appointment.UpdatedAt = &now
+
+			updated, err := schedulingController.updateAppointment(&appointment, previousUpdate)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if updated {
+				schedulingController.revealAppointment(&appointment)
+				utils.JSON(c, http.StatusOK, appointment)
+				return
+			}
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusNotFound, gin.H{"error": scheduling.QueueEmptyError.Error()})
+	}
+}
+
+// openAppointment finds the appointment an examination is written for,
+// which the patient must have checked in for.
+func openAppointment(collection *mongo.Collection, id primitive.ObjectID, noIHS, clientID string) (*scheduling.Appointment, error) {
+	filter := bson.M{
+		"_id":        id,
+		"no_ihs":     noIHS,
+		"client_id":  clientID,
+		"deleted_at": nil,
+	}
+
+	var appointment scheduling.Appointment
+	if err := collection.FindOne(context.Background(), filter).Decode(&appointment); err != nil {
+		return nil, err
+	}
+
+	if !verifiedAppointment(&appointment) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", appointment.ID.Hex())
+		return nil, scheduling.TamperedError
+	}
+
+	if scheduling.CheckTransition(appointment.Status, datastruct.JANJI_SELESAI) != nil {
+		return nil, scheduling.AppointmentOpenError
+	}
+
+	return &appointment, nil
+}
+
+// fulfilAppointment marks the appointment found by openAppointment as done
+// by the examination. Its chief complaint stays as it was stored.
+func fulfilAppointment(c *gin.Context, collection *mongo.Collection, appointment *scheduling.Appointment, examinationID primitive.ObjectID, now time.Time) error {
+	previousUpdate := appointment.UpdatedAt
+
+	appointment.Status = datastruct.JANJI_SELESAI
+	appointment.IDPemeriksaan = &examinationID
+	appointment.RiwayatStatus = append(appointment.RiwayatStatus, newAppointmentHistory(c, datastruct.JANJI_SELESAI, "", now))
+	appointment.UpdatedAt = &now
+
+	if err := signAppointment(appointment); err != nil {
+		return err
+	}
+
+	updated, err := storeAppointment(collection, appointment, previousUpdate)
+	if err != nil {
+		return err
+	}
+
+	if !updated {
+		return scheduling.ConcurrentUpdateError
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package emr_controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"service-outpatient/blindindex"
+	"service-outpatient/config"
+	"service-outpatient/logger"
+)
+
+// loadBlindIndex sets up the search on encrypted fields. Without a key the
+// fields are neither indexed nor searchable, as tokens made with a key that
+// changes could not be found again.
+func loadBlindIndex() *blindindex.Index {
+	key, err := base64.StdEncoding.DecodeString(config.BlindIndexKey)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to decode blind index key: %v", err)
+	}
+
+	if len(key) == 0 {
+		logger.LogWarning.Println("Blind index key is not set, encrypted fields cannot be searched")
+	}
+
+	return blindindex.New(key)
+}
+
+func searchErrorStatus(err error) int {
+	if errors.Is(err, blindindex.DisabledError) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusBadRequest
+}
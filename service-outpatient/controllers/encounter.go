@@ -0,0 +1,439 @@
+package emr_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-outpatient/datastruct"
+	"service-outpatient/datastruct/encounter"
+	"service-outpatient/db/csfle"
+	"service-outpatient/logger"
+	"service-outpatient/pagination"
+	"service-outpatient/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EncounterController keeps the encounters of the patients. An encounter
+// is changed only by the client that opened it, and read by others the
+// patient consented to.
+type EncounterController struct {
+	EncounterCollection *mongo.Collection
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+}
+
+func InitEncounterController(client *mongo.Client, csfle *csfle.CSFLE) *EncounterController {
+	return &EncounterController{
+		EncounterCollection: client.Database("emr").Collection("kunjungan"),
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+	}
+}
+
+func encounterErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound
+	case errors.Is(err, encounter.InvalidTransitionError),
+		errors.Is(err, encounter.NotInProgressError),
+		errors.Is(err, encounter.EncounterClosedError),
+		errors.Is(err, encounter.ConcurrentUpdateError),
+		errors.Is(err, encounter.TamperedError):
+		return http.StatusConflict
+	case errors.Is(err, encounter.InvalidEncounterError),
+		errors.Is(err, primitive.ErrInvalidHex):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sealEncounter encrypts the payer of the encounter and signs it.
+func (encounterController *EncounterController) sealEncounter(data *encounter.Encounter) error {
+	id := data.ID
+
+	data.PenjaminEncrypted = utils.EncryptRandom(
+		data.Penjamin,
+		encounterController.ClientEncryption,
+		encounterController.EncryptionOpts,
+	)
+	data.Penjamin = nil
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	json, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(json))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// verifiedEncounter tells whether the stored encounter still carries a
+// valid signature.
+func verifiedEncounter(data *encounter.Encounter) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// revealEncounter decrypts the payer of a sealed encounter for a response.
+func (encounterController *EncounterController) revealEncounter(data *encounter.Encounter) {
+	if data.PenjaminEncrypted != nil {
+		utils.Decrypt(
+			data.PenjaminEncrypted,
+			encounterController.ClientEncryption,
+		).Unmarshal(&data.Penjamin)
+	}
+
+	data.PenjaminEncrypted = nil
+}
+
+// findEncounter loads the encounter of the path. Only the client that
+// opened it finds it, unless owned is false and the patient consented.
+// Encounters failing their seal are refused.
+func (encounterController *EncounterController) findEncounter(c *gin.Context, owned bool) (*encounter.Encounter, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("encounterId"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":        id,
+		"no_ihs":     c.Param("noIHS"),
+		"deleted_at": nil,
+	}
+	if owned || !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var data encounter.Encounter
+	if err := encounterController.EncounterCollection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if !verifiedEncounter(&data) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+		return nil, encounter.TamperedError
+	}
+
+	return &data, nil
+}
+
+// updateEncounter seals and replaces the encounter unless it was changed
+// since it was read.
+func (encounterController *EncounterController) updateEncounter(data *encounter.Encounter, previousUpdate *time.Time) error {
+	if err := encounterController.sealEncounter(data); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":        data.ID,
+		"updated_at": previousUpdate,
+	}
+
+	result, err := encounterController.EncounterCollection.ReplaceOne(context.Background(), filter, data)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return encounter.ConcurrentUpdateError
+	}
+
+	return nil
+}
+
+// CreateEncounterHandler opens an encounter of the patient at the client.
+func (encounterController *EncounterController) CreateEncounterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body encounter.EncounterBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Penjamin.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		data := encounter.NewEncounter(body, c.GetString("userIdentification"), now)
+		data.ID = primitive.NewObjectID()
+		data.ClientID = c.GetString("userClient")
+		data.CreatedAt = &now
+		data.UpdatedAt = &now
+
+		if err := encounterController.sealEncounter(&data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := encounterController.EncounterCollection.InsertOne(context.Background(), data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(&data)
+		utils.JSON(c, http.StatusCreated, data)
+	}
+}
+
+// GetPatientEncounterHandler lists the encounters of a patient, narrowed
+// down by jenis and status if given.
+func (encounterController *EncounterController) GetPatientEncounterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"no_ihs":     c.Param("noIHS"),
+			"deleted_at": nil,
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		if jenis := c.Query("jenis"); jenis != "" {
+			value, err := encounter.ParseEncounterType(jenis)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["jenis"] = value
+		}
+
+		if status := c.Query("status"); status != "" {
+			value, err := encounter.ParseEncounterStatus(status)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = value
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := encounterController.EncounterCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := encounterController.EncounterCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		encounters := []encounter.Encounter{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var data encounter.Encounter
+			if err := cursor.Decode(&data); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = data.ID
+
+			if !verifiedEncounter(&data) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+				continue
+			}
+
+			encounterController.revealEncounter(&data)
+			encounters = append(encounters, data)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(encounters, total, last, more))
+	}
+}
+
+func (encounterController *EncounterController) GetEncounterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := encounterController.findEncounter(c, false)
+		if err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
+
+// UpdateEncounterHandler moves the patient to another location, hands them
+// over to another responsible doctor or changes who pays, as long as the
+// encounter has not ended.
+func (encounterController *EncounterController) UpdateEncounterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body encounter.UpdateBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := body.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := encounterController.findEncounter(c, true)
+		if err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if data.Closed() {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": encounter.EncounterClosedError.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(data)
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previousUpdate := data.UpdatedAt
+
+		if body.Lokasi != nil {
+			data.Move(*body.Lokasi, c.GetString("userIdentification"), now)
+		}
+		if body.DokterPenanggungJawab != "" {
+			data.DokterPenanggungJawab = body.DokterPenanggungJawab
+		}
+		if body.Penjamin != nil {
+			data.Penjamin = body.Penjamin
+		}
+		data.UpdatedAt = &now
+
+		if err := encounterController.updateEncounter(data, previousUpdate); err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
+
+// TransitionEncounterHandler moves an encounter to the status. Its period
+// starts once the patient is there and ends when it is finished.
+func (encounterController *EncounterController) TransitionEncounterHandler(to datastruct.EncounterStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body encounter.StatusBody
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		data, err := encounterController.findEncounter(c, true)
+		if err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(data)
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previousUpdate := data.UpdatedAt
+
+		if err := data.Transition(to, c.GetString("userIdentification"), body.Alasan, now); err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		data.UpdatedAt = &now
+
+		if err := encounterController.updateEncounter(data, previousUpdate); err != nil {
+			utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterController.revealEncounter(data)
+		utils.JSON(c, http.StatusOK, data)
+	}
+}
+
+// acceptingEncounter finds the encounter a document is written in, which
+// the patient must be at.
+func acceptingEncounter(collection *mongo.Collection, id primitive.ObjectID, noIHS, clientID string) (*encounter.Encounter, error) {
+	filter := bson.M{
+		"_id":        id,
+		"no_ihs":     noIHS,
+		"client_id":  clientID,
+		"deleted_at": nil,
+	}
+
+	var data encounter.Encounter
+	if err := collection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if err := data.Accepts(); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// encounterParam reads the encounter a list is narrowed down to, nil when
+// id_kunjungan is not given.
+func encounterParam(c *gin.Context) (*primitive.ObjectID, error) {
+	value := c.Query("id_kunjungan")
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := encounter.ParseEncounterID(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
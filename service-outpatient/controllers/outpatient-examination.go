@@ -3,14 +3,22 @@ package emr_controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"service-outpatient/config"
 	"service-outpatient/datastruct"
 	"service-outpatient/datastruct/outpatient"
+	"service-outpatient/datastruct/outpatient/identity"
+	"service-outpatient/datastruct/outpatient/scheduling"
 	specialityexamination "service-outpatient/datastruct/outpatient/speciality-examination"
 	"service-outpatient/datastruct/user"
 	"service-outpatient/db/csfle"
+	"service-outpatient/document"
 	"service-outpatient/logger"
+	"service-outpatient/pagination"
+	"service-outpatient/signing"
+	"service-outpatient/terminology"
 	"service-outpatient/utils"
 	"time"
 
@@ -27,9 +35,16 @@ type OutpatientExaminationController struct {
 	LabCollection         *mongo.Collection
 	RadiologiCollection   *mongo.Collection
 	ConsentCollection     *mongo.Collection
+	IdentityCollection    *mongo.Collection
+	AttachmentCollection  *mongo.Collection
+	AppointmentCollection *mongo.Collection
+	EncounterCollection   *mongo.Collection
 
 	ClientEncryption *mongo.ClientEncryption
 	EncryptionOpts   *options.EncryptOptions
+
+	Letterhead document.Letterhead
+	Signing    *signing.Client
 }
 
 type ErrorMapper struct {
@@ -43,9 +58,19 @@ func InitOutpatientExaminationController(client *mongo.Client, csfle *csfle.CSFL
 		LabCollection:         client.Database("fasyankes").Collection("laboratorium"),
 		RadiologiCollection:   client.Database("fasyankes").Collection("radiologi"),
 		ConsentCollection:     client.Database("emr").Collection("consent"),
+		IdentityCollection:    client.Database("emr").Collection("identitas"),
+		AttachmentCollection:  client.Database("emr").Collection("lampiran"),
+		AppointmentCollection: client.Database("emr").Collection("janji_temu"),
+		EncounterCollection:   client.Database("emr").Collection("kunjungan"),
 
 		ClientEncryption: csfle.ClientEncryption,
 		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+
+		Letterhead: loadLetterhead(),
+		Signing: signing.New(
+			config.AuthServiceURL,
+			time.Duration(config.AuthServiceTimeout)*time.Second,
+		),
 	}
 }
 
@@ -63,6 +88,47 @@ func (oic *OutpatientExaminationController) GetPatientConsent(noihs string) (*us
 	return &result, nil
 }
 
+// radiologyPatient reads the demographics of the patient from the identity
+// for the modality worklist. The order is sent without them when the
+// identity cannot be read.
+func (oic *OutpatientExaminationController) radiologyPatient(noihs string) *specialityexamination.RadiologyPatient {
+	var data identity.AdultPatient
+	err := oic.IdentityCollection.FindOne(context.Background(), bson.M{"no_ihs": noihs}).Decode(&data)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.LogError.Printf("Failed to read the identity of patient [%s]: %v\n", noihs, err)
+		}
+		return nil
+	}
+
+	if data.NamaEncrypted == nil || data.ConfidentialEncrypted == nil {
+		return nil
+	}
+
+	utils.Decrypt(
+		data.NamaEncrypted,
+		oic.ClientEncryption,
+	).Unmarshal(&data.NamaLengkap)
+
+	utils.Decrypt(
+		data.ConfidentialEncrypted,
+		oic.ClientEncryption,
+	).Unmarshal(&data.ConfidentialData)
+
+	patient := specialityexamination.RadiologyPatient{}
+	if data.NamaLengkap != nil {
+		patient.NamaPasien = *data.NamaLengkap
+	}
+	if data.ConfidentialData != nil {
+		patient.TanggalLahir = data.ConfidentialData.TanggalLahir
+		if data.ConfidentialData.JenisKelamin != nil {
+			patient.JenisKelamin = *data.ConfidentialData.JenisKelamin
+		}
+	}
+
+	return &patient
+}
+
 func (oic *OutpatientExaminationController) GetAllOutpatientExaminationHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		noIHS := c.Param("noIHS")
@@ -72,16 +138,47 @@ func (oic *OutpatientExaminationController) GetAllOutpatientExaminationHandler()
 			filterExamination["client_id"] = c.GetString("userClient")
 		}
 
-		// Query all outpatient data
-		cursor, err := oic.ExaminationCollection.Find(context.Background(), filterExamination)
+		encounterID, err := encounterParam(c)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if encounterID != nil {
+			filterExamination["id_kunjungan"] = *encounterID
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filterExamination)
+
+		total, err := oic.ExaminationCollection.CountDocuments(context.Background(), filterExamination)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filterExamination)
+
+		// Query a page of outpatient data
+		cursor, err := oic.ExaminationCollection.Find(context.Background(), filterExamination, params.FindOptions())
 		if err != nil {
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer cursor.Close(context.Background())
 
-		var examinationDataList []outpatient.ExaminationDocument
+		examinationDataList := []outpatient.ExaminationDocument{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
 		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
 			var examinationdata outpatient.ExaminationDocument
 			var obatdokumendata specialityexamination.PharmacyRequestDocument
 			var labdata specialityexamination.LaboratoryRequest
@@ -91,6 +188,7 @@ func (oic *OutpatientExaminationController) GetAllOutpatientExaminationHandler()
 				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			last = examinationdata.ID
 
 			id := examinationdata.ID
 			signature := examinationdata.Signature
@@ -231,7 +329,7 @@ func (oic *OutpatientExaminationController) GetAllOutpatientExaminationHandler()
 			return
 		}
 
-		utils.JSON(c, http.StatusOK, examinationDataList)
+		utils.JSON(c, http.StatusOK, params.Page(examinationDataList, total, last, more))
 	}
 }
 
@@ -350,6 +448,60 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 			return
 		}
 
+		if err := examinationdata.ConfidentialData.PemeriksaanSpesialistik.ApplyCoding(); err != nil {
+			if errors.Is(err, terminology.CodeSystemNotReadyError) {
+				utils.JSON(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// checked before any order is sent on to the other services
+		var appointment *scheduling.Appointment
+		if examinationdata.IDJanjiTemu != nil {
+			var err error
+			appointment, err = openAppointment(
+				oic.AppointmentCollection,
+				*examinationdata.IDJanjiTemu,
+				examinationdata.NoIHS,
+				c.GetString("userClient"),
+			)
+			if err != nil {
+				utils.JSON(c, appointmentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if examinationdata.IDKunjungan != nil {
+			_, err := acceptingEncounter(
+				oic.EncounterCollection,
+				*examinationdata.IDKunjungan,
+				examinationdata.NoIHS,
+				c.GetString("userClient"),
+			)
+			if err != nil {
+				utils.JSON(c, encounterErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// the id is given up front for the attachments to be linked to
+		id := primitive.NewObjectID()
+
+		lampiran, err := referAttachments(
+			oic.AttachmentCollection,
+			examinationdata.NoIHS,
+			c.GetString("userClient"),
+			id,
+			examinationdata.ConfidentialData.Attachments()...,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		examinationdata.Lampiran = lampiran
+
 		drugreciperequestptr := examinationdata.ConfidentialData.PemeriksaanSpesialistik.Terapi.ResepObat
 		labrequestptr := examinationdata.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Laboratorium
 		radiologirequestptr := examinationdata.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Radiologi
@@ -358,8 +510,15 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 
 		if drugreciperequestptr != nil {
 			pharmacyrequestdata.Peresepan = *drugreciperequestptr
+			pharmacyrequestdata.IDKunjungan = examinationdata.IDKunjungan
 			examinationdata.ConfidentialData.PemeriksaanSpesialistik.Terapi.ResepObat = nil
 
+			// the pharmacy screens the prescription against these allergies
+			pharmacyConfidential := pharmacyrequestdata.Peresepan.ConfidentialData
+			if len(pharmacyConfidential.DaftarAlergi) == 0 {
+				pharmacyConfidential.DaftarAlergi = examinationdata.ConfidentialData.AsesmenAwal.Anamnesis.RiwayatAlergi
+			}
+
 			pharmacyJson, err := json.Marshal(pharmacyrequestdata)
 			if err != nil {
 				logger.LogError.Println("Error marshalling pharmacy data")
@@ -369,6 +528,15 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 
 			sb, err := utils.PostRequest(c, datastruct.PHARMACY, pharmacyJson)
 			if err != nil {
+				var serviceError *utils.ServiceError
+				if errors.As(err, &serviceError) && serviceError.StatusCode == http.StatusConflict {
+					// clinical warnings the prescriber has to acknowledge first
+					utils.JSON(c, http.StatusConflict, gin.H{
+						"error":    "pharmacy: prescription has unacknowledged clinical warnings",
+						"pharmacy": json.RawMessage(serviceError.Body),
+					})
+					return
+				}
 				utils.JSON(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pharmacy: %s", err.Error())})
 				return
 			}
@@ -377,6 +545,7 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 
 		if labrequestptr != nil {
 			labrequestdata = *labrequestptr
+			labrequestdata.IDKunjungan = examinationdata.IDKunjungan
 			examinationdata.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Laboratorium = nil
 
 			labJson, err := json.Marshal(labrequestdata)
@@ -397,8 +566,14 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 
 		if radiologirequestptr != nil {
 			radiologirequestdata = *radiologirequestptr
+			radiologirequestdata.IDKunjungan = examinationdata.IDKunjungan
 			examinationdata.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Radiologi = nil
 
+			// the radiology service puts the order on the modality worklist
+			if radiologyConfidential := radiologirequestdata.ConfidentialData; radiologyConfidential != nil && radiologyConfidential.Pasien == nil {
+				radiologyConfidential.Pasien = oic.radiologyPatient(radiologirequestdata.NoIHS)
+			}
+
 			radiologiJson, err := json.Marshal(radiologirequestdata)
 			if err != nil {
 				logger.LogError.Println("Error marshalling radiology data")
@@ -426,6 +601,7 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 		examinationdata.ConfidentialEncrypted = confidentialEncryptedField
 		examinationdata.ConfidentialData = nil
 		examinationdata.ClientID = c.GetString("userClient")
+		examinationdata.ID = primitive.NilObjectID
 
 		json, err := json.Marshal(examinationdata)
 		if err != nil {
@@ -435,6 +611,7 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 
 		signature := utils.GenerateSignature(string(json))
 		examinationdata.Signature = &signature
+		examinationdata.ID = id
 
 		_, err = oic.ExaminationCollection.InsertOne(context.Background(), examinationdata)
 		if err != nil {
@@ -442,6 +619,14 @@ func (oic *OutpatientExaminationController) CreateOutpatientExaminationHandler()
 			return
 		}
 
+		linkAttachments(oic.AttachmentCollection, id, examinationdata.Lampiran)
+
+		if appointment != nil {
+			if err := fulfilAppointment(c, oic.AppointmentCollection, appointment, id, now); err != nil {
+				logger.LogError.Printf("Failed to fulfil appointment [%s] with examination [%s]: %v\n", appointment.ID.Hex(), id.Hex(), err)
+			}
+		}
+
 		// Return a success message
 		utils.JSON(c, http.StatusCreated, gin.H{"message": "Outpatient examination data created successfully"})
 	}
@@ -472,11 +657,53 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 			return
 		}
 
+		if err := newData.ConfidentialData.PemeriksaanSpesialistik.ApplyCoding(); err != nil {
+			if errors.Is(err, terminology.CodeSystemNotReadyError) {
+				utils.JSON(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		if newData.CreatedAt == nil {
 			utils.AbortWithStatusJSON(c, http.StatusBadRequest, gin.H{"error": "require created_at data"})
 			return
 		}
 
+		lampiran, err := referAttachments(
+			oic.AttachmentCollection,
+			noIHS,
+			c.GetString("userClient"),
+			objID,
+			newData.ConfidentialData.Attachments()...,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		newData.Lampiran = lampiran
+
+		// checked before any order is sent on to the other services
+		var previous outpatient.ExaminationDocument
+		err = oic.ExaminationCollection.FindOne(context.Background(), bson.M{"_id": objID, "no_ihs": noIHS}).Decode(&previous)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if previous.TandaTanganDigital != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": outpatient.ExaminationSignedError.Error()})
+			return
+		}
+		newData.TandaTanganDigital = nil
+		newData.IDJanjiTemu = previous.IDJanjiTemu
+		newData.IDKunjungan = previous.IDKunjungan
+
 		drugreciperequestptr := newData.ConfidentialData.PemeriksaanSpesialistik.Terapi.ResepObat
 		if newData.ConfidentialData.PemeriksaanSpesialistik.Terapi.ResepObatRefId != nil {
 			if drugreciperequestptr != nil {
@@ -506,8 +733,15 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 		if drugreciperequestptr != nil {
 			pharmacyrequestdata.Peresepan = *drugreciperequestptr
+			pharmacyrequestdata.IDKunjungan = newData.IDKunjungan
 			newData.ConfidentialData.PemeriksaanSpesialistik.Terapi.ResepObat = nil
 
+			// the pharmacy screens the prescription against these allergies
+			pharmacyConfidential := pharmacyrequestdata.Peresepan.ConfidentialData
+			if len(pharmacyConfidential.DaftarAlergi) == 0 {
+				pharmacyConfidential.DaftarAlergi = newData.ConfidentialData.AsesmenAwal.Anamnesis.RiwayatAlergi
+			}
+
 			pharmacyJson, err := json.Marshal(pharmacyrequestdata)
 			if err != nil {
 				logger.LogError.Println("Error marshalling pharmacy data")
@@ -517,6 +751,15 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 			sb, err := utils.PostRequest(c, datastruct.PHARMACY, pharmacyJson)
 			if err != nil {
+				var serviceError *utils.ServiceError
+				if errors.As(err, &serviceError) && serviceError.StatusCode == http.StatusConflict {
+					// clinical warnings the prescriber has to acknowledge first
+					utils.JSON(c, http.StatusConflict, gin.H{
+						"error":    "pharmacy: prescription has unacknowledged clinical warnings",
+						"pharmacy": json.RawMessage(serviceError.Body),
+					})
+					return
+				}
 				utils.JSON(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pharmacy: %s", err.Error())})
 				return
 			}
@@ -525,6 +768,7 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 		if labrequestptr != nil {
 			labrequestdata = *labrequestptr
+			labrequestdata.IDKunjungan = newData.IDKunjungan
 			newData.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Laboratorium = nil
 
 			labJson, err := json.Marshal(labrequestdata)
@@ -545,8 +789,14 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 		if radiologirequestptr != nil {
 			radiologirequestdata = *radiologirequestptr
+			radiologirequestdata.IDKunjungan = newData.IDKunjungan
 			newData.ConfidentialData.PemeriksaanSpesialistik.PemeriksaanPenunjang.Radiologi = nil
 
+			// the radiology service puts the order on the modality worklist
+			if radiologyConfidential := radiologirequestdata.ConfidentialData; radiologyConfidential != nil && radiologyConfidential.Pasien == nil {
+				radiologyConfidential.Pasien = oic.radiologyPatient(radiologirequestdata.NoIHS)
+			}
+
 			radiologiJson, err := json.Marshal(radiologirequestdata)
 			if err != nil {
 				logger.LogError.Println("Error marshalling radiology data")
@@ -564,8 +814,9 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 		// Define a filter to find the document by noRekamMedis
 		filter := bson.M{
-			"_id":    objID,
-			"no_ihs": noIHS,
+			"_id":                  objID,
+			"no_ihs":               noIHS,
+			"tanda_tangan_digital": bson.M{"$exists": false}, // signed in the meantime
 		}
 
 		confidentialEncryptedField := utils.EncryptRandom(
@@ -588,6 +839,10 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 
 		// Create an update document
 		update := bson.M{"$set": newData}
+		if len(newData.Lampiran) == 0 {
+			// attachments dropped from the document leave its signature too
+			update["$unset"] = bson.M{"lampiran": ""}
+		}
 
 		// Update the document in the collection
 		result, err := oic.ExaminationCollection.UpdateOne(context.Background(), filter, update)
@@ -601,6 +856,8 @@ func (oic *OutpatientExaminationController) UpdateOutpatientExaminationHandler()
 			return
 		}
 
+		linkAttachments(oic.AttachmentCollection, objID, newData.Lampiran)
+
 		// Return a success message
 		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d outpatient examination data updated successfully", result.ModifiedCount)})
 	}
@@ -642,3 +899,161 @@ func (oic *OutpatientExaminationController) DeleteOutpatientExaminationHandler()
 		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d outpatient examination data deleted successfully", result.DeletedCount)})
 	}
 }
+
+// findSignedExamination loads an examination whose signature still holds,
+// with its confidential data decrypted. It answers the request itself when
+// it cannot.
+func (oic *OutpatientExaminationController) findSignedExamination(c *gin.Context, tampered error) (*outpatient.ExaminationDocument, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("objID"))
+	if err != nil {
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	filter := bson.M{
+		"_id":    objID,
+		"no_ihs": c.Param("noIHS"),
+	}
+	if !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var examinationdata outpatient.ExaminationDocument
+	err = oic.ExaminationCollection.FindOne(context.Background(), filter).Decode(&examinationdata)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !verifiedExamination(&examinationdata) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		utils.JSON(c, http.StatusConflict, gin.H{"error": tampered.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		examinationdata.ConfidentialEncrypted,
+		oic.ClientEncryption,
+	).Unmarshal(&examinationdata.ConfidentialData)
+
+	return &examinationdata, true
+}
+
+// SignOutpatientExaminationHandler signs the examination with the key of
+// the responsible doctor, who confirms with their password. Only the digest
+// of the examination is sent to the auth service.
+func (oic *OutpatientExaminationController) SignOutpatientExaminationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body outpatient.SignBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		data, ok := oic.findSignedExamination(c, signTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": alreadySignedError.Error()})
+			return
+		}
+
+		if err := data.CanBeSignedBy(c.GetString("userIdentification")); err != nil {
+			utils.JSON(c, http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		digest, err := signing.Digest(data.SignedContent())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		signature, err := oic.Signing.Sign(context.Background(), c.GetHeader("Authorization"), body.Password, digest)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		// guard against a concurrent change on the same examination
+		filter := bson.M{
+			"_id":        data.ID,
+			"updated_at": data.UpdatedAt,
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		data.TandaTanganDigital = signature
+		data.UpdatedAt = &now
+
+		data.ConfidentialEncrypted = utils.EncryptRandom(
+			data.ConfidentialData,
+			oic.ClientEncryption,
+			oic.EncryptionOpts,
+		)
+		data.ConfidentialData = nil
+
+		data.Signature = nil
+		data.ID = primitive.NilObjectID
+
+		json, err := json.Marshal(data)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		documentSignature := utils.GenerateSignature(string(json))
+		data.Signature = &documentSignature
+
+		result, err := oic.ExaminationCollection.UpdateOne(context.Background(), filter, bson.M{"$set": data})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "outpatient examination was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, signature)
+	}
+}
+
+// OutpatientExaminationSignatureHandler shows who signed the examination
+// and whether the signature still holds for the examination on record.
+func (oic *OutpatientExaminationController) OutpatientExaminationSignatureHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, ok := oic.findSignedExamination(c, checkTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": notSignedError.Error()})
+			return
+		}
+
+		check, err := oic.Signing.Check(
+			context.Background(),
+			c.GetHeader("Authorization"),
+			data.TandaTanganDigital,
+			data.SignedContent(),
+		)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, check)
+	}
+}
@@ -0,0 +1,263 @@
+package emr_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-outpatient/config"
+	"service-outpatient/datastruct/outpatient"
+	specialityexamination "service-outpatient/datastruct/outpatient/speciality-examination"
+	"service-outpatient/document"
+	"service-outpatient/logger"
+	"service-outpatient/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const examinationResumeTitle = "Resume Medis Rawat Jalan"
+
+// verifiedExamination tells whether the stored document still carries a
+// valid signature.
+func verifiedExamination(data *outpatient.ExaminationDocument) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+func codedName(concept *specialityexamination.CodedConcept, name string) string {
+	if concept == nil {
+		return name
+	}
+
+	return fmt.Sprintf("%s - %s", concept.Kode, concept.Nama)
+}
+
+func refID(ref *string) string {
+	if ref == nil {
+		return ""
+	}
+
+	return *ref
+}
+
+// renderExaminationResume lays the visit out as a medical resume. The
+// results of the lab, radiology and pharmacy are printed by their services,
+// so the resume only refers to them.
+func renderExaminationResume(letterhead document.Letterhead, data *outpatient.ExaminationDocument, now time.Time) (*document.Document, error) {
+	confidential := data.ConfidentialData
+	consent := &confidential.PersetujuanUmum
+	anamnesis := &confidential.AsesmenAwal.Anamnesis
+	condition := &confidential.AsesmenAwal.PemeriksaanFisik.KeadaanUmum
+	speciality := &confidential.PemeriksaanSpesialistik
+	diagnosis := &speciality.Diagnosis
+
+	visitedAt := time.Time{}
+	if data.CreatedAt != nil {
+		visitedAt = *data.CreatedAt
+	}
+
+	pdf := document.New(letterhead, examinationResumeTitle, data.ID.Hex(), now)
+
+	pdf.Section("Identitas Pasien")
+	pdf.Field("Nama pasien", consent.NamaLengkap)
+	pdf.Field("No. rekam medis", consent.NoRekamMedis)
+	pdf.Field("No. IHS", data.NoIHS)
+	pdf.Field("Tanggal lahir", document.FormatDate(consent.TanggalLahir))
+	pdf.Field("Jenis kelamin", consent.SexString())
+	pdf.Field("Cara pembayaran", confidential.CaraPembayaran)
+	pdf.Field("Tanggal kunjungan", document.FormatTime(visitedAt))
+
+	pdf.Section("Anamnesis")
+	pdf.Field("Keluhan utama", anamnesis.KeluhanUtama)
+	pdf.Field("Riwayat penyakit", strings.Join(anamnesis.RiwayatPenyakit, ", "))
+	pdf.Field("Riwayat alergi", strings.Join(anamnesis.RiwayatAlergi, ", "))
+	pdf.Field("Riwayat pengobatan", strings.Join(anamnesis.RiwayatPengobatan, ", "))
+
+	consciousness := ""
+	if condition.TingkatKesadaran != nil {
+		consciousness = condition.ConsciousnessString()
+	}
+
+	pdf.Section("Pemeriksaan Fisik")
+	pdf.Field("Tingkat kesadaran", consciousness)
+	pdf.Field("Tekanan darah", fmt.Sprintf("%d/%d mmHg", condition.VitalSign.TekananDarah.Sistole, condition.VitalSign.TekananDarah.Diastole))
+	pdf.Field("Denyut jantung", condition.VitalSign.DenyutJantung)
+	pdf.Field("Pernapasan", condition.VitalSign.Pernapasan)
+	pdf.Field("Suhu tubuh", fmt.Sprintf("%d °C", condition.VitalSign.SuhuTubuh))
+
+	secondary := []string{}
+	for i := 0; i < len(diagnosis.DiagnosisAkhir.KodeSekunder); i++ {
+		secondary = append(secondary, codedName(&diagnosis.DiagnosisAkhir.KodeSekunder[i], ""))
+	}
+	if len(secondary) == 0 && diagnosis.DiagnosisAkhir.DiagnosisSekunder != "" {
+		secondary = append(secondary, diagnosis.DiagnosisAkhir.DiagnosisSekunder)
+	}
+
+	pdf.Section("Diagnosis")
+	pdf.Field("Diagnosis awal", codedName(diagnosis.KodeDiagnosisAwal, diagnosis.DiagnosisAwal))
+	pdf.Field("Diagnosis utama", codedName(diagnosis.DiagnosisAkhir.KodePrimer, diagnosis.DiagnosisAkhir.DiagnosisPrimer))
+	pdf.Field("Diagnosis sekunder", strings.Join(secondary, "; "))
+
+	action := &speciality.Terapi.Tindakan
+	actionName := action.NamaTindakan
+	if action.KodeTindakan != nil {
+		actionName = fmt.Sprintf("%s - %s", action.KodeTindakan.Kode, action.NamaTindakan)
+	}
+
+	pdf.Section("Tindakan dan Terapi")
+	pdf.Field("Tindakan", actionName)
+	pdf.Field("Petugas pelaksana", action.PetugasPelaksana)
+	pdf.Field("Tanggal pelaksanaan", document.FormatDate(action.TanggalPelaksanaan))
+	pdf.Field("Rencana rawat", speciality.RencanaRawat)
+	pdf.Field("Instruksi medik", speciality.InstruksiMedik)
+	pdf.Field("No. e-resep", refID(speciality.Terapi.ResepObatRefId))
+
+	history := [][]string{}
+	for i := 0; i < len(speciality.RiwayatPenggunaanObat); i++ {
+		drug := speciality.RiwayatPenggunaanObat[i]
+		history = append(history, []string{drug.NamaObat, drug.DosisPakai, drug.WaktuPenggunaan})
+	}
+
+	pdf.Section("Riwayat Penggunaan Obat")
+	pdf.Table([]document.Column{
+		{Judul: "Nama obat", Lebar: 80},
+		{Judul: "Dosis pakai", Lebar: 50},
+		{Judul: "Waktu penggunaan", Lebar: 50},
+	}, history)
+
+	pdf.Section("Pemeriksaan Penunjang")
+	pdf.Field("No. pemeriksaan laboratorium", refID(speciality.PemeriksaanPenunjang.LabResultRefId))
+	pdf.Field("No. pemeriksaan radiologi", refID(speciality.PemeriksaanPenunjang.RadiologiResultRefId))
+
+	signedAt := visitedAt
+	if signature := data.TandaTanganDigital; signature != nil {
+		printDigitalSignature(pdf, signature)
+		signedAt = signature.Waktu
+	}
+
+	if err := pdf.Sign(
+		"Dokter Penanggung Jawab",
+		speciality.PersetujuanTindakan.DokterPenjelas,
+		signedAt,
+		document.VerificationURL(config.DocumentVerifyURL, data.ID.Hex(), *data.Signature),
+	); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
+
+// ExaminationResumeHandler prints the medical resume of a visit. Documents
+// failing their signature are not printed, as the printout would claim a
+// signature the document no longer has.
+func (oic *OutpatientExaminationController) ExaminationResumeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		objID, err := primitive.ObjectIDFromHex(c.Param("objID"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":    objID,
+			"no_ihs": c.Param("noIHS"),
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		var examinationdata outpatient.ExaminationDocument
+		err = oic.ExaminationCollection.FindOne(context.Background(), filter).Decode(&examinationdata)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verifiedExamination(&examinationdata) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+			utils.JSON(c, http.StatusConflict, gin.H{"error": documentTamperedError.Error()})
+			return
+		}
+
+		utils.Decrypt(
+			examinationdata.ConfidentialEncrypted,
+			oic.ClientEncryption,
+		).Unmarshal(&examinationdata.ConfidentialData)
+
+		pdf, err := renderExaminationResume(oic.Letterhead, &examinationdata, time.Now())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sendPDF(c, pdf, fmt.Sprintf("resume-%s", objID.Hex()))
+	}
+}
+
+// VerifyExaminationHandler tells the holder of a printed resume whether it
+// is genuine and still the document on record.
+func (oic *OutpatientExaminationController) VerifyExaminationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint := c.Query("fingerprint")
+		if fingerprint == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fingerprintRequiredError.Error()})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var examinationdata outpatient.ExaminationDocument
+		err = oic.ExaminationCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&examinationdata)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		valid := verifiedExamination(&examinationdata)
+		if !valid {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		}
+
+		utils.JSON(c, http.StatusOK, document.NewVerification(
+			objID.Hex(),
+			examinationResumeTitle,
+			oic.Letterhead.Nama,
+			document.Check(examinationdata.Signature, valid, fingerprint),
+			examinationdata.UpdatedAt,
+		))
+	}
+}
@@ -0,0 +1,386 @@
+package emr_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-outpatient/datastruct"
+	"service-outpatient/datastruct/outpatient/scheduling"
+	"service-outpatient/db/csfle"
+	"service-outpatient/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SchedulingController keeps the schedules of the practitioners of a client
+// and the appointments booked on them. Every schedule and appointment
+// belongs to the client that made it.
+type SchedulingController struct {
+	ScheduleCollection    *mongo.Collection
+	AppointmentCollection *mongo.Collection
+	CounterCollection     *mongo.Collection
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+}
+
+func InitSchedulingController(client *mongo.Client, csfle *csfle.CSFLE) *SchedulingController {
+	return &SchedulingController{
+		ScheduleCollection:    client.Database("emr").Collection("jadwal_praktik"),
+		AppointmentCollection: client.Database("emr").Collection("janji_temu"),
+		CounterCollection:     client.Database("emr").Collection("nomor_antrian"),
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+	}
+}
+
+// upcoming are the statuses of an appointment the patient may still come
+// for.
+var upcoming = bson.A{
+	datastruct.JANJI_DIJADWALKAN,
+	datastruct.JANJI_CHECK_IN,
+	datastruct.JANJI_DIPANGGIL,
+}
+
+func slotKey(scheduleID primitive.ObjectID, day string) string {
+	return fmt.Sprintf("kuota-%s-%s", scheduleID.Hex(), day)
+}
+
+// takeSlot books one of the slots of the schedule on the day. The count is
+// only raised while it is under the quota; once the quota is reached the
+// counter no longer matches and the upsert fails on its ID.
+func (schedulingController *SchedulingController) takeSlot(schedule *scheduling.PractitionerSchedule, day string) error {
+	filter := bson.M{
+		"_id":    slotKey(schedule.ID, day),
+		"terisi": bson.M{"$lt": schedule.Kuota},
+	}
+	update := bson.M{"$inc": bson.M{"terisi": 1}}
+	opts := options.Update().SetUpsert(true)
+
+	_, err := schedulingController.CounterCollection.UpdateOne(context.Background(), filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		// two requests created the counter of the day at once
+		_, err = schedulingController.CounterCollection.UpdateOne(context.Background(), filter, update, opts)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return scheduling.ScheduleFullError
+	}
+
+	return err
+}
+
+func (schedulingController *SchedulingController) releaseSlot(scheduleID primitive.ObjectID, day string) error {
+	filter := bson.M{
+		"_id":    slotKey(scheduleID, day),
+		"terisi": bson.M{"$gt": 0},
+	}
+
+	_, err := schedulingController.CounterCollection.UpdateOne(context.Background(), filter, bson.M{"$inc": bson.M{"terisi": -1}})
+	return err
+}
+
+func (schedulingController *SchedulingController) takenSlots(scheduleID primitive.ObjectID, day string) (uint16, error) {
+	var counter struct {
+		Terisi uint16 `bson:"terisi"`
+	}
+
+	err := schedulingController.CounterCollection.FindOne(context.Background(), bson.M{"_id": slotKey(scheduleID, day)}).Decode(&counter)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+
+	return counter.Terisi, nil
+}
+
+// nextQueueNumber hands out queue numbers per client, poli and day, in the
+// order the patients check in.
+func (schedulingController *SchedulingController) nextQueueNumber(clientID, poli, day string) (uint16, error) {
+	var counter struct {
+		Urutan uint16 `bson:"urutan"`
+	}
+
+	key := fmt.Sprintf("antrian-%s-%s-%s", clientID, poli, day)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{"$inc": bson.M{"urutan": 1}}
+
+	err := schedulingController.CounterCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": key}, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// two patients checked in first at once
+		err = schedulingController.CounterCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": key}, update, opts).Decode(&counter)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.Urutan, nil
+}
+
+func (schedulingController *SchedulingController) findSchedule(c *gin.Context, id primitive.ObjectID) (*scheduling.PractitionerSchedule, error) {
+	filter := bson.M{
+		"_id":        id,
+		"client_id":  c.GetString("userClient"),
+		"deleted_at": nil,
+	}
+
+	var schedule scheduling.PractitionerSchedule
+	if err := schedulingController.ScheduleCollection.FindOne(context.Background(), filter).Decode(&schedule); err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// hasUpcomingAppointments tells whether patients may still come on the
+// schedule, from today on.
+func (schedulingController *SchedulingController) hasUpcomingAppointments(schedule *scheduling.PractitionerSchedule, now time.Time) (bool, error) {
+	count, err := schedulingController.AppointmentCollection.CountDocuments(context.Background(), bson.M{
+		"id_jadwal":  schedule.ID,
+		"tanggal":    bson.M{"$gte": scheduling.Today(now)},
+		"status":     bson.M{"$in": upcoming},
+		"deleted_at": nil,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (schedulingController *SchedulingController) CreateScheduleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var schedule scheduling.PractitionerSchedule
+		if err := c.ShouldBindJSON(&schedule); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := schedule.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		schedule.ID = primitive.NewObjectID()
+		schedule.ClientID = c.GetString("userClient")
+		schedule.Aktif = true
+		schedule.CreatedAt = &now
+		schedule.UpdatedAt = &now
+		schedule.DeletedAt = nil
+
+		if _, err := schedulingController.ScheduleCollection.InsertOne(context.Background(), schedule); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, schedule)
+	}
+}
+
+// GetAllScheduleHandler lists the schedules of the client by day and hour,
+// optionally of a poli, a practitioner or a day of the week.
+func (schedulingController *SchedulingController) GetAllScheduleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"client_id":  c.GetString("userClient"),
+			"deleted_at": nil,
+		}
+
+		if poli := c.Query("poli"); poli != "" {
+			filter["poli"] = poli
+		}
+
+		if dokter := c.Query("dokter"); dokter != "" {
+			filter["dokter"] = dokter
+		}
+
+		if hari := c.Query("hari"); hari != "" {
+			day, err := strconv.Atoi(hari)
+			if err != nil || day < 0 || day > 6 {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": "hari must be a number from 0 (Sunday) to 6"})
+				return
+			}
+			filter["hari"] = day
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "hari", Value: 1}, {Key: "jam_mulai", Value: 1}})
+		cursor, err := schedulingController.ScheduleCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		schedules := []scheduling.PractitionerSchedule{}
+		if err := cursor.All(context.Background(), &schedules); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, schedules)
+	}
+}
+
+// UpdateScheduleHandler changes a schedule. While patients may still come
+// on it, only its quota and whether it takes new appointments can change.
+func (schedulingController *SchedulingController) UpdateScheduleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("jadwalId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var newSchedule scheduling.PractitionerSchedule
+		if err := c.ShouldBindJSON(&newSchedule); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := newSchedule.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		schedule, err := schedulingController.findSchedule(c, id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		if !newSchedule.SameSlots(schedule) {
+			inUse, err := schedulingController.hasUpcomingAppointments(schedule, now)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if inUse {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": scheduling.ScheduleChangedError.Error()})
+				return
+			}
+		}
+
+		newSchedule.ID = schedule.ID
+		newSchedule.ClientID = schedule.ClientID
+		newSchedule.CreatedAt = schedule.CreatedAt
+		newSchedule.UpdatedAt = &now
+		newSchedule.DeletedAt = nil
+
+		filter := bson.M{
+			"_id":        id,
+			"updated_at": schedule.UpdatedAt,
+		}
+
+		result, err := schedulingController.ScheduleCollection.ReplaceOne(context.Background(), filter, newSchedule)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "the schedule was changed in the meantime, please try again"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, newSchedule)
+	}
+}
+
+func (schedulingController *SchedulingController) DeleteScheduleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("jadwalId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		schedule, err := schedulingController.findSchedule(c, id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		inUse, err := schedulingController.hasUpcomingAppointments(schedule, now)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if inUse {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": scheduling.ScheduleInUseError.Error()})
+			return
+		}
+
+		// appointments that were kept on it still refer to it
+		update := bson.M{"$set": bson.M{
+			"aktif":      false,
+			"updated_at": now,
+			"deleted_at": now,
+		}}
+
+		if _, err := schedulingController.ScheduleCollection.UpdateByID(context.Background(), id, update); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+	}
+}
+
+// ScheduleSlotHandler tells how many appointments the schedule can still
+// take on a day.
+func (schedulingController *SchedulingController) ScheduleSlotHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("jadwalId"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		day := c.Query("tanggal")
+
+		schedule, err := schedulingController.findSchedule(c, id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := schedule.PracticesOn(day); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		taken, err := schedulingController.takenSlots(schedule.ID, day)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, scheduling.NewSlot(schedule, day, taken))
+	}
+}
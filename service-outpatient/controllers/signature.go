@@ -0,0 +1,53 @@
+package emr_controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"service-outpatient/document"
+	"service-outpatient/signing"
+	"service-outpatient/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	alreadySignedError = errors.New("the document has already been signed")
+	notSignedError     = errors.New("the document has not been signed")
+	signTamperedError  = errors.New("the document does not match its signature and cannot be signed")
+	checkTamperedError = errors.New("the document does not match its signature, its digital signature cannot be checked")
+)
+
+// signingError answers with the error of the auth service as it was given,
+// e.g. a wrong password or a clinician without a signing key, and with a bad
+// gateway when the auth service failed or could not be reached.
+func signingError(c *gin.Context, err error) {
+	var serverError *signing.ServerError
+	if errors.As(err, &serverError) {
+		status := serverError.StatusCode
+		if status >= http.StatusInternalServerError {
+			status = http.StatusBadGateway
+		}
+		utils.JSON(c, status, gin.H{"error": serverError.Message()})
+		return
+	}
+
+	var netError net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netError) {
+		utils.JSON(c, http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// printDigitalSignature lists the signer and certificate of a digitally
+// signed document above its signature.
+func printDigitalSignature(pdf *document.Document, signature *signing.Signature) {
+	pdf.Section("Tanda Tangan Digital")
+	pdf.Field("Penanda tangan", signature.Penandatangan)
+	pdf.Field("Peran", signature.Peran)
+	pdf.Field("No. seri sertifikat", signature.NoSeri)
+	pdf.Field("Waktu tanda tangan", document.FormatTime(signature.Waktu))
+}
@@ -0,0 +1,64 @@
+package emr_controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"service-outpatient/terminology"
+	"service-outpatient/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchConceptHandler looks up concepts of the code system by code prefix
+// or display name.
+func SearchConceptHandler(codeSystem *terminology.CodeSystem) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := defaultSearchLimit
+		if l := c.Query("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed < 1 {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+				return
+			}
+			limit = parsed
+		}
+
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+
+		if !codeSystem.Available() {
+			utils.JSON(c, http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("%s: %s", codeSystem.Name, terminology.CodeSystemNotReadyError.Error())})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, codeSystem.Search(c.Query("q"), limit))
+	}
+}
+
+func GetConceptHandler(codeSystem *terminology.CodeSystem) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		concept, err := codeSystem.Lookup(c.Param("kode"))
+		if err != nil {
+			if errors.Is(err, terminology.ConceptNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, terminology.CodeSystemNotReadyError) {
+				utils.JSON(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, concept)
+	}
+}
@@ -0,0 +1,291 @@
+package emr_controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"service-outpatient/datastruct/outpatient"
+	"service-outpatient/logger"
+	"service-outpatient/pagination"
+	"service-outpatient/utils"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Timeline is a page of the timeline of a patient. TidakTersedia lists the
+// types whose service could not be reached, so their records are missing
+// from the page.
+type Timeline struct {
+	*pagination.Page
+	TidakTersedia []outpatient.TimelineType `json:"tidak_tersedia,omitempty"`
+}
+
+// timelineSource is a page of the records of one type. Next is where the
+// next page of the type starts, nil on its last page.
+type timelineSource struct {
+	Items []outpatient.TimelineItem
+	Total int64
+	Next  *primitive.ObjectID
+}
+
+// examinationTimeline reads a page of the examinations of the patient the
+// same way GetAllOutpatientExaminationHandler does, leaving the orders to
+// the services keeping them.
+func (oic *OutpatientExaminationController) examinationTimeline(c *gin.Context, noIHS string, encounterID *primitive.ObjectID, params *pagination.Params) (*timelineSource, error) {
+	filter := bson.M{"no_ihs": noIHS}
+	if !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+	if encounterID != nil {
+		filter["id_kunjungan"] = *encounterID
+	}
+	params.Filter(filter)
+
+	total, err := oic.ExaminationCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	params.PageFilter(filter)
+
+	cursor, err := oic.ExaminationCollection.Find(context.Background(), filter, params.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	source := timelineSource{
+		Items: []outpatient.TimelineItem{},
+		Total: total,
+	}
+
+	var last primitive.ObjectID
+	read := int64(0)
+	for cursor.Next(context.Background()) {
+		if read == params.Limit {
+			source.Next = &last
+			break
+		}
+		read++
+
+		var examinationdata outpatient.ExaminationDocument
+		if err := cursor.Decode(&examinationdata); err != nil {
+			return nil, err
+		}
+		last = examinationdata.ID
+
+		id := examinationdata.ID
+		signature := examinationdata.Signature
+		examinationdata.Signature = nil
+		examinationdata.ID = primitive.NilObjectID
+
+		dataByte, err := json.Marshal(examinationdata)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = utils.VerifySignature(string(dataByte), *signature)
+		if err != nil {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+			continue
+		}
+
+		utils.Decrypt(
+			examinationdata.ConfidentialEncrypted,
+			oic.ClientEncryption,
+		).Unmarshal(&examinationdata.ConfidentialData)
+
+		examinationdata.ConfidentialEncrypted = nil
+		examinationdata.Signature = signature
+		examinationdata.ID = id
+
+		dataByte, err = json.Marshal(examinationdata)
+		if err != nil {
+			return nil, err
+		}
+
+		item, err := outpatient.NewTimelineItem(outpatient.TIMELINE_PEMERIKSAAN, dataByte, c.GetString("userClient"))
+		if err != nil {
+			return nil, err
+		}
+		source.Items = append(source.Items, *item)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return &source, nil
+}
+
+// serviceTimeline reads a page of the records of the type from the service
+// keeping them, which applies the consent of the patient itself.
+func serviceTimeline(c *gin.Context, timelineType outpatient.TimelineType, noIHS string, encounterID *primitive.ObjectID, params *pagination.Params) (*timelineSource, error) {
+	query := url.Values{}
+	query.Set("limit", fmt.Sprint(params.Limit))
+	if encounterID != nil {
+		query.Set("id_kunjungan", encounterID.Hex())
+	}
+	if !params.Descending {
+		query.Set("sort", "asc")
+	}
+	if params.Cursor != nil {
+		query.Set("cursor", params.Cursor.Hex())
+	}
+	if params.From != nil {
+		query.Set("from", params.From.Format(time.DateOnly))
+	}
+	if params.To != nil {
+		query.Set("to", params.To.Format(time.DateOnly))
+	}
+
+	respBody, err := utils.ListRequest(c, timelineType.Service(), noIHS, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var page struct {
+		Data       []json.RawMessage `json:"data"`
+		Total      int64             `json:"total"`
+		NextCursor string            `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(respBody, &page); err != nil {
+		return nil, err
+	}
+
+	source := timelineSource{
+		Items: []outpatient.TimelineItem{},
+		Total: page.Total,
+	}
+
+	for _, data := range page.Data {
+		item, err := outpatient.NewTimelineItem(timelineType, data, c.GetString("userClient"))
+		if err != nil {
+			return nil, err
+		}
+		source.Items = append(source.Items, *item)
+	}
+
+	if page.NextCursor != "" {
+		next, err := primitive.ObjectIDFromHex(page.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		source.Next = &next
+	}
+
+	return &source, nil
+}
+
+// mergeTimeline puts the pages of every type in the order of their IDs,
+// which is the order the records were made in, and cuts the page where it
+// is certain no record of another type comes between. A type with more
+// records was only read up to its next page, so the records of other types
+// past it wait for the next page of the timeline as well.
+func mergeTimeline(sources []*timelineSource, params *pagination.Params) ([]outpatient.TimelineItem, primitive.ObjectID, bool) {
+	// before tells whether a comes before b in the order asked for
+	before := func(a, b primitive.ObjectID) bool {
+		if params.Descending {
+			return bytes.Compare(a[:], b[:]) > 0
+		}
+		return bytes.Compare(a[:], b[:]) < 0
+	}
+
+	items := []outpatient.TimelineItem{}
+	var boundary *primitive.ObjectID
+	for _, source := range sources {
+		items = append(items, source.Items...)
+		if source.Next != nil && (boundary == nil || before(*source.Next, *boundary)) {
+			boundary = source.Next
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return before(items[i].ID, items[j].ID)
+	})
+
+	more := boundary != nil
+	page := []outpatient.TimelineItem{}
+	for _, item := range items {
+		if int64(len(page)) == params.Limit || (boundary != nil && before(*boundary, item.ID)) {
+			more = true
+			break
+		}
+		page = append(page, item)
+	}
+
+	if len(page) > 0 {
+		return page, page[len(page)-1].ID, more
+	}
+	if boundary != nil {
+		return page, *boundary, more
+	}
+	return page, primitive.NilObjectID, more
+}
+
+// PatientTimelineHandler lists the examinations, laboratory results,
+// prescriptions and radiology results of a patient together, the newest
+// first unless sort is asc. jenis narrows the timeline down to some of the
+// types and id_kunjungan to the records of one encounter. A service that
+// cannot be reached leaves its records out rather than failing the
+// timeline, and is named in tidak_tersedia.
+func (oic *OutpatientExaminationController) PatientTimelineHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noIHS := c.Param("noIHS")
+
+		types, err := outpatient.ParseTimelineTypes(c.Query("jenis"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		encounterID, err := encounterParam(c)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sources := []*timelineSource{}
+		unavailable := []outpatient.TimelineType{}
+		total := int64(0)
+		for _, timelineType := range types {
+			var source *timelineSource
+			if timelineType == outpatient.TIMELINE_PEMERIKSAAN {
+				source, err = oic.examinationTimeline(c, noIHS, encounterID, params)
+				if err != nil {
+					utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			} else {
+				source, err = serviceTimeline(c, timelineType, noIHS, encounterID, params)
+				if err != nil {
+					logger.LogError.Printf("Failed to read the %s of the timeline: %v\n", timelineType, err)
+					unavailable = append(unavailable, timelineType)
+					continue
+				}
+			}
+
+			sources = append(sources, source)
+			total += source.Total
+		}
+
+		items, last, more := mergeTimeline(sources, params)
+
+		utils.JSON(c, http.StatusOK, Timeline{
+			Page:          params.Page(items, total, last, more),
+			TidakTersedia: unavailable,
+		})
+	}
+}
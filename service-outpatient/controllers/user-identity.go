@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"service-outpatient/blindindex"
 	"service-outpatient/datastruct/outpatient/identity"
 	"service-outpatient/db/csfle"
+	"service-outpatient/logger"
 	"service-outpatient/utils"
 	"time"
 
@@ -20,6 +22,8 @@ type UserIdentityController struct {
 
 	ClientEncryption *mongo.ClientEncryption
 	EncryptionOpts   *options.EncryptOptions
+
+	BlindIndex *blindindex.Index
 }
 
 func InitUserIdentityController(client *mongo.Client, csfle *csfle.CSFLE) *UserIdentityController {
@@ -27,7 +31,84 @@ func InitUserIdentityController(client *mongo.Client, csfle *csfle.CSFLE) *UserI
 		Collection:       client.Database("emr").Collection("identitas"),
 		ClientEncryption: csfle.ClientEncryption,
 		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+		BlindIndex:       loadBlindIndex(),
+	}
+}
+
+// ReindexIdentities makes the blind indexes of the identities that were
+// stored before the key was set or with an earlier key. Until it is done
+// those identities cannot be found by their name or date of birth.
+func (uic UserIdentityController) ReindexIdentities() {
+	if !uic.BlindIndex.Enabled() {
+		return
+	}
+
+	fingerprint := uic.BlindIndex.Fingerprint()
+	filter := bson.M{"indeks_kunci": bson.M{"$ne": fingerprint}}
+
+	cursor, err := uic.Collection.Find(context.Background(), filter)
+	if err != nil {
+		logger.LogError.Printf("failed to reindex identities: %v", err)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	reindexed := 0
+	for cursor.Next(context.Background()) {
+		var data identity.AdultPatient
+		if err := cursor.Decode(&data); err != nil {
+			logger.LogError.Printf("failed to reindex identities: %v", err)
+			return
+		}
+
+		if err := uic.reindexIdentity(&data); err != nil {
+			logger.LogError.Printf("failed to reindex identity %s: %v", data.NoIHS, err)
+			continue
+		}
+		reindexed++
+	}
+
+	if err := cursor.Err(); err != nil {
+		logger.LogError.Printf("failed to reindex identities: %v", err)
+		return
+	}
+
+	if reindexed > 0 {
+		logger.LogInfo.Printf("Reindexed %d identities", reindexed)
+	}
+}
+
+func (uic UserIdentityController) reindexIdentity(data *identity.AdultPatient) error {
+	if data.NamaEncrypted != nil {
+		name, err := uic.ClientEncryption.Decrypt(context.Background(), *data.NamaEncrypted)
+		if err != nil {
+			return err
+		}
+		if err := name.Unmarshal(&data.NamaLengkap); err != nil {
+			return err
+		}
 	}
+
+	if data.ConfidentialEncrypted != nil {
+		confidential, err := uic.ClientEncryption.Decrypt(context.Background(), *data.ConfidentialEncrypted)
+		if err != nil {
+			return err
+		}
+		if err := confidential.Unmarshal(&data.ConfidentialData); err != nil {
+			return err
+		}
+	}
+
+	data.Index(uic.BlindIndex)
+
+	// an identity updated meanwhile was already indexed with this key
+	filter := bson.M{"no_ihs": data.NoIHS, "indeks_kunci": bson.M{"$ne": data.IndeksKunci}}
+	_, err := uic.Collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{
+		"indeks_nama":          data.IndeksNama,
+		"indeks_tanggal_lahir": data.IndeksTanggalLahir,
+		"indeks_kunci":         data.IndeksKunci,
+	}})
+	return err
 }
 
 func (uic UserIdentityController) GetAllUserIdentityHandler() gin.HandlerFunc {
@@ -58,6 +139,32 @@ func (uic UserIdentityController) GetAllUserIdentityHandler() gin.HandlerFunc {
 			)
 		}
 
+		// the name is matched by the start of its words
+		if nama := c.Query("nama"); nama != "" {
+			tokens, err := uic.BlindIndex.NameQuery(identity.NameField, nama)
+			if err != nil {
+				utils.JSON(c, searchErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			filter["indeks_nama"] = bson.M{"$all": tokens}
+		}
+
+		from, to := c.Query("tanggal_lahir_from"), c.Query("tanggal_lahir_to")
+		if from != "" || to != "" {
+			start, end, err := blindindex.ParseRange(from, to, time.Now())
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			tokens, err := uic.BlindIndex.DateQuery(identity.BirthDateField, start, end)
+			if err != nil {
+				utils.JSON(c, searchErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			filter["indeks_tanggal_lahir"] = bson.M{"$in": tokens}
+		}
+
 		// Query all outpatient data
 		cursor, err := uic.Collection.Find(context.Background(), filter)
 		if err != nil {
@@ -126,6 +233,8 @@ func (uic UserIdentityController) CreateUserIdentityHandler() gin.HandlerFunc {
 		data.CreatedAt = &now
 		data.UpdatedAt = &now
 
+		data.Index(uic.BlindIndex)
+
 		confidentialEncryptedField := utils.EncryptRandom(
 			data.ConfidentialData,
 			uic.ClientEncryption,
@@ -196,6 +305,8 @@ func (uic UserIdentityController) UpdateUserIdentityHandler() gin.HandlerFunc {
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 		newData.UpdatedAt = &now
 
+		newData.Index(uic.BlindIndex)
+
 		encryptedField := utils.EncryptRandom(
 			newData.ConfidentialData,
 			uic.ClientEncryption,
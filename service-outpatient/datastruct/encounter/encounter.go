@@ -0,0 +1,281 @@
+package encounter
+
+import (
+	"errors"
+	"service-outpatient/datastruct"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InvalidTransitionError = errors.New("encounter status transition is not allowed")
+	InvalidStatusError     = errors.New("status must be a number from 1 to 5")
+	InvalidTypeError       = errors.New("jenis must be 0 (IGD), 1 (rawat inap) or 2 (rawat jalan)")
+	InvalidEncounterError  = errors.New("id_kunjungan must be the ID of an encounter")
+	MissingMemberError     = errors.New("no_peserta is required unless the patient pays for themselves")
+	NothingToUpdateError   = errors.New("give the lokasi, dokter_penanggung_jawab or penjamin to change")
+	NotInProgressError     = errors.New("documents can only be added to an encounter the patient arrived for and that has not ended")
+	EncounterClosedError   = errors.New("the encounter has ended and can no longer be changed")
+	ConcurrentUpdateError  = errors.New("the encounter was changed in the meantime, please try again")
+	TamperedError          = errors.New("the encounter does not match its signature")
+)
+
+// EncounterTransitions maps every target status to the statuses it may be
+// reached from. An encounter the patient never came for is cancelled, one
+// that took place is finished.
+var EncounterTransitions = map[datastruct.EncounterStatus][]datastruct.EncounterStatus{
+	datastruct.KUNJUNGAN_TIBA:        {datastruct.KUNJUNGAN_DIRENCANAKAN},
+	datastruct.KUNJUNGAN_BERLANGSUNG: {datastruct.KUNJUNGAN_DIRENCANAKAN, datastruct.KUNJUNGAN_TIBA},
+	datastruct.KUNJUNGAN_SELESAI:     {datastruct.KUNJUNGAN_BERLANGSUNG},
+	datastruct.KUNJUNGAN_DIBATALKAN:  {datastruct.KUNJUNGAN_DIRENCANAKAN, datastruct.KUNJUNGAN_TIBA},
+}
+
+// Encounter is a visit of a patient to a facility: an outpatient visit, an
+// emergency visit or an inpatient stay. The examinations, orders and
+// prescriptions written during it refer to it by its ID, so it groups
+// every document of the visit.
+type Encounter struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID  string                   `json:"client_id" bson:"client_id"`
+	Signature *string                  `json:"signature" bson:"signature"`
+	NoIHS     string                   `json:"no_ihs" bson:"no_ihs"`
+	Jenis     datastruct.TreatmentType `json:"jenis" bson:"jenis"`
+
+	Status        datastruct.EncounterStatus `json:"status" bson:"status"`
+	RiwayatStatus []StatusHistory            `json:"riwayat_status" bson:"riwayat_status"`
+
+	Periode Period `json:"periode" bson:"periode"`
+
+	// Lokasi is where the patient is now, RiwayatLokasi every place they
+	// were during the encounter, the current one last.
+	Lokasi        Location          `json:"lokasi" bson:"lokasi"`
+	RiwayatLokasi []LocationHistory `json:"riwayat_lokasi" bson:"riwayat_lokasi"`
+
+	DokterPenanggungJawab string `json:"dokter_penanggung_jawab" bson:"dokter_penanggung_jawab"`
+
+	Penjamin          *Payer            `json:"penjamin" bson:"penjamin,omitempty"`
+	PenjaminEncrypted *primitive.Binary `json:"encrypted_penjamin" bson:"encrypted_penjamin"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+// Period is when the encounter took place. It starts once the patient is
+// there and ends when the encounter is finished.
+type Period struct {
+	Mulai   *time.Time `json:"mulai,omitempty" bson:"mulai,omitempty"`
+	Selesai *time.Time `json:"selesai,omitempty" bson:"selesai,omitempty"`
+}
+
+// Location is the unit the patient is at, e.g. a poli, the emergency room
+// or a ward, and for a stay the room and bed.
+type Location struct {
+	Unit  string `json:"unit" binding:"required" bson:"unit"`
+	Ruang string `json:"ruang,omitempty" bson:"ruang,omitempty"`
+	Bed   string `json:"bed,omitempty" bson:"bed,omitempty"`
+}
+
+type LocationHistory struct {
+	Lokasi  Location   `json:"lokasi" bson:"lokasi"`
+	Petugas string     `json:"petugas" bson:"petugas"`
+	Mulai   time.Time  `json:"mulai" bson:"mulai"`
+	Selesai *time.Time `json:"selesai,omitempty" bson:"selesai,omitempty"`
+}
+
+// Payer is who pays for the encounter. NoPeserta is the membership number
+// of the patient with the payer, and NoSEP the eligibility letter BPJS
+// gives for the encounter.
+type Payer struct {
+	Jenis        datastruct.PayerType `json:"jenis" binding:"required,min=1,max=4" bson:"jenis"`
+	NamaPenjamin string               `json:"nama_penjamin,omitempty" bson:"nama_penjamin,omitempty"`
+	NoPeserta    string               `json:"no_peserta,omitempty" bson:"no_peserta,omitempty"`
+	NoSEP        string               `json:"no_sep,omitempty" bson:"no_sep,omitempty"`
+}
+
+type StatusHistory struct {
+	Status  datastruct.EncounterStatus `json:"status" bson:"status"`
+	Petugas string                     `json:"petugas" bson:"petugas"`
+	Alasan  string                     `json:"alasan,omitempty" bson:"alasan,omitempty"`
+	Waktu   time.Time                  `json:"waktu" bson:"waktu"`
+}
+
+// EncounterBody opens an encounter. It is planned unless status says the
+// patient already arrived or is being seen, as in an emergency.
+type EncounterBody struct {
+	NoIHS                 string                     `json:"no_ihs" binding:"required"`
+	Jenis                 datastruct.TreatmentType   `json:"jenis" binding:"min=0,max=2"`
+	Status                datastruct.EncounterStatus `json:"status" binding:"omitempty,min=1,max=3"`
+	Lokasi                Location                   `json:"lokasi" binding:"required"`
+	DokterPenanggungJawab string                     `json:"dokter_penanggung_jawab" binding:"required"`
+	Penjamin              Payer                      `json:"penjamin" binding:"required"`
+}
+
+// UpdateBody changes where the patient is, who is responsible for them or
+// who pays. What is left out stays as it is.
+type UpdateBody struct {
+	Lokasi                *Location `json:"lokasi"`
+	DokterPenanggungJawab string    `json:"dokter_penanggung_jawab"`
+	Penjamin              *Payer    `json:"penjamin"`
+}
+
+type StatusBody struct {
+	Alasan string `json:"alasan"`
+}
+
+func (payer *Payer) Validate() error {
+	if payer.Jenis != datastruct.PENJAMIN_UMUM && payer.NoPeserta == "" {
+		return MissingMemberError
+	}
+
+	return nil
+}
+
+func (body *UpdateBody) Validate() error {
+	if body.Lokasi == nil && body.DokterPenanggungJawab == "" && body.Penjamin == nil {
+		return NothingToUpdateError
+	}
+
+	if body.Penjamin != nil {
+		return body.Penjamin.Validate()
+	}
+
+	return nil
+}
+
+func CheckTransition(from, to datastruct.EncounterStatus) error {
+	for _, status := range EncounterTransitions[to] {
+		if status == from {
+			return nil
+		}
+	}
+
+	return InvalidTransitionError
+}
+
+func NewEncounter(body EncounterBody, by string, now time.Time) Encounter {
+	status := body.Status
+	if status == 0 {
+		status = datastruct.KUNJUNGAN_DIRENCANAKAN
+	}
+
+	payer := body.Penjamin
+	encounter := Encounter{
+		NoIHS:  body.NoIHS,
+		Jenis:  body.Jenis,
+		Status: status,
+		RiwayatStatus: []StatusHistory{
+			{Status: status, Petugas: by, Waktu: now},
+		},
+		Lokasi: body.Lokasi,
+		RiwayatLokasi: []LocationHistory{
+			{Lokasi: body.Lokasi, Petugas: by, Mulai: now},
+		},
+		DokterPenanggungJawab: body.DokterPenanggungJawab,
+		Penjamin:              &payer,
+	}
+
+	if status != datastruct.KUNJUNGAN_DIRENCANAKAN {
+		encounter.Periode.Mulai = &now
+	}
+
+	return encounter
+}
+
+// Closed tells whether the encounter ended, finished or cancelled.
+func (encounter *Encounter) Closed() bool {
+	return encounter.Status == datastruct.KUNJUNGAN_SELESAI || encounter.Status == datastruct.KUNJUNGAN_DIBATALKAN
+}
+
+// Accepts tells whether documents can be added to the encounter, which is
+// while the patient is there.
+func (encounter *Encounter) Accepts() error {
+	if encounter.Status != datastruct.KUNJUNGAN_TIBA && encounter.Status != datastruct.KUNJUNGAN_BERLANGSUNG {
+		return NotInProgressError
+	}
+
+	return nil
+}
+
+// Transition moves the encounter to the status, starting its period when
+// the patient arrives and ending it when it is finished.
+func (encounter *Encounter) Transition(to datastruct.EncounterStatus, by, reason string, now time.Time) error {
+	if err := CheckTransition(encounter.Status, to); err != nil {
+		return err
+	}
+
+	switch to {
+	case datastruct.KUNJUNGAN_TIBA, datastruct.KUNJUNGAN_BERLANGSUNG:
+		if encounter.Periode.Mulai == nil {
+			encounter.Periode.Mulai = &now
+		}
+	case datastruct.KUNJUNGAN_SELESAI:
+		encounter.Periode.Selesai = &now
+		encounter.closeLocation(now)
+	case datastruct.KUNJUNGAN_DIBATALKAN:
+		encounter.closeLocation(now)
+	}
+
+	encounter.Status = to
+	encounter.RiwayatStatus = append(encounter.RiwayatStatus, StatusHistory{
+		Status:  to,
+		Petugas: by,
+		Alasan:  reason,
+		Waktu:   now,
+	})
+
+	return nil
+}
+
+// Move puts the patient at another location, e.g. when they are
+// transferred to another ward.
+func (encounter *Encounter) Move(location Location, by string, now time.Time) {
+	if location == encounter.Lokasi {
+		return
+	}
+
+	encounter.closeLocation(now)
+	encounter.Lokasi = location
+	encounter.RiwayatLokasi = append(encounter.RiwayatLokasi, LocationHistory{
+		Lokasi:  location,
+		Petugas: by,
+		Mulai:   now,
+	})
+}
+
+func (encounter *Encounter) closeLocation(now time.Time) {
+	if last := len(encounter.RiwayatLokasi) - 1; last >= 0 && encounter.RiwayatLokasi[last].Selesai == nil {
+		encounter.RiwayatLokasi[last].Selesai = &now
+	}
+}
+
+func ParseEncounterStatus(value string) (datastruct.EncounterStatus, error) {
+	status, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || status < uint64(datastruct.KUNJUNGAN_DIRENCANAKAN) || status > uint64(datastruct.KUNJUNGAN_DIBATALKAN) {
+		return 0, InvalidStatusError
+	}
+
+	return datastruct.EncounterStatus(status), nil
+}
+
+func ParseEncounterType(value string) (datastruct.TreatmentType, error) {
+	jenis, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || jenis > uint64(datastruct.RAWAT_JALAN) {
+		return 0, InvalidTypeError
+	}
+
+	return datastruct.TreatmentType(jenis), nil
+}
+
+// ParseEncounterID reads the ID of an encounter documents are listed by.
+func ParseEncounterID(value string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return primitive.NilObjectID, InvalidEncounterError
+	}
+
+	return id, nil
+}
@@ -4,15 +4,25 @@ type SexType uint8
 type EduEnum uint8
 type MarriageEnum uint8
 type RecipeStatus uint8
+type SignatureType uint8
 type ExaminationPriority uint8
 type SendingMethod uint8
 type AbnormalitiesEnum uint8
 type ConsciousnessLevel uint8
 type RadiologyExaminationType string
 type TreatmentType uint8
+type LabOrderStatus uint8
+type ResultValueType uint8
+type ResultFlag uint8
 type RoleType string
 type ServiceName string
 type PatientConsent bool
+type WarningType uint8
+type WarningSeverity uint8
+type VerificationStatus uint8
+type AppointmentStatus uint8
+type EncounterStatus uint8
+type PayerType uint8
 
 const (
 	UNKNOWN SexType = iota
@@ -41,9 +51,30 @@ const (
 	CERAI_MATI
 )
 
+// PENDING and SUDAH_DIBERIKAN keep their values so stored prescriptions
+// still read the same.
 const (
 	PENDING RecipeStatus = iota
 	SUDAH_DIBERIKAN
+	DITERIMA
+	DIKAJI
+	DISIAPKAN
+	DIBERIKAN_SEBAGIAN
+	DISERAHKAN
+	DITOLAK
+)
+
+const (
+	PERINGATAN_DUPLIKASI WarningType = iota + 1
+	PERINGATAN_INTERAKSI
+	PERINGATAN_ALERGI
+	PERINGATAN_DOSIS
+)
+
+const (
+	TINGKAT_RINGAN WarningSeverity = iota + 1
+	TINGKAT_SEDANG
+	TINGKAT_BERAT
 )
 
 const (
@@ -87,6 +118,33 @@ const (
 	RAWAT_JALAN
 )
 
+const (
+	REQUESTED LabOrderStatus = iota + 1
+	SPECIMEN_COLLECTED
+	RECEIVED
+	IN_ANALYSIS
+	VALIDATED
+	REPORTED
+	ACKNOWLEDGED
+	CANCELLED
+	REJECTED
+)
+
+const (
+	NUMERIC ResultValueType = iota + 1
+	CODED
+	TEXT
+)
+
+const (
+	FLAG_NORMAL ResultFlag = iota + 1
+	FLAG_LOW
+	FLAG_HIGH
+	FLAG_CRITICAL_LOW
+	FLAG_CRITICAL_HIGH
+	FLAG_ABNORMAL
+)
+
 const (
 	DOKTER       RoleType = "Dokter"
 	APOTEK       RoleType = "Apotek"
@@ -104,3 +162,38 @@ const (
 	OPTIN  PatientConsent = true
 	OPTOUT PatientConsent = false
 )
+
+const (
+	TTD_BASAH SignatureType = iota + 1
+	TTD_ELEKTRONIK
+)
+
+const (
+	DOKUMEN_ASLI VerificationStatus = iota + 1
+	DOKUMEN_DIPERBARUI
+	DOKUMEN_TIDAK_VALID
+)
+
+const (
+	JANJI_DIJADWALKAN AppointmentStatus = iota + 1
+	JANJI_CHECK_IN
+	JANJI_DIPANGGIL
+	JANJI_SELESAI
+	JANJI_DIBATALKAN
+	JANJI_TIDAK_HADIR
+)
+
+const (
+	KUNJUNGAN_DIRENCANAKAN EncounterStatus = iota + 1
+	KUNJUNGAN_TIBA
+	KUNJUNGAN_BERLANGSUNG
+	KUNJUNGAN_SELESAI
+	KUNJUNGAN_DIBATALKAN
+)
+
+const (
+	PENJAMIN_UMUM PayerType = iota + 1
+	PENJAMIN_BPJS
+	PENJAMIN_ASURANSI
+	PENJAMIN_PERUSAHAAN
+)
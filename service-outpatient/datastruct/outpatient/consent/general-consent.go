@@ -1,6 +1,7 @@
 package consent
 
 import (
+	"service-outpatient/attachment"
 	"service-outpatient/datastruct"
 	"time"
 )
@@ -30,4 +31,28 @@ type GeneralConsent struct {
 
 	PenanggungJawab string `json:"penanggung_jawab" binding:"required" bson:"penanggung_jawab"`
 	PetugasConsent  string `json:"petugas_consent" binding:"required" bson:"petugas_consent"`
+
+	// LampiranPindaian is the scan of the signed form.
+	LampiranPindaian *attachment.Reference `json:"lampiran_pindaian,omitempty" bson:"lampiran_pindaian,omitempty"`
+}
+
+func (generalConsent *GeneralConsent) SexString() string {
+	if generalConsent.JenisKelamin == nil {
+		return ""
+	}
+
+	switch *generalConsent.JenisKelamin {
+	case datastruct.UNKNOWN:
+		return "Tidak diketahui"
+	case datastruct.MALE:
+		return "Laki-laki"
+	case datastruct.FEMALE:
+		return "Perempuan"
+	case datastruct.UNDEFINED:
+		return "Tidak dapat ditentukan"
+	case datastruct.NOTFILLED:
+		return "Tidak mengisi"
+	default:
+		return ""
+	}
 }
@@ -1,14 +1,22 @@
 package outpatient
 
 import (
+	"errors"
+	"service-outpatient/attachment"
 	"service-outpatient/datastruct/outpatient/consent"
 	earlyassessment "service-outpatient/datastruct/outpatient/early-assessment"
 	specialityexamination "service-outpatient/datastruct/outpatient/speciality-examination"
+	"service-outpatient/signing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	NotResponsibleDoctorError = errors.New("only the doctor responsible for the examination can sign it")
+	ExaminationSignedError    = errors.New("the examination was digitally signed and can no longer be changed")
+)
+
 type ConfidentialExaminationData struct {
 	CaraPembayaran          string                                      `json:"cara_pembayaran" binding:"required" bson:"cara_pembayaran"`
 	PersetujuanUmum         consent.GeneralConsent                      `json:"persetujuan_umum" binding:"required" bson:"persetujuan_umum"`
@@ -23,10 +31,69 @@ type ExaminationDocument struct {
 	Signature *string `json:"signature" bson:"signature"`
 	NoIHS     string  `json:"no_ihs" binding:"required" bson:"no_ihs"`
 
+	// IDJanjiTemu is the appointment the examination was written for, if
+	// the patient came with one.
+	IDJanjiTemu *primitive.ObjectID `json:"id_janji_temu,omitempty" bson:"id_janji_temu,omitempty"`
+
+	// IDKunjungan is the encounter the examination was written in. The
+	// orders and prescription it sends on refer to the same encounter.
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
 	ConfidentialData      *ConfidentialExaminationData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary            `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
+	// Lampiran records the hash of every attachment the confidential data
+	// refers to, so the signature of the document covers them.
+	Lampiran []attachment.Reference `json:"lampiran,omitempty" bson:"lampiran,omitempty"`
+
+	// TandaTanganDigital is the signature of the responsible doctor, made
+	// with the key the auth service issued to them.
+	TandaTanganDigital *signing.Signature `json:"tanda_tangan_digital,omitempty" bson:"tanda_tangan_digital,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
 }
+
+// Attachments lists the attachments the document refers to.
+func (data *ConfidentialExaminationData) Attachments() []*attachment.Reference {
+	return []*attachment.Reference{
+		data.PersetujuanUmum.LampiranPindaian,
+		data.AsesmenAwal.PemeriksaanFisik.LampiranAnatomiTubuh,
+		data.PemeriksaanSpesialistik.PersetujuanTindakan.LampiranPindaian,
+	}
+}
+
+// SignedExamination is what the responsible doctor signs. Nothing of the
+// examination changes once it is signed, so all of it is signed.
+type SignedExamination struct {
+	ID               string                       `json:"_id"`
+	NoIHS            string                       `json:"no_ihs"`
+	ConfidentialData *ConfidentialExaminationData `json:"confidential_data"`
+	CreatedAt        *time.Time                   `json:"created_at"`
+}
+
+type SignBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SignedContent returns the part of the document the doctor signs. The
+// confidential data must be decrypted.
+func (data *ExaminationDocument) SignedContent() SignedExamination {
+	return SignedExamination{
+		ID:               data.ID.Hex(),
+		NoIHS:            data.NoIHS,
+		ConfidentialData: data.ConfidentialData,
+		CreatedAt:        data.CreatedAt,
+	}
+}
+
+// CanBeSignedBy checks the user signing is the doctor who is responsible
+// for the examination.
+func (data *ExaminationDocument) CanBeSignedBy(by string) error {
+	if data.ConfidentialData.PemeriksaanSpesialistik.PersetujuanTindakan.DokterPenjelas != by {
+		return NotResponsibleDoctorError
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package earlyassessment
 
 import (
+	"service-outpatient/attachment"
 	"service-outpatient/datastruct"
 )
 
@@ -51,8 +52,11 @@ type GeneralCondition struct {
 }
 
 type PhysicalExamination struct {
-	URLAnatomiTubuh string           `json:"url_anatomi_tubuh" binding:"required" bson:"url_anatomi_tubuh"`
-	KeadaanUmum     GeneralCondition `json:"keadaan_umum" binding:"required" bson:"keadaan_umum"`
+	// URLAnatomiTubuh is kept for drawings recorded before they were
+	// uploaded as attachments.
+	URLAnatomiTubuh      string                `json:"url_anatomi_tubuh" binding:"required_without=LampiranAnatomiTubuh" bson:"url_anatomi_tubuh"`
+	LampiranAnatomiTubuh *attachment.Reference `json:"lampiran_anatomi_tubuh,omitempty" bson:"lampiran_anatomi_tubuh,omitempty"`
+	KeadaanUmum          GeneralCondition      `json:"keadaan_umum" binding:"required" bson:"keadaan_umum"`
 }
 
 func (generalCondition *GeneralCondition) ConsciousnessString() string {
@@ -1,6 +1,7 @@
 package identity
 
 import (
+	"service-outpatient/blindindex"
 	"service-outpatient/datastruct"
 	"time"
 
@@ -40,6 +41,13 @@ type ConfidentialIdentityData struct {
 	BahasaDikuasai   string                  `json:"bahasa_dikuasai" binding:"required" bson:"bahasa_dikuasai"`
 }
 
+// fields of the blind indexes, which keep the tokens of a field apart from
+// the tokens of another
+const (
+	NameField      = "nama_lengkap"
+	BirthDateField = "tanggal_lahir"
+)
+
 type AdultPatient struct {
 	NoIHS         string            `json:"no_ihs" binding:"required" bson:"no_ihs"`
 	NamaLengkap   *string           `json:"nama_lengkap" binding:"required" bson:"nama_lengkap,omitempty"`
@@ -55,6 +63,13 @@ type AdultPatient struct {
 	ConfidentialData      *ConfidentialIdentityData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary         `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
+	// IndeksNama and IndeksTanggalLahir search the encrypted name and date
+	// of birth by their tokens. IndeksKunci is the fingerprint of the key
+	// they were made with.
+	IndeksNama         []string `json:"-" bson:"indeks_nama,omitempty"`
+	IndeksTanggalLahir []string `json:"-" bson:"indeks_tanggal_lahir,omitempty"`
+	IndeksKunci        string   `json:"-" bson:"indeks_kunci,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
@@ -84,3 +99,19 @@ func (adultPatient *AdultPatient) EduString() string {
 		return ""
 	}
 }
+
+// Index makes the tokens of the name and the date of birth. It must be
+// called before they are encrypted.
+func (adultPatient *AdultPatient) Index(index *blindindex.Index) {
+	adultPatient.IndeksNama = nil
+	if adultPatient.NamaLengkap != nil {
+		adultPatient.IndeksNama = index.NameTokens(NameField, *adultPatient.NamaLengkap)
+	}
+
+	adultPatient.IndeksTanggalLahir = nil
+	if adultPatient.ConfidentialData != nil {
+		adultPatient.IndeksTanggalLahir = index.DateTokens(BirthDateField, adultPatient.ConfidentialData.TanggalLahir)
+	}
+
+	adultPatient.IndeksKunci = index.Fingerprint()
+}
@@ -0,0 +1,154 @@
+package scheduling
+
+import (
+	"errors"
+	"service-outpatient/datastruct"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InvalidTransitionError = errors.New("appointment status transition is not allowed")
+	PastDayError           = errors.New("appointments cannot be made for a day that has passed")
+	NotTodayError          = errors.New("patients can only check in on the day of their appointment")
+	AppointmentOpenError   = errors.New("the appointment is not checked in or has already been fulfilled")
+	QueueEmptyError        = errors.New("no patient is waiting in the queue")
+	InvalidStatusError     = errors.New("status must be a number from 1 to 6")
+	ConcurrentUpdateError  = errors.New("the appointment was changed in the meantime, please try again")
+	AlreadyBookedError     = errors.New("the patient already has an appointment on that schedule and day")
+	TamperedError          = errors.New("the appointment does not match its signature")
+)
+
+// AppointmentTransitions maps every target status to the statuses it may be
+// reached from. An appointment is fulfilled by the examination written for
+// it, whether or not the patient was called through the queue.
+var AppointmentTransitions = map[datastruct.AppointmentStatus][]datastruct.AppointmentStatus{
+	datastruct.JANJI_CHECK_IN:    {datastruct.JANJI_DIJADWALKAN},
+	datastruct.JANJI_DIPANGGIL:   {datastruct.JANJI_CHECK_IN},
+	datastruct.JANJI_SELESAI:     {datastruct.JANJI_CHECK_IN, datastruct.JANJI_DIPANGGIL},
+	datastruct.JANJI_DIBATALKAN:  {datastruct.JANJI_DIJADWALKAN, datastruct.JANJI_CHECK_IN},
+	datastruct.JANJI_TIDAK_HADIR: {datastruct.JANJI_DIJADWALKAN, datastruct.JANJI_DIPANGGIL},
+}
+
+// Appointment is a visit of a patient booked on a schedule. The queue
+// number is given at check-in and counts per poli and day. The chief
+// complaint is stored encrypted.
+type Appointment struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID   string             `json:"client_id" bson:"client_id"`
+	Signature  *string            `json:"signature" bson:"signature"`
+	NoIHS      string             `json:"no_ihs" bson:"no_ihs"`
+	IDJadwal   primitive.ObjectID `json:"id_jadwal" bson:"id_jadwal"`
+	Poli       string             `json:"poli" bson:"poli"`
+	Dokter     string             `json:"dokter" bson:"dokter"`
+	Tanggal    string             `json:"tanggal" bson:"tanggal"` // YYYY-MM-DD
+	JamMulai   string             `json:"jam_mulai" bson:"jam_mulai"`
+	JamSelesai string             `json:"jam_selesai" bson:"jam_selesai"`
+
+	Keluhan          string            `json:"keluhan,omitempty" bson:"keluhan,omitempty"`
+	KeluhanEncrypted *primitive.Binary `json:"encrypted_keluhan" bson:"encrypted_keluhan"`
+
+	Status        datastruct.AppointmentStatus `json:"status" bson:"status"`
+	RiwayatStatus []AppointmentStatusHistory   `json:"riwayat_status" bson:"riwayat_status"`
+	NoAntrian     uint16                       `json:"no_antrian,omitempty" bson:"no_antrian,omitempty"`
+
+	// IDPemeriksaan is the examination written for the appointment.
+	IDPemeriksaan *primitive.ObjectID `json:"id_pemeriksaan,omitempty" bson:"id_pemeriksaan,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+type AppointmentStatusHistory struct {
+	Status  datastruct.AppointmentStatus `json:"status" bson:"status"`
+	Petugas string                       `json:"petugas" bson:"petugas"`
+	Alasan  string                       `json:"alasan,omitempty" bson:"alasan,omitempty"`
+	Waktu   time.Time                    `json:"waktu" bson:"waktu"`
+}
+
+type AppointmentBody struct {
+	NoIHS    string             `json:"no_ihs" binding:"required"`
+	IDJadwal primitive.ObjectID `json:"id_jadwal" binding:"required"`
+	Tanggal  string             `json:"tanggal" binding:"required"`
+	Keluhan  string             `json:"keluhan"`
+}
+
+type RescheduleBody struct {
+	IDJadwal primitive.ObjectID `json:"id_jadwal" binding:"required"`
+	Tanggal  string             `json:"tanggal" binding:"required"`
+	Alasan   string             `json:"alasan"`
+}
+
+type StatusBody struct {
+	Alasan string `json:"alasan"`
+}
+
+// NoShowResult counts the appointments marked as no-shows.
+type NoShowResult struct {
+	Tanggal    string `json:"tanggal"`
+	TidakHadir int64  `json:"tidak_hadir"`
+}
+
+func CheckTransition(from, to datastruct.AppointmentStatus) error {
+	for _, status := range AppointmentTransitions[to] {
+		if status == from {
+			return nil
+		}
+	}
+
+	return InvalidTransitionError
+}
+
+// Bookable tells whether an appointment can be made for the day.
+func Bookable(day string, now time.Time) error {
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		return InvalidDayError
+	}
+
+	// the dates compare in the order of their days
+	if day < Today(now) {
+		return PastDayError
+	}
+
+	return nil
+}
+
+func NewAppointment(body AppointmentBody, schedule *PractitionerSchedule) Appointment {
+	return Appointment{
+		NoIHS:      body.NoIHS,
+		IDJadwal:   schedule.ID,
+		Poli:       schedule.Poli,
+		Dokter:     schedule.Dokter,
+		Tanggal:    body.Tanggal,
+		JamMulai:   schedule.JamMulai,
+		JamSelesai: schedule.JamSelesai,
+		Keluhan:    body.Keluhan,
+		Status:     datastruct.JANJI_DIJADWALKAN,
+	}
+}
+
+// Reschedule moves the appointment to another schedule or day. It is back
+// to scheduled, so a patient who checked in checks in again.
+func (appointment *Appointment) Reschedule(body RescheduleBody, schedule *PractitionerSchedule) {
+	appointment.IDJadwal = schedule.ID
+	appointment.Poli = schedule.Poli
+	appointment.Dokter = schedule.Dokter
+	appointment.Tanggal = body.Tanggal
+	appointment.JamMulai = schedule.JamMulai
+	appointment.JamSelesai = schedule.JamSelesai
+	appointment.Status = datastruct.JANJI_DIJADWALKAN
+	appointment.NoAntrian = 0
+}
+
+func ParseAppointmentStatus(value string) (datastruct.AppointmentStatus, error) {
+	status, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || status < uint64(datastruct.JANJI_DIJADWALKAN) || status > uint64(datastruct.JANJI_TIDAK_HADIR) {
+		return 0, InvalidStatusError
+	}
+
+	return datastruct.AppointmentStatus(status), nil
+}
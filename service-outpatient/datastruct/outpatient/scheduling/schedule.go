@@ -0,0 +1,104 @@
+package scheduling
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InvalidHourError     = errors.New("jam_mulai and jam_selesai must be written as HH:MM, the end after the start")
+	InvalidDayError      = errors.New("tanggal must be written as YYYY-MM-DD")
+	NoPracticeError      = errors.New("the practitioner does not practice on that day")
+	ScheduleFullError    = errors.New("the schedule has no slot left on that day")
+	ScheduleChangedError = errors.New("the schedule has upcoming appointments, only its quota and whether it is active can be changed")
+	ScheduleInUseError   = errors.New("the schedule has upcoming appointments, cancel or move them first")
+)
+
+// PractitionerSchedule is when a practitioner practices at a poli, every
+// week on the same day. Kuota is how many patients can book a day.
+type PractitionerSchedule struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	ClientID   string       `json:"client_id" bson:"client_id"`
+	Poli       string       `json:"poli" binding:"required" bson:"poli"`
+	Dokter     string       `json:"dokter" binding:"required" bson:"dokter"`
+	Hari       time.Weekday `json:"hari" binding:"min=0,max=6" bson:"hari"` // 0 is Sunday
+	JamMulai   string       `json:"jam_mulai" binding:"required" bson:"jam_mulai"`
+	JamSelesai string       `json:"jam_selesai" binding:"required" bson:"jam_selesai"`
+	Kuota      uint16       `json:"kuota" binding:"required,min=1" bson:"kuota"`
+	Aktif      bool         `json:"aktif" bson:"aktif"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+// Slot is how much of the quota of a schedule is taken on a day.
+type Slot struct {
+	IDJadwal primitive.ObjectID `json:"id_jadwal"`
+	Tanggal  string             `json:"tanggal"`
+	Kuota    uint16             `json:"kuota"`
+	Terisi   uint16             `json:"terisi"`
+	Sisa     uint16             `json:"sisa"`
+}
+
+func (schedule *PractitionerSchedule) Validate() error {
+	start, err := time.Parse("15:04", schedule.JamMulai)
+	if err != nil {
+		return InvalidHourError
+	}
+
+	end, err := time.Parse("15:04", schedule.JamSelesai)
+	if err != nil || !end.After(start) {
+		return InvalidHourError
+	}
+
+	return nil
+}
+
+// PracticesOn tells whether an appointment can be made with the schedule on
+// the day, given as YYYY-MM-DD.
+func (schedule *PractitionerSchedule) PracticesOn(day string) error {
+	date, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return InvalidDayError
+	}
+
+	if !schedule.Aktif || date.Weekday() != schedule.Hari {
+		return NoPracticeError
+	}
+
+	return nil
+}
+
+// SameSlots tells whether the schedule still gives the same slots as the
+// other, so the appointments made with it still hold.
+func (schedule *PractitionerSchedule) SameSlots(other *PractitionerSchedule) bool {
+	return schedule.Poli == other.Poli &&
+		schedule.Dokter == other.Dokter &&
+		schedule.Hari == other.Hari &&
+		schedule.JamMulai == other.JamMulai &&
+		schedule.JamSelesai == other.JamSelesai
+}
+
+func NewSlot(schedule *PractitionerSchedule, day string, taken uint16) Slot {
+	slot := Slot{
+		IDJadwal: schedule.ID,
+		Tanggal:  day,
+		Kuota:    schedule.Kuota,
+		Terisi:   taken,
+	}
+
+	if taken < schedule.Kuota {
+		slot.Sisa = schedule.Kuota - taken
+	}
+
+	return slot
+}
+
+// Today is the day as appointments are written, in the time of the server.
+func Today(now time.Time) string {
+	return now.In(time.Local).Format(time.DateOnly)
+}
@@ -1,11 +1,92 @@
 package specialityexamination
 
+import (
+	"errors"
+	"service-outpatient/terminology"
+	"strings"
+)
+
+var (
+	DuplicateDiagnosisError       = errors.New("a diagnosis is coded more than once")
+	PrimaryDiagnosisRequiredError = errors.New("either diagnosis_primer or kode_primer is required")
+)
+
+type CodedConcept struct {
+	Kode string `json:"kode" binding:"required" bson:"kode"`
+	Nama string `json:"nama" bson:"nama"`
+}
+
 type FinalDiagnosis struct {
-	DiagnosisPrimer   string `json:"diagnosis_primer" binding:"required" bson:"diagnosis_primer"`
-	DiagnosisSekunder string `json:"diagnosis_sekunder" binding:"required" bson:"diagnosis_sekunder"`
+	KodePrimer   *CodedConcept  `json:"kode_primer" bson:"kode_primer,omitempty"`
+	KodeSekunder []CodedConcept `json:"kode_sekunder" bson:"kode_sekunder,omitempty"`
+
+	// free text, filled from the coded diagnoses when not given and used on
+	// its own by records that are not coded
+	DiagnosisPrimer   string `json:"diagnosis_primer" bson:"diagnosis_primer"`
+	DiagnosisSekunder string `json:"diagnosis_sekunder" bson:"diagnosis_sekunder"`
 }
 
 type Diagnosis struct {
-	DiagnosisAwal  string         `json:"diagnosis_awal" binding:"required" bson:"diagnosis_awal"`
-	DiagnosisAkhir FinalDiagnosis `json:"diagnosis_akhir" binding:"required" bson:"diagnosis_akhir"`
+	DiagnosisAwal     string         `json:"diagnosis_awal" binding:"required" bson:"diagnosis_awal"`
+	KodeDiagnosisAwal *CodedConcept  `json:"kode_diagnosis_awal" bson:"kode_diagnosis_awal,omitempty"`
+	DiagnosisAkhir    FinalDiagnosis `json:"diagnosis_akhir" binding:"required" bson:"diagnosis_akhir"`
+}
+
+// Resolve checks the code against the code system and takes its display
+// name from there.
+func (concept *CodedConcept) Resolve(codeSystem *terminology.CodeSystem) error {
+	resolved, err := codeSystem.Lookup(concept.Kode)
+	if err != nil {
+		return err
+	}
+
+	concept.Kode = resolved.Kode
+	concept.Nama = resolved.Nama
+	return nil
+}
+
+// ApplyCoding validates the ICD-10 diagnoses, when coded, and fills the free
+// text fields from them. An uncoded primary diagnosis needs its free text.
+func (diagnosis *Diagnosis) ApplyCoding() error {
+	if diagnosis.KodeDiagnosisAwal != nil {
+		if err := diagnosis.KodeDiagnosisAwal.Resolve(terminology.ICD10); err != nil {
+			return err
+		}
+	}
+
+	final := &diagnosis.DiagnosisAkhir
+	seen := map[string]bool{}
+	if final.KodePrimer != nil {
+		if err := final.KodePrimer.Resolve(terminology.ICD10); err != nil {
+			return err
+		}
+
+		seen[final.KodePrimer.Kode] = true
+	} else if final.DiagnosisPrimer == "" {
+		return PrimaryDiagnosisRequiredError
+	}
+
+	names := []string{}
+	for i := 0; i < len(final.KodeSekunder); i++ {
+		if err := final.KodeSekunder[i].Resolve(terminology.ICD10); err != nil {
+			return err
+		}
+
+		if seen[final.KodeSekunder[i].Kode] {
+			return DuplicateDiagnosisError
+		}
+
+		seen[final.KodeSekunder[i].Kode] = true
+		names = append(names, final.KodeSekunder[i].Nama)
+	}
+
+	if final.DiagnosisPrimer == "" {
+		final.DiagnosisPrimer = final.KodePrimer.Nama
+	}
+
+	if final.DiagnosisSekunder == "" {
+		final.DiagnosisSekunder = strings.Join(names, "; ")
+	}
+
+	return nil
 }
@@ -9,3 +9,11 @@ type SpecialityExamination struct {
 	PersetujuanTindakan   InformedConsent       `json:"persetujuan_tindakan" binding:"required" bson:"persetujuan_tindakan"`
 	Terapi                Therapy               `json:"terapi" binding:"required" bson:"terapi"`
 }
+
+func (specialityExamination *SpecialityExamination) ApplyCoding() error {
+	if err := specialityExamination.Diagnosis.ApplyCoding(); err != nil {
+		return err
+	}
+
+	return specialityExamination.Terapi.Tindakan.ApplyCoding()
+}
@@ -1,6 +1,9 @@
 package specialityexamination
 
-import "time"
+import (
+	"service-outpatient/attachment"
+	"time"
+)
 
 type StatementSigner struct {
 	DokterPenjelas     string `json:"dokter_penjelas" binding:"required" bson:"dokter_penjelas"`
@@ -19,4 +22,7 @@ type InformedConsent struct {
 	Persetujuan         bool            `json:"persetujuan" binding:"required" bson:"persetujuan"`
 	WaktuMenjelaskan    time.Time       `json:"waktu_menjelaskan" binding:"required" bson:"waktu_menjelaskan"`
 	PembuatPernyataan   StatementSigner `json:"pembuat_pernyataan" binding:"required" bson:"pembuat_pernyataan"`
+
+	// LampiranPindaian is the scan of the signed statement.
+	LampiranPindaian *attachment.Reference `json:"lampiran_pindaian,omitempty" bson:"lampiran_pindaian,omitempty"`
 }
@@ -12,6 +12,39 @@ type LabExaminationResult struct {
 	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" bson:"nilai_normal"`
 	NilaiRujukan string                       `json:"nilai_rujukan" bson:"nilai_rujukan"`
 	NilaiKritis  string                       `json:"nilai_kritis" bson:"nilai_kritis"`
+
+	BatasKritisBawah *float64 `json:"batas_kritis_bawah" bson:"batas_kritis_bawah,omitempty"`
+	BatasKritisAtas  *float64 `json:"batas_kritis_atas" bson:"batas_kritis_atas,omitempty"`
+	TandaiKritis     bool     `json:"tandai_kritis" bson:"tandai_kritis,omitempty"`
+}
+
+type AnalyteResult struct {
+	KodeLOINC  string                     `json:"kode_loinc" bson:"kode_loinc"`
+	NamaAnalit string                     `json:"nama_analit" bson:"nama_analit"`
+	TipeNilai  datastruct.ResultValueType `json:"tipe_nilai" bson:"tipe_nilai"`
+
+	NilaiNumerik *float64 `json:"nilai_numerik" bson:"nilai_numerik,omitempty"`
+	NilaiKode    string   `json:"nilai_kode" bson:"nilai_kode,omitempty"`
+	NilaiTeks    string   `json:"nilai_teks" bson:"nilai_teks,omitempty"`
+	Satuan       string   `json:"satuan" bson:"satuan"`
+
+	NilaiRujukan string                       `json:"nilai_rujukan" bson:"nilai_rujukan"`
+	NilaiNormal  datastruct.AbnormalitiesEnum `json:"nilai_normal" bson:"nilai_normal"`
+	Flag         datastruct.ResultFlag        `json:"flag" bson:"flag"`
+	Kritis       bool                         `json:"kritis" bson:"kritis"`
+
+	Validator     string     `json:"validator" bson:"validator"`
+	WaktuValidasi *time.Time `json:"waktu_validasi" bson:"waktu_validasi,omitempty"`
+	Catatan       string     `json:"catatan" bson:"catatan"`
+}
+
+type LabStatusHistory struct {
+	Status   datastruct.LabOrderStatus `json:"status" bson:"status"`
+	Petugas  string                    `json:"petugas" bson:"petugas"`
+	Peran    datastruct.RoleType       `json:"peran" bson:"peran"`
+	ClientID string                    `json:"client_id" bson:"client_id"`
+	Alasan   string                    `json:"alasan" bson:"alasan"`
+	Waktu    time.Time                 `json:"waktu" bson:"waktu"`
 }
 
 type ConfidentialLabRequestData struct {
@@ -46,6 +79,7 @@ type ConfidentialLabRequestData struct {
 
 	WaktuPengolahanSpesimen time.Time            `json:"waktu_pengolahan_spesimen" bson:"waktu_pengolahan_spesimen"`
 	HasilPemeriksaan        LabExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+	HasilAnalit             []AnalyteResult      `json:"hasil_analit" bson:"hasil_analit,omitempty"`
 	InterpretasiHasil       string               `json:"interpretasi_hasil" bson:"interpretasi_hasil"`
 
 	DokterValidatorPemeriksaan        string `json:"dokter_validator_pemeriksaan" bson:"dokter_validator_pemeriksaan"`
@@ -64,9 +98,16 @@ type LaboratoryRequest struct {
 
 	// IDPelanggan string `json:"id_pelanggan" bson:"id_pelanggan"`
 	// NoPermintaan           string `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
-	NamaPemeriksaan        string `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
-	NoIHS                  string `json:"no_ihs" binding:"required" bson:"no_ihs"`
-	NamaFasyankesPemeriksa string `json:"nama_fasyankes_pemeriksa" bson:"nama_fasyankes_pemeriksa"`
+	KodePemeriksaan        string   `json:"kode_pemeriksaan" bson:"kode_pemeriksaan,omitempty"`
+	KodeAnalit             []string `json:"kode_analit" bson:"kode_analit,omitempty"`
+	NamaPemeriksaan        string   `json:"nama_pemeriksaan" binding:"required" bson:"nama_pemeriksaan"`
+	NoIHS                  string   `json:"no_ihs" binding:"required" bson:"no_ihs"`
+	NamaFasyankesPemeriksa string   `json:"nama_fasyankes_pemeriksa" bson:"nama_fasyankes_pemeriksa"`
+
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	StatusPemeriksaan datastruct.LabOrderStatus `json:"status_pemeriksaan" bson:"status_pemeriksaan,omitempty"`
+	RiwayatStatus     []LabStatusHistory        `json:"riwayat_status" bson:"riwayat_status,omitempty"`
 
 	ConfidentialData      *ConfidentialLabRequestData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary           `json:"encrypted_confidential" bson:"encrypted_confidential"`
@@ -108,3 +149,28 @@ func (examinationResult *LabExaminationResult) NormalResultString() string {
 		return ""
 	}
 }
+
+func (laboratoryRequest *LaboratoryRequest) StatusString() string {
+	switch laboratoryRequest.StatusPemeriksaan {
+	case datastruct.REQUESTED:
+		return "Diminta"
+	case datastruct.SPECIMEN_COLLECTED:
+		return "Spesimen diambil"
+	case datastruct.RECEIVED:
+		return "Spesimen diterima"
+	case datastruct.IN_ANALYSIS:
+		return "Dalam analisis"
+	case datastruct.VALIDATED:
+		return "Tervalidasi"
+	case datastruct.REPORTED:
+		return "Dilaporkan"
+	case datastruct.ACKNOWLEDGED:
+		return "Diterima pengirim"
+	case datastruct.CANCELLED:
+		return "Dibatalkan"
+	case datastruct.REJECTED:
+		return "Ditolak"
+	default:
+		return ""
+	}
+}
@@ -1,6 +1,7 @@
 package specialityexamination
 
 import (
+	"service-outpatient/attachment"
 	"service-outpatient/datastruct"
 	"time"
 
@@ -52,22 +53,77 @@ type RecipeAssessment struct {
 	Klinis       ClinicalRegulation       `json:"klinis" bson:"klinis"`
 }
 
+// PrescriptionItem is one drug of a prescription. The pharmacy fills in the
+// name, form and route from its formulary when they are left empty.
+type PrescriptionItem struct {
+	IDItem string `json:"id_item" bson:"id_item"`
+	IDObat string `json:"id_obat" binding:"required" bson:"id_obat"`
+
+	NamaObat      string `json:"nama_obat" bson:"nama_obat"`
+	Bentuk        string `json:"bentuk" bson:"bentuk"`
+	RutePemberian string `json:"rute_pemberian" bson:"rute_pemberian"`
+
+	Dosis            float64 `json:"dosis" binding:"required" bson:"dosis"`
+	SatuanDosis      string  `json:"satuan_dosis" binding:"required" bson:"satuan_dosis"`
+	FrekuensiPerHari uint    `json:"frekuensi_per_hari" binding:"required" bson:"frekuensi_per_hari"`
+	DurasiHari       uint    `json:"durasi_hari" bson:"durasi_hari"`
+	JumlahObat       uint    `json:"jumlah_obat" binding:"required" bson:"jumlah_obat"`
+	AturanTambahan   string  `json:"aturan_tambahan" bson:"aturan_tambahan"`
+
+	JumlahDiberikan uint                    `json:"jumlah_diberikan" bson:"jumlah_diberikan"`
+	Status          datastruct.RecipeStatus `json:"status" bson:"status"`
+	PengkajianResep *RecipeAssessment       `json:"pengkajian_resep" bson:"pengkajian_resep,omitempty"`
+	Pengkaji        string                  `json:"pengkaji" bson:"pengkaji,omitempty"`
+	WaktuPengkajian *time.Time              `json:"waktu_pengkajian" bson:"waktu_pengkajian,omitempty"`
+}
+
+// ClinicalWarning is raised by the pharmacy when the prescription is
+// screened for duplicates, interactions and allergies.
+type ClinicalWarning struct {
+	Kode          string                     `json:"kode" bson:"kode"`
+	IDObat        string                     `json:"id_obat" bson:"id_obat"`
+	Jenis         datastruct.WarningType     `json:"jenis" bson:"jenis"`
+	Tingkat       datastruct.WarningSeverity `json:"tingkat" bson:"tingkat"`
+	IDObatTerkait string                     `json:"id_obat_terkait" bson:"id_obat_terkait"`
+	Deskripsi     string                     `json:"deskripsi" bson:"deskripsi"`
+	Rekomendasi   string                     `json:"rekomendasi" bson:"rekomendasi"`
+
+	Dikonfirmasi     bool       `json:"dikonfirmasi" bson:"dikonfirmasi"`
+	AlasanOverride   string     `json:"alasan_override" bson:"alasan_override"`
+	DikonfirmasiOleh string     `json:"dikonfirmasi_oleh" bson:"dikonfirmasi_oleh"`
+	WaktuKonfirmasi  *time.Time `json:"waktu_konfirmasi" bson:"waktu_konfirmasi,omitempty"`
+}
+
+type WarningAcknowledgement struct {
+	Kode   string `json:"kode" binding:"required" bson:"kode"`
+	Alasan string `json:"alasan" bson:"alasan"`
+}
+
 type ConfidentialPharmacyRequestData struct {
 	NamaLengkap            string    `json:"nama_lengkap" binding:"required" bson:"nama_lengkap"`
 	TanggalLahir           time.Time `json:"tanggal_lahir" binding:"required" bson:"tanggal_lahir"`
 	TinggiBadan            uint16    `json:"tinggi_badan" binding:"required" bson:"tinggi_badan"`
 	BeratBadan             uint16    `json:"berat_badan" binding:"required" bson:"berat_badan"`
-	LuasPermukaanTubuhAnak uint16    `json:"luas_permukaan_tubuh_anak" bson:"luas_permukaan_tubuh_anak"`
-	NamaObat               string    `json:"nama_obat" binding:"required" bson:"nama_obat"`
-	Bentuk                 string    `json:"bentuk" binding:"required" bson:"bentuk"`
-	JumlahObat             uint      `json:"jumlah_obat" binding:"required" bson:"jumlah_obat"`
-	AturanPakai            HowToUse  `json:"aturan_pakai" binding:"required" bson:"aturan_pakai"`
+	LuasPermukaanTubuhAnak float64   `json:"luas_permukaan_tubuh_anak" bson:"luas_permukaan_tubuh_anak"`
 	CatatanResep           string    `json:"catatan_resep" binding:"required" bson:"catatan_resep"`
 
+	ItemResep []PrescriptionItem `json:"item_resep" binding:"dive" bson:"item_resep,omitempty"`
+
+	// single drug of prescriptions written before item_resep
+	NamaObat    string    `json:"nama_obat" bson:"nama_obat"`
+	Bentuk      string    `json:"bentuk" bson:"bentuk"`
+	JumlahObat  uint      `json:"jumlah_obat" bson:"jumlah_obat"`
+	AturanPakai *HowToUse `json:"aturan_pakai" bson:"aturan_pakai,omitempty"`
+
 	RiwayatPenggunaan UsageHistory `json:"riwayat_penggunaan" binding:"required" bson:"riwayat_penggunaan"`
 	RiwayatAlergi     bool         `json:"riwayat_alergi" binding:"required" bson:"riwayat_alergi"`
 	JenisAlergi       string       `json:"jenis_alergi" binding:"required" bson:"jenis_alergi"`
 
+	// filled from the anamnesis when the prescription is sent to the pharmacy
+	DaftarAlergi         []string                 `json:"daftar_alergi" bson:"daftar_alergi,omitempty"`
+	PeringatanKlinis     []ClinicalWarning        `json:"peringatan_klinis" bson:"peringatan_klinis,omitempty"`
+	KonfirmasiPeringatan []WarningAcknowledgement `json:"konfirmasi_peringatan" bson:"konfirmasi_peringatan,omitempty"`
+
 	NamaFasyankesPengirim string `json:"nama_fasyankes_pengirim" binding:"required" bson:"nama_fasyankes_pengirim"`
 	UnitPengirim          string `json:"unit_pengirim" binding:"required" bson:"unit_pengirim"`
 	DokterPenulis         string `json:"dokter_penulis" binding:"required" bson:"dokter_penulis"`
@@ -76,7 +132,13 @@ type ConfidentialPharmacyRequestData struct {
 	NoTelpSelularDokter   string `json:"no_telp_selular_dokter" binding:"required" bson:"no_telp_selular_dokter"`
 
 	WaktuPenulisan    time.Time `json:"waktu_penulisan" binding:"required" bson:"waktu_penulisan"`
-	TandaTanganDokter string    `json:"tanda_tangan_dokter" binding:"required" bson:"tanda_tangan_dokter"`
+	TandaTanganDokter string    `json:"tanda_tangan_dokter" binding:"required_without=LampiranTandaTangan" bson:"tanda_tangan_dokter"`
+
+	// LampiranTandaTangan is the scan of a wet signature.
+	LampiranTandaTangan *attachment.Reference `json:"lampiran_tanda_tangan,omitempty" bson:"lampiran_tanda_tangan,omitempty"`
+
+	// required for narcotics and psychotropics
+	JenisTandaTangan datastruct.SignatureType `json:"jenis_tanda_tangan" bson:"jenis_tanda_tangan,omitempty"`
 
 	StatusResep     *datastruct.RecipeStatus `json:"status_resep" binding:"required" bson:"status_resep"`
 	PengkajianResep RecipeAssessment         `json:"pengkajian_resep" bson:"pengkajian_resep"`
@@ -85,9 +147,11 @@ type ConfidentialPharmacyRequestData struct {
 type DrugRecipeRequest struct {
 	NoRekamMedis string `json:"no_rekam_medis" binding:"required" bson:"no_rekam_medis"`
 	IDPelanggan  string `json:"id_pelanggan" bson:"id_pelanggan"`
-	IDObat       string `json:"id_obat" bson:"id_obat"`
+	IDObat       string `json:"id_obat" bson:"id_obat"` // drug of the first item
 	NoIHS        string `json:"no_ihs" binding:"required" bson:"no_ihs"`
 
+	DaftarIDObat []string `json:"daftar_id_obat" bson:"daftar_id_obat,omitempty"`
+
 	NIK          *uint64           `json:"nik" binding:"required" bson:"nik,omitempty"`
 	NIKEncrypted *primitive.Binary `json:"encrypted_nik" bson:"encrypted_nik"`
 
@@ -99,6 +163,8 @@ type PharmacyRequestDocument struct {
 	Signature *string           `json:"signature" bson:"signature"`
 	Peresepan DrugRecipeRequest `json:"peresepan" binding:"required" bson:"peresepan"`
 
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
@@ -110,6 +176,18 @@ func (drugRecipe *DrugRecipeRequest) StatusString() string {
 		return "pending"
 	case datastruct.SUDAH_DIBERIKAN:
 		return "sudah diberikan"
+	case datastruct.DITERIMA:
+		return "diterima"
+	case datastruct.DIKAJI:
+		return "dikaji"
+	case datastruct.DISIAPKAN:
+		return "disiapkan"
+	case datastruct.DIBERIKAN_SEBAGIAN:
+		return "diberikan sebagian"
+	case datastruct.DISERAHKAN:
+		return "diserahkan"
+	case datastruct.DITOLAK:
+		return "ditolak"
 	default:
 		return ""
 	}
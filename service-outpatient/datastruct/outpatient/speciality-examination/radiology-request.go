@@ -1,6 +1,7 @@
 package specialityexamination
 
 import (
+	"service-outpatient/attachment"
 	"service-outpatient/datastruct"
 	"time"
 
@@ -11,6 +12,88 @@ type RadiologyExaminationResult struct {
 	URLFotoHasilPemeriksaan           string `json:"url_foto_hasil_pemeriksaan" bson:"url_foto_hasil_pemeriksaan"`
 	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" bson:"dokter_penginterpretasi_pemeriksaan"`
 	InterpretasiRadiologi             string `json:"interpretasi_radiologi" bson:"interpretasi_radiologi"`
+
+	Laporan      *RadiologyReport       `json:"laporan,omitempty" bson:"-"`
+	LampiranFoto []attachment.Reference `json:"lampiran_foto,omitempty" bson:"-"`
+}
+
+type RadiologyFinding struct {
+	Kode      string `json:"kode"`
+	Sistem    string `json:"sistem"`
+	Deskripsi string `json:"deskripsi"`
+	Catatan   string `json:"catatan"`
+}
+
+type RadiologyReportSection struct {
+	Kode   string             `json:"kode"`
+	Judul  string             `json:"judul"`
+	Temuan []RadiologyFinding `json:"temuan"`
+	Teks   string             `json:"teks"`
+}
+
+type RadiologyReportAddendum struct {
+	Teks     string    `json:"teks"`
+	Radiolog string    `json:"radiolog"`
+	Waktu    time.Time `json:"waktu"`
+}
+
+// RadiologyReport is the structured report as sent by the radiology service.
+// Status is 1 for preliminary, 2 for final and 3 for amended reports.
+type RadiologyReport struct {
+	KodeTemplate     string                    `json:"kode_template"`
+	NamaTemplate     string                    `json:"nama_template"`
+	Status           uint8                     `json:"status"`
+	Bagian           []RadiologyReportSection  `json:"bagian"`
+	Kesan            string                    `json:"kesan"`
+	Radiolog         string                    `json:"radiolog"`
+	WaktuTandaTangan *time.Time                `json:"waktu_tanda_tangan"`
+	Adendum          []RadiologyReportAddendum `json:"adendum"`
+}
+
+type ImagingSeries struct {
+	SeriesInstanceUID string   `json:"series_instance_uid"`
+	NomorSeri         int      `json:"nomor_seri"`
+	Modalitas         string   `json:"modalitas"`
+	Deskripsi         string   `json:"deskripsi"`
+	JumlahInstance    int      `json:"jumlah_instance"`
+	SOPInstanceUID    []string `json:"sop_instance_uid,omitempty"`
+}
+
+// ImagingStudy is the metadata of the linked study as sent by the radiology
+// service.
+type ImagingStudy struct {
+	StudyInstanceUID string          `json:"study_instance_uid"`
+	AccessionNumber  string          `json:"accession_number"`
+	IDPasien         string          `json:"id_pasien"`
+	NamaPasien       string          `json:"nama_pasien"`
+	TanggalStudi     string          `json:"tanggal_studi"`
+	WaktuStudi       string          `json:"waktu_studi"`
+	Deskripsi        string          `json:"deskripsi"`
+	Modalitas        []string        `json:"modalitas"`
+	JumlahSeri       int             `json:"jumlah_seri"`
+	JumlahInstance   int             `json:"jumlah_instance"`
+	Seri             []ImagingSeries `json:"seri,omitempty"`
+}
+
+// RadiologyPatient holds the demographics the radiology service puts on the
+// modality worklist.
+type RadiologyPatient struct {
+	NamaPasien   string             `json:"nama_pasien" bson:"nama_pasien"`
+	TanggalLahir time.Time          `json:"tanggal_lahir" bson:"tanggal_lahir"`
+	JenisKelamin datastruct.SexType `json:"jenis_kelamin" bson:"jenis_kelamin"`
+}
+
+// RadiologySchedule is the worklist entry the radiology service made for the
+// order.
+type RadiologySchedule struct {
+	StudyInstanceUID  string    `json:"study_instance_uid"`
+	KodeProsedur      string    `json:"kode_prosedur"`
+	DeskripsiProsedur string    `json:"deskripsi_prosedur"`
+	Modalitas         string    `json:"modalitas"`
+	AETitleStasiun    string    `json:"ae_title_stasiun"`
+	NamaStasiun       string    `json:"nama_stasiun"`
+	WaktuJadwal       time.Time `json:"waktu_jadwal"`
+	Status            uint8     `json:"status"`
 }
 
 type ConfidentialRadiologyRequestData struct {
@@ -30,6 +113,8 @@ type ConfidentialRadiologyRequestData struct {
 	WaktuPemeriksaan  time.Time                  `json:"waktu_pemeriksaan" bson:"waktu_pemeriksaan"`
 	JenisBahanKontras string                     `json:"jenis_bahan_kontras" bson:"jenis_bahan_kontras"`
 	HasilPemeriksaan  RadiologyExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+
+	Pasien *RadiologyPatient `json:"pasien,omitempty" bson:"pasien,omitempty"`
 }
 
 type RadiologyRequest struct {
@@ -39,6 +124,14 @@ type RadiologyRequest struct {
 	JenisPemeriksaan datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan" binding:"required" bson:"jenis_pemeriksaan"`
 	// NoPermintaan     string                              `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
 
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	AccessionNumber string             `json:"accession_number,omitempty" bson:"accession_number,omitempty"`
+	Jadwal          *RadiologySchedule `json:"jadwal,omitempty" bson:"-"`
+
+	StudyInstanceUID string        `json:"study_instance_uid,omitempty" bson:"study_instance_uid,omitempty"`
+	Studi            *ImagingStudy `json:"studi,omitempty" bson:"-"`
+
 	ConfidentialData      *ConfidentialRadiologyRequestData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary                 `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
@@ -1,17 +1,24 @@
 package specialityexamination
 
 import (
+	"errors"
+	"service-outpatient/terminology"
 	"time"
 )
 
+var (
+	ActionRequiredError = errors.New("either nama_tindakan or kode_tindakan is required")
+)
+
 type Action struct {
-	NamaTindakan       string    `json:"nama_tindakan" binding:"required" bson:"nama_tindakan"`
-	PetugasPelaksana   string    `json:"petugas_pelaksana" binding:"required" bson:"petugas_pelaksana"`
-	TanggalPelaksanaan time.Time `json:"tanggal_pelaksanaan" binding:"required" bson:"tanggal_pelaksanaan"`
-	WaktuMulai         time.Time `json:"waktu_mulai" binding:"required" bson:"waktu_mulai"`
-	WaktuSelesai       time.Time `json:"waktu_selesai" binding:"required" bson:"waktu_selesai"`
-	AlatMedisDigunakan string    `json:"alat_medis_digunakan" binding:"required" bson:"alat_medis_digunakan"`
-	BMHP               string    `json:"bmhp" binding:"required" bson:"bmhp"`
+	NamaTindakan       string        `json:"nama_tindakan" bson:"nama_tindakan"`
+	KodeTindakan       *CodedConcept `json:"kode_tindakan" bson:"kode_tindakan,omitempty"` // ICD-9-CM
+	PetugasPelaksana   string        `json:"petugas_pelaksana" binding:"required" bson:"petugas_pelaksana"`
+	TanggalPelaksanaan time.Time     `json:"tanggal_pelaksanaan" binding:"required" bson:"tanggal_pelaksanaan"`
+	WaktuMulai         time.Time     `json:"waktu_mulai" binding:"required" bson:"waktu_mulai"`
+	WaktuSelesai       time.Time     `json:"waktu_selesai" binding:"required" bson:"waktu_selesai"`
+	AlatMedisDigunakan string        `json:"alat_medis_digunakan" binding:"required" bson:"alat_medis_digunakan"`
+	BMHP               string        `json:"bmhp" binding:"required" bson:"bmhp"`
 }
 
 type Therapy struct {
@@ -20,3 +27,24 @@ type Therapy struct {
 	HTTPResponseStatus *string            `json:"http_response_status" bson:"http_response_status"`
 	ResepObat          *DrugRecipeRequest `json:"resep_obat" bson:"resep_obat,omitempty"` //bisa empty on create, harus ada ketika get (beda collection)
 }
+
+// ApplyCoding validates the ICD-9-CM procedure code and names the action
+// after it when no name was given.
+func (action *Action) ApplyCoding() error {
+	if action.KodeTindakan == nil {
+		if action.NamaTindakan == "" {
+			return ActionRequiredError
+		}
+		return nil
+	}
+
+	if err := action.KodeTindakan.Resolve(terminology.ICD9CM); err != nil {
+		return err
+	}
+
+	if action.NamaTindakan == "" {
+		action.NamaTindakan = action.KodeTindakan.Nama
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package outpatient
+
+import (
+	"encoding/json"
+	"errors"
+	"service-outpatient/datastruct"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TimelineType string
+type TimelineVisibility string
+
+const (
+	TIMELINE_PEMERIKSAAN  TimelineType = "pemeriksaan"
+	TIMELINE_LABORATORIUM TimelineType = "laboratorium"
+	TIMELINE_RESEP        TimelineType = "resep"
+	TIMELINE_RADIOLOGI    TimelineType = "radiologi"
+)
+
+// TimelineTypes are the records a timeline is made of, in the order they
+// are read.
+var TimelineTypes = []TimelineType{
+	TIMELINE_PEMERIKSAAN,
+	TIMELINE_LABORATORIUM,
+	TIMELINE_RESEP,
+	TIMELINE_RADIOLOGI,
+}
+
+// Why a record can be seen: it was made by the facility asking, the patient
+// consented to the facility seeing it, or it was made before records had an
+// owner.
+const (
+	VISIBILITAS_FASYANKES   TimelineVisibility = "fasyankes"
+	VISIBILITAS_PERSETUJUAN TimelineVisibility = "persetujuan"
+	VISIBILITAS_UMUM        TimelineVisibility = "umum"
+)
+
+var InvalidTimelineTypeError = errors.New("jenis must be a comma separated list of pemeriksaan, laboratorium, resep and radiologi")
+
+// Service is the service that keeps the records of the type. Examinations
+// are kept by this service.
+func (timelineType TimelineType) Service() datastruct.ServiceName {
+	switch timelineType {
+	case TIMELINE_LABORATORIUM:
+		return datastruct.LABORATORY
+	case TIMELINE_RESEP:
+		return datastruct.PHARMACY
+	case TIMELINE_RADIOLOGI:
+		return datastruct.RADIOLOGY
+	default:
+		return ""
+	}
+}
+
+// ParseTimelineTypes reads a comma separated list of types. An empty list
+// is every type.
+func ParseTimelineTypes(value string) ([]TimelineType, error) {
+	if value == "" {
+		return TimelineTypes, nil
+	}
+
+	asked := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		asked[strings.TrimSpace(name)] = true
+	}
+
+	types := []TimelineType{}
+	for _, timelineType := range TimelineTypes {
+		if asked[string(timelineType)] {
+			types = append(types, timelineType)
+			delete(asked, string(timelineType))
+		}
+	}
+
+	if len(asked) > 0 {
+		return nil, InvalidTimelineTypeError
+	}
+
+	return types, nil
+}
+
+// TimelineItem is a record of the patient on their timeline. Data is the
+// record as the service keeping it returned it.
+type TimelineItem struct {
+	ID          primitive.ObjectID `json:"id"`
+	Jenis       TimelineType       `json:"jenis"`
+	Judul       string             `json:"judul,omitempty"`
+	ClientID    string             `json:"client_id"`
+	Visibilitas TimelineVisibility `json:"visibilitas"`
+	Waktu       *time.Time         `json:"waktu"`
+	Data        json.RawMessage    `json:"data"`
+}
+
+// timelineRecord is what every record has in common, whichever service
+// keeps it. Laboratory results name their ID id instead of _id.
+type timelineRecord struct {
+	ID              primitive.ObjectID `json:"_id"`
+	LabID           primitive.ObjectID `json:"id"`
+	ClientID        string             `json:"client_id"`
+	NamaPemeriksaan string             `json:"nama_pemeriksaan"`
+	CreatedAt       *time.Time         `json:"created_at"`
+}
+
+// NewTimelineItem reads a record of the type as the facility of clientID
+// sees it.
+func NewTimelineItem(timelineType TimelineType, data json.RawMessage, clientID string) (*TimelineItem, error) {
+	var record timelineRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	id := record.ID
+	if id.IsZero() {
+		id = record.LabID
+	}
+
+	visibility := VISIBILITAS_PERSETUJUAN
+	switch record.ClientID {
+	case clientID:
+		visibility = VISIBILITAS_FASYANKES
+	case "":
+		visibility = VISIBILITAS_UMUM
+	}
+
+	return &TimelineItem{
+		ID:          id,
+		Jenis:       timelineType,
+		Judul:       record.NamaPemeriksaan,
+		ClientID:    record.ClientID,
+		Visibilitas: visibility,
+		Waktu:       record.CreatedAt,
+		Data:        data,
+	}, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"service-outpatient/datastruct"
 	"service-outpatient/logger"
 	"strings"
 
@@ -53,3 +54,95 @@ func CreateKeyVaultIndex(keyVaultClient *mongo.Client, keyVaultNamespace string)
 	return nil
 
 }
+
+// CreatePatientListIndex serves the list of a patient, which is paged in
+// the order of the IDs.
+func CreatePatientListIndex(client *mongo.Client) error {
+	listIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("emr").Collection("pemeriksaan").Indexes().CreateOne(context.TODO(), listIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create patient list index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateIdentitySearchIndex serves the search of patients by the blind
+// indexes of their name and date of birth. The two are indexed apart, as
+// one index cannot hold two arrays.
+func CreateIdentitySearchIndex(client *mongo.Client) error {
+	searchIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "indeks_nama", Value: 1}}},
+		{Keys: bson.D{{Key: "indeks_tanggal_lahir", Value: 1}}},
+	}
+
+	_, err := client.Database("emr").Collection("identitas").Indexes().CreateMany(context.TODO(), searchIndexes)
+	if err != nil {
+		return fmt.Errorf("failed to create identity search index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateAppointmentIndex serves the appointments of a day and its queue,
+// and the appointments of a patient.
+func CreateAppointmentIndex(client *mongo.Client) error {
+	appointmentIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "tanggal", Value: 1}, {Key: "poli", Value: 1}, {Key: "no_antrian", Value: 1}}},
+		{Keys: bson.D{{Key: "id_jadwal", Value: 1}, {Key: "tanggal", Value: 1}}},
+		{Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}}},
+	}
+
+	_, err := client.Database("emr").Collection("janji_temu").Indexes().CreateMany(context.TODO(), appointmentIndexes)
+	if err != nil {
+		return fmt.Errorf("failed to create appointment index: %v", err)
+	}
+
+	// a patient is booked once on a schedule and day while the appointment
+	// is upcoming, i.e. scheduled, checked in or called
+	bookingIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "id_jadwal", Value: 1}, {Key: "tanggal", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{Key: "status", Value: bson.D{
+					{Key: "$lte", Value: datastruct.JANJI_DIPANGGIL},
+				}},
+			}),
+	}
+
+	_, err = client.Database("emr").Collection("janji_temu").Indexes().CreateOne(context.TODO(), bookingIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create appointment booking index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateEncounterIndex serves the encounters of a patient and the
+// examinations written in an encounter.
+func CreateEncounterIndex(client *mongo.Client) error {
+	encounterIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("emr").Collection("kunjungan").Indexes().CreateOne(context.TODO(), encounterIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create encounter index: %v", err)
+	}
+
+	examinationIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "id_kunjungan", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+
+	_, err = client.Database("emr").Collection("pemeriksaan").Indexes().CreateOne(context.TODO(), examinationIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create encounter index: %v", err)
+	}
+
+	return nil
+}
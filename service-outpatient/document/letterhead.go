@@ -0,0 +1,74 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var (
+	LogoTypeError = errors.New("the logo of the letterhead must be a png or jpeg image")
+)
+
+var logoTypes = map[string]string{
+	"image/png":  "PNG",
+	"image/jpeg": "JPG",
+}
+
+// Letterhead is printed on top of every page of the documents issued by the
+// facility.
+type Letterhead struct {
+	Nama    string
+	Alamat  string
+	Telepon string
+	Surel   string
+
+	Logo     []byte
+	TipeLogo string
+}
+
+// LoadLetterhead reads the logo of the facility, if any, so it is read once
+// and not on every document.
+func LoadLetterhead(nama, alamat, telepon, surel, logo string) (Letterhead, error) {
+	letterhead := Letterhead{
+		Nama:    nama,
+		Alamat:  alamat,
+		Telepon: telepon,
+		Surel:   surel,
+	}
+
+	if logo == "" {
+		return letterhead, nil
+	}
+
+	content, err := os.ReadFile(logo)
+	if err != nil {
+		return letterhead, err
+	}
+
+	contentType := http.DetectContentType(content)
+	imageType, ok := logoTypes[contentType]
+	if !ok {
+		return letterhead, fmt.Errorf("%s: %w", contentType, LogoTypeError)
+	}
+
+	letterhead.Logo = content
+	letterhead.TipeLogo = imageType
+
+	return letterhead, nil
+}
+
+// Contact joins the phone number and the email address of the facility.
+func (letterhead *Letterhead) Contact() string {
+	switch {
+	case letterhead.Telepon != "" && letterhead.Surel != "":
+		return fmt.Sprintf("Telp. %s | Surel: %s", letterhead.Telepon, letterhead.Surel)
+	case letterhead.Telepon != "":
+		return fmt.Sprintf("Telp. %s", letterhead.Telepon)
+	case letterhead.Surel != "":
+		return fmt.Sprintf("Surel: %s", letterhead.Surel)
+	default:
+		return ""
+	}
+}
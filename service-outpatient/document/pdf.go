@@ -0,0 +1,295 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	margin      = 15.0
+	lineHeight  = 5.0
+	labelWidth  = 55.0
+	qrSize      = 30.0
+	signerWidth = 65.0
+	signHeight  = 42.0
+)
+
+// Column is a column of a table, its width given in millimetres.
+type Column struct {
+	Judul string
+	Lebar float64
+}
+
+// Document lays out a printable A4 document with the letterhead of the
+// facility on every page. It only uses the core fonts of PDF, so no font
+// files are needed to render it.
+type Document struct {
+	pdf        *gofpdf.Fpdf
+	translate  func(string) string
+	letterhead Letterhead
+}
+
+// New starts a document with its title and number on the first page. The
+// footer of every page shows the number and when the document was printed.
+func New(letterhead Letterhead, title, number string, printedAt time.Time) *Document {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+5)
+	pdf.AliasNbPages("{nb}")
+	pdf.SetCreationDate(printedAt)
+	pdf.SetTitle(title, true)
+	pdf.SetCreator(letterhead.Nama, true)
+
+	document := &Document{
+		pdf:        pdf,
+		translate:  pdf.UnicodeTranslatorFromDescriptor(""),
+		letterhead: letterhead,
+	}
+
+	if letterhead.Logo != nil {
+		pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: letterhead.TipeLogo}, bytes.NewReader(letterhead.Logo))
+	}
+
+	pdf.SetHeaderFunc(document.header)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.CellFormat(0, 4, document.translate(fmt.Sprintf("No. %s - dicetak %s", number, FormatTime(printedAt))), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 4, fmt.Sprintf("Halaman %d dari {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 7, document.translate(strings.ToUpper(title)), "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(0, 5, document.translate(fmt.Sprintf("No. %s", number)), "", 1, "C", false, 0, "")
+	pdf.Ln(3)
+
+	return document
+}
+
+func (document *Document) header() {
+	pdf := document.pdf
+	letterhead := document.letterhead
+
+	x := margin
+	if letterhead.Logo != nil {
+		pdf.ImageOptions("logo", margin, margin, 0, 18, false, gofpdf.ImageOptions{ImageType: letterhead.TipeLogo}, 0, "")
+		x += 22
+	}
+
+	pdf.SetXY(x, margin)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 7, document.translate(letterhead.Nama), "", 2, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 9)
+	if letterhead.Alamat != "" {
+		pdf.CellFormat(0, 4.5, document.translate(letterhead.Alamat), "", 2, "L", false, 0, "")
+	}
+	if contact := letterhead.Contact(); contact != "" {
+		pdf.CellFormat(0, 4.5, document.translate(contact), "", 2, "L", false, 0, "")
+	}
+
+	width, _ := pdf.GetPageSize()
+	y := margin + 20
+	pdf.SetLineWidth(0.6)
+	pdf.Line(margin, y, width-margin, y)
+	pdf.SetLineWidth(0.2)
+	pdf.Line(margin, y+1, width-margin, y+1)
+
+	pdf.SetY(y + 4)
+}
+
+func (document *Document) width() float64 {
+	width, _ := document.pdf.GetPageSize()
+	return width - 2*margin
+}
+
+// fits starts a new page when the next height would not fit on this one.
+func (document *Document) fits(height float64) {
+	_, pageHeight := document.pdf.GetPageSize()
+	if document.pdf.GetY()+height > pageHeight-margin-5 {
+		document.pdf.AddPage()
+	}
+}
+
+func orDash(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// Section starts a part of the document under a shaded heading.
+func (document *Document) Section(title string) {
+	pdf := document.pdf
+
+	document.fits(3 * lineHeight)
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	pdf.CellFormat(0, 6, document.translate(title), "", 1, "L", true, 0, "")
+	pdf.Ln(1)
+}
+
+// Field prints a label with its value. Long values wrap below the value
+// column.
+func (document *Document) Field(label, value string) {
+	pdf := document.pdf
+
+	document.fits(lineHeight)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(labelWidth, lineHeight, document.translate(label), "", 0, "L", false, 0, "")
+	pdf.CellFormat(3, lineHeight, ":", "", 0, "L", false, 0, "")
+	pdf.MultiCell(document.width()-labelWidth-3, lineHeight, document.translate(orDash(value)), "", "L", false)
+}
+
+func (document *Document) Paragraph(text string) {
+	document.pdf.SetFont("Helvetica", "", 9)
+	document.pdf.MultiCell(0, lineHeight, document.translate(orDash(text)), "", "L", false)
+}
+
+// List prints the items as bullets, or a dash when there are none.
+func (document *Document) List(items []string) {
+	if len(items) == 0 {
+		document.Paragraph("")
+		return
+	}
+
+	pdf := document.pdf
+	pdf.SetFont("Helvetica", "", 9)
+	for i := 0; i < len(items); i++ {
+		document.fits(lineHeight)
+		pdf.CellFormat(5, lineHeight, document.translate("•"), "", 0, "L", false, 0, "")
+		pdf.MultiCell(document.width()-5, lineHeight, document.translate(orDash(items[i])), "", "L", false)
+	}
+}
+
+// Table prints the rows under a header. Cells wrap, and every row is as
+// tall as its longest cell. The header is repeated on a new page.
+func (document *Document) Table(columns []Column, rows [][]string) {
+	pdf := document.pdf
+
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 8.5)
+		pdf.SetFillColor(240, 240, 240)
+		for i := 0; i < len(columns); i++ {
+			pdf.CellFormat(columns[i].Lebar, 6, document.translate(columns[i].Judul), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 8.5)
+	}
+
+	document.fits(12)
+	header()
+
+	if len(rows) == 0 {
+		total := 0.0
+		for i := 0; i < len(columns); i++ {
+			total += columns[i].Lebar
+		}
+		pdf.CellFormat(total, 6, "-", "1", 1, "C", false, 0, "")
+		return
+	}
+
+	for i := 0; i < len(rows); i++ {
+		lines := 1
+		for j := 0; j < len(columns) && j < len(rows[i]); j++ {
+			count := len(pdf.SplitLines([]byte(document.translate(rows[i][j])), columns[j].Lebar-2))
+			if count > lines {
+				lines = count
+			}
+		}
+
+		height := float64(lines)*4.5 + 1.5
+		_, pageHeight := pdf.GetPageSize()
+		if pdf.GetY()+height > pageHeight-margin-5 {
+			pdf.AddPage()
+			header()
+		}
+
+		x, y := pdf.GetXY()
+		for j := 0; j < len(columns); j++ {
+			cell := ""
+			if j < len(rows[i]) {
+				cell = rows[i][j]
+			}
+
+			pdf.Rect(x, y, columns[j].Lebar, height, "D")
+			pdf.SetXY(x+1, y+0.75)
+			pdf.MultiCell(columns[j].Lebar-2, 4.5, document.translate(cell), "", "L", false)
+			x += columns[j].Lebar
+		}
+		pdf.SetXY(margin, y+height)
+	}
+}
+
+// Sign closes the document with its signer and a QR code. The QR code links
+// to the verification of the signature of the stored document, so a reader
+// can tell whether the printout is still the document on record.
+func (document *Document) Sign(role, signer string, signedAt time.Time, verification string) error {
+	pdf := document.pdf
+
+	qr, err := qrcode.Encode(verification, qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+	pdf.RegisterImageOptionsReader("verification", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(qr))
+
+	pdf.Ln(4)
+	document.fits(signHeight)
+	_, y := pdf.GetXY()
+
+	pdf.ImageOptions("verification", margin, y, qrSize, qrSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, verification)
+	pdf.SetXY(margin+qrSize+3, y+2)
+	pdf.SetFont("Helvetica", "", 7.5)
+	pdf.MultiCell(document.width()-qrSize-signerWidth-6, 3.8, document.translate(
+		"Dokumen ini ditandatangani secara elektronik. Pindai kode QR untuk memeriksa keaslian dokumen dan memastikan dokumen belum diubah sejak dicetak.",
+	), "", "L", false)
+
+	x := margin + document.width() - signerWidth
+	pdf.SetXY(x, y)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(signerWidth, lineHeight, document.translate(FormatDate(signedAt)), "", 2, "C", false, 0, "")
+	pdf.CellFormat(signerWidth, lineHeight, document.translate(role), "", 2, "C", false, 0, "")
+	pdf.SetXY(x, y+signHeight-14)
+	pdf.SetFont("Helvetica", "BU", 9)
+	pdf.CellFormat(signerWidth, lineHeight, document.translate(orDash(signer)), "", 2, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "I", 7.5)
+	pdf.CellFormat(signerWidth, 4, document.translate("Tanda tangan elektronik"), "", 2, "C", false, 0, "")
+
+	pdf.SetXY(margin, y+signHeight)
+
+	return pdf.Error()
+}
+
+// Write renders the document. Any error while laying it out surfaces here.
+func (document *Document) Write(w io.Writer) error {
+	return document.pdf.Output(w)
+}
+
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format("02-01-2006")
+}
+
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format("02-01-2006 15:04")
+}
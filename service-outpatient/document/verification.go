@@ -0,0 +1,83 @@
+package document
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"service-outpatient/datastruct"
+	"time"
+)
+
+// Verification is what the public verification of a printed document
+// tells. It names the document but never shows its content.
+type Verification struct {
+	ID             string                        `json:"id"`
+	JenisDokumen   string                        `json:"jenis_dokumen"`
+	Fasyankes      string                        `json:"fasyankes"`
+	Status         datastruct.VerificationStatus `json:"status"`
+	Keterangan     string                        `json:"keterangan"`
+	DiperbaruiPada *time.Time                    `json:"diperbarui_pada,omitempty"`
+}
+
+// Fingerprint is a short digest of the signature of a document. It is put
+// into the QR code of the printout instead of the signature itself, which
+// is too long to scan reliably.
+func Fingerprint(signature string) string {
+	sum := sha256.Sum256([]byte(signature))
+	return hex.EncodeToString(sum[:10])
+}
+
+// VerificationURL is the link in the QR code of a printout, pointing to the
+// verification of the document as it was signed when printed.
+func VerificationURL(base, id, signature string) string {
+	query := url.Values{}
+	query.Set("fingerprint", Fingerprint(signature))
+
+	return fmt.Sprintf("%s/%s?%s", base, id, query.Encode())
+}
+
+// Check tells whether the stored document still carries a valid signature
+// and whether it is the one the printout was made from.
+func Check(signature *string, valid bool, fingerprint string) datastruct.VerificationStatus {
+	if signature == nil || !valid {
+		return datastruct.DOKUMEN_TIDAK_VALID
+	}
+
+	if subtle.ConstantTimeCompare([]byte(Fingerprint(*signature)), []byte(fingerprint)) != 1 {
+		return datastruct.DOKUMEN_DIPERBARUI
+	}
+
+	return datastruct.DOKUMEN_ASLI
+}
+
+func NewVerification(id, kind, facility string, status datastruct.VerificationStatus, updatedAt *time.Time) Verification {
+	verification := Verification{
+		ID:           id,
+		JenisDokumen: kind,
+		Fasyankes:    facility,
+		Status:       status,
+	}
+	verification.Keterangan = verification.StatusString()
+
+	// the date is only shown to holders of the printout on record
+	if status == datastruct.DOKUMEN_ASLI {
+		verification.DiperbaruiPada = updatedAt
+	}
+
+	return verification
+}
+
+func (verification *Verification) StatusString() string {
+	switch verification.Status {
+	case datastruct.DOKUMEN_ASLI:
+		return "Dokumen asli dan sesuai dengan data yang tersimpan"
+	case datastruct.DOKUMEN_DIPERBARUI:
+		return "Dokumen telah diperbarui sejak dicetak, minta cetakan terbaru"
+	case datastruct.DOKUMEN_TIDAK_VALID:
+		return "Tanda tangan dokumen tidak valid"
+	default:
+		return ""
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"service-outpatient/db/csfle"
 	"service-outpatient/logger"
 	"service-outpatient/router"
+	"service-outpatient/terminology"
 )
 
 func main() {
 	cfg := config.Get()
+	terminology.Init()
+
 	keyVaultNamespace := "encryption.__keyVault"
 
 	client := db.ConnectDB(&cfg)
@@ -21,6 +24,26 @@ func main() {
 		return
 	}
 
+	if err := db.CreatePatientListIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateIdentitySearchIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateAppointmentIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateEncounterIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
 	csfle := csfle.InitCSFLE(&cfg, client)
 
 	err := csfle.CreateClientEncryption(keyVaultNamespace).GetKey()
@@ -6,6 +6,8 @@ import (
 	"service-outpatient/datastruct"
 	"service-outpatient/db/csfle"
 	"service-outpatient/middleware"
+	"service-outpatient/pagination"
+	"service-outpatient/terminology"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +19,9 @@ type RouterConfig struct {
 
 	UserIdentityController *emr_controllers.UserIdentityController
 	OutpatientExamination  *emr_controllers.OutpatientExaminationController
+	Attachment             *emr_controllers.AttachmentController
+	Scheduling             *emr_controllers.SchedulingController
+	Encounter              *emr_controllers.EncounterController
 }
 
 func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
@@ -24,8 +29,15 @@ func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
 		Client:                 client,
 		UserIdentityController: emr_controllers.InitUserIdentityController(client, csfle),
 		OutpatientExamination:  emr_controllers.InitOutpatientExaminationController(client, csfle),
+		Attachment:             emr_controllers.InitAttachmentController(client, csfle),
+		Scheduling:             emr_controllers.InitSchedulingController(client, csfle),
+		Encounter:              emr_controllers.InitEncounterController(client, csfle),
 	}
 
+	// identities stored before the blind index key was set, or with an
+	// earlier key, are indexed again meanwhile
+	go routerConfig.UserIdentityController.ReindexIdentities()
+
 	return routerConfig.SetRouter()
 }
 
@@ -35,6 +47,18 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 
 	router.GET("/live", LivenessCheck())
 	router.GET("/ready", ReadinessCheck(routerConfig.Client))
+
+	// signed download links are opened without a token or timestamp, e.g.
+	// from an image tag
+	router.GET(emr_controllers.AttachmentLinkPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"expires", "signature"}}),
+		routerConfig.Attachment.LinkedAttachmentHandler())
+
+	// printed documents are verified by scanning their QR code
+	router.GET(emr_controllers.DocumentVerifyPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"fingerprint"}}),
+		routerConfig.OutpatientExamination.VerifyExaminationHandler())
+
 	router.Use(middleware.CORS(), middleware.Timekeep(time.Duration(config.TimestampSkew)*time.Millisecond))
 
 	// Define routes
@@ -51,7 +75,11 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		"paramKey":  "objID",
 	}
 
-	// resource.GET("/identity", middleware.Authorization(datastruct.DOKTER), routerConfig.UserIdentityController.GetAllUserIdentityHandler())
+	resource.GET("/identity",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{
+			"no_ihs", "nik", "identitas_lain", "nama", "tanggal_lahir_from", "tanggal_lahir_to",
+		}}),
+		routerConfig.UserIdentityController.GetAllUserIdentityHandler())
 	// resource.POST("/identity", middleware.Authorization(datastruct.DOKTER), routerConfig.UserIdentityController.CreateUserIdentityHandler())
 	// resource.PUT("/identity/:noIHS", middleware.Authorization(datastruct.DOKTER), routerConfig.UserIdentityController.UpdateUserIdentityHandler())
 	// resource.DELETE("/identity/:noIHS", middleware.Authorization(datastruct.DOKTER), routerConfig.UserIdentityController.DeleteUserIdentityHandler())
@@ -60,16 +88,40 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		Queries: []string{},
 	}
 
+	ap2 := middleware.AcceptableParams{
+		Queries: append([]string{"id_kunjungan"}, pagination.Queries...),
+	}
+
 	resource.GET("/outpatient/patient/:noIHS",
 		middleware.GetConsent(consentGetter),
-		middleware.Sanitize(ap),
+		middleware.Sanitize(ap2),
 		routerConfig.OutpatientExamination.GetAllOutpatientExaminationHandler())
 
+	resource.GET("/timeline/:noIHS",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(middleware.AcceptableParams{Queries: append([]string{"jenis", "id_kunjungan"}, pagination.Queries...)}),
+		routerConfig.OutpatientExamination.PatientTimelineHandler())
+
 	resource.GET("/outpatient/:noIHS/:objID",
 		middleware.GetConsent(consentGetter),
 		middleware.Sanitize(ap),
 		routerConfig.OutpatientExamination.GetOutpatientExaminationHandler())
 
+	resource.GET("/outpatient/:noIHS/:objID/pdf",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.OutpatientExamination.ExaminationResumeHandler())
+
+	resource.GET("/outpatient/:noIHS/:objID/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.OutpatientExamination.OutpatientExaminationSignatureHandler())
+
+	resource.POST("/outpatient/:noIHS/:objID/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.OutpatientExamination.SignOutpatientExaminationHandler())
+
 	resource.POST("/outpatient",
 		middleware.Sanitize(ap),
 		routerConfig.OutpatientExamination.CreateOutpatientExaminationHandler())
@@ -89,5 +141,160 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		middleware.Sanitize(ap),
 		emr_controllers.ConsentHandler(routerConfig.OutpatientExamination.ConsentCollection))
 
+	attachmentDeleteConfig := map[string]string{
+		"filterKey": "_id",
+		"paramKey":  "id",
+	}
+
+	resource.POST("/attachment/:noIHS",
+		middleware.Sanitize(ap),
+		routerConfig.Attachment.UploadAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.Attachment.GetAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id/content",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.Attachment.DownloadAttachmentHandler())
+
+	resource.POST("/attachment/:noIHS/:id/link",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.Attachment.AttachmentLinkHandler())
+
+	resource.DELETE("/attachment/:noIHS/:id",
+		middleware.AuthorizationDelete(attachmentDeleteConfig, routerConfig.Attachment.AttachmentCollection),
+		middleware.Sanitize(ap),
+		routerConfig.Attachment.DeleteAttachmentHandler())
+
+	ap4 := middleware.AcceptableParams{
+		Queries: []string{"poli", "dokter", "hari"},
+	}
+
+	resource.POST("/schedule",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.CreateScheduleHandler())
+
+	resource.GET("/schedule",
+		middleware.Sanitize(ap4),
+		routerConfig.Scheduling.GetAllScheduleHandler())
+
+	resource.PUT("/schedule/:jadwalId",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.UpdateScheduleHandler())
+
+	resource.DELETE("/schedule/:jadwalId",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.DeleteScheduleHandler())
+
+	resource.GET("/schedule/:jadwalId/slot",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"tanggal"}}),
+		routerConfig.Scheduling.ScheduleSlotHandler())
+
+	resource.POST("/appointment",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.CreateAppointmentHandler())
+
+	resource.GET("/appointment",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"tanggal", "poli", "dokter", "status"}}),
+		routerConfig.Scheduling.GetAllAppointmentHandler())
+
+	resource.GET("/appointment/patient/:noIHS",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: append([]string{"status"}, pagination.Queries...)}),
+		routerConfig.Scheduling.GetPatientAppointmentHandler())
+
+	resource.POST("/appointment/no-show",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"tanggal"}}),
+		routerConfig.Scheduling.MarkNoShowHandler())
+
+	resource.GET("/appointment/:appointmentId",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.GetAppointmentHandler())
+
+	resource.PUT("/appointment/:appointmentId",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.RescheduleAppointmentHandler())
+
+	resource.POST("/appointment/:appointmentId/check-in",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.TransitionAppointmentHandler(datastruct.JANJI_CHECK_IN))
+
+	resource.POST("/appointment/:appointmentId/cancel",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.TransitionAppointmentHandler(datastruct.JANJI_DIBATALKAN))
+
+	resource.POST("/appointment/:appointmentId/no-show",
+		middleware.Sanitize(ap),
+		routerConfig.Scheduling.TransitionAppointmentHandler(datastruct.JANJI_TIDAK_HADIR))
+
+	ap5 := middleware.AcceptableParams{
+		Queries: []string{"poli", "dokter"},
+	}
+
+	resource.GET("/queue",
+		middleware.Sanitize(ap5),
+		routerConfig.Scheduling.GetQueueHandler())
+
+	resource.POST("/queue/call-next",
+		middleware.Sanitize(ap5),
+		routerConfig.Scheduling.CallNextHandler())
+
+	resource.POST("/encounter",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.CreateEncounterHandler())
+
+	resource.GET("/encounter/patient/:noIHS",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(middleware.AcceptableParams{Queries: append([]string{"jenis", "status"}, pagination.Queries...)}),
+		routerConfig.Encounter.GetPatientEncounterHandler())
+
+	resource.GET("/encounter/:noIHS/:encounterId",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.GetEncounterHandler())
+
+	resource.PUT("/encounter/:noIHS/:encounterId",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.UpdateEncounterHandler())
+
+	resource.POST("/encounter/:noIHS/:encounterId/arrived",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.TransitionEncounterHandler(datastruct.KUNJUNGAN_TIBA))
+
+	resource.POST("/encounter/:noIHS/:encounterId/in-progress",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.TransitionEncounterHandler(datastruct.KUNJUNGAN_BERLANGSUNG))
+
+	resource.POST("/encounter/:noIHS/:encounterId/finished",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.TransitionEncounterHandler(datastruct.KUNJUNGAN_SELESAI))
+
+	resource.POST("/encounter/:noIHS/:encounterId/cancelled",
+		middleware.Sanitize(ap),
+		routerConfig.Encounter.TransitionEncounterHandler(datastruct.KUNJUNGAN_DIBATALKAN))
+
+	ap3 := middleware.AcceptableParams{
+		Queries: []string{"q", "limit"},
+	}
+
+	resource.GET("/terminology/icd10",
+		middleware.Sanitize(ap3),
+		emr_controllers.SearchConceptHandler(terminology.ICD10))
+
+	resource.GET("/terminology/icd10/:kode",
+		middleware.Sanitize(ap),
+		emr_controllers.GetConceptHandler(terminology.ICD10))
+
+	resource.GET("/terminology/icd9cm",
+		middleware.Sanitize(ap3),
+		emr_controllers.SearchConceptHandler(terminology.ICD9CM))
+
+	resource.GET("/terminology/icd9cm/:kode",
+		middleware.Sanitize(ap),
+		emr_controllers.GetConceptHandler(terminology.ICD9CM))
+
 	return router
 }
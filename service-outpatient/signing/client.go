@@ -0,0 +1,184 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServerError is returned when the auth service answered with an error
+// status, e.g. a wrong password or a clinician without a signing key.
+type ServerError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (serverError *ServerError) Error() string {
+	return fmt.Sprintf("auth service responded with %s - %s", serverError.Status, serverError.Body)
+}
+
+// Message is the error the auth service gave, falling back to the raw body.
+func (serverError *ServerError) Message() string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal([]byte(serverError.Body), &body) == nil && body.Error != "" {
+		return body.Error
+	}
+
+	return serverError.Body
+}
+
+// Signature is the signature a clinician put on a document with the key
+// issued to them by the auth service. It is kept along the document.
+type Signature struct {
+	Algoritma     string    `json:"algoritma" bson:"algoritma"`
+	Digest        string    `json:"digest" bson:"digest"`
+	Nilai         string    `json:"nilai" bson:"nilai"`
+	Sertifikat    string    `json:"sertifikat" bson:"sertifikat"`
+	NoSeri        string    `json:"no_seri" bson:"no_seri"`
+	Penandatangan string    `json:"penandatangan" bson:"penandatangan"`
+	Peran         string    `json:"peran" bson:"peran"`
+	Waktu         time.Time `json:"waktu" bson:"waktu"`
+}
+
+// Verification is what the auth service tells about a signature: who made
+// it and whether it holds.
+type Verification struct {
+	Status     uint8  `json:"status"`
+	Valid      bool   `json:"valid"`
+	Keterangan string `json:"keterangan"`
+
+	Penandatangan string     `json:"penandatangan"`
+	Surel         string     `json:"surel"`
+	Peran         string     `json:"peran"`
+	NoSeri        string     `json:"no_seri"`
+	Penerbit      string     `json:"penerbit"`
+	Waktu         time.Time  `json:"waktu"`
+	BerlakuDari   time.Time  `json:"berlaku_dari"`
+	BerlakuSampai time.Time  `json:"berlaku_sampai"`
+	DicabutPada   *time.Time `json:"dicabut_pada,omitempty"`
+}
+
+// Check is a signature as the auth service verified it, along with whether
+// the document still matches the digest that was signed.
+type Check struct {
+	TandaTangan *Signature    `json:"tanda_tangan"`
+	Verifikasi  *Verification `json:"verifikasi"`
+	Sesuai      bool          `json:"sesuai"`
+	Valid       bool          `json:"valid"`
+}
+
+// Digest is the hex encoded sha-256 of the JSON of the signed content. Only
+// the digest is sent to the auth service.
+func Digest(content interface{}) (string, error) {
+	contentByte, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(contentByte)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Client signs and verifies documents through the auth service, on behalf
+// of the clinician whose token it forwards.
+type Client struct {
+	URL    string
+	Client *http.Client
+}
+
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		URL:    strings.TrimRight(baseURL, "/"),
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (client *Client) post(ctx context.Context, authorization, path string, body, result interface{}) error {
+	bodyByte, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.URL+path, bytes.NewBuffer(bodyByte))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", authorization)
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &ServerError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(respBody),
+		}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Sign has the auth service sign the digest with the key of the clinician,
+// who confirms with their password.
+func (client *Client) Sign(ctx context.Context, authorization, password, digest string) (*Signature, error) {
+	body := map[string]string{
+		"password": password,
+		"digest":   digest,
+	}
+
+	var signature Signature
+	if err := client.post(ctx, authorization, "/api/v1/signing/sign", body, &signature); err != nil {
+		return nil, err
+	}
+
+	return &signature, nil
+}
+
+func (client *Client) Verify(ctx context.Context, authorization string, signature *Signature) (*Verification, error) {
+	var verification Verification
+	if err := client.post(ctx, authorization, "/api/v1/signing/verify", signature, &verification); err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+// Check verifies the signature and compares its digest with the digest of
+// the content the document has now.
+func (client *Client) Check(ctx context.Context, authorization string, signature *Signature, content interface{}) (*Check, error) {
+	digest, err := Digest(content)
+	if err != nil {
+		return nil, err
+	}
+
+	verification, err := client.Verify(ctx, authorization, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := digest == signature.Digest
+	return &Check{
+		TandaTangan: signature,
+		Verifikasi:  verification,
+		Sesuai:      matches,
+		Valid:       matches && verification.Valid,
+	}, nil
+}
@@ -0,0 +1,228 @@
+// Package terminology holds the code systems examinations are coded with.
+// Each code system is read from a local tab separated file with one concept
+// per line: the code followed by its display name. Empty lines and lines
+// starting with '#' are skipped.
+package terminology
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"service-outpatient/config"
+	"service-outpatient/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadInterval spaces out the attempts to load a code system whose file
+// was missing or invalid.
+const reloadInterval = time.Minute
+
+var (
+	ConceptNotFoundError    = errors.New("code is not found in the code system")
+	CodeSystemNotReadyError = errors.New("code system is not loaded yet, coded input cannot be checked")
+
+	ICD10  *CodeSystem
+	ICD9CM *CodeSystem
+)
+
+type Concept struct {
+	Kode string `json:"kode"`
+	Nama string `json:"nama"`
+}
+
+type CodeSystem struct {
+	Name     string
+	path     string
+	concepts []Concept
+	index    map[string]int
+
+	mu    sync.RWMutex
+	tried time.Time
+}
+
+// Init loads every code system configured for the service. A code system
+// whose file is missing does not stop the service: coded input is refused
+// with CodeSystemNotReadyError until the file is in place and loads.
+func Init() {
+	ICD10 = Open("ICD-10", config.ICD10File)
+	ICD9CM = Open("ICD-9-CM", config.ICD9CMFile)
+}
+
+// Open loads the code system from path, or returns it empty, to be loaded
+// again on use, when it cannot be read.
+func Open(name, path string) *CodeSystem {
+	codeSystem, err := Load(name, path)
+	if err != nil {
+		logger.LogWarning.Printf("%s is not available, coded input is refused until it loads: %v\n", name, err)
+		return &CodeSystem{Name: name, path: path, tried: time.Now()}
+	}
+
+	logger.LogInfo.Printf("Loaded %d %s codes\n", codeSystem.Len(), name)
+	return codeSystem
+}
+
+// ready tells whether the code system has its concepts, trying to load them
+// again at most once per reloadInterval.
+func (codeSystem *CodeSystem) ready() bool {
+	codeSystem.mu.RLock()
+	loaded := codeSystem.index != nil
+	codeSystem.mu.RUnlock()
+	if loaded {
+		return true
+	}
+
+	codeSystem.mu.Lock()
+	defer codeSystem.mu.Unlock()
+
+	if codeSystem.index != nil {
+		return true
+	}
+
+	if time.Since(codeSystem.tried) < reloadInterval {
+		return false
+	}
+	codeSystem.tried = time.Now()
+
+	loadedSystem, err := Load(codeSystem.Name, codeSystem.path)
+	if err != nil {
+		logger.LogWarning.Printf("%s is still not available: %v\n", codeSystem.Name, err)
+		return false
+	}
+
+	codeSystem.concepts = loadedSystem.concepts
+	codeSystem.index = loadedSystem.index
+	logger.LogInfo.Printf("Loaded %d %s codes\n", len(codeSystem.concepts), codeSystem.Name)
+	return true
+}
+
+// Available tells whether the concepts of the code system are loaded.
+func (codeSystem *CodeSystem) Available() bool {
+	return codeSystem.ready()
+}
+
+// NormalizeCode makes "a09.9", "A09.9" and "A099" the same key.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), ".", ""))
+}
+
+func Load(name, path string) (*CodeSystem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	codeSystem := &CodeSystem{
+		Name:  name,
+		path:  path,
+		index: map[string]int{},
+	}
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(text, "\t", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" {
+			return nil, fmt.Errorf("%s line %d: expected code and display separated by a tab", path, line)
+		}
+
+		concept := Concept{
+			Kode: strings.TrimSpace(fields[0]),
+			Nama: strings.TrimSpace(fields[1]),
+		}
+
+		key := NormalizeCode(concept.Kode)
+		if _, ok := codeSystem.index[key]; ok {
+			return nil, fmt.Errorf("%s line %d: duplicate code %s", path, line, concept.Kode)
+		}
+
+		codeSystem.index[key] = len(codeSystem.concepts)
+		codeSystem.concepts = append(codeSystem.concepts, concept)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(codeSystem.concepts) == 0 {
+		return nil, fmt.Errorf("%s has no concepts", path)
+	}
+
+	sort.Slice(codeSystem.concepts, func(i, j int) bool {
+		return NormalizeCode(codeSystem.concepts[i].Kode) < NormalizeCode(codeSystem.concepts[j].Kode)
+	})
+	for i := 0; i < len(codeSystem.concepts); i++ {
+		codeSystem.index[NormalizeCode(codeSystem.concepts[i].Kode)] = i
+	}
+
+	return codeSystem, nil
+}
+
+func (codeSystem *CodeSystem) Len() int {
+	codeSystem.mu.RLock()
+	defer codeSystem.mu.RUnlock()
+
+	return len(codeSystem.concepts)
+}
+
+func (codeSystem *CodeSystem) Lookup(code string) (*Concept, error) {
+	if !codeSystem.ready() {
+		return nil, fmt.Errorf("%s: %w", codeSystem.Name, CodeSystemNotReadyError)
+	}
+
+	i, ok := codeSystem.index[NormalizeCode(code)]
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %w", codeSystem.Name, code, ConceptNotFoundError)
+	}
+
+	concept := codeSystem.concepts[i]
+	return &concept, nil
+}
+
+// Search returns concepts whose code starts with the query, followed by the
+// concepts whose display name contains it, up to limit results.
+func (codeSystem *CodeSystem) Search(query string, limit int) []Concept {
+	results := []Concept{}
+	query = strings.TrimSpace(query)
+	if query == "" || !codeSystem.ready() {
+		return results
+	}
+
+	codePrefix := NormalizeCode(query)
+	lowered := strings.ToLower(query)
+	matched := map[int]bool{}
+
+	start := sort.Search(len(codeSystem.concepts), func(i int) bool {
+		return NormalizeCode(codeSystem.concepts[i].Kode) >= codePrefix
+	})
+	for i := start; i < len(codeSystem.concepts) && len(results) < limit; i++ {
+		if !strings.HasPrefix(NormalizeCode(codeSystem.concepts[i].Kode), codePrefix) {
+			break
+		}
+
+		matched[i] = true
+		results = append(results, codeSystem.concepts[i])
+	}
+
+	for i := 0; i < len(codeSystem.concepts) && len(results) < limit; i++ {
+		if matched[i] {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(codeSystem.concepts[i].Nama), lowered) {
+			results = append(results, codeSystem.concepts[i])
+		}
+	}
+
+	return results
+}
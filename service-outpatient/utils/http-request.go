@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"service-outpatient/config"
 	"service-outpatient/datastruct"
 	"service-outpatient/logger"
@@ -14,26 +15,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ServiceError is returned when another service answered with an error
+// status, so callers can act on the status and body it sent.
+type ServiceError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (serviceError *ServiceError) Error() string {
+	return fmt.Sprintf("error creating request | %s - %s", serviceError.Status, serviceError.Body)
+}
+
 type Getter struct {
 	NoIHS       string
 	RefID       string
 	ServiceName datastruct.ServiceName
 }
 
-func PostRequest(c *gin.Context, serviceName datastruct.ServiceName, body []byte) (string, error) {
-	bufferBytes := bytes.NewBuffer(body)
-
-	var serviceUrl string
+func serviceURL(serviceName datastruct.ServiceName) (string, error) {
 	switch serviceName {
-	case "laboratory":
-		serviceUrl = config.LabServiceURL
-	case "radiology":
-		serviceUrl = config.RadiologyServiceURL
-	case "pharmacy":
-		serviceUrl = config.PharmacyServiceURL
+	case datastruct.LABORATORY:
+		return config.LabServiceURL, nil
+	case datastruct.RADIOLOGY:
+		return config.RadiologyServiceURL, nil
+	case datastruct.PHARMACY:
+		return config.PharmacyServiceURL, nil
 	default:
 		return "", fmt.Errorf("service %s undefined", serviceName)
 	}
+}
+
+func PostRequest(c *gin.Context, serviceName datastruct.ServiceName, body []byte) (string, error) {
+	bufferBytes := bytes.NewBuffer(body)
+
+	serviceUrl, err := serviceURL(serviceName)
+	if err != nil {
+		return "", err
+	}
 
 	req, _ := http.NewRequest(
 		"POST",
@@ -63,17 +82,9 @@ func PostRequest(c *gin.Context, serviceName datastruct.ServiceName, body []byte
 }
 
 func (g *Getter) GetRequest(c *gin.Context) ([]byte, error) {
-	var serviceUrl string
-
-	switch g.ServiceName {
-	case datastruct.LABORATORY:
-		serviceUrl = config.LabServiceURL
-	case datastruct.RADIOLOGY:
-		serviceUrl = config.RadiologyServiceURL
-	case datastruct.PHARMACY:
-		serviceUrl = config.PharmacyServiceURL
-	default:
-		return nil, fmt.Errorf("service %s undefined", g.ServiceName)
+	serviceUrl, err := serviceURL(g.ServiceName)
+	if err != nil {
+		return nil, err
 	}
 
 	req, _ := http.NewRequest(
@@ -98,6 +109,47 @@ func (g *Getter) GetRequest(c *gin.Context) ([]byte, error) {
 	return respBody, nil
 }
 
+// ListRequest gets a page of the records the service keeps on the patient,
+// as the doctor sees them.
+func ListRequest(c *gin.Context, serviceName datastruct.ServiceName, noIHS string, query url.Values) ([]byte, error) {
+	serviceUrl, err := serviceURL(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/api/v1/request/%s/%s?%s", serviceUrl, serviceName, url.PathEscape(noIHS), query.Encode()),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", c.GetHeader("Authorization"))
+	req.Header.Add("X-Timestamp", fmt.Sprint(time.Now().UnixMilli()))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, GenerateError(resp, string(respBody))
+	}
+
+	return respBody, nil
+}
+
 func GenerateError(response *http.Response, respBody string) error {
-	return fmt.Errorf("error creating request | %s - %s", response.Status, respBody)
+	return &ServiceError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Body:       respBody,
+	}
 }
@@ -0,0 +1,173 @@
+package attachment
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	EmptyFileError       = errors.New("the attachment is empty")
+	TooLargeError        = errors.New("the attachment exceeds the maximum size")
+	ContentTypeError     = errors.New("only png, jpeg, gif, webp and pdf files can be attached")
+	TamperedError        = errors.New("the content of the attachment does not match its hash")
+	LinkedError          = errors.New("the attachment is already linked to another document")
+	PatientMismatchError = errors.New("the attachment belongs to another patient")
+)
+
+// contentTypes lists the files accepted as attachments: drawings, photos,
+// scanned forms and signatures.
+var contentTypes = map[string]string{
+	"image/png":       "png",
+	"image/jpeg":      "jpg",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"application/pdf": "pdf",
+}
+
+// Attachment is the record of a clinical file. The file itself is kept in
+// the store, encrypted with a key of its own, which is in turn encrypted
+// with the data encryption key of the service.
+type Attachment struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID   string `json:"client_id" bson:"client_id"`
+	NoIHS      string `json:"no_ihs" bson:"no_ihs"`
+	TipeKonten string `json:"tipe_konten" bson:"tipe_konten"`
+	Ukuran     int    `json:"ukuran" bson:"ukuran"`
+	SHA256     string `json:"sha256" bson:"sha256"`
+	Pengunggah string `json:"pengunggah" bson:"pengunggah"`
+
+	// DokumenID is the document the attachment is linked to. An attachment
+	// is linked once, when the document referring to it is saved.
+	DokumenID *primitive.ObjectID `json:"dokumen_id" bson:"dokumen_id"`
+
+	KunciObjek       string            `json:"-" bson:"kunci_objek"`
+	KunciTerenkripsi *primitive.Binary `json:"-" bson:"kunci_terenkripsi"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
+}
+
+// Reference links a document to an attachment. The content type and the
+// hash are copied from the attachment when the document is saved, so the
+// signature of the document covers the content of its attachments.
+type Reference struct {
+	ID         primitive.ObjectID `json:"id" binding:"required" bson:"id"`
+	TipeKonten string             `json:"tipe_konten" bson:"tipe_konten"`
+	SHA256     string             `json:"sha256" bson:"sha256"`
+}
+
+// Link is a short-lived signed URL to download an attachment.
+type Link struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DetectContentType sniffs the type of the content instead of trusting the
+// type sent by the client.
+func DetectContentType(content []byte, maxSize int) (string, error) {
+	if len(content) == 0 {
+		return "", EmptyFileError
+	}
+
+	if len(content) > maxSize {
+		return "", fmt.Errorf("%d bytes: %w", len(content), TooLargeError)
+	}
+
+	contentType := http.DetectContentType(content)
+	if _, ok := contentTypes[contentType]; !ok {
+		return "", fmt.Errorf("%s: %w", contentType, ContentTypeError)
+	}
+
+	return contentType, nil
+}
+
+func Sum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ObjectKey spreads attachments over a directory per month of upload.
+func ObjectKey(id primitive.ObjectID) string {
+	return fmt.Sprintf("%s/%s", id.Timestamp().UTC().Format("2006/01"), id.Hex())
+}
+
+func (attachment *Attachment) FileName() string {
+	return fmt.Sprintf("%s.%s", attachment.ID.Hex(), contentTypes[attachment.TipeKonten])
+}
+
+func (attachment *Attachment) Reference() Reference {
+	return Reference{
+		ID:         attachment.ID,
+		TipeKonten: attachment.TipeKonten,
+		SHA256:     attachment.SHA256,
+	}
+}
+
+// Verify checks the decrypted content against the hash recorded on upload.
+func (attachment *Attachment) Verify(content []byte) error {
+	if Sum(content) != attachment.SHA256 {
+		return fmt.Errorf("%s: %w", attachment.ID.Hex(), TamperedError)
+	}
+
+	return nil
+}
+
+// Seal encrypts the content with AES-256-GCM under a new key. The ID of the
+// attachment is authenticated along, so the content of one attachment
+// cannot be passed off as another. The nonce is put before the ciphertext.
+func Seal(id primitive.ObjectID, content []byte) ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, content, id[:]), key, nil
+}
+
+func Open(id primitive.ObjectID, sealed, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: %w", id.Hex(), TamperedError)
+	}
+
+	content, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], id[:])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id.Hex(), TamperedError)
+	}
+
+	return content, nil
+}
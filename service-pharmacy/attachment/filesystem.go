@@ -0,0 +1,70 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps attachments as files below a root directory, e.g. a
+// mounted volume.
+type FileStore struct {
+	Root string
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{Root: root}, nil
+}
+
+func (store *FileStore) path(key string) string {
+	return filepath.Join(store.Root, filepath.FromSlash(key))
+}
+
+// Put writes the content to a temporary file first, so readers never see a
+// partly written attachment.
+func (store *FileStore) Put(ctx context.Context, key string, content []byte) error {
+	path := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (store *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	content, err := os.ReadFile(store.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, NotFoundError
+	}
+
+	return content, err
+}
+
+func (store *FileStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(store.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
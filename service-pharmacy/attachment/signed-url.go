@@ -0,0 +1,56 @@
+package attachment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	LinkExpiredError   = errors.New("the download link has expired")
+	LinkSignatureError = errors.New("the download link is not valid")
+)
+
+func linkSignature(secret []byte, id string, expires int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%d", id, expires)
+	return mac.Sum(nil)
+}
+
+// SignLink makes a link to download the attachment without a token until
+// it expires. The path is the route the link is served from.
+func SignLink(secret []byte, path, id string, expiresAt time.Time) Link {
+	expires := expiresAt.Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", hex.EncodeToString(linkSignature(secret, id, expires)))
+
+	return Link{
+		URL:       fmt.Sprintf("%s/%s?%s", path, id, query.Encode()),
+		ExpiresAt: time.Unix(expires, 0),
+	}
+}
+
+func VerifyLink(secret []byte, id, expires, signature string, now time.Time) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return LinkSignatureError
+	}
+
+	sent, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(sent, linkSignature(secret, id, expiresAt)) {
+		return LinkSignatureError
+	}
+
+	if now.Unix() > expiresAt {
+		return LinkExpiredError
+	}
+
+	return nil
+}
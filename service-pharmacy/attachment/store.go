@@ -0,0 +1,55 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	NotFoundError     = errors.New("attachment is not found")
+	UnknownStoreError = errors.New("attachment store must be either filesystem or s3")
+)
+
+// Store keeps the encrypted content of attachments under a key. The content
+// is encrypted before it is put into the store, so the store never sees
+// clinical files in the clear.
+type Store interface {
+	Put(ctx context.Context, key string, content []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type StoreConfig struct {
+	Backend string
+
+	// Path is the root directory of the filesystem store.
+	Path string
+
+	// S3 compatible object storage, e.g. MinIO
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Timeout   time.Duration
+}
+
+func NewStore(storeConfig StoreConfig) (Store, error) {
+	switch storeConfig.Backend {
+	case "filesystem":
+		return NewFileStore(storeConfig.Path)
+	case "s3":
+		return NewS3Store(
+			storeConfig.S3Endpoint,
+			storeConfig.S3Region,
+			storeConfig.S3Bucket,
+			storeConfig.S3AccessKey,
+			storeConfig.S3SecretKey,
+			storeConfig.S3Timeout,
+		), nil
+	default:
+		return nil, fmt.Errorf("%s: %w", storeConfig.Backend, UnknownStoreError)
+	}
+}
@@ -19,6 +19,32 @@ var (
 	RSAPublicKey  string
 
 	TimestampSkew int
+
+	InteractionKBFile      string
+	ActivePrescriptionDays int
+	NearExpiryDays         int
+
+	AttachmentStore       string
+	AttachmentPath        string
+	AttachmentS3Endpoint  string
+	AttachmentS3Region    string
+	AttachmentS3Bucket    string
+	AttachmentS3AccessKey string
+	AttachmentS3SecretKey string
+	AttachmentTimeout     int
+	AttachmentMaxSize     int
+	AttachmentLinkKey     string
+	AttachmentLinkTTL     int
+
+	FacilityName      string
+	FacilityAddress   string
+	FacilityPhone     string
+	FacilityEmail     string
+	FacilityLogo      string
+	DocumentVerifyURL string
+
+	AuthServiceURL     string
+	AuthServiceTimeout int
 )
 
 type Config struct {
@@ -46,6 +72,32 @@ type Config struct {
 	RSAPublicKey  string `envconfig:"RSA_PUBLIC_KEY" default:""`
 
 	TimestampSkew int `envconfig:"TIMESTAMP_SKEW" default:"5000"` //ms
+
+	InteractionKBFile      string `envconfig:"INTERACTION_KB_FILE" default:"knowledge/interactions.json"`
+	ActivePrescriptionDays int    `envconfig:"ACTIVE_PRESCRIPTION_DAYS" default:"30"`
+	NearExpiryDays         int    `envconfig:"NEAR_EXPIRY_DAYS" default:"90"`
+
+	AttachmentStore       string `envconfig:"ATTACHMENT_STORE" default:"s3"` // s3, filesystem is not shared by the instances
+	AttachmentPath        string `envconfig:"ATTACHMENT_PATH" default:"attachments"`
+	AttachmentS3Endpoint  string `envconfig:"ATTACHMENT_S3_ENDPOINT" default:"http://localhost:9000"` // minio
+	AttachmentS3Region    string `envconfig:"ATTACHMENT_S3_REGION" default:"us-east-1"`
+	AttachmentS3Bucket    string `envconfig:"ATTACHMENT_S3_BUCKET" default:"emr-attachments"`
+	AttachmentS3AccessKey string `envconfig:"ATTACHMENT_S3_ACCESS_KEY" default:""` // secret
+	AttachmentS3SecretKey string `envconfig:"ATTACHMENT_S3_SECRET_KEY" default:""` // secret
+	AttachmentTimeout     int    `envconfig:"ATTACHMENT_TIMEOUT" default:"30"`     //s
+	AttachmentMaxSize     int    `envconfig:"ATTACHMENT_MAX_SIZE" default:"10"`    //MB
+	AttachmentLinkKey     string `envconfig:"ATTACHMENT_LINK_KEY" default:""`      // secret, base64 format
+	AttachmentLinkTTL     int    `envconfig:"ATTACHMENT_LINK_TTL" default:"300"`   //s
+
+	FacilityName      string `envconfig:"FACILITY_NAME" default:"Fasilitas Pelayanan Kesehatan"`
+	FacilityAddress   string `envconfig:"FACILITY_ADDRESS" default:""`
+	FacilityPhone     string `envconfig:"FACILITY_PHONE" default:""`
+	FacilityEmail     string `envconfig:"FACILITY_EMAIL" default:""`
+	FacilityLogo      string `envconfig:"FACILITY_LOGO" default:""` // png or jpeg file
+	DocumentVerifyURL string `envconfig:"DOCUMENT_VERIFY_URL" default:"http://localhost:8083/verify"`
+
+	AuthServiceURL     string `envconfig:"AUTH_SERVICE_URL" default:"http://localhost:8080"` // signs documents with the keys of clinicians
+	AuthServiceTimeout int    `envconfig:"AUTH_SERVICE_TIMEOUT" default:"10"`                //s
 }
 
 func Get() Config {
@@ -59,6 +111,32 @@ func Get() Config {
 
 	TimestampSkew = cfg.TimestampSkew
 
+	InteractionKBFile = cfg.InteractionKBFile
+	ActivePrescriptionDays = cfg.ActivePrescriptionDays
+	NearExpiryDays = cfg.NearExpiryDays
+
+	AttachmentStore = cfg.AttachmentStore
+	AttachmentPath = cfg.AttachmentPath
+	AttachmentS3Endpoint = cfg.AttachmentS3Endpoint
+	AttachmentS3Region = cfg.AttachmentS3Region
+	AttachmentS3Bucket = cfg.AttachmentS3Bucket
+	AttachmentS3AccessKey = cfg.AttachmentS3AccessKey
+	AttachmentS3SecretKey = cfg.AttachmentS3SecretKey
+	AttachmentTimeout = cfg.AttachmentTimeout
+	AttachmentMaxSize = cfg.AttachmentMaxSize
+	AttachmentLinkKey = cfg.AttachmentLinkKey
+	AttachmentLinkTTL = cfg.AttachmentLinkTTL
+
+	FacilityName = cfg.FacilityName
+	FacilityAddress = cfg.FacilityAddress
+	FacilityPhone = cfg.FacilityPhone
+	FacilityEmail = cfg.FacilityEmail
+	FacilityLogo = cfg.FacilityLogo
+	DocumentVerifyURL = cfg.DocumentVerifyURL
+
+	AuthServiceURL = cfg.AuthServiceURL
+	AuthServiceTimeout = cfg.AuthServiceTimeout
+
 	cfg.DBUser = url.QueryEscape(cfg.DBUser)
 	cfg.DBPassword = url.QueryEscape(cfg.DBPassword)
 
@@ -91,9 +169,30 @@ func AccessSecret(cfg *Config) {
 		logger.LogFatal.Fatalf("failed to access db secret: %v", err)
 	}
 
+	secretAttachmentAccess, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.AttachmentS3AccessKey, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access attachment store access key secret: %v", err)
+	}
+
+	secretAttachmentSecret, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.AttachmentS3SecretKey, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access attachment store secret key secret: %v", err)
+	}
+
+	secretAttachmentLink, err := InitSecretConfig(&ctx, cfg.SMProjectId, cfg.AttachmentLinkKey, cfg.SecretVersion).
+		AccessSecretResource(client)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to access attachment link key secret: %v", err)
+	}
+
 	cfg.SAPrivateKey = string(secretSaPrivate.Payload.Data)
 	cfg.RSAPrivateKey = string(secretRsaPrivate.Payload.Data)
 	cfg.DBPassword = string(secretDbPrivate.Payload.Data)
+	cfg.AttachmentS3AccessKey = string(secretAttachmentAccess.Payload.Data)
+	cfg.AttachmentS3SecretKey = string(secretAttachmentSecret.Payload.Data)
+	cfg.AttachmentLinkKey = string(secretAttachmentLink.Payload.Data)
 }
 
 func AccessKeyFromFile(keyName string) string {
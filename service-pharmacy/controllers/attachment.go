@@ -0,0 +1,422 @@
+package fasyankes_controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"service-pharmacy/attachment"
+	"service-pharmacy/config"
+	"service-pharmacy/db/csfle"
+	"service-pharmacy/logger"
+	"service-pharmacy/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AttachmentLinkPath is the route short-lived download links are served
+// from, outside of the token check.
+const AttachmentLinkPath = "/attachment"
+
+var fileRequiredError = errors.New("file is required as multipart form data")
+
+// AttachmentController keeps the clinical files of documents. Attachments
+// are shared by the services: they are recorded in one collection and kept
+// in one store, so a document of one service can refer to a file uploaded
+// through another.
+type AttachmentController struct {
+	AttachmentCollection *mongo.Collection
+
+	ClientEncryption *mongo.ClientEncryption
+	EncryptionOpts   *options.EncryptOptions
+
+	Store   attachment.Store
+	MaxSize int
+	LinkKey []byte
+	LinkTTL time.Duration
+}
+
+func InitAttachmentController(client *mongo.Client, csfle *csfle.CSFLE) *AttachmentController {
+	// every instance of every service reads the files and the links another
+	// one wrote, so neither may be local to this instance
+	if config.AttachmentStore != "s3" {
+		logger.LogFatal.Fatalf("attachment store must be s3, %s is not shared by the instances", config.AttachmentStore)
+	}
+
+	store, err := attachment.NewStore(attachment.StoreConfig{
+		Backend:     config.AttachmentStore,
+		Path:        config.AttachmentPath,
+		S3Endpoint:  config.AttachmentS3Endpoint,
+		S3Region:    config.AttachmentS3Region,
+		S3Bucket:    config.AttachmentS3Bucket,
+		S3AccessKey: config.AttachmentS3AccessKey,
+		S3SecretKey: config.AttachmentS3SecretKey,
+		S3Timeout:   time.Duration(config.AttachmentTimeout) * time.Second,
+	})
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to set up attachment store: %v", err)
+	}
+
+	linkKey, err := base64.StdEncoding.DecodeString(config.AttachmentLinkKey)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to decode attachment link key: %v", err)
+	}
+
+	if len(linkKey) == 0 {
+		logger.LogFatal.Fatal("attachment link key is not set")
+	}
+
+	return &AttachmentController{
+		AttachmentCollection: client.Database("emr").Collection("lampiran"),
+
+		ClientEncryption: csfle.ClientEncryption,
+		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+
+		Store:   store,
+		MaxSize: config.AttachmentMaxSize << 20,
+		LinkKey: linkKey,
+		LinkTTL: time.Duration(config.AttachmentLinkTTL) * time.Second,
+	}
+}
+
+func attachmentErrorStatus(err error) int {
+	if errors.Is(err, attachment.NotFoundError) || errors.Is(err, mongo.ErrNoDocuments) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, attachment.TooLargeError) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if errors.Is(err, attachment.ContentTypeError) {
+		return http.StatusUnsupportedMediaType
+	}
+
+	if errors.Is(err, attachment.LinkedError) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, attachment.LinkExpiredError) || errors.Is(err, attachment.LinkSignatureError) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, fileRequiredError) ||
+		errors.Is(err, attachment.EmptyFileError) ||
+		errors.Is(err, attachment.PatientMismatchError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// referAttachments checks the attachments a document refers to. The
+// references are filled in from the attachments and returned to be recorded
+// in the signed part of the document.
+func referAttachments(collection *mongo.Collection, noIHS, clientID string, documentID primitive.ObjectID, references ...*attachment.Reference) ([]attachment.Reference, error) {
+	var referred []attachment.Reference
+
+	for i := 0; i < len(references); i++ {
+		reference := references[i]
+		if reference == nil {
+			continue
+		}
+
+		var record attachment.Attachment
+		err := collection.FindOne(context.Background(), bson.M{"_id": reference.ID, "deleted_at": nil}).Decode(&record)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, fmt.Errorf("%s: %w", reference.ID.Hex(), attachment.NotFoundError)
+			}
+			return nil, err
+		}
+
+		if record.NoIHS != noIHS {
+			return nil, fmt.Errorf("%s: %w", record.ID.Hex(), attachment.PatientMismatchError)
+		}
+
+		// an attachment is linked by the client which uploaded it, and stays
+		// with the document it was linked to
+		if record.DokumenID != nil {
+			if *record.DokumenID != documentID {
+				return nil, fmt.Errorf("%s: %w", record.ID.Hex(), attachment.LinkedError)
+			}
+		} else if record.ClientID != clientID {
+			return nil, fmt.Errorf("%s: %w", record.ID.Hex(), attachment.NotFoundError)
+		}
+
+		*reference = record.Reference()
+		referred = append(referred, *reference)
+	}
+
+	return referred, nil
+}
+
+// linkAttachments links the attachments to the document once it is saved,
+// after which they can no longer be deleted or referred to by another
+// document.
+func linkAttachments(collection *mongo.Collection, documentID primitive.ObjectID, references []attachment.Reference) {
+	if len(references) == 0 {
+		return
+	}
+
+	ids := bson.A{}
+	for i := 0; i < len(references); i++ {
+		ids = append(ids, references[i].ID)
+	}
+
+	_, err := collection.UpdateMany(
+		context.Background(),
+		bson.M{"_id": bson.M{"$in": ids}, "dokumen_id": nil},
+		bson.M{"$set": bson.M{"dokumen_id": documentID}},
+	)
+	if err != nil {
+		logger.LogError.Printf("Failed to link attachments to document [%s]: %v\n", documentID.Hex(), err)
+	}
+}
+
+// findAttachment reads an attachment of the patient. Without the consent of
+// the patient only attachments uploaded by the client itself are found.
+func (attachmentController *AttachmentController) findAttachment(c *gin.Context) (*attachment.Attachment, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":        id,
+		"no_ihs":     c.Param("noIHS"),
+		"deleted_at": nil,
+	}
+	if !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var record attachment.Attachment
+	if err := attachmentController.AttachmentCollection.FindOne(context.Background(), filter).Decode(&record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// serveAttachment decrypts the attachment and checks it against the hash
+// recorded on upload before sending it.
+func (attachmentController *AttachmentController) serveAttachment(c *gin.Context, record *attachment.Attachment) {
+	sealed, err := attachmentController.Store.Get(c.Request.Context(), record.KunciObjek)
+	if err != nil {
+		utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var key []byte
+	utils.Decrypt(
+		record.KunciTerenkripsi,
+		attachmentController.ClientEncryption,
+	).Unmarshal(&key)
+
+	content, err := attachment.Open(record.ID, sealed, key)
+	if err == nil {
+		err = record.Verify(content)
+	}
+	if err != nil {
+		logger.LogWarning.Printf("Attachment with ID [%s] was tampered\n", record.ID.Hex())
+		utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, int64(len(content)), record.TipeKonten, bytes.NewReader(content), map[string]string{
+		"Cache-Control":       "private, no-store",
+		"Content-Disposition": fmt.Sprintf("inline; filename=%q", record.FileName()),
+	})
+}
+
+// UploadAttachmentHandler takes a file of the patient as multipart form
+// data. The attachment is linked once a document refers to it.
+func (attachmentController *AttachmentController) UploadAttachmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// leave room for the rest of the form
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(attachmentController.MaxSize)+1<<20)
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				utils.JSON(c, http.StatusRequestEntityTooLarge, gin.H{"error": attachment.TooLargeError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fileRequiredError.Error()})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		content, err := io.ReadAll(io.LimitReader(file, int64(attachmentController.MaxSize)+1))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		contentType, err := attachment.DetectContentType(content, attachmentController.MaxSize)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		record := attachment.Attachment{
+			ID:         primitive.NewObjectID(),
+			ClientID:   c.GetString("userClient"),
+			NoIHS:      c.Param("noIHS"),
+			TipeKonten: contentType,
+			Ukuran:     len(content),
+			SHA256:     attachment.Sum(content),
+			Pengunggah: c.GetString("userIdentification"),
+			CreatedAt:  &now,
+		}
+		record.KunciObjek = attachment.ObjectKey(record.ID)
+
+		sealed, key, err := attachment.Seal(record.ID, content)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		record.KunciTerenkripsi = utils.EncryptRandom(
+			key,
+			attachmentController.ClientEncryption,
+			attachmentController.EncryptionOpts,
+		)
+
+		if err := attachmentController.Store.Put(c.Request.Context(), record.KunciObjek, sealed); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := attachmentController.AttachmentCollection.InsertOne(context.Background(), record); err != nil {
+			if err := attachmentController.Store.Delete(context.Background(), record.KunciObjek); err != nil {
+				logger.LogError.Printf("Failed to remove the content of attachment [%s]: %v\n", record.ID.Hex(), err)
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, record)
+	}
+}
+
+func (attachmentController *AttachmentController) GetAttachmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		record, err := attachmentController.findAttachment(c)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, record)
+	}
+}
+
+func (attachmentController *AttachmentController) DownloadAttachmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		record, err := attachmentController.findAttachment(c)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		attachmentController.serveAttachment(c, record)
+	}
+}
+
+// AttachmentLinkHandler signs a short-lived link to the attachment, e.g. for
+// an image tag, which cannot send the token along.
+func (attachmentController *AttachmentController) AttachmentLinkHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		record, err := attachmentController.findAttachment(c)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		expiresAt := time.Now().Add(attachmentController.LinkTTL)
+		utils.JSON(c, http.StatusOK, attachment.SignLink(attachmentController.LinkKey, AttachmentLinkPath, record.ID.Hex(), expiresAt))
+	}
+}
+
+// LinkedAttachmentHandler serves an attachment through a signed link. The
+// consent was checked when the link was signed.
+func (attachmentController *AttachmentController) LinkedAttachmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := attachment.VerifyLink(attachmentController.LinkKey, c.Param("id"), c.Query("expires"), c.Query("signature"), time.Now())
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var record attachment.Attachment
+		err = attachmentController.AttachmentCollection.FindOne(context.Background(), bson.M{"_id": id, "deleted_at": nil}).Decode(&record)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		attachmentController.serveAttachment(c, &record)
+	}
+}
+
+// DeleteAttachmentHandler removes an attachment which no document refers to
+// yet, e.g. one uploaded by mistake.
+func (attachmentController *AttachmentController) DeleteAttachmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		record, err := attachmentController.findAttachment(c)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if record.DokumenID != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": attachment.LinkedError.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		filter := bson.M{"_id": record.ID, "dokumen_id": nil}
+		result, err := attachmentController.AttachmentCollection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"deleted_at": now}})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": attachment.LinkedError.Error()})
+			return
+		}
+
+		if err := attachmentController.Store.Delete(c.Request.Context(), record.KunciObjek); err != nil {
+			logger.LogError.Printf("Failed to remove the content of attachment [%s]: %v\n", record.ID.Hex(), err)
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d attachment deleted successfully", result.ModifiedCount)})
+	}
+}
@@ -0,0 +1,200 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"service-pharmacy/config"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/knowledge"
+	"service-pharmacy/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ScreeningResult struct {
+	Peringatan           []pharmacy.ClinicalWarning `json:"peringatan"`
+	MemerlukanKonfirmasi bool                       `json:"memerlukan_konfirmasi"`
+}
+
+func (pharmacyController *PharmacyController) consentGiven(noIHS, clientID string) bool {
+	consent, err := pharmacyController.GetPatientConsent(noIHS)
+	if err != nil {
+		return bool(datastruct.OPTOUT)
+	}
+
+	for i := 0; i < len(consent.ConsentTo); i++ {
+		if consent.ConsentTo[i].ClientID == clientID {
+			return bool(datastruct.OPTIN)
+		}
+	}
+
+	return bool(datastruct.OPTOUT)
+}
+
+// activeDrugs looks up the drugs of the patient's recent prescriptions that
+// are still being worked on. Rejected prescriptions and those handed over in
+// full are left out, so only their status is decrypted besides the plaintext
+// drug references. Prescriptions of other facilities are only included when
+// the patient consented to it.
+func (pharmacyController *PharmacyController) activeDrugs(noIHS, clientID string, exclude primitive.ObjectID) ([]pharmacy.Drug, error) {
+	since := time.Now().AddDate(0, 0, -config.ActivePrescriptionDays)
+
+	filter := bson.M{
+		"peresepan.no_ihs": noIHS,
+		"created_at":       bson.M{"$gte": since},
+	}
+
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+	}
+
+	if !pharmacyController.consentGiven(noIHS, clientID) {
+		filter["$or"] = bson.A{
+			bson.M{"client_id": clientID},
+			bson.M{"client_id": ""},
+		}
+	}
+
+	opts := options.Find().SetProjection(bson.M{
+		"peresepan.id_obat":                1,
+		"peresepan.daftar_id_obat":         1,
+		"peresepan.encrypted_confidential": 1,
+	})
+	cursor, err := pharmacyController.FaskesCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for cursor.Next(context.Background()) {
+		var prescription struct {
+			Peresepan struct {
+				IDObat                string            `bson:"id_obat"`
+				DaftarIDObat          []string          `bson:"daftar_id_obat"`
+				ConfidentialEncrypted *primitive.Binary `bson:"encrypted_confidential"`
+			} `bson:"peresepan"`
+		}
+		if err := cursor.Decode(&prescription); err != nil {
+			return nil, err
+		}
+
+		if prescription.Peresepan.ConfidentialEncrypted != nil {
+			var data pharmacy.ConfidentialPharmacyData
+			utils.Decrypt(
+				prescription.Peresepan.ConfidentialEncrypted,
+				pharmacyController.ClientEncryption,
+			).Unmarshal(&data)
+
+			if data.Settled() {
+				continue
+			}
+		}
+
+		drugIDs := append([]string{prescription.Peresepan.IDObat}, prescription.Peresepan.DaftarIDObat...)
+		for i := 0; i < len(drugIDs); i++ {
+			if drugIDs[i] != "" && !seen[drugIDs[i]] {
+				seen[drugIDs[i]] = true
+				ids = append(ids, drugIDs[i])
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	drugs := []pharmacy.Drug{}
+	if len(ids) == 0 {
+		return drugs, nil
+	}
+
+	// drugs removed from the formulary since can no longer be screened
+	drugCursor, err := pharmacyController.FormularyCollection.Find(context.Background(), bson.M{"id_obat": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer drugCursor.Close(context.Background())
+
+	if err := drugCursor.All(context.Background(), &drugs); err != nil {
+		return nil, err
+	}
+
+	return drugs, nil
+}
+
+// screenItems runs the clinical screening for the drugs of a prescription.
+// Every drug is compared with the patient's active drugs and with the drugs
+// listed before it, so a pair within the prescription is reported once.
+func (pharmacyController *PharmacyController) screenItems(drugs []*pharmacy.Drug, noIHS, clientID string, allergies []string, exclude primitive.ObjectID) ([]pharmacy.ClinicalWarning, error) {
+	active, err := pharmacyController.activeDrugs(noIHS, clientID, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []pharmacy.ClinicalWarning{}
+	for i := 0; i < len(drugs); i++ {
+		others := append([]pharmacy.Drug{}, active...)
+		for j := 0; j < i; j++ {
+			others = append(others, *drugs[j])
+		}
+
+		warnings = append(warnings, knowledge.Base.Screen(drugs[i], others, allergies)...)
+	}
+
+	return warnings, nil
+}
+
+// CheckPrescriptionHandler screens drugs without writing a prescription so
+// the prescriber can see the warnings beforehand.
+func (pharmacyController *PharmacyController) CheckPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.PrescriptionCheckBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		exclude := primitive.NilObjectID
+		if body.KecualikanID != "" {
+			id, err := primitive.ObjectIDFromHex(body.KecualikanID)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			exclude = id
+		}
+
+		drugs := []*pharmacy.Drug{}
+		for i := 0; i < len(body.DaftarIDObat); i++ {
+			drug, err := pharmacyController.findDrug(body.DaftarIDObat[i])
+			if err != nil {
+				if errors.Is(err, pharmacy.DrugNotFoundError) {
+					utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			drugs = append(drugs, drug)
+		}
+
+		warnings, err := pharmacyController.screenItems(drugs, body.NoIHS, c.GetString("userClient"), body.DaftarAlergi, exclude)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, ScreeningResult{
+			Peringatan:           warnings,
+			MemerlukanKonfirmasi: len(warnings) > 0,
+		})
+	}
+}
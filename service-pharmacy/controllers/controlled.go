@@ -0,0 +1,330 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/pagination"
+	"service-pharmacy/utils"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// registerControlled writes the stock movements of a narcotic or
+// psychotropic into the controlled register, chained to the facility's last
+// entry, within the transaction of ctx. A concurrent writer taking the same
+// position fails the transaction on the unique urutan, so none of the
+// entries are kept and the caller starts the stock change over.
+func (pharmacyController *PharmacyController) registerControlled(ctx context.Context, drug *pharmacy.Drug, satuan string, movements []pharmacy.StockMovement) error {
+	clientID := movements[0].ClientID
+
+	var last pharmacy.ControlledRegisterEntry
+	opts := options.FindOne().SetSort(bson.D{{Key: "urutan", Value: -1}})
+	err := pharmacyController.RegisterCollection.FindOne(ctx, bson.M{"client_id": clientID}, opts).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	entries, err := pharmacy.ChainEntries(last, drug, satuan, movements)
+	if err != nil {
+		return err
+	}
+
+	documents := []interface{}{}
+	for i := 0; i < len(entries); i++ {
+		dataByte, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+
+		signature := utils.GenerateSignature(string(dataByte))
+		entries[i].Signature = &signature
+
+		documents = append(documents, entries[i])
+	}
+
+	_, err = pharmacyController.RegisterCollection.InsertMany(ctx, documents)
+	return err
+}
+
+// GetControlledRegisterHandler lists the controlled register in the order it
+// was written, unless sort is desc. Entries of a facility are inserted in
+// the order of urutan, so paging by ID keeps that order.
+func (pharmacyController *PharmacyController) GetControlledRegisterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"client_id": c.GetString("userClient")}
+
+		if idObat := c.Query("id_obat"); idObat != "" {
+			filter["id_obat"] = idObat
+		}
+
+		params, err := pagination.ParseOldestFirst(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.FilterOn("waktu", filter)
+
+		total, err := pharmacyController.RegisterCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.RegisterCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		entries := []pharmacy.ControlledRegisterEntry{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var entry pharmacy.ControlledRegisterEntry
+			if err := cursor.Decode(&entry); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = entry.ID
+			entries = append(entries, entry)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(entries, total, last, more))
+	}
+}
+
+// VerifyControlledRegisterHandler walks the whole hash chain of the facility
+// and reports every entry that was changed, removed or inserted afterwards.
+func (pharmacyController *PharmacyController) VerifyControlledRegisterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts := options.Find().SetSort(bson.D{{Key: "urutan", Value: 1}})
+		cursor, err := pharmacyController.RegisterCollection.Find(context.Background(), bson.M{"client_id": c.GetString("userClient")}, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		result := pharmacy.RegisterVerification{Kerusakan: []pharmacy.RegisterBreak{}}
+		previous := pharmacy.ControlledRegisterEntry{}
+		for cursor.Next(context.Background()) {
+			var entry pharmacy.ControlledRegisterEntry
+			if err := cursor.Decode(&entry); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			result.JumlahEntri++
+
+			if entry.Urutan != previous.Urutan+1 {
+				result.Kerusakan = append(result.Kerusakan, pharmacy.RegisterBreak{
+					Urutan: entry.Urutan,
+					Alasan: fmt.Sprintf("entries between %d and %d are missing", previous.Urutan, entry.Urutan),
+				})
+			}
+
+			if entry.HashSebelumnya != previous.Hash {
+				result.Kerusakan = append(result.Kerusakan, pharmacy.RegisterBreak{
+					Urutan: entry.Urutan,
+					Alasan: "hash_sebelumnya does not match the previous entry",
+				})
+			}
+
+			hash, err := entry.ComputeHash()
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if hash != entry.Hash {
+				result.Kerusakan = append(result.Kerusakan, pharmacy.RegisterBreak{
+					Urutan: entry.Urutan,
+					Alasan: "content does not match its hash",
+				})
+			}
+
+			signature := entry.Signature
+			entry.Signature = nil
+			entry.ID = primitive.NilObjectID
+
+			dataByte, err := json.Marshal(entry)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if signature == nil {
+				result.Kerusakan = append(result.Kerusakan, pharmacy.RegisterBreak{Urutan: entry.Urutan, Alasan: "signature is missing"})
+			} else if _, err := utils.VerifySignature(string(dataByte), *signature); err != nil {
+				result.Kerusakan = append(result.Kerusakan, pharmacy.RegisterBreak{Urutan: entry.Urutan, Alasan: "signature is not valid"})
+			}
+
+			previous = entry
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result.Utuh = len(result.Kerusakan) == 0
+		utils.JSON(c, http.StatusOK, result)
+	}
+}
+
+// ControlledReportHandler builds the monthly report of narcotics and
+// psychotropics from the register, by default for the previous month.
+// With format=csv it is returned in the layout of the SIPNAP upload.
+func (pharmacyController *PharmacyController) ControlledReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID := c.GetString("userClient")
+
+		period := c.Query("periode")
+		if period == "" {
+			period = time.Now().AddDate(0, -1, 0).Format("2006-01")
+		}
+
+		start, end, err := pharmacy.ParseReportPeriod(period, time.Local)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+
+		// the balance at the start is the balance after the last earlier entry
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"client_id": clientID, "waktu": bson.M{"$lt": start}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "urutan", Value: 1}}}},
+			{{Key: "$group", Value: bson.M{
+				"_id":          "$id_obat",
+				"nama_obat":    bson.M{"$last": "$nama_obat"},
+				"golongan":     bson.M{"$last": "$golongan"},
+				"sub_golongan": bson.M{"$last": "$sub_golongan"},
+				"satuan":       bson.M{"$last": "$satuan"},
+				"saldo":        bson.M{"$last": "$saldo"},
+			}}},
+		}
+
+		cursor, err := pharmacyController.RegisterCollection.Aggregate(context.Background(), pipeline)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		opening := []pharmacy.ControlledReportLine{}
+		err = cursor.All(context.Background(), &opening)
+		cursor.Close(context.Background())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		lines := map[string]*pharmacy.ControlledReportLine{}
+		for i := 0; i < len(opening); i++ {
+			line := opening[i]
+			line.StokAkhir = line.StokAwal
+			lines[line.KodeObat] = &line
+		}
+
+		filter := bson.M{
+			"client_id": clientID,
+			"waktu":     bson.M{"$gte": start, "$lt": end},
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "urutan", Value: 1}})
+		cursor, err = pharmacyController.RegisterCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		for cursor.Next(context.Background()) {
+			var entry pharmacy.ControlledRegisterEntry
+			if err := cursor.Decode(&entry); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			line, ok := lines[entry.IDObat]
+			if !ok {
+				line = &pharmacy.ControlledReportLine{
+					KodeObat:      entry.IDObat,
+					NamaObat:      entry.NamaObat,
+					SubGolongan:   entry.SubGolongan,
+					Satuan:        entry.Satuan,
+					JenisGolongan: entry.Golongan,
+				}
+				lines[entry.IDObat] = line
+			}
+
+			line.Apply(&entry)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		report := pharmacy.ControlledReport{
+			Periode:    period,
+			ClientID:   clientID,
+			DibuatPada: time.Now().Truncate(time.Duration(time.Millisecond)),
+			Item:       []pharmacy.ControlledReportLine{},
+		}
+
+		for _, line := range lines {
+			line.Golongan = pharmacy.DrugScheduleString(line.JenisGolongan)
+			report.Item = append(report.Item, *line)
+		}
+
+		sort.Slice(report.Item, func(i, j int) bool {
+			if report.Item[i].JenisGolongan != report.Item[j].JenisGolongan {
+				return report.Item[i].JenisGolongan < report.Item[j].JenisGolongan
+			}
+			return report.Item[i].NamaObat < report.Item[j].NamaObat
+		})
+
+		if format == "json" {
+			utils.JSON(c, http.StatusOK, report)
+			return
+		}
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"sipnap-%s.csv\"", period))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.WriteAll(report.Records()); err != nil {
+			c.Error(err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package fasyankes_controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/datastruct/user"
+	"service-pharmacy/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WorkflowResult struct {
+	StatusResep   datastruct.RecipeStatus `json:"status_resep"`
+	Status        string                  `json:"status"`
+	RiwayatStatus []pharmacy.StatusChange `json:"riwayat_status"`
+	Alokasi       []DispensedStock        `json:"alokasi,omitempty"`
+
+	PeringatanDosis []pharmacy.ClinicalWarning `json:"peringatan_dosis,omitempty"`
+}
+
+// workflowErrorStatus tells steps taken out of order and client mistakes
+// apart from database failures.
+func workflowErrorStatus(err error) int {
+	if errors.Is(err, pharmacy.InvalidTransitionError) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, pharmacy.NothingToDispenseError) ||
+		errors.Is(err, pharmacy.DispenseQuantityError) ||
+		errors.Is(err, pharmacy.PrescriptionItemNotFoundError) {
+		return http.StatusBadRequest
+	}
+
+	return stockErrorStatus(err)
+}
+
+// workflowStep loads the prescription, applies a step of the pharmacist's
+// workflow and saves it. Stock taken by the step is given back when the
+// prescription could not be saved.
+func (pharmacyController *PharmacyController) workflowStep(c *gin.Context, step func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error)) {
+	if !c.GetBool("patientConsent") {
+		utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+		return
+	}
+
+	data, err := pharmacyController.findPrescription(c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return
+		}
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := data.Peresepan.NormalizeItems(); err != nil {
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().Truncate(time.Duration(time.Millisecond))
+	officer := c.GetString("userIdentification")
+
+	dispensed, err := step(data, officer, now)
+	if err != nil {
+		utils.JSON(c, workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	confidential := data.Peresepan.ConfidentialData
+	result := WorkflowResult{
+		StatusResep:   confidential.Status(),
+		Status:        pharmacy.RecipeStatusString(confidential.Status()),
+		RiwayatStatus: confidential.RiwayatStatus,
+		Alokasi:       dispensed,
+	}
+
+	if history := confidential.RiwayatStatus; len(history) > 0 && history[len(history)-1].Ke == datastruct.DIKAJI {
+		result.PeringatanDosis = pharmacy.WarningsOf(confidential.PeringatanKlinis, datastruct.PERINGATAN_DOSIS)
+	}
+
+	previousUpdate := data.UpdatedAt
+	data.UpdatedAt = &now
+
+	if err := pharmacyController.sealPrescription(data); err != nil {
+		pharmacyController.returnStock(c.GetString("userClient"), dispensed, data.ID.Hex(), officer)
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := pharmacyController.updatePrescription(data, previousUpdate)
+	if err != nil {
+		pharmacyController.returnStock(c.GetString("userClient"), dispensed, data.ID.Hex(), officer)
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !updated {
+		pharmacyController.returnStock(c.GetString("userClient"), dispensed, data.ID.Hex(), officer)
+		utils.JSON(c, http.StatusConflict, gin.H{"error": "prescription was modified by another request"})
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, result)
+}
+
+// ReceivePrescriptionHandler takes a prescription into the pharmacy's queue.
+// A prescription sent by a doctor belongs to the first pharmacy receiving it.
+func (pharmacyController *PharmacyController) ReceivePrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the body is optional for this step
+		var body pharmacy.WorkflowNoteBody
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			if data.ClientID == "" {
+				data.ClientID = c.GetString("userClient")
+			}
+
+			return nil, data.Peresepan.ConfidentialData.Advance(datastruct.DITERIMA, nil, body.Catatan, by, now)
+		})
+	}
+}
+
+// ReviewPrescriptionHandler records the pharmacist's administrative,
+// pharmaceutical and clinical review of the whole prescription. The doses
+// are checked again against the current formulary.
+func (pharmacyController *PharmacyController) ReviewPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.ReviewBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			confidential := data.Peresepan.ConfidentialData
+			if err := confidential.Advance(datastruct.DIKAJI, nil, body.Catatan, by, now); err != nil {
+				return nil, err
+			}
+
+			confidential.PengkajianResep = body.PengkajianResep
+
+			drugs, err := pharmacyController.itemDrugs(confidential.ItemResep)
+			if err != nil {
+				return nil, err
+			}
+			applyDoseWarnings(confidential, drugs, now)
+
+			return nil, nil
+		})
+	}
+}
+
+func (pharmacyController *PharmacyController) PreparePrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the body is optional for this step
+		var body pharmacy.WorkflowNoteBody
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			return nil, data.Peresepan.ConfidentialData.Advance(datastruct.DISIAPKAN, nil, body.Catatan, by, now)
+		})
+	}
+}
+
+// DispensePrescriptionHandler gives some or all of the items and takes them
+// from the stock. Items can be given in several steps.
+func (pharmacyController *PharmacyController) DispensePrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the body is optional for this step
+		var body pharmacy.DispenseBody
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			confidential := data.Peresepan.ConfidentialData
+
+			// both dispensing statuses are reached from the same steps
+			if err := pharmacy.CheckTransition(confidential.Status(), datastruct.DIBERIKAN_SEBAGIAN); err != nil {
+				return nil, err
+			}
+
+			given, err := confidential.Dispense(body.Item)
+			if err != nil {
+				return nil, err
+			}
+
+			items := []string{}
+			for i := 0; i < len(given); i++ {
+				items = append(items, given[i].IDItem)
+			}
+
+			if err := confidential.Advance(pharmacy.DispensingStatus(confidential.ItemResep), items, body.Catatan, by, now); err != nil {
+				return nil, err
+			}
+
+			return pharmacyController.dispenseStock(c.GetString("userClient"), given, data.ID.Hex(), by)
+		})
+	}
+}
+
+// HandoverPrescriptionHandler records who received the drugs and the
+// counseling given with them.
+func (pharmacyController *PharmacyController) HandoverPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.Handover
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			confidential := data.Peresepan.ConfidentialData
+			if err := confidential.Advance(datastruct.DISERAHKAN, nil, body.Konseling.Catatan, by, now); err != nil {
+				return nil, err
+			}
+
+			body.Petugas = by
+			body.WaktuPenyerahan = now
+			confidential.Penyerahan = &body
+			return nil, nil
+		})
+	}
+}
+
+// RejectPrescriptionHandler returns the prescription to the prescriber with
+// the reason. It can be received again once the prescriber revised it.
+func (pharmacyController *PharmacyController) RejectPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.RejectionBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pharmacyController.workflowStep(c, func(data *pharmacy.Pharmacy, by string, now time.Time) ([]DispensedStock, error) {
+			return nil, data.Peresepan.ConfidentialData.Advance(datastruct.DITOLAK, nil, body.Alasan, by, now)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package fasyankes_controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-pharmacy/config"
+	"service-pharmacy/document"
+	"service-pharmacy/logger"
+	"service-pharmacy/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DocumentVerifyPath is the route printed documents are verified from,
+// outside of the token check, e.g. by scanning their QR code.
+const DocumentVerifyPath = "/verify"
+
+var (
+	documentTamperedError    = errors.New("the document does not match its signature and cannot be printed")
+	fingerprintRequiredError = errors.New("fingerprint is required")
+)
+
+// loadLetterhead reads the letterhead of the facility from the config. A
+// logo which cannot be read is left out rather than failing every document.
+func loadLetterhead() document.Letterhead {
+	letterhead, err := document.LoadLetterhead(
+		config.FacilityName,
+		config.FacilityAddress,
+		config.FacilityPhone,
+		config.FacilityEmail,
+		config.FacilityLogo,
+	)
+	if err != nil {
+		logger.LogWarning.Printf("Failed to read the logo of the letterhead: %v\n", err)
+	}
+
+	return letterhead
+}
+
+// sendPDF renders the document in full before sending it, so an error while
+// laying it out still gets a proper response.
+func sendPDF(c *gin.Context, pdf *document.Document, name string) {
+	var content bytes.Buffer
+	if err := pdf.Write(&content); err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, int64(content.Len()), "application/pdf", &content, map[string]string{
+		"Cache-Control":       "private, no-store",
+		"Content-Disposition": fmt.Sprintf("inline; filename=%q", name+".pdf"),
+	})
+}
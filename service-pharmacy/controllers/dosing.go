@@ -0,0 +1,112 @@
+package fasyankes_controllers
+
+import (
+	"errors"
+	"net/http"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/dosing"
+	"service-pharmacy/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DoseCalculation struct {
+	Pasien     dosing.Patient             `json:"pasien"`
+	Dosis      *dosing.Dose               `json:"dosis"`
+	Peringatan []pharmacy.ClinicalWarning `json:"peringatan"`
+}
+
+// dosingPatient works out the patient's dosing measurements. The body
+// surface area computed for a child is kept on the prescription.
+func dosingPatient(birth time.Time, height, weight uint16, bsa *float64, now time.Time) dosing.Patient {
+	patient := dosing.NewPatient(birth, float64(height), float64(weight), *bsa, now)
+	if *bsa <= 0 && patient.Child() {
+		*bsa = patient.LuasPermukaanTubuh
+	}
+
+	return patient
+}
+
+// itemDrugs looks up the drug of every item. Drugs removed from the
+// formulary since are left nil and cannot be checked.
+func (pharmacyController *PharmacyController) itemDrugs(items []pharmacy.PrescriptionItem) ([]*pharmacy.Drug, error) {
+	drugs := []*pharmacy.Drug{}
+	for i := 0; i < len(items); i++ {
+		drug, err := pharmacyController.findDrug(items[i].IDObat)
+		if err != nil && !errors.Is(err, pharmacy.DrugNotFoundError) {
+			return nil, err
+		}
+		drugs = append(drugs, drug)
+	}
+
+	return drugs, nil
+}
+
+// applyDoseWarnings checks the doses of a prescription and keeps the outcome
+// with its other clinical warnings.
+func applyDoseWarnings(data *pharmacy.ConfidentialPharmacyData, drugs []*pharmacy.Drug, now time.Time) []pharmacy.ClinicalWarning {
+	patient := dosingPatient(data.TanggalLahir, data.TinggiBadan, data.BeratBadan, &data.LuasPermukaanTubuhAnak, now)
+
+	warnings := dosing.CheckItems(drugs, data.ItemResep, patient)
+	data.PeringatanKlinis = pharmacy.ReplaceWarnings(data.PeringatanKlinis, datastruct.PERINGATAN_DOSIS, warnings)
+
+	if data.PengkajianResep.Klinis.IndikasiDosisPenggunaan == "" {
+		data.PengkajianResep.Klinis.IndikasiDosisPenggunaan = pharmacy.Summarize(warnings, datastruct.PERINGATAN_DOSIS)
+	}
+
+	return warnings
+}
+
+// CalculateDoseHandler works out the dose range of a drug for a patient and
+// checks a dose against it when one is given.
+func (pharmacyController *PharmacyController) CalculateDoseHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.DoseCalculationBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		drug, err := pharmacyController.findDrug(body.IDObat)
+		if err != nil {
+			if errors.Is(err, pharmacy.DrugNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		patient := dosing.NewPatient(body.TanggalLahir, body.TinggiBadan, body.BeratBadan, body.LuasPermukaanTubuh, time.Now())
+
+		dose, err := dosing.Calculate(drug, patient)
+		if err != nil {
+			if errors.Is(err, dosing.NoDosingRuleError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error(), "pasien": patient})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error(), "pasien": patient})
+			return
+		}
+
+		result := DoseCalculation{
+			Pasien:     patient,
+			Dosis:      dose,
+			Peringatan: []pharmacy.ClinicalWarning{},
+		}
+
+		if body.Dosis > 0 {
+			item := pharmacy.PrescriptionItem{
+				IDObat:           drug.IDObat,
+				Dosis:            body.Dosis,
+				SatuanDosis:      body.SatuanDosis,
+				FrekuensiPerHari: body.FrekuensiPerHari,
+			}
+			result.Peringatan = dosing.Check(drug, &item, patient)
+		}
+
+		utils.JSON(c, http.StatusOK, result)
+	}
+}
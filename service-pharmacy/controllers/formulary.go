@@ -0,0 +1,327 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/pagination"
+	"service-pharmacy/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (pharmacyController *PharmacyController) findDrug(idObat string) (*pharmacy.Drug, error) {
+	var drug pharmacy.Drug
+	err := pharmacyController.FormularyCollection.FindOne(context.Background(), bson.M{"id_obat": idObat}).Decode(&drug)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%s: %w", idObat, pharmacy.DrugNotFoundError)
+		}
+		return nil, err
+	}
+
+	return &drug, nil
+}
+
+// resolveItems makes sure every item refers to a formulary entry and that
+// the drug written on the item is that entry. Missing names, forms and
+// routes are taken from the formulary.
+func (pharmacyController *PharmacyController) resolveItems(items []pharmacy.PrescriptionItem) ([]*pharmacy.Drug, error) {
+	drugs := []*pharmacy.Drug{}
+	for i := 0; i < len(items); i++ {
+		item := &items[i]
+
+		drug, err := pharmacyController.findDrug(item.IDObat)
+		if err != nil {
+			return nil, err
+		}
+
+		if item.NamaObat == "" {
+			item.NamaObat = drug.Name()
+		}
+		if item.Bentuk == "" {
+			item.Bentuk = drug.BentukSediaan
+		}
+		if item.RutePemberian == "" {
+			item.RutePemberian = drug.RutePemberian
+		}
+
+		if err := drug.Check(item.NamaObat, item.Bentuk, item.JumlahObat); err != nil {
+			return nil, err
+		}
+
+		drugs = append(drugs, drug)
+	}
+
+	return drugs, nil
+}
+
+// prescriptionErrorStatus tells client mistakes apart from database failures.
+func prescriptionErrorStatus(err error) int {
+	if errors.Is(err, pharmacy.DrugNotFoundError) ||
+		errors.Is(err, pharmacy.DrugNameMismatchError) ||
+		errors.Is(err, pharmacy.DrugFormMismatchError) ||
+		errors.Is(err, pharmacy.DrugQuantityLimitError) ||
+		errors.Is(err, pharmacy.ControlledSignatureRequiredError) ||
+		errors.Is(err, pharmacy.ControlledSignatureMissingError) ||
+		errors.Is(err, pharmacy.ControlledLicenseRequiredError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (pharmacyController *PharmacyController) GetFormularyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{}
+
+		if q := c.Query("q"); q != "" {
+			regex := primitive.Regex{
+				Pattern: regexp.QuoteMeta(q),
+				Options: "i",
+			}
+
+			filter["$or"] = bson.A{
+				bson.M{"id_obat": regex},
+				bson.M{"nama_generik": regex},
+				bson.M{"nama_dagang": regex},
+			}
+		}
+
+		// an ATC code matches every drug below it in the hierarchy
+		if atc := c.Query("kode_atc"); atc != "" {
+			filter["kode_atc"] = primitive.Regex{
+				Pattern: "^" + regexp.QuoteMeta(strings.ToUpper(atc)),
+			}
+		}
+
+		if form := c.Query("bentuk_sediaan"); form != "" {
+			filter["bentuk_sediaan"] = primitive.Regex{
+				Pattern: "^" + regexp.QuoteMeta(form) + "$",
+				Options: "i",
+			}
+		}
+
+		if route := c.Query("rute_pemberian"); route != "" {
+			filter["rute_pemberian"] = primitive.Regex{
+				Pattern: "^" + regexp.QuoteMeta(route) + "$",
+				Options: "i",
+			}
+		}
+
+		if schedule := c.Query("golongan"); schedule != "" {
+			value, err := strconv.ParseUint(schedule, 10, 8)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["golongan"] = value
+		}
+
+		if fornas := c.Query("fornas"); fornas != "" {
+			value, err := strconv.ParseBool(fornas)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["fornas"] = value
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := pharmacyController.FormularyCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.FormularyCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		drugs := []pharmacy.Drug{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var drug pharmacy.Drug
+			if err := cursor.Decode(&drug); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = drug.ID
+			drugs = append(drugs, drug)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(drugs, total, last, more))
+	}
+}
+
+func (pharmacyController *PharmacyController) GetDrugHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		drug, err := pharmacyController.findDrug(c.Param("idObat"))
+		if err != nil {
+			if errors.Is(err, pharmacy.DrugNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, drug)
+	}
+}
+
+func (pharmacyController *PharmacyController) CreateDrugHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var drug pharmacy.Drug
+		if err := c.ShouldBindJSON(&drug); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := drug.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := pharmacyController.findDrug(drug.IDObat)
+		if err == nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": pharmacy.DrugDuplicateError.Error()})
+			return
+		} else if !errors.Is(err, pharmacy.DrugNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		drug.ID = primitive.NilObjectID
+		drug.ClientID = c.GetString("userClient")
+		drug.CreatedAt = &now
+		drug.UpdatedAt = &now
+
+		if _, err := pharmacyController.FormularyCollection.InsertOne(context.Background(), drug); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": pharmacy.DrugDuplicateError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{"message": "Drug created successfully"})
+	}
+}
+
+func (pharmacyController *PharmacyController) UpdateDrugHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var drug pharmacy.Drug
+		if err := c.ShouldBindJSON(&drug); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := drug.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		idObat := c.Param("idObat")
+		if drug.IDObat != idObat {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "id_obat cannot be changed"})
+			return
+		}
+
+		existing, err := pharmacyController.findDrug(idObat)
+		if err != nil {
+			if errors.Is(err, pharmacy.DrugNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		drug.ID = primitive.NilObjectID
+		drug.ClientID = existing.ClientID
+		drug.CreatedAt = existing.CreatedAt
+		drug.UpdatedAt = &now
+
+		result, err := pharmacyController.FormularyCollection.UpdateOne(context.Background(), bson.M{"_id": existing.ID}, bson.M{"$set": drug})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d drug updated successfully", result.ModifiedCount)})
+	}
+}
+
+func (pharmacyController *PharmacyController) DeleteDrugHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inUse, err := pharmacyController.FaskesCollection.CountDocuments(context.Background(), bson.M{"$or": bson.A{
+			bson.M{"peresepan.id_obat": c.Param("idObat")},
+			bson.M{"peresepan.daftar_id_obat": c.Param("idObat")},
+		}})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if inUse > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "drug is still referenced by prescriptions"})
+			return
+		}
+
+		stocked, err := pharmacyController.InventoryCollection.CountDocuments(context.Background(), bson.M{"id_obat": c.Param("idObat")})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if stocked > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "drug is still referenced by inventory items"})
+			return
+		}
+
+		result, err := pharmacyController.FormularyCollection.DeleteOne(context.Background(), bson.M{"id_obat": c.Param("idObat")})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d drug deleted successfully", result.DeletedCount)})
+	}
+}
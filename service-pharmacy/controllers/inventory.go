@@ -0,0 +1,907 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"service-pharmacy/config"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/logger"
+	"service-pharmacy/pagination"
+	"service-pharmacy/utils"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stockRetries bounds how often a stock change is retried when another
+// request changed the same item in between.
+const stockRetries = 3
+
+// DispensedStock records which batches were taken for a drug so the stock
+// can be given back when the prescription could not be saved.
+type DispensedStock struct {
+	IDObat  string                     `json:"id_obat"`
+	Alokasi []pharmacy.BatchAllocation `json:"alokasi"`
+}
+
+type LowStockItem struct {
+	IDObat       string `json:"id_obat"`
+	NamaObat     string `json:"nama_obat"`
+	Lokasi       string `json:"lokasi"`
+	StokMinimum  uint   `json:"stok_minimum"`
+	StokTersedia uint   `json:"stok_tersedia"`
+	TotalStok    uint   `json:"total_stok"`
+}
+
+func (pharmacyController *PharmacyController) findInventoryItem(clientID, idObat string) (*pharmacy.InventoryItem, error) {
+	filter := bson.M{
+		"client_id": clientID,
+		"id_obat":   idObat,
+	}
+
+	var item pharmacy.InventoryItem
+	if err := pharmacyController.InventoryCollection.FindOne(context.Background(), filter).Decode(&item); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%s: %w", idObat, pharmacy.InventoryItemNotFoundError)
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// recordMovements signs the ledger entries and stores them within the
+// transaction of ctx. Movements of narcotics and psychotropics also go into
+// the controlled register.
+func (pharmacyController *PharmacyController) recordMovements(ctx context.Context, movements []pharmacy.StockMovement, satuan string) error {
+	if len(movements) == 0 {
+		return nil
+	}
+
+	documents := []interface{}{}
+	for i := 0; i < len(movements); i++ {
+		movement := movements[i]
+		movement.Signature = nil
+		movement.ID = primitive.NilObjectID
+
+		dataByte, err := json.Marshal(movement)
+		if err != nil {
+			return err
+		}
+
+		signature := utils.GenerateSignature(string(dataByte))
+		movement.Signature = &signature
+		documents = append(documents, movement)
+	}
+
+	if _, err := pharmacyController.StockCollection.InsertMany(ctx, documents); err != nil {
+		return err
+	}
+
+	drug, err := pharmacyController.findDrug(movements[0].IDObat)
+	if err != nil {
+		if errors.Is(err, pharmacy.DrugNotFoundError) {
+			return nil
+		}
+		return err
+	}
+
+	if !drug.Controlled() {
+		return nil
+	}
+
+	return pharmacyController.registerControlled(ctx, drug, satuan, movements)
+}
+
+// changeStock applies change to the stock of a drug and writes the ledger
+// entries it returns. The item is read again and the change repeated when
+// another request updated or added it in between, or took the same place in
+// the controlled register. With create set, a drug the facility does not
+// stock yet is added from the formulary.
+func (pharmacyController *PharmacyController) changeStock(clientID, idObat string, create bool, change func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error)) (*pharmacy.InventoryItem, error) {
+	for attempt := 0; attempt < stockRetries; attempt++ {
+		isNew := false
+		item, err := pharmacyController.findInventoryItem(clientID, idObat)
+		if err != nil {
+			if !create || !errors.Is(err, pharmacy.InventoryItemNotFoundError) {
+				return nil, err
+			}
+
+			drug, err := pharmacyController.findDrug(idObat)
+			if err != nil {
+				return nil, err
+			}
+
+			isNew = true
+			item = &pharmacy.InventoryItem{
+				ClientID: clientID,
+				IDObat:   idObat,
+				NamaObat: drug.Name(),
+				Satuan:   drug.BentukSediaan,
+				Batch:    []pharmacy.StockBatch{},
+			}
+		}
+
+		movements, err := change(item)
+		if err != nil {
+			return nil, err
+		}
+		item.Recount()
+
+		err = pharmacyController.storeStock(item, isNew, movements)
+		if errors.Is(err, pharmacy.StockConflictError) || mongo.IsDuplicateKeyError(err) {
+			// another request changed the item or the register first
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return item, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", idObat, pharmacy.StockConflictError)
+}
+
+// storeStock writes the changed item and its ledger entries in one
+// transaction, so the stock never changes without its entries.
+func (pharmacyController *PharmacyController) storeStock(item *pharmacy.InventoryItem, isNew bool, movements []pharmacy.StockMovement) error {
+	session, err := pharmacyController.InventoryCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	now := time.Now().Truncate(time.Duration(time.Millisecond))
+	previousUpdate := item.UpdatedAt
+	item.UpdatedAt = &now
+
+	_, err = session.WithTransaction(context.Background(), func(ctx mongo.SessionContext) (interface{}, error) {
+		if isNew {
+			item.ID = primitive.NilObjectID
+			item.CreatedAt = &now
+			result, err := pharmacyController.InventoryCollection.InsertOne(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			item.ID = result.InsertedID.(primitive.ObjectID)
+		} else {
+			filter := bson.M{
+				"_id":        item.ID,
+				"updated_at": previousUpdate,
+			}
+
+			id := item.ID
+			item.ID = primitive.NilObjectID
+			result, err := pharmacyController.InventoryCollection.UpdateOne(ctx, filter, bson.M{"$set": item})
+			item.ID = id
+			if err != nil {
+				return nil, err
+			}
+
+			if result.MatchedCount == 0 {
+				return nil, pharmacy.StockConflictError
+			}
+		}
+
+		for i := 0; i < len(movements); i++ {
+			movements[i].ClientID = item.ClientID
+			movements[i].IDObat = item.IDObat
+			movements[i].SaldoTotal = item.TotalStok
+			movements[i].Waktu = now
+		}
+
+		return nil, pharmacyController.recordMovements(ctx, movements, item.Satuan)
+	})
+	if err != nil {
+		item.UpdatedAt = previousUpdate
+	}
+
+	return err
+}
+
+// dispenseStock takes what was given from the facility's stock, first
+// expiring first. Stock already taken is given back when a later drug runs
+// short.
+func (pharmacyController *PharmacyController) dispenseStock(clientID string, given []pharmacy.DispensedQuantity, reference, officer string) ([]DispensedStock, error) {
+	quantities := map[string]uint{}
+	order := []string{}
+	for i := 0; i < len(given); i++ {
+		if _, ok := quantities[given[i].IDObat]; !ok {
+			order = append(order, given[i].IDObat)
+		}
+		quantities[given[i].IDObat] += given[i].Jumlah
+	}
+
+	dispensed := []DispensedStock{}
+	for i := 0; i < len(order); i++ {
+		idObat := order[i]
+
+		var allocations []pharmacy.BatchAllocation
+		_, err := pharmacyController.changeStock(clientID, idObat, false, func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error) {
+			var err error
+			allocations, err = item.AllocateFEFO(quantities[idObat], time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			movements := []pharmacy.StockMovement{}
+			for j := 0; j < len(allocations); j++ {
+				movements = append(movements, pharmacy.StockMovement{
+					NoBatch:    allocations[j].NoBatch,
+					Jenis:      datastruct.PENGELUARAN,
+					Jumlah:     -int(allocations[j].Jumlah),
+					SaldoBatch: item.FindBatch(allocations[j].NoBatch).Jumlah,
+					Referensi:  reference,
+					Keterangan: "Pemberian obat resep",
+					Petugas:    officer,
+				})
+			}
+
+			return movements, nil
+		})
+		if err != nil {
+			pharmacyController.returnStock(clientID, dispensed, reference, officer)
+			return nil, err
+		}
+
+		dispensed = append(dispensed, DispensedStock{IDObat: idObat, Alokasi: allocations})
+	}
+
+	return dispensed, nil
+}
+
+// returnStock puts dispensed stock back into the batches it came from. It is
+// used to compensate a dispensing whose prescription was not saved, so a
+// failure is only logged.
+func (pharmacyController *PharmacyController) returnStock(clientID string, dispensed []DispensedStock, reference, officer string) {
+	for i := 0; i < len(dispensed); i++ {
+		allocations := dispensed[i].Alokasi
+
+		_, err := pharmacyController.changeStock(clientID, dispensed[i].IDObat, false, func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error) {
+			movements := []pharmacy.StockMovement{}
+			for j := 0; j < len(allocations); j++ {
+				err := item.Receive(pharmacy.StockBatch{
+					NoBatch:           allocations[j].NoBatch,
+					TanggalKadaluarsa: allocations[j].TanggalKadaluarsa,
+					Jumlah:            allocations[j].Jumlah,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				movements = append(movements, pharmacy.StockMovement{
+					NoBatch:    allocations[j].NoBatch,
+					Jenis:      datastruct.PENYESUAIAN,
+					Jumlah:     int(allocations[j].Jumlah),
+					SaldoBatch: item.FindBatch(allocations[j].NoBatch).Jumlah,
+					Referensi:  reference,
+					Keterangan: "Pembatalan pemberian obat",
+					Petugas:    officer,
+				})
+			}
+
+			return movements, nil
+		})
+		if err != nil {
+			logger.LogError.Printf("Failed to return stock of [%s] for [%s]: %v\n", dispensed[i].IDObat, reference, err)
+		}
+	}
+}
+
+// stockErrorStatus tells shortages and client mistakes apart from database
+// failures.
+func stockErrorStatus(err error) int {
+	if errors.Is(err, pharmacy.InsufficientStockError) ||
+		errors.Is(err, pharmacy.InventoryItemNotFoundError) ||
+		errors.Is(err, pharmacy.StockConflictError) ||
+		errors.Is(err, pharmacy.BatchExpiryMismatchError) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, pharmacy.DrugNotFoundError) ||
+		errors.Is(err, pharmacy.BatchNotFoundError) ||
+		errors.Is(err, pharmacy.BatchExpiredError) ||
+		errors.Is(err, pharmacy.InvalidQuantityError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (pharmacyController *PharmacyController) GetInventoryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"client_id": c.GetString("userClient")}
+
+		if q := c.Query("q"); q != "" {
+			regex := primitive.Regex{
+				Pattern: regexp.QuoteMeta(q),
+				Options: "i",
+			}
+
+			filter["$or"] = bson.A{
+				bson.M{"id_obat": regex},
+				bson.M{"nama_obat": regex},
+			}
+		}
+
+		if location := c.Query("lokasi"); location != "" {
+			filter["lokasi"] = location
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := pharmacyController.InventoryCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.InventoryCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		items := []pharmacy.InventoryItem{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var item pharmacy.InventoryItem
+			if err := cursor.Decode(&item); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = item.ID
+			items = append(items, item)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(items, total, last, more))
+	}
+}
+
+func (pharmacyController *PharmacyController) GetInventoryItemHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		item, err := pharmacyController.findInventoryItem(c.GetString("userClient"), c.Param("idObat"))
+		if err != nil {
+			if errors.Is(err, pharmacy.InventoryItemNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, item)
+	}
+}
+
+// CreateInventoryItemHandler registers a formulary drug as stocked by the
+// facility. Stock only enters through a goods receipt.
+func (pharmacyController *PharmacyController) CreateInventoryItemHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var item pharmacy.InventoryItem
+		if err := c.ShouldBindJSON(&item); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientID := c.GetString("userClient")
+
+		drug, err := pharmacyController.findDrug(item.IDObat)
+		if err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = pharmacyController.findInventoryItem(clientID, item.IDObat)
+		if err == nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": pharmacy.InventoryItemDuplicateError.Error()})
+			return
+		} else if !errors.Is(err, pharmacy.InventoryItemNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		item.ID = primitive.NilObjectID
+		item.ClientID = clientID
+		item.NamaObat = drug.Name()
+		if item.Satuan == "" {
+			item.Satuan = drug.BentukSediaan
+		}
+		item.Batch = []pharmacy.StockBatch{}
+		item.TotalStok = 0
+		item.CreatedAt = &now
+		item.UpdatedAt = &now
+
+		if _, err := pharmacyController.InventoryCollection.InsertOne(context.Background(), item); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{"message": "Inventory item created successfully"})
+	}
+}
+
+// UpdateInventoryItemHandler changes the storage details of an item. The
+// quantities can only change through receipts, adjustments and opname.
+func (pharmacyController *PharmacyController) UpdateInventoryItemHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var item pharmacy.InventoryItem
+		if err := c.ShouldBindJSON(&item); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if item.IDObat != c.Param("idObat") {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "id_obat cannot be changed"})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		filter := bson.M{
+			"client_id": c.GetString("userClient"),
+			"id_obat":   item.IDObat,
+		}
+
+		update := bson.M{"$set": bson.M{
+			"satuan":       item.Satuan,
+			"lokasi":       item.Lokasi,
+			"stok_minimum": item.StokMinimum,
+			"updated_at":   now,
+		}}
+
+		result, err := pharmacyController.InventoryCollection.UpdateOne(context.Background(), filter, update)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d inventory item updated successfully", result.ModifiedCount)})
+	}
+}
+
+// GoodsReceiptHandler books a delivery into stock. Drugs the facility did
+// not stock before are added from the formulary.
+func (pharmacyController *PharmacyController) GoodsReceiptHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.GoodsReceiptBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		for i := 0; i < len(body.Item); i++ {
+			if !body.Item[i].TanggalKadaluarsa.After(now) {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": fmt.Errorf("%s: %w", body.Item[i].NoBatch, pharmacy.BatchExpiredError).Error()})
+				return
+			}
+		}
+
+		clientID := c.GetString("userClient")
+		officer := c.GetString("userIdentification")
+
+		items := []pharmacy.InventoryItem{}
+		for i := 0; i < len(body.Item); i++ {
+			line := body.Item[i]
+			line.TanggalPenerimaan = now
+
+			item, err := pharmacyController.changeStock(clientID, line.IDObat, true, func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error) {
+				if err := item.Receive(line.StockBatch); err != nil {
+					return nil, err
+				}
+
+				return []pharmacy.StockMovement{{
+					NoBatch:    line.NoBatch,
+					Jenis:      datastruct.PENERIMAAN,
+					Jumlah:     int(line.Jumlah),
+					SaldoBatch: item.FindBatch(line.NoBatch).Jumlah,
+					Referensi:  body.NoPenerimaan,
+					Keterangan: "Penerimaan dari " + body.Pemasok,
+					Petugas:    officer,
+				}}, nil
+			})
+			if err != nil {
+				// earlier lines are already booked and stay in the ledger
+				utils.JSON(c, stockErrorStatus(err), gin.H{"error": err.Error(), "diterima": items})
+				return
+			}
+
+			items = append(items, *item)
+		}
+
+		utils.JSON(c, http.StatusCreated, items)
+	}
+}
+
+func (pharmacyController *PharmacyController) StockAdjustmentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.StockAdjustmentBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		officer := c.GetString("userIdentification")
+
+		item, err := pharmacyController.changeStock(c.GetString("userClient"), c.Param("idObat"), false, func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error) {
+			batch, err := item.Adjust(body.NoBatch, body.Jumlah)
+			if err != nil {
+				return nil, err
+			}
+
+			return []pharmacy.StockMovement{{
+				NoBatch:    body.NoBatch,
+				Jenis:      datastruct.PENYESUAIAN,
+				Jumlah:     body.Jumlah,
+				SaldoBatch: batch.Jumlah,
+				Keterangan: body.Alasan,
+				Petugas:    officer,
+			}}, nil
+		})
+		if err != nil {
+			if errors.Is(err, pharmacy.InventoryItemNotFoundError) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.JSON(c, stockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, item)
+	}
+}
+
+// StockOpnameHandler sets the batches to the physically counted quantities
+// and books the differences. Batches that were not counted are left alone.
+func (pharmacyController *PharmacyController) StockOpnameHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.StockOpnameBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientID := c.GetString("userClient")
+		officer := c.GetString("userIdentification")
+		reference := "OPNAME-" + time.Now().Format("20060102150405")
+
+		counts := map[string][]pharmacy.StockCountLine{}
+		order := []string{}
+		for i := 0; i < len(body.Item); i++ {
+			if _, ok := counts[body.Item[i].IDObat]; !ok {
+				order = append(order, body.Item[i].IDObat)
+			}
+			counts[body.Item[i].IDObat] = append(counts[body.Item[i].IDObat], body.Item[i])
+		}
+
+		items := []pharmacy.InventoryItem{}
+		for i := 0; i < len(order); i++ {
+			lines := counts[order[i]]
+
+			item, err := pharmacyController.changeStock(clientID, order[i], false, func(item *pharmacy.InventoryItem) ([]pharmacy.StockMovement, error) {
+				movements := []pharmacy.StockMovement{}
+				for j := 0; j < len(lines); j++ {
+					batch := item.FindBatch(lines[j].NoBatch)
+					if batch == nil {
+						return nil, fmt.Errorf("%s: %w", lines[j].NoBatch, pharmacy.BatchNotFoundError)
+					}
+
+					delta := int(*lines[j].JumlahFisik) - int(batch.Jumlah)
+					if delta == 0 {
+						continue
+					}
+
+					batch.Jumlah = *lines[j].JumlahFisik
+					movements = append(movements, pharmacy.StockMovement{
+						NoBatch:    batch.NoBatch,
+						Jenis:      datastruct.STOK_OPNAME,
+						Jumlah:     delta,
+						SaldoBatch: batch.Jumlah,
+						Referensi:  reference,
+						Keterangan: body.Catatan,
+						Petugas:    officer,
+					})
+				}
+
+				return movements, nil
+			})
+			if err != nil {
+				utils.JSON(c, stockErrorStatus(err), gin.H{"error": err.Error(), "disesuaikan": items})
+				return
+			}
+
+			items = append(items, *item)
+		}
+
+		utils.JSON(c, http.StatusOK, items)
+	}
+}
+
+// GetStockLedgerHandler lists the stock movements of a drug, oldest first
+// unless sort is desc.
+func (pharmacyController *PharmacyController) GetStockLedgerHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"client_id": c.GetString("userClient"),
+			"id_obat":   c.Param("idObat"),
+		}
+
+		params, err := pagination.ParseOldestFirst(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.FilterOn("waktu", filter)
+
+		total, err := pharmacyController.StockCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.StockCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		movements := []pharmacy.StockMovement{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var movement pharmacy.StockMovement
+			if err := cursor.Decode(&movement); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = movement.ID
+
+			id := movement.ID
+			signature := movement.Signature
+			movement.Signature = nil
+			movement.ID = primitive.NilObjectID
+
+			dataByte, err := json.Marshal(movement)
+			if err != nil {
+				logger.LogPanic.Panicf("Failed to marshal json data")
+			}
+
+			if signature == nil {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+				continue
+			} else if _, err = utils.VerifySignature(string(dataByte), *signature); err != nil {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+				continue
+			}
+
+			movement.Signature = signature
+			movement.ID = id
+			movements = append(movements, movement)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(movements, total, last, more))
+	}
+}
+
+// usableStock is the stock of an item that has not expired by the given
+// time, worked out by the database.
+func usableStock(at time.Time) bson.M {
+	return bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$batch", bson.A{}}},
+			"as":    "batch",
+			"cond":  bson.M{"$gt": bson.A{"$$batch.tanggal_kadaluarsa", at}},
+		}},
+		"as": "batch",
+		"in": "$$batch.jumlah",
+	}}}
+}
+
+// LowStockReportHandler lists the items whose unexpired stock is at or
+// below their minimum.
+func (pharmacyController *PharmacyController) LowStockReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		filter := bson.M{
+			"client_id": c.GetString("userClient"),
+			"$expr":     bson.M{"$lte": bson.A{usableStock(now), "$stok_minimum"}},
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := pharmacyController.InventoryCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.InventoryCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		report := []LowStockItem{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var item pharmacy.InventoryItem
+			if err := cursor.Decode(&item); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = item.ID
+
+			report = append(report, LowStockItem{
+				IDObat:       item.IDObat,
+				NamaObat:     item.NamaObat,
+				Lokasi:       item.Lokasi,
+				StokMinimum:  item.StokMinimum,
+				StokTersedia: item.UsableStock(now),
+				TotalStok:    item.TotalStok,
+			})
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(report, total, last, more))
+	}
+}
+
+// NearExpiryReportHandler lists the batches expiring within the given number
+// of days, including those already expired. The report is paged by item,
+// with every expiring batch of an item on the same page, soonest first.
+func (pharmacyController *PharmacyController) NearExpiryReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := config.NearExpiryDays
+		if value := c.Query("hari"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": "hari must be a non-negative number"})
+				return
+			}
+			days = parsed
+		}
+
+		now := time.Now()
+		limit := now.AddDate(0, 0, days)
+
+		filter := bson.M{
+			"client_id":                c.GetString("userClient"),
+			"batch.tanggal_kadaluarsa": bson.M{"$lte": limit},
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := pharmacyController.InventoryCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := pharmacyController.InventoryCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		report := []pharmacy.ExpiringBatch{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var item pharmacy.InventoryItem
+			if err := cursor.Decode(&item); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = item.ID
+
+			expiring := []pharmacy.ExpiringBatch{}
+			for j := 0; j < len(item.Batch); j++ {
+				batch := item.Batch[j]
+				if batch.TanggalKadaluarsa.After(limit) {
+					continue
+				}
+
+				expiring = append(expiring, pharmacy.ExpiringBatch{
+					IDObat:     item.IDObat,
+					NamaObat:   item.NamaObat,
+					StockBatch: batch,
+					SisaHari:   int(batch.TanggalKadaluarsa.Sub(now).Hours() / 24),
+				})
+			}
+
+			sort.Slice(expiring, func(i, j int) bool {
+				return expiring[i].TanggalKadaluarsa.Before(expiring[j].TanggalKadaluarsa)
+			})
+			report = append(report, expiring...)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(report, total, last, more))
+	}
+}
@@ -6,11 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"service-pharmacy/config"
 	specialityexamination "service-pharmacy/datastruct/outpatient"
 	"service-pharmacy/datastruct/pharmacy"
 	"service-pharmacy/datastruct/user"
 	"service-pharmacy/db/csfle"
+	"service-pharmacy/document"
+	"service-pharmacy/dosing"
 	"service-pharmacy/logger"
+	"service-pharmacy/pagination"
+	"service-pharmacy/signing"
 	"service-pharmacy/utils"
 	"time"
 
@@ -22,20 +27,39 @@ import (
 )
 
 type PharmacyController struct {
-	FaskesCollection  *mongo.Collection
-	ConsentCollection *mongo.Collection
+	FaskesCollection     *mongo.Collection
+	ConsentCollection    *mongo.Collection
+	FormularyCollection  *mongo.Collection
+	InventoryCollection  *mongo.Collection
+	StockCollection      *mongo.Collection
+	RegisterCollection   *mongo.Collection
+	AttachmentCollection *mongo.Collection
+	Letterhead           document.Letterhead
 
 	ClientEncryption *mongo.ClientEncryption
 	EncryptionOpts   *options.EncryptOptions
+
+	Signing *signing.Client
 }
 
 func InitPharmacyController(client *mongo.Client, csfle *csfle.CSFLE) *PharmacyController {
 	return &PharmacyController{
-		FaskesCollection:  client.Database("fasyankes").Collection("apotek"),
-		ConsentCollection: client.Database("emr").Collection("consent"),
+		FaskesCollection:     client.Database("fasyankes").Collection("apotek"),
+		ConsentCollection:    client.Database("emr").Collection("consent"),
+		FormularyCollection:  client.Database("fasyankes").Collection("formularium"),
+		InventoryCollection:  client.Database("fasyankes").Collection("persediaan"),
+		StockCollection:      client.Database("fasyankes").Collection("kartu_stok"),
+		RegisterCollection:   client.Database("fasyankes").Collection("register_narkotika"),
+		AttachmentCollection: client.Database("emr").Collection("lampiran"),
+		Letterhead:           loadLetterhead(),
 
 		ClientEncryption: csfle.ClientEncryption,
 		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK),
+
+		Signing: signing.New(
+			config.AuthServiceURL,
+			time.Duration(config.AuthServiceTimeout)*time.Second,
+		),
 	}
 }
 
@@ -125,8 +149,66 @@ func (pharmacyController *PharmacyController) CreatePharmacyRequest() gin.Handle
 			return
 		}
 
+		if err := pharmacyrequest.Peresepan.NormalizeItems(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		confidential := pharmacyrequest.Peresepan.ConfidentialData
+		drugs, err := pharmacyController.resolveItems(confidential.ItemResep)
+		if err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := pharmacy.CheckControlled(drugs, confidential.JenisTandaTangan, confidential.DoctorSignature(), confidential.SIPDokterPenulis); err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		// the id is given up front for the attachments to be linked to
+		id := primitive.NewObjectID()
+
+		lampiran, err := referAttachments(
+			pharmacyController.AttachmentCollection,
+			pharmacyrequest.Peresepan.NoIHS,
+			c.GetString("userClient"),
+			id,
+			confidential.LampiranTandaTangan,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		pharmacyrequest.Lampiran = lampiran
+
+		warnings, err := pharmacyController.screenItems(
+			drugs,
+			pharmacyrequest.Peresepan.NoIHS,
+			c.GetString("userClient"),
+			confidential.Allergies(),
+			primitive.NilObjectID,
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 
+		patient := dosingPatient(confidential.TanggalLahir, confidential.TinggiBadan, confidential.BeratBadan, &confidential.LuasPermukaanTubuhAnak, now)
+		warnings = append(warnings, dosing.CheckItems(drugs, confidential.ItemResep, patient)...)
+
+		pending := pharmacy.AcknowledgeWarnings(warnings, confidential.KonfirmasiPeringatan, c.GetString("userIdentification"), now)
+		if len(pending) > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{
+				"error":      pharmacy.UnacknowledgedWarningError.Error(),
+				"peringatan": pending,
+			})
+			return
+		}
+		confidential.ApplyScreening(warnings)
+
 		pharmacyrequest.CreatedAt = &now
 		pharmacyrequest.UpdatedAt = &now
 
@@ -147,6 +229,7 @@ func (pharmacyController *PharmacyController) CreatePharmacyRequest() gin.Handle
 
 		pharmacyrequest.Peresepan.NIKEncrypted = nikEncryptedField
 		pharmacyrequest.Peresepan.NIK = nil
+		pharmacyrequest.ID = primitive.NilObjectID
 
 		json, err := json.Marshal(pharmacyrequest)
 		if err != nil {
@@ -156,6 +239,7 @@ func (pharmacyController *PharmacyController) CreatePharmacyRequest() gin.Handle
 
 		signature := utils.GenerateSignature(string(json))
 		pharmacyrequest.Signature = &signature
+		pharmacyrequest.ID = id
 
 		resultPharmacyRequest, err := pharmacyController.FaskesCollection.InsertOne(context.Background(), pharmacyrequest)
 		if err != nil {
@@ -163,6 +247,8 @@ func (pharmacyController *PharmacyController) CreatePharmacyRequest() gin.Handle
 			return
 		}
 
+		linkAttachments(pharmacyController.AttachmentCollection, id, pharmacyrequest.Lampiran)
+
 		utils.JSON(c, http.StatusOK, resultPharmacyRequest.InsertedID.(primitive.ObjectID).Hex())
 	}
 }
@@ -187,8 +273,21 @@ func (pharmacyController *PharmacyController) GetAllPharmacyHandler() gin.Handle
 			filter["peresepan.id_pelanggan"] = idPelanggan
 		}
 
+		if idKunjungan := c.Query("id_kunjungan"); idKunjungan != "" {
+			encounterID, err := primitive.ObjectIDFromHex(idKunjungan)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": pharmacy.InvalidEncounterError.Error()})
+				return
+			}
+			filter["id_kunjungan"] = encounterID
+		}
+
+		conditions := bson.A{}
 		if idObat != "" {
-			filter["peresepan.id_obat"] = idObat
+			conditions = append(conditions, bson.M{"$or": bson.A{
+				bson.M{"peresepan.id_obat": idObat},
+				bson.M{"peresepan.daftar_id_obat": idObat},
+			}})
 		}
 
 		if nik != "" {
@@ -200,27 +299,54 @@ func (pharmacyController *PharmacyController) GetAllPharmacyHandler() gin.Handle
 		}
 
 		if !c.GetBool("patientConsent") {
-			filter["$or"] = bson.A{
+			conditions = append(conditions, bson.M{"$or": bson.A{
 				bson.M{"client_id": c.GetString("userClient")},
 				bson.M{"client_id": ""},
-			}
+			}})
+		}
+
+		if len(conditions) > 0 {
+			filter["$and"] = conditions
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := pharmacyController.FaskesCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		params.PageFilter(filter)
 
-		// Query all pharmacy data
-		cursor, err := pharmacyController.FaskesCollection.Find(context.Background(), filter)
+		// Query a page of pharmacy data
+		cursor, err := pharmacyController.FaskesCollection.Find(context.Background(), filter, params.FindOptions())
 		if err != nil {
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer cursor.Close(context.Background())
 
-		var pharmacyData []pharmacy.Pharmacy
+		pharmacyData := []pharmacy.Pharmacy{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
 		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
 			var data pharmacy.Pharmacy
 			if err := cursor.Decode(&data); err != nil {
 				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			last = data.ID
 
 			signature := data.Signature
 			id := data.ID
@@ -269,7 +395,7 @@ func (pharmacyController *PharmacyController) GetAllPharmacyHandler() gin.Handle
 			return
 		}
 
-		utils.JSON(c, http.StatusOK, pharmacyData)
+		utils.JSON(c, http.StatusOK, params.Page(pharmacyData, total, last, more))
 	}
 }
 
@@ -283,13 +409,56 @@ func (pharmacyController *PharmacyController) CreatePharmacyHandler() gin.Handle
 			return
 		}
 
+		if err := data.Peresepan.NormalizeItems(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		drugs, err := pharmacyController.resolveItems(data.Peresepan.ConfidentialData.ItemResep)
+		if err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		confidential := data.Peresepan.ConfidentialData
+		if err := pharmacy.CheckControlled(drugs, confidential.JenisTandaTangan, confidential.DoctorSignature(), confidential.SIPDokterPenulis); err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 
+		// out of range doses are kept for the pharmacist's review
+		applyDoseWarnings(confidential, drugs, now)
+
 		data.CreatedAt = &now
 		data.UpdatedAt = &now
 
 		data.ClientID = c.GetString("userClient")
 
+		// items handed over right away leave the stock under this prescription
+		id := primitive.NewObjectID()
+
+		lampiran, err := referAttachments(
+			pharmacyController.AttachmentCollection,
+			data.Peresepan.NoIHS,
+			data.ClientID,
+			id,
+			confidential.LampiranTandaTangan,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		data.Lampiran = lampiran
+
+		officer := c.GetString("userIdentification")
+		dispensed, err := pharmacyController.dispenseStock(data.ClientID, pharmacy.DispensedSince(nil, data.Peresepan.ConfidentialData.ItemResep), id.Hex(), officer)
+		if err != nil {
+			utils.JSON(c, stockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
 		dispensingEncryptedField := utils.EncryptRandom(
 			data.Dispensing,
 			pharmacyController.ClientEncryption,
@@ -325,14 +494,18 @@ func (pharmacyController *PharmacyController) CreatePharmacyHandler() gin.Handle
 
 		signature := utils.GenerateSignature(string(json))
 		data.Signature = &signature
+		data.ID = id
 
 		// Insert the new pharmacy data
 		_, err = pharmacyController.FaskesCollection.InsertOne(context.Background(), data)
 		if err != nil {
+			pharmacyController.returnStock(data.ClientID, dispensed, id.Hex(), officer)
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		linkAttachments(pharmacyController.AttachmentCollection, id, data.Lampiran)
+
 		// Return a success message
 		utils.JSON(c, http.StatusCreated, gin.H{"message": "Pharmacy data created successfully"})
 	}
@@ -360,20 +533,124 @@ func (pharmacyController *PharmacyController) UpdatePharmacyHandler() gin.Handle
 			return
 		}
 
+		previous, err := pharmacyController.findPrescription(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// once the pharmacy received the prescription it only moves through
+		// the workflow steps
+		if previous.Peresepan.ConfidentialData.Received() {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": pharmacy.ReceivedError.Error()})
+			return
+		}
+
+		if err := previous.Peresepan.NormalizeItems(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := newData.Peresepan.NormalizeItems(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the workflow fields are only written by the workflow steps
+		newData.Peresepan.ConfidentialData.KeepWorkflow(previous.Peresepan.ConfidentialData)
+
+		drugs, err := pharmacyController.resolveItems(newData.Peresepan.ConfidentialData.ItemResep)
+		if err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		confidential := newData.Peresepan.ConfidentialData
+		if err := pharmacy.CheckControlled(drugs, confidential.JenisTandaTangan, confidential.DoctorSignature(), confidential.SIPDokterPenulis); err != nil {
+			utils.JSON(c, prescriptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
 		if newData.CreatedAt == nil {
 			utils.AbortWithStatusJSON(c, http.StatusBadRequest, gin.H{"error": "require created_at data"})
 			return
 		}
 
+		lampiran, err := referAttachments(
+			pharmacyController.AttachmentCollection,
+			noIHS,
+			c.GetString("userClient"),
+			id,
+			confidential.LampiranTandaTangan,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		newData.Lampiran = lampiran
+
+		// what the prescriber signed stays as it was signed
+		if previous.TandaTanganDigital != nil {
+			content := newData.SignedContent()
+			content.ID = id.Hex()
+
+			digest, err := signing.Digest(content)
+			if err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if digest != previous.TandaTanganDigital.Digest {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": pharmacy.SignedContentChangedError.Error()})
+				return
+			}
+		}
+		newData.TandaTanganDigital = previous.TandaTanganDigital
+		newData.IDKunjungan = previous.IDKunjungan
+
 		// Define a filter to find the document by idResep
+		// and require the version the update was made against
 		filter := bson.M{
 			"_id":              id,
 			"peresepan.no_ihs": noIHS,
+			"updated_at":       previous.UpdatedAt,
+		}
+
+		// the prescription is screened again without comparing it to itself,
+		// warnings acknowledged before stay acknowledged
+		warnings, err := pharmacyController.screenItems(
+			drugs,
+			noIHS,
+			c.GetString("userClient"),
+			confidential.Allergies(),
+			id,
+		)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 		newData.UpdatedAt = &now
 
+		patient := dosingPatient(confidential.TanggalLahir, confidential.TinggiBadan, confidential.BeratBadan, &confidential.LuasPermukaanTubuhAnak, now)
+		warnings = append(warnings, dosing.CheckItems(drugs, confidential.ItemResep, patient)...)
+		warnings = pharmacy.MergeWarnings(previous.Peresepan.ConfidentialData.PeringatanKlinis, warnings)
+
+		pending := pharmacy.AcknowledgeWarnings(warnings, confidential.KonfirmasiPeringatan, c.GetString("userIdentification"), now)
+		if len(pending) > 0 {
+			utils.JSON(c, http.StatusConflict, gin.H{
+				"error":      pharmacy.UnacknowledgedWarningError.Error(),
+				"peringatan": pending,
+			})
+			return
+		}
+		confidential.ApplyScreening(warnings)
+
 		dispensingEncryptedField := utils.EncryptRandom(
 			newData.Dispensing,
 			pharmacyController.ClientEncryption,
@@ -413,6 +690,10 @@ func (pharmacyController *PharmacyController) UpdatePharmacyHandler() gin.Handle
 
 		// Create an update document
 		update := bson.M{"$set": newData}
+		if len(newData.Lampiran) == 0 {
+			// attachments dropped from the document leave its signature too
+			update["$unset"] = bson.M{"lampiran": ""}
+		}
 
 		// Update the document in the collection
 		result, err := pharmacyController.FaskesCollection.UpdateOne(context.Background(), filter, update)
@@ -422,10 +703,12 @@ func (pharmacyController *PharmacyController) UpdatePharmacyHandler() gin.Handle
 		}
 
 		if result.MatchedCount == 0 {
-			utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "prescription was modified by another request"})
 			return
 		}
 
+		linkAttachments(pharmacyController.AttachmentCollection, id, newData.Lampiran)
+
 		// Return a success message
 		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d pharmacy data updated successfully", result.ModifiedCount)})
 	}
@@ -0,0 +1,181 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/datastruct/user"
+	"service-pharmacy/logger"
+	"service-pharmacy/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// findPrescription loads a prescription with its confidential data
+// decrypted. The dispensing and NIK stay encrypted.
+func (pharmacyController *PharmacyController) findPrescription(c *gin.Context) (*pharmacy.Pharmacy, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("Id"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":              id,
+		"peresepan.no_ihs": c.Param("noIHS"),
+	}
+
+	var data pharmacy.Pharmacy
+	if err := pharmacyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	signature := data.Signature
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	if err != nil {
+		logger.LogPanic.Panicf("Failed to marshal json data")
+	}
+
+	if signature == nil {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+	} else if _, err = utils.VerifySignature(string(dataByte), *signature); err != nil {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+	}
+
+	utils.Decrypt(
+		data.Peresepan.ConfidentialEncrypted,
+		pharmacyController.ClientEncryption,
+	).Unmarshal(&data.Peresepan.ConfidentialData)
+
+	data.Signature = signature
+	data.ID = id
+
+	return &data, nil
+}
+
+// sealPrescription encrypts the confidential data again and signs the
+// prescription the same way it was signed on creation.
+func (pharmacyController *PharmacyController) sealPrescription(data *pharmacy.Pharmacy) error {
+	data.Peresepan.ConfidentialEncrypted = utils.EncryptRandom(
+		data.Peresepan.ConfidentialData,
+		pharmacyController.ClientEncryption,
+		pharmacyController.EncryptionOpts,
+	)
+	data.Peresepan.ConfidentialData = nil
+
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(dataByte))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// updatePrescription writes a sealed prescription back, failing when it was
+// changed since it was read.
+func (pharmacyController *PharmacyController) updatePrescription(data *pharmacy.Pharmacy, previousUpdate *time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":        data.ID,
+		"updated_at": previousUpdate,
+	}
+
+	id := data.ID
+	data.ID = primitive.NilObjectID
+	result, err := pharmacyController.FaskesCollection.UpdateOne(context.Background(), filter, bson.M{"$set": data})
+	data.ID = id
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// ReviewPrescriptionItemHandler records the pharmacist's review of a single
+// item of a prescription.
+func (pharmacyController *PharmacyController) ReviewPrescriptionItemHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		var assessment pharmacy.RecipeAssessment
+		if err := c.ShouldBindJSON(&assessment); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := pharmacyController.findPrescription(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// prescriptions written before line items get theirs on first review
+		if err := data.Peresepan.NormalizeItems(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := pharmacy.FindItem(data.Peresepan.ConfidentialData.ItemResep, c.Param("idItem"))
+		if err != nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		item.PengkajianResep = &assessment
+		item.Pengkaji = c.GetString("userIdentification")
+		item.WaktuPengkajian = &now
+		reviewed := *item
+
+		drugs, err := pharmacyController.itemDrugs(data.Peresepan.ConfidentialData.ItemResep)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		applyDoseWarnings(data.Peresepan.ConfidentialData, drugs, now)
+
+		previousUpdate := data.UpdatedAt
+		data.UpdatedAt = &now
+
+		if err := pharmacyController.sealPrescription(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := pharmacyController.updatePrescription(data, previousUpdate)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !updated {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "prescription was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, reviewed)
+	}
+}
@@ -0,0 +1,393 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-pharmacy/config"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/datastruct/user"
+	"service-pharmacy/document"
+	"service-pharmacy/logger"
+	"service-pharmacy/signing"
+	"service-pharmacy/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const prescriptionTitle = "Resep Elektronik"
+
+// verifiedPrescription tells whether the stored document still carries a
+// valid signature.
+func verifiedPrescription(data *pharmacy.Pharmacy) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// prescriptionRow writes an item the way it is read on a paper prescription,
+// e.g. "500 mg, 3 x sehari selama 5 hari".
+func prescriptionRow(number int, item *pharmacy.PrescriptionItem) []string {
+	name := item.NamaObat
+	if item.Bentuk != "" {
+		name = fmt.Sprintf("%s (%s)", item.NamaObat, item.Bentuk)
+	}
+
+	rules := []string{}
+	if item.Dosis != 0 {
+		rules = append(rules, strings.TrimSpace(strconv.FormatFloat(item.Dosis, 'f', -1, 64)+" "+item.SatuanDosis))
+	}
+	if item.FrekuensiPerHari != 0 {
+		frequency := fmt.Sprintf("%d x sehari", item.FrekuensiPerHari)
+		if item.DurasiHari != 0 {
+			frequency = fmt.Sprintf("%s selama %d hari", frequency, item.DurasiHari)
+		}
+		rules = append(rules, frequency)
+	}
+	if item.RutePemberian != "" {
+		rules = append(rules, item.RutePemberian)
+	}
+	if item.AturanTambahan != "" {
+		rules = append(rules, item.AturanTambahan)
+	}
+
+	return []string{
+		strconv.Itoa(number),
+		name,
+		strings.Join(rules, ", "),
+		strconv.FormatUint(uint64(item.JumlahObat), 10),
+		item.StatusString(),
+	}
+}
+
+// renderPrescription lays the prescription out as it would be written on
+// paper, with the prescriber signing it.
+func renderPrescription(letterhead document.Letterhead, data *pharmacy.Pharmacy, now time.Time) (*document.Document, error) {
+	confidential := data.Peresepan.ConfidentialData
+
+	pdf := document.New(letterhead, prescriptionTitle, data.ID.Hex(), now)
+
+	pdf.Section("Identitas Pasien")
+	pdf.Field("Nama pasien", confidential.NamaLengkap)
+	pdf.Field("No. rekam medis", data.Peresepan.NoRekamMedis)
+	pdf.Field("No. IHS", data.Peresepan.NoIHS)
+	pdf.Field("Tanggal lahir", document.FormatDate(confidential.TanggalLahir))
+	pdf.Field("Tinggi / berat badan", fmt.Sprintf("%d cm / %d kg", confidential.TinggiBadan, confidential.BeratBadan))
+	pdf.Field("Alergi", strings.Join(confidential.Allergies(), ", "))
+
+	pdf.Section("Penulis Resep")
+	pdf.Field("Dokter", confidential.DokterPenulis)
+	pdf.Field("SIP", confidential.SIPDokterPenulis)
+	pdf.Field("Fasyankes pengirim", confidential.NamaFasyankesPengirim)
+	pdf.Field("Unit pengirim", confidential.UnitPengirim)
+	pdf.Field("Waktu penulisan", document.FormatTime(confidential.WaktuPenulisan))
+
+	items := confidential.ItemResep
+	if len(items) == 0 && confidential.NamaObat != "" {
+		howToUse := pharmacy.HowToUse{}
+		if confidential.AturanPakai != nil {
+			howToUse = *confidential.AturanPakai
+		}
+		items = []pharmacy.PrescriptionItem{
+			pharmacy.LegacyItem(data.Peresepan.IDObat, confidential.NamaObat, confidential.Bentuk, confidential.JumlahObat, howToUse),
+		}
+	}
+
+	rows := [][]string{}
+	for i := 0; i < len(items); i++ {
+		rows = append(rows, prescriptionRow(i+1, &items[i]))
+	}
+
+	pdf.Section("Obat")
+	pdf.Table([]document.Column{
+		{Judul: "No.", Lebar: 10},
+		{Judul: "Nama obat", Lebar: 55},
+		{Judul: "Aturan pakai", Lebar: 65},
+		{Judul: "Jumlah", Lebar: 18},
+		{Judul: "Status", Lebar: 32},
+	}, rows)
+	pdf.Field("Catatan resep", confidential.CatatanResep)
+	pdf.Field("Status resep", data.Peresepan.StatusString())
+
+	signedAt := confidential.WaktuPenulisan
+	if signature := data.TandaTanganDigital; signature != nil {
+		printDigitalSignature(pdf, signature)
+		signedAt = signature.Waktu
+	}
+
+	if err := pdf.Sign(
+		"Dokter Penulis Resep",
+		confidential.DokterPenulis,
+		signedAt,
+		document.VerificationURL(config.DocumentVerifyURL, data.ID.Hex(), *data.Signature),
+	); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
+
+// PrescriptionHandler prints a prescription. Documents failing their
+// signature are not printed, as the printout would claim a signature the
+// document no longer has.
+func (pharmacyController *PharmacyController) PrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		objID, err := primitive.ObjectIDFromHex(c.Param("Id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":              objID,
+			"peresepan.no_ihs": c.Param("noIHS"),
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		var data pharmacy.Pharmacy
+		err = pharmacyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verifiedPrescription(&data) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+			utils.JSON(c, http.StatusConflict, gin.H{"error": documentTamperedError.Error()})
+			return
+		}
+
+		utils.Decrypt(
+			data.Peresepan.ConfidentialEncrypted,
+			pharmacyController.ClientEncryption,
+		).Unmarshal(&data.Peresepan.ConfidentialData)
+
+		pdf, err := renderPrescription(pharmacyController.Letterhead, &data, time.Now())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sendPDF(c, pdf, fmt.Sprintf("resep-%s", objID.Hex()))
+	}
+}
+
+// VerifyPrescriptionHandler tells the holder of a printed prescription
+// whether it is genuine and still the document on record.
+func (pharmacyController *PharmacyController) VerifyPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint := c.Query("fingerprint")
+		if fingerprint == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fingerprintRequiredError.Error()})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var data pharmacy.Pharmacy
+		err = pharmacyController.FaskesCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&data)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		valid := verifiedPrescription(&data)
+		if !valid {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		}
+
+		utils.JSON(c, http.StatusOK, document.NewVerification(
+			objID.Hex(),
+			prescriptionTitle,
+			pharmacyController.Letterhead.Nama,
+			document.Check(data.Signature, valid, fingerprint),
+			data.UpdatedAt,
+		))
+	}
+}
+
+// findSignedPrescription loads a prescription whose signature still holds,
+// with its confidential data decrypted and its items normalized. It answers
+// the request itself when it cannot.
+func (pharmacyController *PharmacyController) findSignedPrescription(c *gin.Context, tampered error) (*pharmacy.Pharmacy, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("Id"))
+	if err != nil {
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	filter := bson.M{
+		"_id":              objID,
+		"peresepan.no_ihs": c.Param("noIHS"),
+	}
+	if !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var data pharmacy.Pharmacy
+	err = pharmacyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !verifiedPrescription(&data) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		utils.JSON(c, http.StatusConflict, gin.H{"error": tampered.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		data.Peresepan.ConfidentialEncrypted,
+		pharmacyController.ClientEncryption,
+	).Unmarshal(&data.Peresepan.ConfidentialData)
+
+	if err := data.Peresepan.NormalizeItems(); err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return &data, true
+}
+
+// SignPrescriptionHandler signs the prescription with the key of the doctor
+// who wrote it, who confirms with their password. Only the digest of the
+// prescription is sent to the auth service.
+func (pharmacyController *PharmacyController) SignPrescriptionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body pharmacy.SignBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		data, ok := pharmacyController.findSignedPrescription(c, signTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": alreadySignedError.Error()})
+			return
+		}
+
+		err := data.CanBeSignedBy(c.GetString("userIdentification"))
+		if errors.Is(err, pharmacy.NotPrescriberError) {
+			utils.JSON(c, http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		digest, err := signing.Digest(data.SignedContent())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		signature, err := pharmacyController.Signing.Sign(context.Background(), c.GetHeader("Authorization"), body.Password, digest)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		previousUpdate := data.UpdatedAt
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		data.TandaTanganDigital = signature
+		data.UpdatedAt = &now
+
+		if err := pharmacyController.sealPrescription(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := pharmacyController.updatePrescription(data, previousUpdate)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !updated {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": "prescription was modified by another request"})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, signature)
+	}
+}
+
+// PrescriptionSignatureHandler shows who signed the prescription and whether
+// the signature still holds for the prescription on record.
+func (pharmacyController *PharmacyController) PrescriptionSignatureHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, ok := pharmacyController.findSignedPrescription(c, checkTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": notSignedError.Error()})
+			return
+		}
+
+		check, err := pharmacyController.Signing.Check(
+			context.Background(),
+			c.GetHeader("Authorization"),
+			data.TandaTanganDigital,
+			data.SignedContent(),
+		)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, check)
+	}
+}
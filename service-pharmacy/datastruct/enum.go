@@ -3,10 +3,25 @@ package datastruct
 type RecipeStatus uint8
 type RoleType string
 type PatientConsent bool
+type WarningType uint8
+type WarningSeverity uint8
+type StockMovementType uint8
+type DrugSchedule uint8
+type SignatureType uint8
+type DoseBasis uint8
+type VerificationStatus uint8
 
+// PENDING and SUDAH_DIBERIKAN keep their values so stored prescriptions
+// still read the same.
 const (
 	PENDING RecipeStatus = iota
 	SUDAH_DIBERIKAN
+	DITERIMA
+	DIKAJI
+	DISIAPKAN
+	DIBERIKAN_SEBAGIAN
+	DISERAHKAN
+	DITOLAK
 )
 
 const (
@@ -20,3 +35,48 @@ const (
 	OPTIN  PatientConsent = true
 	OPTOUT PatientConsent = false
 )
+
+const (
+	PERINGATAN_DUPLIKASI WarningType = iota + 1
+	PERINGATAN_INTERAKSI
+	PERINGATAN_ALERGI
+	PERINGATAN_DOSIS
+)
+
+const (
+	TINGKAT_RINGAN WarningSeverity = iota + 1
+	TINGKAT_SEDANG
+	TINGKAT_BERAT
+)
+
+const (
+	PENERIMAAN StockMovementType = iota + 1
+	PENGELUARAN
+	PENYESUAIAN
+	STOK_OPNAME
+)
+
+// OBAT_UMUM is zero so drugs entered before scheduling are not controlled.
+const (
+	OBAT_UMUM DrugSchedule = iota
+	NARKOTIKA
+	PSIKOTROPIKA
+	PREKURSOR
+)
+
+const (
+	TTD_BASAH SignatureType = iota + 1
+	TTD_ELEKTRONIK
+)
+
+const (
+	DOSIS_TETAP DoseBasis = iota + 1
+	DOSIS_PER_KG
+	DOSIS_PER_M2
+)
+
+const (
+	DOKUMEN_ASLI VerificationStatus = iota + 1
+	DOKUMEN_DIPERBARUI
+	DOKUMEN_TIDAK_VALID
+)
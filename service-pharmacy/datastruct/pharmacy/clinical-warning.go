@@ -0,0 +1,199 @@
+package pharmacy
+
+import (
+	"errors"
+	"service-pharmacy/datastruct"
+	"strings"
+	"time"
+)
+
+var (
+	UnacknowledgedWarningError = errors.New("prescription has clinical warnings that must be acknowledged")
+)
+
+// ClinicalWarning is raised when a prescription is screened against the
+// patient's active prescriptions, allergies and the interaction knowledge
+// base. Kode identifies the warning so it can be acknowledged on resubmit.
+type ClinicalWarning struct {
+	Kode          string                     `json:"kode" bson:"kode"`
+	IDObat        string                     `json:"id_obat" bson:"id_obat"`
+	Jenis         datastruct.WarningType     `json:"jenis" bson:"jenis"`
+	Tingkat       datastruct.WarningSeverity `json:"tingkat" bson:"tingkat"`
+	IDObatTerkait string                     `json:"id_obat_terkait" bson:"id_obat_terkait"`
+	Deskripsi     string                     `json:"deskripsi" bson:"deskripsi"`
+	Rekomendasi   string                     `json:"rekomendasi" bson:"rekomendasi"`
+
+	Dikonfirmasi     bool       `json:"dikonfirmasi" bson:"dikonfirmasi"`
+	AlasanOverride   string     `json:"alasan_override" bson:"alasan_override"`
+	DikonfirmasiOleh string     `json:"dikonfirmasi_oleh" bson:"dikonfirmasi_oleh"`
+	WaktuKonfirmasi  *time.Time `json:"waktu_konfirmasi" bson:"waktu_konfirmasi,omitempty"`
+}
+
+// WarningAcknowledgement is sent by the prescriber for every warning. Severe
+// warnings can only be overridden with a reason.
+type WarningAcknowledgement struct {
+	Kode   string `json:"kode" binding:"required" bson:"kode"`
+	Alasan string `json:"alasan" bson:"alasan"`
+}
+
+type PrescriptionCheckBody struct {
+	NoIHS        string   `json:"no_ihs" binding:"required"`
+	DaftarIDObat []string `json:"daftar_id_obat" binding:"required,min=1"`
+	DaftarAlergi []string `json:"daftar_alergi"`
+
+	// the prescription being replaced, so it is not compared with itself
+	KecualikanID string `json:"kecualikan_id"`
+}
+
+// DoseCalculationBody asks for the dose range of a drug for a patient. The
+// dose written on a prescription is checked against it when given.
+type DoseCalculationBody struct {
+	IDObat             string    `json:"id_obat" binding:"required"`
+	TanggalLahir       time.Time `json:"tanggal_lahir" binding:"required"`
+	BeratBadan         float64   `json:"berat_badan"`
+	TinggiBadan        float64   `json:"tinggi_badan"`
+	LuasPermukaanTubuh float64   `json:"luas_permukaan_tubuh"`
+
+	Dosis            float64 `json:"dosis"`
+	SatuanDosis      string  `json:"satuan_dosis"`
+	FrekuensiPerHari uint    `json:"frekuensi_per_hari"`
+}
+
+func (warning *ClinicalWarning) TypeString() string {
+	switch warning.Jenis {
+	case datastruct.PERINGATAN_DUPLIKASI:
+		return "Duplikasi pengobatan"
+	case datastruct.PERINGATAN_INTERAKSI:
+		return "Interaksi obat"
+	case datastruct.PERINGATAN_ALERGI:
+		return "Alergi"
+	case datastruct.PERINGATAN_DOSIS:
+		return "Dosis"
+	default:
+		return ""
+	}
+}
+
+func (warning *ClinicalWarning) SeverityString() string {
+	switch warning.Tingkat {
+	case datastruct.TINGKAT_RINGAN:
+		return "Ringan"
+	case datastruct.TINGKAT_SEDANG:
+		return "Sedang"
+	case datastruct.TINGKAT_BERAT:
+		return "Berat"
+	default:
+		return ""
+	}
+}
+
+// AcknowledgeWarnings marks the warnings the prescriber responded to and
+// returns those still left open. Warnings acknowledged before stay as they
+// are.
+func AcknowledgeWarnings(warnings []ClinicalWarning, acks []WarningAcknowledgement, by string, now time.Time) []ClinicalWarning {
+	reasons := map[string]string{}
+	for i := 0; i < len(acks); i++ {
+		reasons[acks[i].Kode] = strings.TrimSpace(acks[i].Alasan)
+	}
+
+	pending := []ClinicalWarning{}
+	for i := 0; i < len(warnings); i++ {
+		warning := &warnings[i]
+		if warning.Dikonfirmasi {
+			continue
+		}
+
+		reason, ok := reasons[warning.Kode]
+		if !ok || (warning.Tingkat == datastruct.TINGKAT_BERAT && reason == "") {
+			pending = append(pending, *warning)
+			continue
+		}
+
+		warning.Dikonfirmasi = true
+		warning.AlasanOverride = reason
+		warning.DikonfirmasiOleh = by
+		warning.WaktuKonfirmasi = &now
+	}
+
+	return pending
+}
+
+// Summarize lists the descriptions of warnings of one type, used to fill in
+// the clinical review before the pharmacist sees the prescription.
+func Summarize(warnings []ClinicalWarning, warningType datastruct.WarningType) string {
+	descriptions := []string{}
+	for i := 0; i < len(warnings); i++ {
+		if warnings[i].Jenis == warningType {
+			descriptions = append(descriptions, warnings[i].Deskripsi)
+		}
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+func WarningsOf(warnings []ClinicalWarning, warningType datastruct.WarningType) []ClinicalWarning {
+	found := []ClinicalWarning{}
+	for i := 0; i < len(warnings); i++ {
+		if warnings[i].Jenis == warningType {
+			found = append(found, warnings[i])
+		}
+	}
+
+	return found
+}
+
+// ReplaceWarnings swaps the warnings of one type for a fresh screening. A
+// warning raised again keeps its acknowledgement.
+func ReplaceWarnings(existing []ClinicalWarning, warningType datastruct.WarningType, fresh []ClinicalWarning) []ClinicalWarning {
+	acknowledged := map[string]ClinicalWarning{}
+	warnings := []ClinicalWarning{}
+	for i := 0; i < len(existing); i++ {
+		if existing[i].Jenis != warningType {
+			warnings = append(warnings, existing[i])
+			continue
+		}
+
+		if existing[i].Dikonfirmasi {
+			acknowledged[existing[i].Kode] = existing[i]
+		}
+	}
+
+	for i := 0; i < len(fresh); i++ {
+		warning := fresh[i]
+		if previous, ok := acknowledged[warning.Kode]; ok {
+			warning.Dikonfirmasi = true
+			warning.AlasanOverride = previous.AlasanOverride
+			warning.DikonfirmasiOleh = previous.DikonfirmasiOleh
+			warning.WaktuKonfirmasi = previous.WaktuKonfirmasi
+		}
+		warnings = append(warnings, warning)
+	}
+
+	return warnings
+}
+
+// MergeWarnings screens a prescription again on top of its stored warnings.
+// A warning raised again keeps its acknowledgement, so only new warnings
+// have to be acknowledged.
+func MergeWarnings(stored, fresh []ClinicalWarning) []ClinicalWarning {
+	acknowledged := map[string]ClinicalWarning{}
+	for i := 0; i < len(stored); i++ {
+		if stored[i].Dikonfirmasi {
+			acknowledged[stored[i].Kode] = stored[i]
+		}
+	}
+
+	warnings := []ClinicalWarning{}
+	for i := 0; i < len(fresh); i++ {
+		warning := fresh[i]
+		if previous, ok := acknowledged[warning.Kode]; ok {
+			warning.Dikonfirmasi = true
+			warning.AlasanOverride = previous.AlasanOverride
+			warning.DikonfirmasiOleh = previous.DikonfirmasiOleh
+			warning.WaktuKonfirmasi = previous.WaktuKonfirmasi
+		}
+		warnings = append(warnings, warning)
+	}
+
+	return warnings
+}
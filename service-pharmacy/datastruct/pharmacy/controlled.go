@@ -0,0 +1,220 @@
+package pharmacy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"service-pharmacy/datastruct"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ControlledSignatureRequiredError = errors.New("prescriptions of narcotics and psychotropics must state jenis_tanda_tangan")
+	ControlledSignatureMissingError  = errors.New("prescriptions of narcotics and psychotropics must be signed by the prescriber")
+	ControlledLicenseRequiredError   = errors.New("prescriptions of narcotics and psychotropics must carry the prescriber's sip")
+	InvalidReportPeriodError         = errors.New("periode must be written as YYYY-MM")
+)
+
+// ControlledRegisterEntry is an entry of the register of narcotics and
+// psychotropics. Every entry holds the hash of the one before it, so a
+// changed or removed entry breaks the chain from there on.
+type ControlledRegisterEntry struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID  string  `json:"client_id" bson:"client_id"`
+	Signature *string `json:"signature" bson:"signature"`
+
+	Urutan uint64 `json:"urutan" bson:"urutan"`
+
+	IDObat      string                  `json:"id_obat" bson:"id_obat"`
+	NamaObat    string                  `json:"nama_obat" bson:"nama_obat"`
+	Golongan    datastruct.DrugSchedule `json:"golongan" bson:"golongan"`
+	SubGolongan string                  `json:"sub_golongan" bson:"sub_golongan"`
+	Satuan      string                  `json:"satuan" bson:"satuan"`
+
+	NoBatch    string                       `json:"no_batch" bson:"no_batch"`
+	Jenis      datastruct.StockMovementType `json:"jenis" bson:"jenis"`
+	Jumlah     int                          `json:"jumlah" bson:"jumlah"`
+	SaldoBatch uint                         `json:"saldo_batch" bson:"saldo_batch"`
+	Saldo      uint                         `json:"saldo" bson:"saldo"`
+	Referensi  string                       `json:"referensi" bson:"referensi"`
+	Keterangan string                       `json:"keterangan" bson:"keterangan"`
+	Petugas    string                       `json:"petugas" bson:"petugas"`
+	Waktu      time.Time                    `json:"waktu" bson:"waktu"`
+
+	HashSebelumnya string `json:"hash_sebelumnya" bson:"hash_sebelumnya"`
+	Hash           string `json:"hash" bson:"hash"`
+}
+
+type RegisterBreak struct {
+	Urutan uint64 `json:"urutan"`
+	Alasan string `json:"alasan"`
+}
+
+type RegisterVerification struct {
+	Utuh        bool            `json:"utuh"`
+	JumlahEntri int             `json:"jumlah_entri"`
+	Kerusakan   []RegisterBreak `json:"kerusakan"`
+}
+
+// ControlledReportLine is a row of the monthly report, following the
+// columns of the SIPNAP upload.
+type ControlledReportLine struct {
+	KodeObat    string `json:"kode_obat" bson:"_id"`
+	NamaObat    string `json:"nama_obat" bson:"nama_obat"`
+	Golongan    string `json:"golongan" bson:"-"`
+	SubGolongan string `json:"sub_golongan" bson:"sub_golongan"`
+	Satuan      string `json:"satuan" bson:"satuan"`
+
+	StokAwal    uint `json:"stok_awal" bson:"saldo"`
+	Pemasukan   uint `json:"pemasukan" bson:"-"`
+	Pengeluaran uint `json:"pengeluaran" bson:"-"`
+	Penyesuaian int  `json:"penyesuaian" bson:"-"`
+	StokAkhir   uint `json:"stok_akhir" bson:"-"`
+
+	JenisGolongan datastruct.DrugSchedule `json:"-" bson:"golongan"`
+}
+
+type ControlledReport struct {
+	Periode    string                 `json:"periode"`
+	ClientID   string                 `json:"client_id"`
+	DibuatPada time.Time              `json:"dibuat_pada"`
+	Item       []ControlledReportLine `json:"item"`
+}
+
+// CheckControlled makes sure prescriptions of controlled drugs are signed
+// and carry the prescriber's license.
+func CheckControlled(drugs []*Drug, signatureType datastruct.SignatureType, signature, license string) error {
+	for i := 0; i < len(drugs); i++ {
+		if !drugs[i].Controlled() {
+			continue
+		}
+
+		if signatureType != datastruct.TTD_BASAH && signatureType != datastruct.TTD_ELEKTRONIK {
+			return fmt.Errorf("%s: %w", drugs[i].IDObat, ControlledSignatureRequiredError)
+		}
+		if strings.TrimSpace(signature) == "" {
+			return fmt.Errorf("%s: %w", drugs[i].IDObat, ControlledSignatureMissingError)
+		}
+		if strings.TrimSpace(license) == "" {
+			return fmt.Errorf("%s: %w", drugs[i].IDObat, ControlledLicenseRequiredError)
+		}
+	}
+
+	return nil
+}
+
+// ComputeHash chains the entry to the one before it. The hash covers every
+// field but the hash and the signature.
+func (entry *ControlledRegisterEntry) ComputeHash() (string, error) {
+	content := *entry
+	content.ID = primitive.NilObjectID
+	content.Signature = nil
+	content.Hash = ""
+	content.Waktu = content.Waktu.UTC()
+
+	dataByte, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(entry.HashSebelumnya), dataByte...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainEntries turns the stock movements of a controlled drug into register
+// entries following last, each holding the hash of the one before it. The
+// entries are not signed yet.
+func ChainEntries(last ControlledRegisterEntry, drug *Drug, satuan string, movements []StockMovement) ([]ControlledRegisterEntry, error) {
+	entries := []ControlledRegisterEntry{}
+	for i := 0; i < len(movements); i++ {
+		entry := ControlledRegisterEntry{
+			ClientID:       movements[i].ClientID,
+			Urutan:         last.Urutan + 1,
+			IDObat:         drug.IDObat,
+			NamaObat:       drug.Name(),
+			Golongan:       drug.Golongan,
+			SubGolongan:    drug.SubGolongan,
+			Satuan:         satuan,
+			NoBatch:        movements[i].NoBatch,
+			Jenis:          movements[i].Jenis,
+			Jumlah:         movements[i].Jumlah,
+			SaldoBatch:     movements[i].SaldoBatch,
+			Saldo:          movements[i].SaldoTotal,
+			Referensi:      movements[i].Referensi,
+			Keterangan:     movements[i].Keterangan,
+			Petugas:        movements[i].Petugas,
+			Waktu:          movements[i].Waktu.UTC(),
+			HashSebelumnya: last.Hash,
+		}
+
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			return nil, err
+		}
+		entry.Hash = hash
+
+		entries = append(entries, entry)
+		last = entry
+	}
+
+	return entries, nil
+}
+
+// ParseReportPeriod returns the first moment of the month and of the month
+// after it.
+func ParseReportPeriod(period string, location *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", period, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidReportPeriodError
+	}
+
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// Apply adds a register entry of the period to the line.
+func (line *ControlledReportLine) Apply(entry *ControlledRegisterEntry) {
+	switch entry.Jenis {
+	case datastruct.PENERIMAAN:
+		line.Pemasukan += uint(entry.Jumlah)
+	case datastruct.PENGELUARAN:
+		line.Pengeluaran += uint(-entry.Jumlah)
+	default:
+		line.Penyesuaian += entry.Jumlah
+	}
+
+	line.StokAkhir = entry.Saldo
+}
+
+// Records lays the report out as CSV rows with a header.
+func (report *ControlledReport) Records() [][]string {
+	records := [][]string{{
+		"periode", "kode_obat", "nama_obat", "golongan", "sub_golongan", "satuan",
+		"stok_awal", "pemasukan", "pengeluaran", "penyesuaian", "stok_akhir",
+	}}
+
+	for i := 0; i < len(report.Item); i++ {
+		line := report.Item[i]
+		records = append(records, []string{
+			report.Periode,
+			line.KodeObat,
+			line.NamaObat,
+			line.Golongan,
+			line.SubGolongan,
+			line.Satuan,
+			strconv.FormatUint(uint64(line.StokAwal), 10),
+			strconv.FormatUint(uint64(line.Pemasukan), 10),
+			strconv.FormatUint(uint64(line.Pengeluaran), 10),
+			strconv.Itoa(line.Penyesuaian),
+			strconv.FormatUint(uint64(line.StokAkhir), 10),
+		})
+	}
+
+	return records
+}
@@ -0,0 +1,97 @@
+package pharmacy
+
+import (
+	"service-pharmacy/datastruct"
+	"testing"
+	"time"
+)
+
+func controlledMovements() []StockMovement {
+	at := time.Date(2024, time.March, 1, 9, 30, 0, 0, time.FixedZone("WIB", 7*60*60))
+
+	return []StockMovement{
+		{ClientID: "faskes-1", NoBatch: "M-01", Jenis: datastruct.PENERIMAAN, Jumlah: 20, SaldoBatch: 20, SaldoTotal: 30, Referensi: "GR-1", Petugas: "apoteker", Waktu: at},
+		{ClientID: "faskes-1", NoBatch: "M-02", Jenis: datastruct.PENGELUARAN, Jumlah: -4, SaldoBatch: 6, SaldoTotal: 26, Referensi: "RX-1", Petugas: "apoteker", Waktu: at},
+		{ClientID: "faskes-1", NoBatch: "M-01", Jenis: datastruct.PENYESUAIAN, Jumlah: -1, SaldoBatch: 19, SaldoTotal: 25, Referensi: "ADJ-1", Petugas: "apoteker", Waktu: at},
+	}
+}
+
+// verifyChain recomputes every hash of the register the way the register
+// check does and returns the position of the first broken entry, or zero.
+func verifyChain(t *testing.T, previous ControlledRegisterEntry, entries []ControlledRegisterEntry) uint64 {
+	t.Helper()
+
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			t.Fatalf("ComputeHash: %v", err)
+		}
+
+		if entry.Urutan != previous.Urutan+1 || entry.HashSebelumnya != previous.Hash || entry.Hash != hash {
+			return entry.Urutan
+		}
+
+		previous = entry
+	}
+
+	return 0
+}
+
+func TestChainEntries(t *testing.T) {
+	drug := &Drug{IDObat: "NRK-01", NamaGenerik: "Morfin", Kekuatan: 10, SatuanKekuatan: "mg", Golongan: datastruct.NARKOTIKA, SubGolongan: "II"}
+	last := ControlledRegisterEntry{Urutan: 7, Hash: "c0ffee"}
+
+	entries, err := ChainEntries(last, drug, "ampul", controlledMovements())
+	if err != nil {
+		t.Fatalf("ChainEntries: %v", err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if entries[0].Urutan != 8 || entries[2].Urutan != 10 {
+		t.Errorf("entries numbered %d to %d, want 8 to 10", entries[0].Urutan, entries[2].Urutan)
+	}
+	if entries[0].HashSebelumnya != last.Hash {
+		t.Errorf("first entry follows %q, want %q", entries[0].HashSebelumnya, last.Hash)
+	}
+	if entries[1].NamaObat != "Morfin 10 mg" || entries[1].Saldo != 26 {
+		t.Errorf("entry = %+v, want the drug name and the balance of the movement", entries[1])
+	}
+
+	if broken := verifyChain(t, last, entries); broken != 0 {
+		t.Fatalf("chain breaks at %d, want it intact", broken)
+	}
+}
+
+func TestChainEntriesTampered(t *testing.T) {
+	drug := &Drug{IDObat: "PSI-01", NamaGenerik: "Diazepam", Golongan: datastruct.PSIKOTROPIKA}
+	last := ControlledRegisterEntry{}
+
+	entries, err := ChainEntries(last, drug, "tablet", controlledMovements())
+	if err != nil {
+		t.Fatalf("ChainEntries: %v", err)
+	}
+
+	// a changed quantity no longer matches its hash
+	changed := append([]ControlledRegisterEntry{}, entries...)
+	changed[1].Jumlah = -2
+	if broken := verifyChain(t, last, changed); broken != 2 {
+		t.Errorf("changed entry: chain breaks at %d, want 2", broken)
+	}
+
+	// a removed entry leaves the next one pointing at a missing hash
+	removed := []ControlledRegisterEntry{entries[0], entries[2]}
+	if broken := verifyChain(t, last, removed); broken != 3 {
+		t.Errorf("removed entry: chain breaks at %d, want 3", broken)
+	}
+
+	// the time is hashed in UTC, so reading it back in another zone keeps it
+	local := append([]ControlledRegisterEntry{}, entries...)
+	local[0].Waktu = local[0].Waktu.In(time.FixedZone("WITA", 8*60*60))
+	if broken := verifyChain(t, last, local); broken != 0 {
+		t.Errorf("entry read in another zone: chain breaks at %d, want it intact", broken)
+	}
+}
@@ -24,12 +24,5 @@ type Dispensing struct {
 }
 
 func (dispensing *Dispensing) StatusString() string {
-	switch *dispensing.StatusResep {
-	case datastruct.PENDING:
-		return "pending"
-	case datastruct.SUDAH_DIBERIKAN:
-		return "sudah diberikan"
-	default:
-		return ""
-	}
+	return RecipeStatusString(*dispensing.StatusResep)
 }
@@ -1,11 +1,22 @@
 package pharmacy
 
 import (
+	"errors"
+	"service-pharmacy/attachment"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/signing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	PrescriptionReceivedError = errors.New("the prescription was already taken in by the pharmacy and can no longer be signed")
+	NotPrescriberError        = errors.New("only the doctor who wrote the prescription can sign it")
+	SignedContentChangedError = errors.New("the prescription was digitally signed, what the prescriber signed cannot be changed")
+	InvalidEncounterError     = errors.New("id_kunjungan must be the ID of an encounter")
+)
+
 type Pharmacy struct {
 	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 
@@ -13,10 +24,110 @@ type Pharmacy struct {
 	Signature *string    `json:"signature" bson:"signature"`
 	Peresepan DrugRecipe `json:"peresepan" binding:"required" bson:"peresepan"`
 
+	// IDKunjungan is the encounter the prescription was written in, if any.
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
 	Dispensing          *Dispensing       `json:"dispensing" binding:"required" bson:"dispensing,omitempty"`
 	DispensingEncrypted *primitive.Binary `json:"encrypted_dispensing" bson:"encrypted_dispensing"`
 
+	// Lampiran records the hash of every attachment of the prescription, so
+	// the signature of the document covers them.
+	Lampiran []attachment.Reference `json:"lampiran,omitempty" bson:"lampiran,omitempty"`
+
+	// TandaTanganDigital is the signature of the prescriber, made with the
+	// key the auth service issued to them.
+	TandaTanganDigital *signing.Signature `json:"tanda_tangan_digital,omitempty" bson:"tanda_tangan_digital,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
 }
+
+// SignedPrescriptionItem is an item as the prescriber wrote it. The name,
+// form and route come from the formulary and the rest is filled in by the
+// pharmacy, so neither is signed.
+type SignedPrescriptionItem struct {
+	IDObat           string  `json:"id_obat"`
+	Dosis            float64 `json:"dosis"`
+	SatuanDosis      string  `json:"satuan_dosis"`
+	FrekuensiPerHari uint    `json:"frekuensi_per_hari"`
+	DurasiHari       uint    `json:"durasi_hari"`
+	JumlahObat       uint    `json:"jumlah_obat"`
+	AturanTambahan   string  `json:"aturan_tambahan"`
+}
+
+// SignedPrescription is what the prescriber signs: the patient and the
+// drugs as they were prescribed, without the review and dispensing that
+// follow.
+type SignedPrescription struct {
+	ID           string    `json:"_id"`
+	NoRekamMedis string    `json:"no_rekam_medis"`
+	NoIHS        string    `json:"no_ihs"`
+	NamaLengkap  string    `json:"nama_lengkap"`
+	TanggalLahir time.Time `json:"tanggal_lahir"`
+	TinggiBadan  uint16    `json:"tinggi_badan"`
+	BeratBadan   uint16    `json:"berat_badan"`
+
+	ItemResep    []SignedPrescriptionItem `json:"item_resep"`
+	CatatanResep string                   `json:"catatan_resep"`
+
+	DokterPenulis    string    `json:"dokter_penulis"`
+	SIPDokterPenulis string    `json:"sip_dokter_penulis"`
+	WaktuPenulisan   time.Time `json:"waktu_penulisan"`
+}
+
+type SignBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SignedContent returns the part of the prescription the prescriber signs.
+// The confidential data must be decrypted and its items normalized.
+func (data *Pharmacy) SignedContent() SignedPrescription {
+	confidential := data.Peresepan.ConfidentialData
+
+	items := []SignedPrescriptionItem{}
+	for i := 0; i < len(confidential.ItemResep); i++ {
+		item := confidential.ItemResep[i]
+		items = append(items, SignedPrescriptionItem{
+			IDObat:           item.IDObat,
+			Dosis:            item.Dosis,
+			SatuanDosis:      item.SatuanDosis,
+			FrekuensiPerHari: item.FrekuensiPerHari,
+			DurasiHari:       item.DurasiHari,
+			JumlahObat:       item.JumlahObat,
+			AturanTambahan:   item.AturanTambahan,
+		})
+	}
+
+	return SignedPrescription{
+		ID:           data.ID.Hex(),
+		NoRekamMedis: data.Peresepan.NoRekamMedis,
+		NoIHS:        data.Peresepan.NoIHS,
+		NamaLengkap:  confidential.NamaLengkap,
+		TanggalLahir: confidential.TanggalLahir,
+		TinggiBadan:  confidential.TinggiBadan,
+		BeratBadan:   confidential.BeratBadan,
+
+		ItemResep:    items,
+		CatatanResep: confidential.CatatanResep,
+
+		DokterPenulis:    confidential.DokterPenulis,
+		SIPDokterPenulis: confidential.SIPDokterPenulis,
+		WaktuPenulisan:   confidential.WaktuPenulisan,
+	}
+}
+
+// CanBeSignedBy checks the prescription is still waiting for the pharmacy,
+// and that the user signing it wrote it.
+func (data *Pharmacy) CanBeSignedBy(by string) error {
+	confidential := data.Peresepan.ConfidentialData
+	if confidential.Status() != datastruct.PENDING {
+		return PrescriptionReceivedError
+	}
+
+	if confidential.DokterPenulis != by {
+		return NotPrescriberError
+	}
+
+	return nil
+}
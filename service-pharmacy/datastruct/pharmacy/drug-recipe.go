@@ -1,6 +1,7 @@
 package pharmacy
 
 import (
+	"service-pharmacy/attachment"
 	"service-pharmacy/datastruct"
 	"time"
 
@@ -56,20 +57,29 @@ type ConfidentialPharmacyData struct {
 	NamaLengkap  string    `json:"nama_lengkap" binding:"required" bson:"nama_lengkap"`
 	TanggalLahir time.Time `json:"tanggal_lahir" binding:"required" bson:"tanggal_lahir"`
 
-	TinggiBadan            uint16 `json:"tinggi_badan" binding:"required" bson:"tinggi_badan"`
-	BeratBadan             uint16 `json:"berat_badan" binding:"required" bson:"berat_badan"`
-	LuasPermukaanTubuhAnak uint16 `json:"luas_permukaan_tubuh_anak" bson:"luas_permukaan_tubuh_anak"`
+	TinggiBadan            uint16  `json:"tinggi_badan" binding:"required" bson:"tinggi_badan"`
+	BeratBadan             uint16  `json:"berat_badan" binding:"required" bson:"berat_badan"`
+	LuasPermukaanTubuhAnak float64 `json:"luas_permukaan_tubuh_anak" bson:"luas_permukaan_tubuh_anak"`
 
-	NamaObat     string   `json:"nama_obat" binding:"required" bson:"nama_obat"`
-	Bentuk       string   `json:"bentuk" binding:"required" bson:"bentuk"`
-	JumlahObat   uint     `json:"jumlah_obat" binding:"required" bson:"jumlah_obat"`
-	AturanPakai  HowToUse `json:"aturan_pakai" binding:"required" bson:"aturan_pakai"`
-	CatatanResep string   `json:"catatan_resep" binding:"required" bson:"catatan_resep"`
+	ItemResep []PrescriptionItem `json:"item_resep" binding:"dive" bson:"item_resep,omitempty"`
+
+	// single drug of prescriptions written before item_resep, moved into an
+	// item when the prescription is saved
+	NamaObat     string    `json:"nama_obat" bson:"nama_obat"`
+	Bentuk       string    `json:"bentuk" bson:"bentuk"`
+	JumlahObat   uint      `json:"jumlah_obat" bson:"jumlah_obat"`
+	AturanPakai  *HowToUse `json:"aturan_pakai" bson:"aturan_pakai,omitempty"`
+	CatatanResep string    `json:"catatan_resep" binding:"required" bson:"catatan_resep"`
 
 	RiwayatPenggunaan UsageHistory `json:"riwayat_penggunaan" binding:"required" bson:"riwayat_penggunaan"`
 	RiwayatAlergi     bool         `json:"riwayat_alergi" binding:"required" bson:"riwayat_alergi"`
 	JenisAlergi       string       `json:"jenis_alergi" binding:"required" bson:"jenis_alergi"`
 
+	// allergies from the anamnesis and the outcome of the clinical screening
+	DaftarAlergi         []string                 `json:"daftar_alergi" bson:"daftar_alergi,omitempty"`
+	PeringatanKlinis     []ClinicalWarning        `json:"peringatan_klinis" bson:"peringatan_klinis,omitempty"`
+	KonfirmasiPeringatan []WarningAcknowledgement `json:"konfirmasi_peringatan" bson:"konfirmasi_peringatan,omitempty"`
+
 	NamaFasyankesPengirim string `json:"nama_fasyankes_pengirim" binding:"required" bson:"nama_fasyankes_pengirim"`
 	UnitPengirim          string `json:"unit_pengirim" binding:"required" bson:"unit_pengirim"`
 	DokterPenulis         string `json:"dokter_penulis" binding:"required" bson:"dokter_penulis"`
@@ -78,18 +88,30 @@ type ConfidentialPharmacyData struct {
 	NoTelpSelularDokter   string `json:"no_telp_selular_dokter" binding:"required" bson:"no_telp_selular_dokter"`
 
 	WaktuPenulisan    time.Time `json:"waktu_penulisan" binding:"required" bson:"waktu_penulisan"`
-	TandaTanganDokter string    `json:"tanda_tangan_dokter" binding:"required" bson:"tanda_tangan_dokter"`
+	TandaTanganDokter string    `json:"tanda_tangan_dokter" binding:"required_without=LampiranTandaTangan" bson:"tanda_tangan_dokter"`
+
+	// LampiranTandaTangan is the scan of a wet signature.
+	LampiranTandaTangan *attachment.Reference `json:"lampiran_tanda_tangan,omitempty" bson:"lampiran_tanda_tangan,omitempty"`
+
+	// required for narcotics and psychotropics
+	JenisTandaTangan datastruct.SignatureType `json:"jenis_tanda_tangan" bson:"jenis_tanda_tangan,omitempty"`
 
-	StatusResep     *datastruct.RecipeStatus `json:"status_resep" binding:"required" bson:"status_resep"`
+	// written by the pharmacy, an update keeps them as they were stored
+	StatusResep     *datastruct.RecipeStatus `json:"status_resep" bson:"status_resep"`
 	PengkajianResep RecipeAssessment         `json:"pengkajian_resep" binding:"required" bson:"pengkajian_resep"`
+
+	RiwayatStatus []StatusChange `json:"riwayat_status" bson:"riwayat_status,omitempty"`
+	Penyerahan    *Handover      `json:"penyerahan" bson:"penyerahan,omitempty"`
 }
 
 type DrugRecipe struct {
 	NoRekamMedis string `json:"no_rekam_medis" binding:"required" bson:"no_rekam_medis"`
 	IDPelanggan  string `json:"id_pelanggan" binding:"required" bson:"id_pelanggan"`
-	IDObat       string `json:"id_obat" binding:"required" bson:"id_obat"`
+	IDObat       string `json:"id_obat" bson:"id_obat"` // drug of the first item
 	NoIHS        string `json:"no_ihs" binding:"required" bson:"no_ihs"`
 
+	DaftarIDObat []string `json:"daftar_id_obat" bson:"daftar_id_obat,omitempty"`
+
 	NIK          *uint64           `json:"nik" binding:"required" bson:"nik,omitempty"`
 	NIKEncrypted *primitive.Binary `json:"encrypted_nik" bson:"encrypted_nik"`
 
@@ -98,12 +120,83 @@ type DrugRecipe struct {
 }
 
 func (drugRecipe *DrugRecipe) StatusString() string {
-	switch *drugRecipe.ConfidentialData.StatusResep {
-	case datastruct.PENDING:
-		return "pending"
-	case datastruct.SUDAH_DIBERIKAN:
-		return "sudah diberikan"
-	default:
-		return ""
+	return RecipeStatusString(*drugRecipe.ConfidentialData.StatusResep)
+}
+
+// NormalizeItems moves the legacy single drug into an item, numbers the items
+// and refreshes the plaintext drug references and the overall status.
+func (drugRecipe *DrugRecipe) NormalizeItems() error {
+	data := drugRecipe.ConfidentialData
+	if len(data.ItemResep) == 0 {
+		if data.NamaObat == "" {
+			return PrescriptionItemRequiredError
+		}
+
+		howToUse := HowToUse{}
+		if data.AturanPakai != nil {
+			howToUse = *data.AturanPakai
+		}
+
+		item := LegacyItem(drugRecipe.IDObat, data.NamaObat, data.Bentuk, data.JumlahObat, howToUse)
+		if data.StatusResep != nil {
+			item.Status = *data.StatusResep
+		}
+		data.ItemResep = []PrescriptionItem{item}
+	}
+
+	drugIDs, err := NumberItems(data.ItemResep)
+	if err != nil {
+		return err
+	}
+	SettleItems(data.ItemResep)
+
+	drugRecipe.DaftarIDObat = drugIDs
+	drugRecipe.IDObat = drugIDs[0]
+
+	status := PrescriptionStatus(data.ItemResep, data.StatusResep)
+	data.StatusResep = &status
+
+	return nil
+}
+
+// Allergies lists every allergy known for the patient, including the one
+// written on the prescription itself.
+func (data *ConfidentialPharmacyData) Allergies() []string {
+	allergies := append([]string{}, data.DaftarAlergi...)
+	if data.RiwayatAlergi && data.JenisAlergi != "" {
+		allergies = append(allergies, data.JenisAlergi)
+	}
+
+	return allergies
+}
+
+// DoctorSignature is the signature written by the prescriber, or the ID of
+// the scan of the signature when it was attached instead.
+func (data *ConfidentialPharmacyData) DoctorSignature() string {
+	if data.TandaTanganDokter == "" && data.LampiranTandaTangan != nil {
+		return data.LampiranTandaTangan.ID.Hex()
+	}
+
+	return data.TandaTanganDokter
+}
+
+// ApplyScreening keeps the screened warnings and fills in the parts of the
+// clinical review the pharmacist has not written yet.
+func (data *ConfidentialPharmacyData) ApplyScreening(warnings []ClinicalWarning) {
+	data.PeringatanKlinis = warnings
+	data.KonfirmasiPeringatan = nil
+
+	clinical := &data.PengkajianResep.Klinis
+	if clinical.DuplikasiPengobatan == "" {
+		clinical.DuplikasiPengobatan = Summarize(warnings, datastruct.PERINGATAN_DUPLIKASI)
+	}
+	if clinical.InteraksiObat == "" {
+		clinical.InteraksiObat = Summarize(warnings, datastruct.PERINGATAN_INTERAKSI)
+	}
+	if clinical.AlergiDanROTD == "" {
+		clinical.AlergiDanROTD = Summarize(warnings, datastruct.PERINGATAN_ALERGI)
+	}
+	if clinical.IndikasiDosisPenggunaan == "" {
+		clinical.IndikasiDosisPenggunaan = Summarize(warnings, datastruct.PERINGATAN_DOSIS)
 	}
 }
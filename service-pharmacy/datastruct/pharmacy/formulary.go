@@ -0,0 +1,214 @@
+package pharmacy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"service-pharmacy/datastruct"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	DrugNotFoundError        = errors.New("drug is not registered in the formulary")
+	DrugDuplicateError       = errors.New("drug with the same id_obat already exists")
+	DrugNameMismatchError    = errors.New("nama_obat does not match the generic or brand name of the drug")
+	DrugFormMismatchError    = errors.New("bentuk does not match the dosage form of the drug")
+	DrugQuantityLimitError   = errors.New("jumlah_obat exceeds the maximum quantity allowed per prescription")
+	InvalidATCCodeError      = errors.New("kode_atc is not a valid ATC code")
+	InvalidDrugStrengthError = errors.New("kekuatan must be positive when satuan_kekuatan is set")
+	InvalidDrugScheduleError = errors.New("golongan is not a known drug schedule")
+	InvalidDosingRuleError   = errors.New("aturan_dosis must have a known basis, a unit and dosis_minimal not above dosis_maksimal")
+)
+
+// Drug is a formulary entry prescriptions refer to through id_obat.
+type Drug struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	IDObat         string  `json:"id_obat" binding:"required" bson:"id_obat"`
+	NamaGenerik    string  `json:"nama_generik" binding:"required" bson:"nama_generik"`
+	NamaDagang     string  `json:"nama_dagang" bson:"nama_dagang"`
+	Kekuatan       float64 `json:"kekuatan" bson:"kekuatan"`
+	SatuanKekuatan string  `json:"satuan_kekuatan" bson:"satuan_kekuatan"` // e.g. mg, mg/5 mL, IU
+	BentukSediaan  string  `json:"bentuk_sediaan" binding:"required" bson:"bentuk_sediaan"`
+	RutePemberian  string  `json:"rute_pemberian" binding:"required" bson:"rute_pemberian"`
+	KodeATC        string  `json:"kode_atc" bson:"kode_atc"`
+
+	// Fornas marks drugs listed in the national formulary, Restriksi holds
+	// its prescribing restrictions and PeresepanMaksimal the maximum quantity
+	// per prescription, where zero means unlimited.
+	Fornas            bool   `json:"fornas" bson:"fornas"`
+	Restriksi         string `json:"restriksi" bson:"restriksi"`
+	PeresepanMaksimal uint   `json:"peresepan_maksimal" bson:"peresepan_maksimal"`
+
+	// Golongan marks narcotics, psychotropics and precursors, SubGolongan
+	// the class within it (e.g. "II" for narkotika golongan II).
+	Golongan    datastruct.DrugSchedule `json:"golongan" bson:"golongan"`
+	SubGolongan string                  `json:"sub_golongan" bson:"sub_golongan"`
+
+	AturanDosis []DosingRule `json:"aturan_dosis" bson:"aturan_dosis,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// DosingRule is the dose range of a drug for patients within an age and
+// weight band. Doses are per administration in SatuanDosis, multiplied by
+// the weight in kg or the body surface area in m² depending on Basis. The
+// maximum limits are zero when not set.
+type DosingRule struct {
+	UsiaMinimalBulan  uint    `json:"usia_minimal_bulan" bson:"usia_minimal_bulan"`
+	UsiaMaksimalBulan uint    `json:"usia_maksimal_bulan" bson:"usia_maksimal_bulan"`
+	BeratMinimal      float64 `json:"berat_minimal" bson:"berat_minimal"`
+	BeratMaksimal     float64 `json:"berat_maksimal" bson:"berat_maksimal"`
+
+	Basis               datastruct.DoseBasis `json:"basis" bson:"basis"`
+	SatuanDosis         string               `json:"satuan_dosis" bson:"satuan_dosis"`
+	DosisMinimal        float64              `json:"dosis_minimal" bson:"dosis_minimal"`
+	DosisMaksimal       float64              `json:"dosis_maksimal" bson:"dosis_maksimal"`
+	DosisHarianMaksimal float64              `json:"dosis_harian_maksimal" bson:"dosis_harian_maksimal"`
+
+	// cap the weight or BSA based dose and daily dose, usually the adult
+	// doses
+	DosisAbsolutMaksimal       float64 `json:"dosis_absolut_maksimal" bson:"dosis_absolut_maksimal"`
+	DosisHarianAbsolutMaksimal float64 `json:"dosis_harian_absolut_maksimal" bson:"dosis_harian_absolut_maksimal"`
+
+	Keterangan string `json:"keterangan" bson:"keterangan"`
+}
+
+func (rule *DosingRule) Validate() error {
+	if rule.Basis < datastruct.DOSIS_TETAP || rule.Basis > datastruct.DOSIS_PER_M2 || strings.TrimSpace(rule.SatuanDosis) == "" {
+		return InvalidDosingRuleError
+	}
+
+	if rule.DosisMinimal < 0 || rule.DosisMaksimal < 0 || rule.DosisHarianMaksimal < 0 ||
+		rule.DosisAbsolutMaksimal < 0 || rule.DosisHarianAbsolutMaksimal < 0 {
+		return InvalidDosingRuleError
+	}
+
+	if rule.DosisMaksimal > 0 && rule.DosisMinimal > rule.DosisMaksimal {
+		return InvalidDosingRuleError
+	}
+
+	return nil
+}
+
+// Applies tells whether the rule covers a patient of the given age in months
+// and weight in kg. An unknown weight matches every weight band.
+func (rule *DosingRule) Applies(ageMonths uint, weight float64) bool {
+	if ageMonths < rule.UsiaMinimalBulan || (rule.UsiaMaksimalBulan > 0 && ageMonths > rule.UsiaMaksimalBulan) {
+		return false
+	}
+
+	if weight > 0 && (weight < rule.BeratMinimal || (rule.BeratMaksimal > 0 && weight > rule.BeratMaksimal)) {
+		return false
+	}
+
+	return true
+}
+
+// atcPattern accepts every ATC level from the anatomical main group ("N")
+// down to the chemical substance ("N02BE01").
+var atcPattern = regexp.MustCompile(`^[A-Z]([0-9]{2}([A-Z]([A-Z]([0-9]{2})?)?)?)?$`)
+
+func (drug *Drug) Validate() error {
+	drug.KodeATC = strings.ToUpper(strings.TrimSpace(drug.KodeATC))
+	if drug.KodeATC != "" && !atcPattern.MatchString(drug.KodeATC) {
+		return InvalidATCCodeError
+	}
+
+	if drug.Kekuatan < 0 || (drug.SatuanKekuatan != "" && drug.Kekuatan == 0) {
+		return InvalidDrugStrengthError
+	}
+
+	if drug.Golongan > datastruct.PREKURSOR {
+		return InvalidDrugScheduleError
+	}
+
+	for i := 0; i < len(drug.AturanDosis); i++ {
+		if err := drug.AturanDosis[i].Validate(); err != nil {
+			return fmt.Errorf("aturan_dosis %d: %w", i, err)
+		}
+	}
+
+	drug.SubGolongan = strings.ToUpper(strings.TrimSpace(drug.SubGolongan))
+	if drug.Golongan == datastruct.OBAT_UMUM {
+		drug.SubGolongan = ""
+	}
+
+	return nil
+}
+
+// Controlled drugs need a signed prescription with the prescriber's license
+// and every movement of their stock goes into the controlled register.
+func (drug *Drug) Controlled() bool {
+	return drug.Golongan == datastruct.NARKOTIKA || drug.Golongan == datastruct.PSIKOTROPIKA
+}
+
+func (drug *Drug) ScheduleString() string {
+	return DrugScheduleString(drug.Golongan)
+}
+
+func DrugScheduleString(schedule datastruct.DrugSchedule) string {
+	switch schedule {
+	case datastruct.OBAT_UMUM:
+		return "Obat umum"
+	case datastruct.NARKOTIKA:
+		return "Narkotika"
+	case datastruct.PSIKOTROPIKA:
+		return "Psikotropika"
+	case datastruct.PREKURSOR:
+		return "Prekursor"
+	default:
+		return ""
+	}
+}
+
+// Name is the generic name followed by the strength, e.g. "Paracetamol 500 mg".
+func (drug *Drug) Name() string {
+	if drug.Kekuatan == 0 {
+		return drug.NamaGenerik
+	}
+
+	return fmt.Sprintf("%s %s %s", drug.NamaGenerik, strconv.FormatFloat(drug.Kekuatan, 'f', -1, 64), drug.SatuanKekuatan)
+}
+
+// Check validates the drug name, dosage form and quantity written on a
+// prescription against the entry. Names and forms are compared without
+// regard to case or surrounding spaces.
+func (drug *Drug) Check(name, form string, quantity uint) error {
+	names := []string{drug.NamaGenerik, drug.Name()}
+	if drug.NamaDagang != "" {
+		names = append(names, drug.NamaDagang)
+	}
+
+	if !equalFoldAny(name, names) {
+		return fmt.Errorf("%s: %w", drug.IDObat, DrugNameMismatchError)
+	}
+
+	if !equalFoldAny(form, []string{drug.BentukSediaan}) {
+		return fmt.Errorf("%s: %w", drug.IDObat, DrugFormMismatchError)
+	}
+
+	if drug.PeresepanMaksimal > 0 && quantity > drug.PeresepanMaksimal {
+		return fmt.Errorf("%s: %w", drug.IDObat, DrugQuantityLimitError)
+	}
+
+	return nil
+}
+
+func equalFoldAny(value string, candidates []string) bool {
+	value = strings.TrimSpace(value)
+	for i := 0; i < len(candidates); i++ {
+		if strings.EqualFold(value, strings.TrimSpace(candidates[i])) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,245 @@
+package pharmacy
+
+import (
+	"errors"
+	"fmt"
+	"service-pharmacy/datastruct"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	InventoryItemNotFoundError  = errors.New("drug is not stocked by this facility")
+	InventoryItemDuplicateError = errors.New("drug is already stocked by this facility")
+	BatchNotFoundError          = errors.New("batch is not found for this drug")
+	BatchExpiryMismatchError    = errors.New("batch was received before with a different expiry date")
+	BatchExpiredError           = errors.New("batch has already expired")
+	InsufficientStockError      = errors.New("stock is insufficient")
+	InvalidQuantityError        = errors.New("jumlah must not be zero")
+	StockConflictError          = errors.New("stock was modified by another request")
+)
+
+type StockBatch struct {
+	NoBatch           string    `json:"no_batch" binding:"required" bson:"no_batch"`
+	TanggalKadaluarsa time.Time `json:"tanggal_kadaluarsa" binding:"required" bson:"tanggal_kadaluarsa"`
+	Jumlah            uint      `json:"jumlah" bson:"jumlah"`
+	HargaSatuan       float64   `json:"harga_satuan" bson:"harga_satuan"`
+	TanggalPenerimaan time.Time `json:"tanggal_penerimaan" bson:"tanggal_penerimaan"`
+}
+
+// InventoryItem is the stock of a formulary drug held by one facility.
+type InventoryItem struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	IDObat      string `json:"id_obat" binding:"required" bson:"id_obat"`
+	NamaObat    string `json:"nama_obat" bson:"nama_obat"`
+	Satuan      string `json:"satuan" bson:"satuan"` // unit of issue, e.g. tablet
+	Lokasi      string `json:"lokasi" bson:"lokasi"`
+	StokMinimum uint   `json:"stok_minimum" bson:"stok_minimum"`
+
+	Batch     []StockBatch `json:"batch" bson:"batch"`
+	TotalStok uint         `json:"total_stok" bson:"total_stok"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// BatchAllocation keeps the expiry date so stock can be returned to a batch
+// even after it ran out.
+type BatchAllocation struct {
+	NoBatch           string    `json:"no_batch" bson:"no_batch"`
+	TanggalKadaluarsa time.Time `json:"tanggal_kadaluarsa" bson:"tanggal_kadaluarsa"`
+	Jumlah            uint      `json:"jumlah" bson:"jumlah"`
+}
+
+// StockMovement is an entry of the stock ledger. Entries are signed and never
+// changed; a correction is a new entry.
+type StockMovement struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID  string  `json:"client_id" bson:"client_id"`
+	Signature *string `json:"signature" bson:"signature"`
+
+	IDObat     string                       `json:"id_obat" bson:"id_obat"`
+	NoBatch    string                       `json:"no_batch" bson:"no_batch"`
+	Jenis      datastruct.StockMovementType `json:"jenis" bson:"jenis"`
+	Jumlah     int                          `json:"jumlah" bson:"jumlah"`
+	SaldoBatch uint                         `json:"saldo_batch" bson:"saldo_batch"`
+	SaldoTotal uint                         `json:"saldo_total" bson:"saldo_total"`
+	Referensi  string                       `json:"referensi" bson:"referensi"`
+	Keterangan string                       `json:"keterangan" bson:"keterangan"`
+	Petugas    string                       `json:"petugas" bson:"petugas"`
+	Waktu      time.Time                    `json:"waktu" bson:"waktu"`
+}
+
+type GoodsReceiptLine struct {
+	IDObat string `json:"id_obat" binding:"required"`
+	StockBatch
+}
+
+type GoodsReceiptBody struct {
+	NoPenerimaan string             `json:"no_penerimaan" binding:"required"`
+	Pemasok      string             `json:"pemasok" binding:"required"`
+	Item         []GoodsReceiptLine `json:"item" binding:"required,min=1,dive"`
+}
+
+type StockAdjustmentBody struct {
+	NoBatch string `json:"no_batch" binding:"required"`
+	Jumlah  int    `json:"jumlah" binding:"required"`
+	Alasan  string `json:"alasan" binding:"required"`
+}
+
+type StockCountLine struct {
+	IDObat      string `json:"id_obat" binding:"required"`
+	NoBatch     string `json:"no_batch" binding:"required"`
+	JumlahFisik *uint  `json:"jumlah_fisik" binding:"required"`
+}
+
+type StockOpnameBody struct {
+	Catatan string           `json:"catatan"`
+	Item    []StockCountLine `json:"item" binding:"required,min=1,dive"`
+}
+
+type ExpiringBatch struct {
+	IDObat   string `json:"id_obat"`
+	NamaObat string `json:"nama_obat"`
+	StockBatch
+	SisaHari int `json:"sisa_hari"`
+}
+
+func (movement *StockMovement) TypeString() string {
+	switch movement.Jenis {
+	case datastruct.PENERIMAAN:
+		return "Penerimaan"
+	case datastruct.PENGELUARAN:
+		return "Pengeluaran"
+	case datastruct.PENYESUAIAN:
+		return "Penyesuaian"
+	case datastruct.STOK_OPNAME:
+		return "Stok opname"
+	default:
+		return ""
+	}
+}
+
+// Recount refreshes the total and drops batches that ran out.
+func (item *InventoryItem) Recount() {
+	batches := []StockBatch{}
+	var total uint
+	for i := 0; i < len(item.Batch); i++ {
+		if item.Batch[i].Jumlah == 0 {
+			continue
+		}
+
+		total += item.Batch[i].Jumlah
+		batches = append(batches, item.Batch[i])
+	}
+
+	item.Batch = batches
+	item.TotalStok = total
+}
+
+// UsableStock is the stock that has not expired by the given time.
+func (item *InventoryItem) UsableStock(at time.Time) uint {
+	var total uint
+	for i := 0; i < len(item.Batch); i++ {
+		if item.Batch[i].TanggalKadaluarsa.After(at) {
+			total += item.Batch[i].Jumlah
+		}
+	}
+
+	return total
+}
+
+func (item *InventoryItem) FindBatch(noBatch string) *StockBatch {
+	for i := 0; i < len(item.Batch); i++ {
+		if item.Batch[i].NoBatch == noBatch {
+			return &item.Batch[i]
+		}
+	}
+
+	return nil
+}
+
+// Receive adds a received batch, merging it with an earlier receipt of the
+// same batch.
+func (item *InventoryItem) Receive(batch StockBatch) error {
+	if batch.Jumlah == 0 {
+		return InvalidQuantityError
+	}
+
+	existing := item.FindBatch(batch.NoBatch)
+	if existing == nil {
+		item.Batch = append(item.Batch, batch)
+		return nil
+	}
+
+	if !existing.TanggalKadaluarsa.Equal(batch.TanggalKadaluarsa) {
+		return fmt.Errorf("%s: %w", batch.NoBatch, BatchExpiryMismatchError)
+	}
+
+	existing.Jumlah += batch.Jumlah
+	return nil
+}
+
+// Adjust changes the quantity of a batch by delta.
+func (item *InventoryItem) Adjust(noBatch string, delta int) (*StockBatch, error) {
+	if delta == 0 {
+		return nil, InvalidQuantityError
+	}
+
+	batch := item.FindBatch(noBatch)
+	if batch == nil {
+		return nil, fmt.Errorf("%s: %w", noBatch, BatchNotFoundError)
+	}
+
+	if delta < 0 && uint(-delta) > batch.Jumlah {
+		return nil, fmt.Errorf("%s: %w", noBatch, InsufficientStockError)
+	}
+
+	batch.Jumlah = uint(int(batch.Jumlah) + delta)
+	return batch, nil
+}
+
+// AllocateFEFO takes the quantity from the batches that expire first,
+// skipping those already expired.
+func (item *InventoryItem) AllocateFEFO(quantity uint, at time.Time) ([]BatchAllocation, error) {
+	if quantity == 0 {
+		return nil, InvalidQuantityError
+	}
+
+	if item.UsableStock(at) < quantity {
+		return nil, fmt.Errorf("%s: %w", item.IDObat, InsufficientStockError)
+	}
+
+	sort.SliceStable(item.Batch, func(i, j int) bool {
+		return item.Batch[i].TanggalKadaluarsa.Before(item.Batch[j].TanggalKadaluarsa)
+	})
+
+	allocations := []BatchAllocation{}
+	for i := 0; i < len(item.Batch) && quantity > 0; i++ {
+		batch := &item.Batch[i]
+		if batch.Jumlah == 0 || !batch.TanggalKadaluarsa.After(at) {
+			continue
+		}
+
+		taken := batch.Jumlah
+		if taken > quantity {
+			taken = quantity
+		}
+
+		batch.Jumlah -= taken
+		quantity -= taken
+		allocations = append(allocations, BatchAllocation{
+			NoBatch:           batch.NoBatch,
+			TanggalKadaluarsa: batch.TanggalKadaluarsa,
+			Jumlah:            taken,
+		})
+	}
+
+	return allocations, nil
+}
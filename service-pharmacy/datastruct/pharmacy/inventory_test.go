@@ -0,0 +1,149 @@
+package pharmacy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var stockDay = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func stockItem() *InventoryItem {
+	return &InventoryItem{
+		IDObat: "OBT-001",
+		Batch: []StockBatch{
+			{NoBatch: "B-LATE", TanggalKadaluarsa: stockDay.AddDate(1, 0, 0), Jumlah: 10},
+			{NoBatch: "B-EXPIRED", TanggalKadaluarsa: stockDay.AddDate(0, 0, -1), Jumlah: 5},
+			{NoBatch: "B-EARLY", TanggalKadaluarsa: stockDay.AddDate(0, 2, 0), Jumlah: 4},
+		},
+	}
+}
+
+func TestAllocateFEFO(t *testing.T) {
+	item := stockItem()
+
+	allocations, err := item.AllocateFEFO(6, stockDay)
+	if err != nil {
+		t.Fatalf("AllocateFEFO: %v", err)
+	}
+
+	want := []BatchAllocation{
+		{NoBatch: "B-EARLY", TanggalKadaluarsa: stockDay.AddDate(0, 2, 0), Jumlah: 4},
+		{NoBatch: "B-LATE", TanggalKadaluarsa: stockDay.AddDate(1, 0, 0), Jumlah: 2},
+	}
+	if len(allocations) != len(want) {
+		t.Fatalf("got %d allocations, want %d: %+v", len(allocations), len(want), allocations)
+	}
+	for i := 0; i < len(want); i++ {
+		if allocations[i] != want[i] {
+			t.Errorf("allocation %d = %+v, want %+v", i, allocations[i], want[i])
+		}
+	}
+
+	if got := item.FindBatch("B-EARLY").Jumlah; got != 0 {
+		t.Errorf("B-EARLY left %d, want 0", got)
+	}
+	if got := item.FindBatch("B-LATE").Jumlah; got != 8 {
+		t.Errorf("B-LATE left %d, want 8", got)
+	}
+	if got := item.FindBatch("B-EXPIRED").Jumlah; got != 5 {
+		t.Errorf("expired batch was touched, left %d, want 5", got)
+	}
+}
+
+func TestAllocateFEFOInsufficient(t *testing.T) {
+	item := stockItem()
+
+	// the expired batch does not count towards the usable stock
+	if _, err := item.AllocateFEFO(15, stockDay); !errors.Is(err, InsufficientStockError) {
+		t.Fatalf("AllocateFEFO(15) error = %v, want %v", err, InsufficientStockError)
+	}
+	if got := item.FindBatch("B-LATE").Jumlah; got != 10 {
+		t.Errorf("stock changed on a refused allocation, B-LATE left %d", got)
+	}
+
+	if _, err := item.AllocateFEFO(0, stockDay); !errors.Is(err, InvalidQuantityError) {
+		t.Errorf("AllocateFEFO(0) error = %v, want %v", err, InvalidQuantityError)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	item := stockItem()
+
+	if err := item.Receive(StockBatch{NoBatch: "B-NEW", TanggalKadaluarsa: stockDay.AddDate(2, 0, 0), Jumlah: 3}); err != nil {
+		t.Fatalf("Receive new batch: %v", err)
+	}
+	if batch := item.FindBatch("B-NEW"); batch == nil || batch.Jumlah != 3 {
+		t.Fatalf("new batch = %+v, want 3 in stock", batch)
+	}
+
+	if err := item.Receive(StockBatch{NoBatch: "B-LATE", TanggalKadaluarsa: stockDay.AddDate(1, 0, 0), Jumlah: 5}); err != nil {
+		t.Fatalf("Receive existing batch: %v", err)
+	}
+	if got := item.FindBatch("B-LATE").Jumlah; got != 15 {
+		t.Errorf("B-LATE = %d after receipt, want 15", got)
+	}
+
+	err := item.Receive(StockBatch{NoBatch: "B-LATE", TanggalKadaluarsa: stockDay.AddDate(1, 1, 0), Jumlah: 5})
+	if !errors.Is(err, BatchExpiryMismatchError) {
+		t.Errorf("Receive with another expiry error = %v, want %v", err, BatchExpiryMismatchError)
+	}
+
+	if err := item.Receive(StockBatch{NoBatch: "B-ZERO", TanggalKadaluarsa: stockDay}); !errors.Is(err, InvalidQuantityError) {
+		t.Errorf("Receive of nothing error = %v, want %v", err, InvalidQuantityError)
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	tests := []struct {
+		name    string
+		noBatch string
+		delta   int
+		want    uint
+		err     error
+	}{
+		{name: "add", noBatch: "B-LATE", delta: 3, want: 13},
+		{name: "take", noBatch: "B-LATE", delta: -10, want: 0},
+		{name: "more than the batch", noBatch: "B-EARLY", delta: -5, err: InsufficientStockError},
+		{name: "unknown batch", noBatch: "B-NONE", delta: 1, err: BatchNotFoundError},
+		{name: "zero", noBatch: "B-LATE", delta: 0, err: InvalidQuantityError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := stockItem()
+
+			batch, err := item.Adjust(tt.noBatch, tt.delta)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Adjust error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Adjust: %v", err)
+			}
+
+			if batch.Jumlah != tt.want {
+				t.Errorf("batch = %d, want %d", batch.Jumlah, tt.want)
+			}
+			if got := item.FindBatch(tt.noBatch).Jumlah; got != tt.want {
+				t.Errorf("stored batch = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecount(t *testing.T) {
+	item := stockItem()
+	item.Batch[0].Jumlah = 0
+
+	item.Recount()
+
+	if item.TotalStok != 9 {
+		t.Errorf("TotalStok = %d, want 9", item.TotalStok)
+	}
+	if len(item.Batch) != 2 || item.FindBatch("B-LATE") != nil {
+		t.Errorf("batches after recount = %+v, want the empty batch dropped", item.Batch)
+	}
+}
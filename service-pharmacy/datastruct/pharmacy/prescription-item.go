@@ -0,0 +1,250 @@
+package pharmacy
+
+import (
+	"errors"
+	"fmt"
+	"service-pharmacy/datastruct"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	PrescriptionItemRequiredError = errors.New("prescription must have at least one item_resep or the legacy nama_obat")
+	PrescriptionItemNotFoundError = errors.New("item is not part of this prescription")
+	ItemDuplicateIDError          = errors.New("id_item is used by more than one item")
+)
+
+// PrescriptionItem is one drug of a prescription. Every item is reviewed
+// and dispensed on its own.
+type PrescriptionItem struct {
+	IDItem string `json:"id_item" bson:"id_item"`
+	IDObat string `json:"id_obat" binding:"required" bson:"id_obat"`
+
+	// taken from the formulary when left empty
+	NamaObat      string `json:"nama_obat" bson:"nama_obat"`
+	Bentuk        string `json:"bentuk" bson:"bentuk"`
+	RutePemberian string `json:"rute_pemberian" bson:"rute_pemberian"`
+
+	Dosis            float64 `json:"dosis" binding:"required" bson:"dosis"`
+	SatuanDosis      string  `json:"satuan_dosis" binding:"required" bson:"satuan_dosis"`
+	FrekuensiPerHari uint    `json:"frekuensi_per_hari" binding:"required" bson:"frekuensi_per_hari"`
+	DurasiHari       uint    `json:"durasi_hari" bson:"durasi_hari"`
+	JumlahObat       uint    `json:"jumlah_obat" binding:"required" bson:"jumlah_obat"`
+	AturanTambahan   string  `json:"aturan_tambahan" bson:"aturan_tambahan"`
+
+	JumlahDiberikan uint                    `json:"jumlah_diberikan" bson:"jumlah_diberikan"`
+	Status          datastruct.RecipeStatus `json:"status" bson:"status"`
+	PengkajianResep *RecipeAssessment       `json:"pengkajian_resep" bson:"pengkajian_resep,omitempty"`
+	Pengkaji        string                  `json:"pengkaji" bson:"pengkaji,omitempty"`
+	WaktuPengkajian *time.Time              `json:"waktu_pengkajian" bson:"waktu_pengkajian,omitempty"`
+}
+
+// DispensedQuantity is what was given of an item in one step.
+type DispensedQuantity struct {
+	IDItem string `json:"id_item"`
+	IDObat string `json:"id_obat"`
+	Jumlah uint   `json:"jumlah"`
+}
+
+// LegacyItem turns the single drug of a prescription written before line
+// items existed into an item. The free text dose and interval are parsed on
+// a best effort basis and kept in the additional rules.
+func LegacyItem(idObat, name, form string, quantity uint, howToUse HowToUse) PrescriptionItem {
+	item := PrescriptionItem{
+		IDObat:        idObat,
+		NamaObat:      name,
+		Bentuk:        form,
+		RutePemberian: howToUse.Metode,
+		SatuanDosis:   howToUse.SatuanDosis,
+		JumlahObat:    quantity,
+	}
+
+	if dose, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(howToUse.DosisPakai), ",", "."), 64); err == nil {
+		item.Dosis = dose
+	}
+
+	// "3x1", "3 x sehari" or "3" all mean three times a day
+	interval := strings.TrimSpace(howToUse.IntervalPakai)
+	digits := strings.IndexFunc(interval, func(r rune) bool { return r < '0' || r > '9' })
+	if digits == -1 {
+		digits = len(interval)
+	}
+	if frequency, err := strconv.ParseUint(interval[:digits], 10, 32); err == nil {
+		item.FrekuensiPerHari = uint(frequency)
+	}
+
+	rules := []string{}
+	if interval != "" {
+		rules = append(rules, interval)
+	}
+	if howToUse.AturanTambahan != "" {
+		rules = append(rules, howToUse.AturanTambahan)
+	}
+	item.AturanTambahan = strings.Join(rules, ", ")
+
+	return item
+}
+
+// NumberItems gives every item without one a line number and returns the
+// drug references of the items, kept in plaintext for queries.
+func NumberItems(items []PrescriptionItem) ([]string, error) {
+	seen := map[string]bool{}
+	for i := 0; i < len(items); i++ {
+		if items[i].IDItem == "" {
+			continue
+		}
+		if seen[items[i].IDItem] {
+			return nil, ItemDuplicateIDError
+		}
+		seen[items[i].IDItem] = true
+	}
+
+	next := 1
+	drugIDs := []string{}
+	for i := 0; i < len(items); i++ {
+		if items[i].IDItem == "" {
+			for seen[strconv.Itoa(next)] {
+				next++
+			}
+			items[i].IDItem = strconv.Itoa(next)
+			seen[items[i].IDItem] = true
+		}
+
+		drugIDs = append(drugIDs, items[i].IDObat)
+	}
+
+	return drugIDs, nil
+}
+
+func FindItem(items []PrescriptionItem, id string) (*PrescriptionItem, error) {
+	for i := 0; i < len(items); i++ {
+		if items[i].IDItem == id {
+			return &items[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %w", id, PrescriptionItemNotFoundError)
+}
+
+func (item *PrescriptionItem) Remaining() uint {
+	if item.JumlahDiberikan >= item.JumlahObat {
+		return 0
+	}
+
+	return item.JumlahObat - item.JumlahDiberikan
+}
+
+// SettleItems keeps the status of the items in line with what was given, so
+// an item marked as given counts as given in full.
+func SettleItems(items []PrescriptionItem) {
+	for i := 0; i < len(items); i++ {
+		item := &items[i]
+		switch {
+		case item.Status == datastruct.SUDAH_DIBERIKAN || (item.JumlahObat > 0 && item.JumlahDiberikan >= item.JumlahObat):
+			item.Status = datastruct.SUDAH_DIBERIKAN
+			item.JumlahDiberikan = item.JumlahObat
+		case item.JumlahDiberikan > 0:
+			item.Status = datastruct.DIBERIKAN_SEBAGIAN
+		default:
+			item.Status = datastruct.PENDING
+		}
+	}
+}
+
+// KeepProgress copies the review and what was given of every item from its
+// previous version. Items that are new start as pending.
+func KeepProgress(previous, current []PrescriptionItem) {
+	stored := map[string]*PrescriptionItem{}
+	for i := 0; i < len(previous); i++ {
+		stored[previous[i].IDItem] = &previous[i]
+	}
+
+	for i := 0; i < len(current); i++ {
+		item := &current[i]
+		if before, ok := stored[item.IDItem]; ok {
+			item.JumlahDiberikan = before.JumlahDiberikan
+			item.Status = before.Status
+			item.PengkajianResep = before.PengkajianResep
+			item.Pengkaji = before.Pengkaji
+			item.WaktuPengkajian = before.WaktuPengkajian
+			continue
+		}
+
+		item.JumlahDiberikan = 0
+		item.Status = datastruct.PENDING
+		item.PengkajianResep = nil
+		item.Pengkaji = ""
+		item.WaktuPengkajian = nil
+	}
+}
+
+// DispensedSince lists what was given of every item since the previous
+// version of the prescription. Both versions must be settled.
+func DispensedSince(previous, current []PrescriptionItem) []DispensedQuantity {
+	given := map[string]uint{}
+	for i := 0; i < len(previous); i++ {
+		given[previous[i].IDItem] = previous[i].JumlahDiberikan
+	}
+
+	dispensed := []DispensedQuantity{}
+	for i := 0; i < len(current); i++ {
+		if current[i].JumlahDiberikan > given[current[i].IDItem] {
+			dispensed = append(dispensed, DispensedQuantity{
+				IDItem: current[i].IDItem,
+				IDObat: current[i].IDObat,
+				Jumlah: current[i].JumlahDiberikan - given[current[i].IDItem],
+			})
+		}
+	}
+
+	return dispensed
+}
+
+// PrescriptionStatus follows the items once any of them was given, keeping a
+// handover. Before that the workflow status is kept.
+func PrescriptionStatus(items []PrescriptionItem, current *datastruct.RecipeStatus) datastruct.RecipeStatus {
+	status := datastruct.PENDING
+	if current != nil {
+		status = *current
+	}
+
+	given, full := 0, 0
+	for i := 0; i < len(items); i++ {
+		if items[i].JumlahDiberikan > 0 {
+			given++
+		}
+		if items[i].Status == datastruct.SUDAH_DIBERIKAN {
+			full++
+		}
+	}
+
+	if given == 0 {
+		if status == datastruct.SUDAH_DIBERIKAN || status == datastruct.DIBERIKAN_SEBAGIAN || status == datastruct.DISERAHKAN {
+			return datastruct.PENDING
+		}
+		return status
+	}
+
+	if status == datastruct.DISERAHKAN {
+		return status
+	}
+
+	return DispensingStatus(items)
+}
+
+// DispensingStatus tells a prescription given in full apart from one given in
+// part.
+func DispensingStatus(items []PrescriptionItem) datastruct.RecipeStatus {
+	for i := 0; i < len(items); i++ {
+		if items[i].Status != datastruct.SUDAH_DIBERIKAN {
+			return datastruct.DIBERIKAN_SEBAGIAN
+		}
+	}
+
+	return datastruct.SUDAH_DIBERIKAN
+}
+
+func (item *PrescriptionItem) StatusString() string {
+	return RecipeStatusString(item.Status)
+}
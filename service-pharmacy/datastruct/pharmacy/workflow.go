@@ -0,0 +1,212 @@
+package pharmacy
+
+import (
+	"errors"
+	"fmt"
+	"service-pharmacy/datastruct"
+	"time"
+)
+
+var (
+	InvalidTransitionError = errors.New("prescription cannot move to this status from its current status")
+	NothingToDispenseError = errors.New("every item has already been given in full")
+	DispenseQuantityError  = errors.New("jumlah exceeds the quantity left to give")
+	ReceivedError          = errors.New("prescription has been received by the pharmacy and can no longer be changed")
+)
+
+// transitions lists for every status the statuses it can be reached from.
+// Dispensing can be repeated until every item was given in full, also after
+// a partial handover.
+var transitions = map[datastruct.RecipeStatus][]datastruct.RecipeStatus{
+	datastruct.DITERIMA:           {datastruct.PENDING, datastruct.DITOLAK},
+	datastruct.DIKAJI:             {datastruct.DITERIMA, datastruct.DIKAJI},
+	datastruct.DISIAPKAN:          {datastruct.DIKAJI},
+	datastruct.DIBERIKAN_SEBAGIAN: {datastruct.DISIAPKAN, datastruct.DIBERIKAN_SEBAGIAN, datastruct.DISERAHKAN},
+	datastruct.SUDAH_DIBERIKAN:    {datastruct.DISIAPKAN, datastruct.DIBERIKAN_SEBAGIAN, datastruct.DISERAHKAN},
+	datastruct.DISERAHKAN:         {datastruct.DIBERIKAN_SEBAGIAN, datastruct.SUDAH_DIBERIKAN},
+	datastruct.DITOLAK:            {datastruct.PENDING, datastruct.DITERIMA, datastruct.DIKAJI, datastruct.DISIAPKAN},
+}
+
+// StatusChange is an entry of the workflow history of a prescription.
+type StatusChange struct {
+	Dari    datastruct.RecipeStatus `json:"dari" bson:"dari"`
+	Ke      datastruct.RecipeStatus `json:"ke" bson:"ke"`
+	IDItem  []string                `json:"id_item" bson:"id_item,omitempty"`
+	Catatan string                  `json:"catatan" bson:"catatan"`
+	Petugas string                  `json:"petugas" bson:"petugas"`
+	Waktu   time.Time               `json:"waktu" bson:"waktu"`
+}
+
+type Counseling struct {
+	Diberikan bool     `json:"diberikan" bson:"diberikan"`
+	Materi    []string `json:"materi" bson:"materi"` // e.g. cara pakai, efek samping, penyimpanan
+	Catatan   string   `json:"catatan" bson:"catatan"`
+}
+
+// Handover records to whom the drugs were handed and the counseling given.
+type Handover struct {
+	NamaPenerima     string     `json:"nama_penerima" binding:"required" bson:"nama_penerima"`
+	HubunganPenerima string     `json:"hubungan_penerima" binding:"required" bson:"hubungan_penerima"`
+	Konseling        Counseling `json:"konseling" bson:"konseling"`
+
+	Petugas         string    `json:"petugas" bson:"petugas"`
+	WaktuPenyerahan time.Time `json:"waktu_penyerahan" bson:"waktu_penyerahan"`
+}
+
+type WorkflowNoteBody struct {
+	Catatan string `json:"catatan"`
+}
+
+type ReviewBody struct {
+	PengkajianResep RecipeAssessment `json:"pengkajian_resep" binding:"required"`
+	Catatan         string           `json:"catatan"`
+}
+
+type DispenseLine struct {
+	IDItem string `json:"id_item" binding:"required"`
+	Jumlah uint   `json:"jumlah"` // zero gives the rest of the item
+}
+
+// DispenseBody without items gives the rest of every item.
+type DispenseBody struct {
+	Item    []DispenseLine `json:"item" binding:"dive"`
+	Catatan string         `json:"catatan"`
+}
+
+type RejectionBody struct {
+	Alasan string `json:"alasan" binding:"required"`
+}
+
+func RecipeStatusString(status datastruct.RecipeStatus) string {
+	switch status {
+	case datastruct.PENDING:
+		return "pending"
+	case datastruct.SUDAH_DIBERIKAN:
+		return "sudah diberikan"
+	case datastruct.DITERIMA:
+		return "diterima"
+	case datastruct.DIKAJI:
+		return "dikaji"
+	case datastruct.DISIAPKAN:
+		return "disiapkan"
+	case datastruct.DIBERIKAN_SEBAGIAN:
+		return "diberikan sebagian"
+	case datastruct.DISERAHKAN:
+		return "diserahkan"
+	case datastruct.DITOLAK:
+		return "ditolak"
+	default:
+		return ""
+	}
+}
+
+func CheckTransition(from, to datastruct.RecipeStatus) error {
+	for i := 0; i < len(transitions[to]); i++ {
+		if transitions[to][i] == from {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s to %s: %w", RecipeStatusString(from), RecipeStatusString(to), InvalidTransitionError)
+}
+
+func (data *ConfidentialPharmacyData) Status() datastruct.RecipeStatus {
+	if data.StatusResep == nil {
+		return datastruct.PENDING
+	}
+
+	return *data.StatusResep
+}
+
+// Settled tells a prescription that was rejected, or handed over with every
+// item given in full, apart from one still being worked on.
+func (data *ConfidentialPharmacyData) Settled() bool {
+	switch data.Status() {
+	case datastruct.DITOLAK, datastruct.SUDAH_DIBERIKAN:
+		return true
+	case datastruct.DISERAHKAN:
+		return DispensingStatus(data.ItemResep) == datastruct.SUDAH_DIBERIKAN
+	default:
+		return false
+	}
+}
+
+// Received tells a prescription the pharmacy has started working on apart
+// from one the prescriber can still change.
+func (data *ConfidentialPharmacyData) Received() bool {
+	return data.Status() != datastruct.PENDING
+}
+
+// KeepWorkflow copies what the pharmacy recorded from the stored version,
+// so an update of the prescription cannot move it along the workflow.
+func (data *ConfidentialPharmacyData) KeepWorkflow(previous *ConfidentialPharmacyData) {
+	data.StatusResep = previous.StatusResep
+	data.PengkajianResep = previous.PengkajianResep
+	data.RiwayatStatus = previous.RiwayatStatus
+	data.Penyerahan = previous.Penyerahan
+
+	KeepProgress(previous.ItemResep, data.ItemResep)
+}
+
+// Advance moves the prescription to a status and records who did it.
+func (data *ConfidentialPharmacyData) Advance(to datastruct.RecipeStatus, items []string, note, by string, at time.Time) error {
+	from := data.Status()
+	if err := CheckTransition(from, to); err != nil {
+		return err
+	}
+
+	data.StatusResep = &to
+	data.RiwayatStatus = append(data.RiwayatStatus, StatusChange{
+		Dari:    from,
+		Ke:      to,
+		IDItem:  items,
+		Catatan: note,
+		Petugas: by,
+		Waktu:   at,
+	})
+
+	return nil
+}
+
+// Dispense gives the lines, or the rest of every item when there are none,
+// and returns what was given. The status is left to the caller.
+func (data *ConfidentialPharmacyData) Dispense(lines []DispenseLine) ([]DispensedQuantity, error) {
+	if len(lines) == 0 {
+		for i := 0; i < len(data.ItemResep); i++ {
+			if data.ItemResep[i].Remaining() > 0 {
+				lines = append(lines, DispenseLine{IDItem: data.ItemResep[i].IDItem})
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, NothingToDispenseError
+	}
+
+	dispensed := []DispensedQuantity{}
+	for i := 0; i < len(lines); i++ {
+		item, err := FindItem(data.ItemResep, lines[i].IDItem)
+		if err != nil {
+			return nil, err
+		}
+
+		quantity := lines[i].Jumlah
+		if quantity == 0 {
+			quantity = item.Remaining()
+		}
+
+		if quantity == 0 {
+			return nil, fmt.Errorf("%s: %w", item.IDItem, NothingToDispenseError)
+		}
+		if quantity > item.Remaining() {
+			return nil, fmt.Errorf("%s: %w", item.IDItem, DispenseQuantityError)
+		}
+
+		item.JumlahDiberikan += quantity
+		dispensed = append(dispensed, DispensedQuantity{IDItem: item.IDItem, IDObat: item.IDObat, Jumlah: quantity})
+	}
+
+	SettleItems(data.ItemResep)
+
+	return dispensed, nil
+}
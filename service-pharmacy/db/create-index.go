@@ -53,3 +53,67 @@ func CreateKeyVaultIndex(keyVaultClient *mongo.Client, keyVaultNamespace string)
 	return nil
 
 }
+
+// CreateControlledRegisterIndex makes the position in the controlled
+// register unique per facility, so two entries can never claim the same
+// place in the hash chain.
+func CreateControlledRegisterIndex(client *mongo.Client) error {
+	registerIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "urutan", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("register_narkotika").Indexes().CreateOne(context.TODO(), registerIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create controlled register index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateInventoryIndex keeps a single stock item per drug and facility, so
+// two goods receipts of a drug not stocked yet cannot both add it.
+func CreateInventoryIndex(client *mongo.Client) error {
+	inventoryIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "id_obat", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("persediaan").Indexes().CreateOne(context.TODO(), inventoryIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create inventory index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateFormularyIndex keeps a drug registered once. The formulary is shared
+// by every facility, so id_obat is unique across clients.
+func CreateFormularyIndex(client *mongo.Client) error {
+	formularyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "id_obat", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("formularium").Indexes().CreateOne(context.TODO(), formularyIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create formulary index: %v", err)
+	}
+
+	return nil
+}
+
+// CreatePatientListIndex serves the list of a patient, which is paged in
+// the order of the IDs.
+func CreatePatientListIndex(client *mongo.Client) error {
+	listIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "peresepan.no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("fasyankes").Collection("apotek").Indexes().CreateOne(context.TODO(), listIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create patient list index: %v", err)
+	}
+
+	return nil
+}
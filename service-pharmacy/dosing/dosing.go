@@ -0,0 +1,273 @@
+package dosing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	NoDosingRuleError       = errors.New("the formulary has no dosing rule for a patient of this age and weight")
+	MeasurementMissingError = errors.New("the dosing rule needs the patient's weight or body surface area")
+)
+
+// childMonths is the age below which the pediatric body surface area is
+// kept on the prescription.
+const childMonths = 18 * 12
+
+// Patient holds what the dose of a patient depends on.
+type Patient struct {
+	UsiaBulan          uint    `json:"usia_bulan"`
+	BeratBadan         float64 `json:"berat_badan"`
+	TinggiBadan        float64 `json:"tinggi_badan"`
+	LuasPermukaanTubuh float64 `json:"luas_permukaan_tubuh"`
+}
+
+// Dose is the range of a drug worked out for a patient, in the unit of the
+// dosing rule.
+type Dose struct {
+	Aturan              pharmacy.DosingRule `json:"aturan"`
+	SatuanDosis         string              `json:"satuan_dosis"`
+	DosisMinimal        float64             `json:"dosis_minimal"`
+	DosisMaksimal       float64             `json:"dosis_maksimal"`
+	DosisHarianMaksimal float64             `json:"dosis_harian_maksimal"`
+}
+
+// Mosteller estimates the body surface area in m² from the height in cm and
+// the weight in kg.
+func Mosteller(height, weight float64) float64 {
+	if height <= 0 || weight <= 0 {
+		return 0
+	}
+
+	return round(math.Sqrt(height * weight / 3600))
+}
+
+func AgeInMonths(birth, at time.Time) uint {
+	if birth.IsZero() || at.Before(birth) {
+		return 0
+	}
+
+	months := (at.Year()-birth.Year())*12 + int(at.Month()) - int(birth.Month())
+	if at.Day() < birth.Day() {
+		months--
+	}
+
+	if months < 0 {
+		return 0
+	}
+
+	return uint(months)
+}
+
+// NewPatient works out the body surface area when it was not measured.
+func NewPatient(birth time.Time, height, weight, bsa float64, at time.Time) Patient {
+	patient := Patient{
+		UsiaBulan:          AgeInMonths(birth, at),
+		BeratBadan:         weight,
+		TinggiBadan:        height,
+		LuasPermukaanTubuh: bsa,
+	}
+
+	if patient.LuasPermukaanTubuh <= 0 {
+		patient.LuasPermukaanTubuh = Mosteller(height, weight)
+	}
+
+	return patient
+}
+
+func (patient *Patient) Child() bool {
+	return patient.UsiaBulan < childMonths
+}
+
+// SelectRule returns the first rule of the drug covering the patient.
+func SelectRule(drug *pharmacy.Drug, patient Patient) *pharmacy.DosingRule {
+	for i := 0; i < len(drug.AturanDosis); i++ {
+		if drug.AturanDosis[i].Applies(patient.UsiaBulan, patient.BeratBadan) {
+			return &drug.AturanDosis[i]
+		}
+	}
+
+	return nil
+}
+
+// Calculate scales the rule of the drug covering the patient by the weight or
+// body surface area, capped at the absolute maximum dose and daily dose.
+func Calculate(drug *pharmacy.Drug, patient Patient) (*Dose, error) {
+	rule := SelectRule(drug, patient)
+	if rule == nil {
+		return nil, fmt.Errorf("%s: %w", drug.IDObat, NoDosingRuleError)
+	}
+
+	factor := 1.0
+	switch rule.Basis {
+	case datastruct.DOSIS_PER_KG:
+		factor = patient.BeratBadan
+	case datastruct.DOSIS_PER_M2:
+		factor = patient.LuasPermukaanTubuh
+	}
+
+	if factor <= 0 {
+		return nil, fmt.Errorf("%s: %w", drug.IDObat, MeasurementMissingError)
+	}
+
+	dose := Dose{
+		Aturan:              *rule,
+		SatuanDosis:         rule.SatuanDosis,
+		DosisMinimal:        round(rule.DosisMinimal * factor),
+		DosisMaksimal:       round(rule.DosisMaksimal * factor),
+		DosisHarianMaksimal: round(rule.DosisHarianMaksimal * factor),
+	}
+
+	if limit := rule.DosisAbsolutMaksimal; limit > 0 {
+		if dose.DosisMaksimal == 0 || dose.DosisMaksimal > limit {
+			dose.DosisMaksimal = limit
+		}
+		if dose.DosisMinimal > limit {
+			dose.DosisMinimal = limit
+		}
+	}
+
+	if limit := rule.DosisHarianAbsolutMaksimal; limit > 0 {
+		if dose.DosisHarianMaksimal == 0 || dose.DosisHarianMaksimal > limit {
+			dose.DosisHarianMaksimal = limit
+		}
+	}
+
+	return &dose, nil
+}
+
+// Amount converts the dose written on an item into the unit of the rule. A
+// dose written in units of the dosage form, e.g. "1 tablet", is multiplied
+// by the strength of the drug.
+func Amount(item *pharmacy.PrescriptionItem, drug *pharmacy.Drug, unit string) (float64, bool) {
+	if sameUnit(item.SatuanDosis, unit) {
+		return item.Dosis, true
+	}
+
+	if drug.Kekuatan > 0 && sameUnit(drug.SatuanKekuatan, unit) {
+		return item.Dosis * drug.Kekuatan, true
+	}
+
+	return 0, false
+}
+
+// warningCode names a dose warning after the item, so two items of the same
+// drug are acknowledged on their own, e.g. "2/OBT-01/DOSIS:MAKSIMAL". An item
+// that was not numbered yet is named after the drug only.
+func warningCode(drug *pharmacy.Drug, item *pharmacy.PrescriptionItem, kind string) string {
+	if item.IDItem == "" {
+		return drug.IDObat + "/DOSIS:" + kind
+	}
+
+	return item.IDItem + "/" + drug.IDObat + "/DOSIS:" + kind
+}
+
+// measurementWarning tells the prescriber the dose could not be checked
+// because the rule for the patient needs a measurement that is missing.
+func measurementWarning(drug *pharmacy.Drug, item *pharmacy.PrescriptionItem, patient Patient) pharmacy.ClinicalWarning {
+	measurement := "luas permukaan tubuh (atau tinggi dan berat badan)"
+	if rule := SelectRule(drug, patient); rule != nil && rule.Basis == datastruct.DOSIS_PER_KG {
+		measurement = "berat badan"
+	}
+
+	return pharmacy.ClinicalWarning{
+		Kode:        warningCode(drug, item, "PENGUKURAN"),
+		IDObat:      drug.IDObat,
+		Jenis:       datastruct.PERINGATAN_DOSIS,
+		Tingkat:     datastruct.TINGKAT_SEDANG,
+		Deskripsi:   fmt.Sprintf("Dosis %s tidak dapat diperiksa karena %s pasien tidak diketahui", drug.Name(), measurement),
+		Rekomendasi: fmt.Sprintf("Lengkapi %s pasien atau periksa dosis %s secara manual", measurement, drug.Name()),
+	}
+}
+
+// Check compares the dose written on an item with the range for the patient.
+// Drugs without a rule for the patient, or doses that cannot be converted to
+// the unit of the rule, are not checked. A rule needing a measurement the
+// patient lacks is reported, since the dose could not be checked. Warning
+// codes are prefixed with the item, see warningCode.
+func Check(drug *pharmacy.Drug, item *pharmacy.PrescriptionItem, patient Patient) []pharmacy.ClinicalWarning {
+	warnings := []pharmacy.ClinicalWarning{}
+
+	dose, err := Calculate(drug, patient)
+	if errors.Is(err, MeasurementMissingError) {
+		return append(warnings, measurementWarning(drug, item, patient))
+	}
+	if err != nil {
+		return warnings
+	}
+
+	amount, ok := Amount(item, drug, dose.SatuanDosis)
+	if !ok {
+		return warnings
+	}
+
+	recommendation := fmt.Sprintf("Sesuaikan dosis %s ke rentang %s–%s %s per pemberian", drug.Name(), format(dose.DosisMinimal), format(dose.DosisMaksimal), dose.SatuanDosis)
+
+	if dose.DosisMaksimal > 0 && amount > dose.DosisMaksimal {
+		warnings = append(warnings, pharmacy.ClinicalWarning{
+			Kode:        warningCode(drug, item, "MAKSIMAL"),
+			IDObat:      drug.IDObat,
+			Jenis:       datastruct.PERINGATAN_DOSIS,
+			Tingkat:     datastruct.TINGKAT_BERAT,
+			Deskripsi:   fmt.Sprintf("Dosis %s %s %s melebihi dosis maksimal %s %s untuk pasien ini", drug.Name(), format(amount), dose.SatuanDosis, format(dose.DosisMaksimal), dose.SatuanDosis),
+			Rekomendasi: recommendation,
+		})
+	}
+
+	if dose.DosisMinimal > 0 && amount < dose.DosisMinimal {
+		warnings = append(warnings, pharmacy.ClinicalWarning{
+			Kode:        warningCode(drug, item, "MINIMAL"),
+			IDObat:      drug.IDObat,
+			Jenis:       datastruct.PERINGATAN_DOSIS,
+			Tingkat:     datastruct.TINGKAT_SEDANG,
+			Deskripsi:   fmt.Sprintf("Dosis %s %s %s di bawah dosis minimal %s %s untuk pasien ini", drug.Name(), format(amount), dose.SatuanDosis, format(dose.DosisMinimal), dose.SatuanDosis),
+			Rekomendasi: recommendation,
+		})
+	}
+
+	daily := amount * float64(item.FrekuensiPerHari)
+	if dose.DosisHarianMaksimal > 0 && daily > dose.DosisHarianMaksimal {
+		warnings = append(warnings, pharmacy.ClinicalWarning{
+			Kode:        warningCode(drug, item, "HARIAN"),
+			IDObat:      drug.IDObat,
+			Jenis:       datastruct.PERINGATAN_DOSIS,
+			Tingkat:     datastruct.TINGKAT_BERAT,
+			Deskripsi:   fmt.Sprintf("Dosis harian %s %s %s melebihi dosis harian maksimal %s %s untuk pasien ini", drug.Name(), format(daily), dose.SatuanDosis, format(dose.DosisHarianMaksimal), dose.SatuanDosis),
+			Rekomendasi: fmt.Sprintf("Kurangi dosis atau frekuensi %s hingga total tidak melebihi %s %s per hari", drug.Name(), format(dose.DosisHarianMaksimal), dose.SatuanDosis),
+		})
+	}
+
+	return warnings
+}
+
+// CheckItems checks every item against the drug resolved for it. Items
+// without a drug are skipped.
+func CheckItems(drugs []*pharmacy.Drug, items []pharmacy.PrescriptionItem, patient Patient) []pharmacy.ClinicalWarning {
+	warnings := []pharmacy.ClinicalWarning{}
+	for i := 0; i < len(items) && i < len(drugs); i++ {
+		if drugs[i] == nil {
+			continue
+		}
+		warnings = append(warnings, Check(drugs[i], &items[i], patient)...)
+	}
+
+	return warnings
+}
+
+func sameUnit(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func format(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,209 @@
+package dosing
+
+import (
+	"errors"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"testing"
+	"time"
+)
+
+func TestMosteller(t *testing.T) {
+	tests := []struct {
+		height, weight float64
+		want           float64
+	}{
+		{height: 180, weight: 80, want: 2},
+		{height: 100, weight: 16, want: 0.67},
+		{height: 50, weight: 3.5, want: 0.22},
+		{height: 0, weight: 20, want: 0},
+		{height: 120, weight: 0, want: 0},
+		{height: -150, weight: 50, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := Mosteller(tt.height, tt.weight); got != tt.want {
+			t.Errorf("Mosteller(%v, %v) = %v, want %v", tt.height, tt.weight, got, tt.want)
+		}
+	}
+}
+
+func TestAgeInMonths(t *testing.T) {
+	birth := time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want uint
+	}{
+		{name: "day of birth", at: birth, want: 0},
+		{name: "before the day of the month", at: time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC), want: 0},
+		{name: "on the day of the month", at: time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC), want: 2},
+		{name: "across years", at: time.Date(2023, time.January, 30, 0, 0, 0, 0, time.UTC), want: 35},
+		{name: "three years", at: time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC), want: 36},
+		{name: "before birth", at: birth.AddDate(0, 0, -1), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AgeInMonths(birth, tt.at); got != tt.want {
+				t.Errorf("AgeInMonths = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := AgeInMonths(time.Time{}, birth); got != 0 {
+		t.Errorf("AgeInMonths without a birth date = %d, want 0", got)
+	}
+}
+
+func paracetamol() *pharmacy.Drug {
+	return &pharmacy.Drug{
+		IDObat:         "OBT-PCT",
+		NamaGenerik:    "Parasetamol",
+		Kekuatan:       120,
+		SatuanKekuatan: "mg",
+		AturanDosis: []pharmacy.DosingRule{
+			{
+				UsiaMaksimalBulan:          18*12 - 1,
+				Basis:                      datastruct.DOSIS_PER_KG,
+				SatuanDosis:                "mg",
+				DosisMinimal:               10,
+				DosisMaksimal:              15,
+				DosisHarianMaksimal:        60,
+				DosisAbsolutMaksimal:       500,
+				DosisHarianAbsolutMaksimal: 4000,
+			},
+			{
+				UsiaMinimalBulan:    18 * 12,
+				Basis:               datastruct.DOSIS_TETAP,
+				SatuanDosis:         "mg",
+				DosisMinimal:        500,
+				DosisMaksimal:       1000,
+				DosisHarianMaksimal: 4000,
+			},
+		},
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name    string
+		patient Patient
+		want    Dose
+	}{
+		{
+			name:    "per kg",
+			patient: Patient{UsiaBulan: 48, BeratBadan: 16},
+			want:    Dose{DosisMinimal: 160, DosisMaksimal: 240, DosisHarianMaksimal: 960},
+		},
+		{
+			name:    "capped at the absolute maximum",
+			patient: Patient{UsiaBulan: 180, BeratBadan: 60},
+			want:    Dose{DosisMinimal: 500, DosisMaksimal: 500, DosisHarianMaksimal: 3600},
+		},
+		{
+			name:    "daily dose capped at the absolute maximum",
+			patient: Patient{UsiaBulan: 180, BeratBadan: 80},
+			want:    Dose{DosisMinimal: 500, DosisMaksimal: 500, DosisHarianMaksimal: 4000},
+		},
+		{
+			name:    "fixed adult dose",
+			patient: Patient{UsiaBulan: 400, BeratBadan: 70},
+			want:    Dose{DosisMinimal: 500, DosisMaksimal: 1000, DosisHarianMaksimal: 4000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dose, err := Calculate(paracetamol(), tt.patient)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+
+			if dose.DosisMinimal != tt.want.DosisMinimal || dose.DosisMaksimal != tt.want.DosisMaksimal || dose.DosisHarianMaksimal != tt.want.DosisHarianMaksimal {
+				t.Errorf("dose = %v–%v (%v a day), want %v–%v (%v a day)",
+					dose.DosisMinimal, dose.DosisMaksimal, dose.DosisHarianMaksimal,
+					tt.want.DosisMinimal, tt.want.DosisMaksimal, tt.want.DosisHarianMaksimal)
+			}
+			if dose.SatuanDosis != "mg" {
+				t.Errorf("SatuanDosis = %q, want mg", dose.SatuanDosis)
+			}
+		})
+	}
+}
+
+func TestCalculatePerSquareMetre(t *testing.T) {
+	drug := &pharmacy.Drug{
+		IDObat: "OBT-MTX",
+		AturanDosis: []pharmacy.DosingRule{
+			{Basis: datastruct.DOSIS_PER_M2, SatuanDosis: "mg", DosisMinimal: 10, DosisMaksimal: 20},
+		},
+	}
+
+	patient := NewPatient(time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC), 100, 16, 0, time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC))
+	if patient.LuasPermukaanTubuh != 0.67 {
+		t.Fatalf("LuasPermukaanTubuh = %v, want 0.67 from Mosteller", patient.LuasPermukaanTubuh)
+	}
+
+	dose, err := Calculate(drug, patient)
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	if dose.DosisMinimal != 6.7 || dose.DosisMaksimal != 13.4 {
+		t.Errorf("dose = %v–%v, want 6.7–13.4", dose.DosisMinimal, dose.DosisMaksimal)
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	if _, err := Calculate(paracetamol(), Patient{UsiaBulan: 48}); !errors.Is(err, MeasurementMissingError) {
+		t.Errorf("without a weight error = %v, want %v", err, MeasurementMissingError)
+	}
+
+	drug := &pharmacy.Drug{IDObat: "OBT-NONE"}
+	if _, err := Calculate(drug, Patient{UsiaBulan: 48, BeratBadan: 16}); !errors.Is(err, NoDosingRuleError) {
+		t.Errorf("without a rule error = %v, want %v", err, NoDosingRuleError)
+	}
+}
+
+func TestCheckItemCodes(t *testing.T) {
+	drug := paracetamol()
+	patient := Patient{UsiaBulan: 48, BeratBadan: 16}
+
+	items := []pharmacy.PrescriptionItem{
+		{IDItem: "1", IDObat: drug.IDObat, Dosis: 400, SatuanDosis: "mg", FrekuensiPerHari: 1},
+		{IDItem: "2", IDObat: drug.IDObat, Dosis: 400, SatuanDosis: "mg", FrekuensiPerHari: 1},
+	}
+
+	warnings := CheckItems([]*pharmacy.Drug{drug, drug}, items, patient)
+	if len(warnings) != 2 {
+		t.Fatalf("got %d warnings, want one per item: %+v", len(warnings), warnings)
+	}
+	if warnings[0].Kode != "1/OBT-PCT/DOSIS:MAKSIMAL" || warnings[1].Kode != "2/OBT-PCT/DOSIS:MAKSIMAL" {
+		t.Errorf("codes = %q and %q, want them keyed by item", warnings[0].Kode, warnings[1].Kode)
+	}
+}
+
+func TestCheckDailyAbsoluteMaximum(t *testing.T) {
+	drug := paracetamol()
+	item := pharmacy.PrescriptionItem{IDItem: "4", IDObat: drug.IDObat, Dosis: 500, SatuanDosis: "mg", FrekuensiPerHari: 9}
+
+	// 60 mg/kg a day would allow 4800 mg
+	warnings := Check(drug, &item, Patient{UsiaBulan: 180, BeratBadan: 80})
+	if len(warnings) != 1 || warnings[0].Kode != "4/OBT-PCT/DOSIS:HARIAN" {
+		t.Fatalf("warnings = %+v, want the daily dose over 4000 mg", warnings)
+	}
+}
+
+func TestCheckMissingMeasurement(t *testing.T) {
+	drug := paracetamol()
+	item := pharmacy.PrescriptionItem{IDItem: "3", IDObat: drug.IDObat, Dosis: 1, SatuanDosis: "tablet"}
+
+	warnings := Check(drug, &item, Patient{UsiaBulan: 48})
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1: %+v", len(warnings), warnings)
+	}
+	if warnings[0].Kode != "3/OBT-PCT/DOSIS:PENGUKURAN" || warnings[0].Jenis != datastruct.PERINGATAN_DOSIS {
+		t.Errorf("warning = %+v, want a dose warning about the missing weight", warnings[0])
+	}
+}
@@ -0,0 +1,275 @@
+// Package knowledge holds the drug interaction and allergy knowledge base
+// prescriptions are screened against. It is read from a local JSON file so
+// the pharmacy can keep it current without a release. Drugs are referred to
+// by ATC code, where a shorter code covers every drug below it, or by their
+// generic name.
+package knowledge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"service-pharmacy/config"
+	"service-pharmacy/datastruct"
+	"service-pharmacy/datastruct/pharmacy"
+	"service-pharmacy/logger"
+	"strings"
+)
+
+var Base *KnowledgeBase
+
+type Interaction struct {
+	ObatA       []string `json:"obat_a"`
+	ObatB       []string `json:"obat_b"`
+	Tingkat     string   `json:"tingkat"`
+	Deskripsi   string   `json:"deskripsi"`
+	Rekomendasi string   `json:"rekomendasi"`
+
+	severity datastruct.WarningSeverity
+}
+
+// AllergyClass links the allergen terms written in the anamnesis, e.g.
+// "penisilin", to the drugs that may cross react.
+type AllergyClass struct {
+	Alergen     []string `json:"alergen"`
+	Obat        []string `json:"obat"`
+	Tingkat     string   `json:"tingkat"`
+	Deskripsi   string   `json:"deskripsi"`
+	Rekomendasi string   `json:"rekomendasi"`
+
+	severity datastruct.WarningSeverity
+}
+
+type KnowledgeBase struct {
+	Interaksi []Interaction  `json:"interaksi"`
+	Alergi    []AllergyClass `json:"alergi"`
+}
+
+// terms written in the anamnesis when the patient has no known allergy
+var noAllergy = map[string]bool{
+	"":          true,
+	"-":         true,
+	"tidak ada": true,
+	"tidak":     true,
+	"disangkal": true,
+	"none":      true,
+}
+
+var atcPattern = regexp.MustCompile(`^[A-Z][0-9A-Z]*$`)
+
+// Init loads the knowledge base configured for the service. Prescriptions
+// must not go unscreened, so a missing or malformed file is fatal.
+func Init() {
+	var err error
+
+	Base, err = Load(config.InteractionKBFile)
+	if err != nil {
+		logger.LogFatal.Fatalf("failed to load interaction knowledge base: %v", err)
+	}
+
+	logger.LogInfo.Printf("Loaded %d drug interactions and %d allergy classes\n", len(Base.Interaksi), len(Base.Alergi))
+}
+
+func ParseSeverity(severity string) (datastruct.WarningSeverity, error) {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "ringan":
+		return datastruct.TINGKAT_RINGAN, nil
+	case "sedang":
+		return datastruct.TINGKAT_SEDANG, nil
+	case "berat":
+		return datastruct.TINGKAT_BERAT, nil
+	default:
+		return 0, fmt.Errorf("unknown severity %q", severity)
+	}
+}
+
+func Load(path string) (*KnowledgeBase, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var kb KnowledgeBase
+	if err := json.Unmarshal(file, &kb); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := 0; i < len(kb.Interaksi); i++ {
+		interaction := &kb.Interaksi[i]
+		if len(interaction.ObatA) == 0 || len(interaction.ObatB) == 0 {
+			return nil, fmt.Errorf("%s: interaction %d must list both drugs", path, i)
+		}
+
+		interaction.severity, err = ParseSeverity(interaction.Tingkat)
+		if err != nil {
+			return nil, fmt.Errorf("%s: interaction %d: %w", path, i, err)
+		}
+	}
+
+	for i := 0; i < len(kb.Alergi); i++ {
+		allergy := &kb.Alergi[i]
+		if len(allergy.Alergen) == 0 || len(allergy.Obat) == 0 {
+			return nil, fmt.Errorf("%s: allergy class %d must list allergens and drugs", path, i)
+		}
+
+		allergy.severity, err = ParseSeverity(allergy.Tingkat)
+		if err != nil {
+			return nil, fmt.Errorf("%s: allergy class %d: %w", path, i, err)
+		}
+	}
+
+	return &kb, nil
+}
+
+// Screen compares a drug against the patient's other active drugs and the
+// allergies recorded for the patient. Warning codes are prefixed with the
+// drug, e.g. "OBT-01/INTERAKSI:OBT-02".
+func (kb *KnowledgeBase) Screen(drug *pharmacy.Drug, active []pharmacy.Drug, allergies []string) []pharmacy.ClinicalWarning {
+	warnings := []pharmacy.ClinicalWarning{}
+
+	for i := 0; i < len(active); i++ {
+		other := &active[i]
+
+		if other.IDObat == drug.IDObat {
+			warnings = append(warnings, pharmacy.ClinicalWarning{
+				Kode:          "DUPLIKASI:" + other.IDObat,
+				Jenis:         datastruct.PERINGATAN_DUPLIKASI,
+				Tingkat:       datastruct.TINGKAT_SEDANG,
+				IDObatTerkait: other.IDObat,
+				Deskripsi:     fmt.Sprintf("%s sudah diresepkan dan masih aktif", other.Name()),
+				Rekomendasi:   "Pastikan resep sebelumnya dihentikan atau sesuaikan jumlah obat",
+			})
+			continue
+		}
+
+		// drugs of the same chemical subgroup (ATC level 4) treat the same thing
+		if len(drug.KodeATC) >= 5 && len(other.KodeATC) >= 5 && drug.KodeATC[:5] == other.KodeATC[:5] {
+			warnings = append(warnings, pharmacy.ClinicalWarning{
+				Kode:          "DUPLIKASI:" + other.IDObat,
+				Jenis:         datastruct.PERINGATAN_DUPLIKASI,
+				Tingkat:       datastruct.TINGKAT_RINGAN,
+				IDObatTerkait: other.IDObat,
+				Deskripsi:     fmt.Sprintf("%s dan %s berasal dari golongan terapi yang sama (%s)", drug.Name(), other.Name(), drug.KodeATC[:5]),
+				Rekomendasi:   "Pertimbangkan apakah kedua obat memang diperlukan",
+			})
+		}
+
+		for j := 0; j < len(kb.Interaksi); j++ {
+			interaction := &kb.Interaksi[j]
+			if !(matchesAny(drug, interaction.ObatA) && matchesAny(other, interaction.ObatB)) &&
+				!(matchesAny(drug, interaction.ObatB) && matchesAny(other, interaction.ObatA)) {
+				continue
+			}
+
+			warnings = append(warnings, pharmacy.ClinicalWarning{
+				Kode:          "INTERAKSI:" + other.IDObat,
+				Jenis:         datastruct.PERINGATAN_INTERAKSI,
+				Tingkat:       interaction.severity,
+				IDObatTerkait: other.IDObat,
+				Deskripsi:     fmt.Sprintf("%s dengan %s: %s", drug.Name(), other.Name(), interaction.Deskripsi),
+				Rekomendasi:   interaction.Rekomendasi,
+			})
+			break
+		}
+	}
+
+	for i := 0; i < len(allergies); i++ {
+		allergy := strings.ToLower(strings.TrimSpace(allergies[i]))
+		if noAllergy[allergy] {
+			continue
+		}
+
+		if mentionsDrug(allergy, drug) {
+			warnings = append(warnings, pharmacy.ClinicalWarning{
+				Kode:        "ALERGI:" + allergy,
+				Jenis:       datastruct.PERINGATAN_ALERGI,
+				Tingkat:     datastruct.TINGKAT_BERAT,
+				Deskripsi:   fmt.Sprintf("Pasien memiliki riwayat alergi %s", allergies[i]),
+				Rekomendasi: "Ganti dengan obat lain",
+			})
+			continue
+		}
+
+		for j := 0; j < len(kb.Alergi); j++ {
+			class := &kb.Alergi[j]
+			if !mentionsAny(allergy, class.Alergen) || !matchesAny(drug, class.Obat) {
+				continue
+			}
+
+			warnings = append(warnings, pharmacy.ClinicalWarning{
+				Kode:        "ALERGI:" + allergy,
+				Jenis:       datastruct.PERINGATAN_ALERGI,
+				Tingkat:     class.severity,
+				Deskripsi:   fmt.Sprintf("Pasien memiliki riwayat alergi %s: %s", allergies[i], class.Deskripsi),
+				Rekomendasi: class.Rekomendasi,
+			})
+			break
+		}
+	}
+
+	// warnings are acknowledged per drug of a prescription
+	for i := 0; i < len(warnings); i++ {
+		warnings[i].IDObat = drug.IDObat
+		warnings[i].Kode = drug.IDObat + "/" + warnings[i].Kode
+	}
+
+	return unique(warnings)
+}
+
+// unique keeps the first warning of every code, e.g. when the same allergy
+// was written twice.
+func unique(warnings []pharmacy.ClinicalWarning) []pharmacy.ClinicalWarning {
+	seen := map[string]bool{}
+	result := []pharmacy.ClinicalWarning{}
+	for i := 0; i < len(warnings); i++ {
+		if seen[warnings[i].Kode] {
+			continue
+		}
+
+		seen[warnings[i].Kode] = true
+		result = append(result, warnings[i])
+	}
+
+	return result
+}
+
+// matchesAny tells whether the drug is one of the ATC codes or generic names.
+func matchesAny(drug *pharmacy.Drug, references []string) bool {
+	for i := 0; i < len(references); i++ {
+		reference := strings.TrimSpace(references[i])
+		if atcPattern.MatchString(reference) && drug.KodeATC != "" && strings.HasPrefix(drug.KodeATC, reference) {
+			return true
+		}
+
+		if strings.EqualFold(reference, drug.NamaGenerik) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mentionsDrug tells whether an allergy names the drug itself.
+func mentionsDrug(allergy string, drug *pharmacy.Drug) bool {
+	names := []string{drug.NamaGenerik, drug.NamaDagang}
+	for i := 0; i < len(names); i++ {
+		name := strings.ToLower(strings.TrimSpace(names[i]))
+		if len(name) >= 3 && strings.Contains(allergy, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mentionsAny(allergy string, allergens []string) bool {
+	for i := 0; i < len(allergens); i++ {
+		allergen := strings.ToLower(strings.TrimSpace(allergens[i]))
+		if allergen != "" && strings.Contains(allergy, allergen) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,12 +5,14 @@ import (
 	"service-pharmacy/config"
 	"service-pharmacy/db"
 	"service-pharmacy/db/csfle"
+	"service-pharmacy/knowledge"
 	"service-pharmacy/logger"
 	"service-pharmacy/router"
 )
 
 func main() {
 	cfg := config.Get()
+	knowledge.Init()
 	keyVaultNamespace := "encryption.__keyVault"
 
 	client := db.ConnectDB(&cfg)
@@ -21,6 +23,26 @@ func main() {
 		return
 	}
 
+	if err := db.CreateControlledRegisterIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateFormularyIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateInventoryIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreatePatientListIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
 	csfle := csfle.InitCSFLE(&cfg, client)
 
 	err := csfle.CreateClientEncryption(keyVaultNamespace).GetKey()
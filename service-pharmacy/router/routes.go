@@ -6,6 +6,7 @@ import (
 	"service-pharmacy/datastruct"
 	"service-pharmacy/db/csfle"
 	"service-pharmacy/middleware"
+	"service-pharmacy/pagination"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,14 +14,16 @@ import (
 )
 
 type RouterConfig struct {
-	Client             *mongo.Client
-	PharmacyController *fasyankes_controllers.PharmacyController
+	Client               *mongo.Client
+	PharmacyController   *fasyankes_controllers.PharmacyController
+	AttachmentController *fasyankes_controllers.AttachmentController
 }
 
 func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
 	routerConfig := RouterConfig{
-		Client:             client,
-		PharmacyController: fasyankes_controllers.InitPharmacyController(client, csfle),
+		Client:               client,
+		PharmacyController:   fasyankes_controllers.InitPharmacyController(client, csfle),
+		AttachmentController: fasyankes_controllers.InitAttachmentController(client, csfle),
 	}
 
 	return routerConfig.SetRouter()
@@ -32,6 +35,18 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 
 	router.GET("/live", LivenessCheck())
 	router.GET("/ready", ReadinessCheck(routerConfig.Client))
+
+	// signed download links are opened without a token or timestamp, e.g.
+	// from an image tag
+	router.GET(fasyankes_controllers.AttachmentLinkPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"expires", "signature"}}),
+		routerConfig.AttachmentController.LinkedAttachmentHandler())
+
+	// printed documents are verified by scanning their QR code
+	router.GET(fasyankes_controllers.DocumentVerifyPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"fingerprint"}}),
+		routerConfig.PharmacyController.VerifyPrescriptionHandler())
+
 	router.Use(middleware.CORS(), middleware.Timekeep(time.Duration(config.TimestampSkew)*time.Millisecond))
 
 	// Define routes
@@ -53,14 +68,127 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	}
 
 	ap2 := middleware.AcceptableParams{
-		Queries: []string{"no_rekam_medis", "id_pelanggan", "id_obat", "nik"},
+		Queries: append([]string{"no_rekam_medis", "id_pelanggan", "id_obat", "nik", "id_kunjungan"}, pagination.Queries...),
+	}
+
+	formularyUpdateConfig := map[string]string{
+		"filterKey": "id_obat",
+		"paramKey":  "idObat",
+	}
+
+	ap3 := middleware.AcceptableParams{
+		Queries: append([]string{"q", "kode_atc", "bentuk_sediaan", "rute_pemberian", "fornas", "golongan"}, pagination.Queries...),
+	}
+
+	resource.GET("/pharmacy/formulary",
+		middleware.Sanitize(ap3),
+		routerConfig.PharmacyController.GetFormularyHandler())
+
+	resource.GET("/pharmacy/formulary/:idObat",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.GetDrugHandler())
+
+	resource.POST("/pharmacy/formulary",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.CreateDrugHandler())
+
+	resource.PUT("/pharmacy/formulary/:idObat",
+		middleware.AuthorizationUpdate(formularyUpdateConfig, routerConfig.PharmacyController.FormularyCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.UpdateDrugHandler())
+
+	resource.DELETE("/pharmacy/formulary/:idObat",
+		middleware.AuthorizationDelete(formularyUpdateConfig, routerConfig.PharmacyController.FormularyCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.DeleteDrugHandler())
+
+	ap4 := middleware.AcceptableParams{
+		Queries: append([]string{"q", "lokasi"}, pagination.Queries...),
+	}
+
+	ap5 := middleware.AcceptableParams{
+		Queries: pagination.Queries,
+	}
+
+	ap6 := middleware.AcceptableParams{
+		Queries: append([]string{"hari"}, pagination.Queries...),
+	}
+
+	resource.GET("/pharmacy/inventory",
+		middleware.Sanitize(ap4),
+		routerConfig.PharmacyController.GetInventoryHandler())
+
+	resource.POST("/pharmacy/inventory",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.CreateInventoryItemHandler())
+
+	resource.POST("/pharmacy/inventory/receipt",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.GoodsReceiptHandler())
+
+	resource.POST("/pharmacy/inventory/opname",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.StockOpnameHandler())
+
+	resource.GET("/pharmacy/inventory/report/low-stock",
+		middleware.Sanitize(ap5),
+		routerConfig.PharmacyController.LowStockReportHandler())
+
+	resource.GET("/pharmacy/inventory/report/near-expiry",
+		middleware.Sanitize(ap6),
+		routerConfig.PharmacyController.NearExpiryReportHandler())
+
+	resource.GET("/pharmacy/inventory/:idObat",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.GetInventoryItemHandler())
+
+	resource.PUT("/pharmacy/inventory/:idObat",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.UpdateInventoryItemHandler())
+
+	resource.POST("/pharmacy/inventory/:idObat/adjustment",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.StockAdjustmentHandler())
+
+	resource.GET("/pharmacy/inventory/:idObat/ledger",
+		middleware.Sanitize(ap5),
+		routerConfig.PharmacyController.GetStockLedgerHandler())
+
+	ap7 := middleware.AcceptableParams{
+		Queries: append([]string{"id_obat"}, pagination.Queries...),
+	}
+
+	ap8 := middleware.AcceptableParams{
+		Queries: []string{"periode", "format"},
 	}
 
+	resource.GET("/pharmacy/controlled/register",
+		middleware.Sanitize(ap7),
+		routerConfig.PharmacyController.GetControlledRegisterHandler())
+
+	resource.GET("/pharmacy/controlled/register/verify",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.VerifyControlledRegisterHandler())
+
+	resource.GET("/pharmacy/controlled/report",
+		middleware.Sanitize(ap8),
+		routerConfig.PharmacyController.ControlledReportHandler())
+
 	resource.GET("/pharmacy/:noIHS",
 		middleware.GetConsent(consentGetter),
 		middleware.Sanitize(ap2),
 		routerConfig.PharmacyController.GetAllPharmacyHandler())
 
+	resource.GET("/pharmacy/:noIHS/:Id/pdf",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.PrescriptionHandler())
+
+	resource.GET("/pharmacy/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.PrescriptionSignatureHandler())
+
 	resource.POST("/pharmacy",
 		middleware.Sanitize(ap),
 		routerConfig.PharmacyController.CreatePharmacyHandler())
@@ -71,11 +199,90 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		middleware.Sanitize(ap),
 		routerConfig.PharmacyController.UpdatePharmacyHandler())
 
+	resource.PUT("/pharmacy/:noIHS/:Id/item/:idItem/review",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.ReviewPrescriptionItemHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/receive",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.ReceivePrescriptionHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/review",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.ReviewPrescriptionHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/prepare",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.PreparePrescriptionHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/dispense",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.DispensePrescriptionHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/handover",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.HandoverPrescriptionHandler())
+
+	resource.PUT("/pharmacy/:noIHS/:Id/reject",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.RejectPrescriptionHandler())
+
 	resource.DELETE("/pharmacy/:Id",
 		middleware.AuthorizationDelete(authUpdateConfig, routerConfig.PharmacyController.FaskesCollection),
 		middleware.Sanitize(ap),
 		routerConfig.PharmacyController.DeletePharmacyHandler())
 
+	resource.POST("/pharmacy/check",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.CheckPrescriptionHandler())
+
+	resource.POST("/pharmacy/dosing",
+		middleware.Sanitize(ap),
+		routerConfig.PharmacyController.CalculateDoseHandler())
+
+	attachmentDeleteConfig := map[string]string{
+		"filterKey": "_id",
+		"paramKey":  "id",
+	}
+
+	resource.POST("/attachment/:noIHS",
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.UploadAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.GetAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id/content",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.DownloadAttachmentHandler())
+
+	resource.POST("/attachment/:noIHS/:id/link",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.AttachmentLinkHandler())
+
+	resource.DELETE("/attachment/:noIHS/:id",
+		middleware.AuthorizationDelete(attachmentDeleteConfig, routerConfig.AttachmentController.AttachmentCollection),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.DeleteAttachmentHandler())
+
 	resource.POST("/pharmacy/consent",
 		middleware.Sanitize(ap),
 		fasyankes_controllers.ConsentHandler(routerConfig.PharmacyController.ConsentCollection))
@@ -83,8 +290,16 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	request := v1.Group("/request")
 	request.Use(middleware.Authorization(datastruct.DOKTER))
 
+	request.GET("/pharmacy/formulary", middleware.Sanitize(ap3), routerConfig.PharmacyController.GetFormularyHandler())
+	request.GET("/pharmacy/formulary/:idObat", routerConfig.PharmacyController.GetDrugHandler())
+	request.GET("/pharmacy/:noIHS", middleware.GetConsent(consentGetter), middleware.Sanitize(ap2), routerConfig.PharmacyController.GetAllPharmacyHandler())
 	request.GET("/pharmacy/:noIHS/:Id", middleware.GetConsent(consentGetter), routerConfig.PharmacyController.GetPharmacyDataById())
+	request.GET("/pharmacy/:noIHS/:Id/pdf", middleware.GetConsent(consentGetter), routerConfig.PharmacyController.PrescriptionHandler())
+	request.GET("/pharmacy/:noIHS/:Id/signature", middleware.GetConsent(consentGetter), routerConfig.PharmacyController.PrescriptionSignatureHandler())
+	request.POST("/pharmacy/:noIHS/:Id/signature", middleware.GetConsent(consentGetter), routerConfig.PharmacyController.SignPrescriptionHandler())
 	request.POST("/pharmacy", routerConfig.PharmacyController.CreatePharmacyRequest())
+	request.POST("/pharmacy/check", routerConfig.PharmacyController.CheckPrescriptionHandler())
+	request.POST("/pharmacy/dosing", routerConfig.PharmacyController.CalculateDoseHandler())
 
 	return router
 }
@@ -0,0 +1,175 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServerError is returned when the object storage answered with an error
+// status.
+type ServerError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (serverError *ServerError) Error() string {
+	return fmt.Sprintf("object storage responded with %s - %s", serverError.Status, serverError.Body)
+}
+
+// S3Store keeps attachments in a bucket of an S3 compatible object storage,
+// e.g. MinIO. Objects are addressed path-style, which every S3 compatible
+// storage understands.
+type S3Store struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string, timeout time.Duration) *S3Store {
+	return &S3Store{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{Timeout: timeout},
+	}
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (store *S3Store) sign(req *http.Request, payload []byte, now time.Time) {
+	payloadHash := hashHex(payload)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, store.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+store.SecretKey), date)
+	key = hmacSHA256(key, store.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		store.AccessKey,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+// send runs a signed request on an object and turns error statuses into
+// errors. The caller closes the body of a successful response.
+func (store *S3Store) send(ctx context.Context, method, key string, payload []byte) (*http.Response, error) {
+	target := fmt.Sprintf("%s/%s/%s", store.Endpoint, store.Bucket, key)
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	store.sign(req, payload, time.Now())
+
+	resp, err := store.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, NotFoundError
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &ServerError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(respBody),
+		}
+	}
+
+	return resp, nil
+}
+
+func (store *S3Store) Put(ctx context.Context, key string, content []byte) error {
+	resp, err := store.send(ctx, http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (store *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := store.send(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// Delete removes the object. Objects which are already gone are not an
+// error, as S3 does not tell them apart either.
+func (store *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := store.send(ctx, http.MethodDelete, key, nil)
+	if err != nil && !errors.Is(err, NotFoundError) {
+		return err
+	}
+
+	if resp != nil {
+		return resp.Body.Close()
+	}
+
+	return nil
+}
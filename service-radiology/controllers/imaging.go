@@ -0,0 +1,508 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"service-radiology/datastruct/radiology"
+	"service-radiology/datastruct/user"
+	"service-radiology/dicomweb"
+	"service-radiology/logger"
+	"service-radiology/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StudyUploadResult struct {
+	Studi       radiology.ImagingStudy `json:"studi"`
+	JumlahGagal int                    `json:"jumlah_gagal"`
+}
+
+// imagingErrorStatus tells client mistakes and conflicts apart from the PACS
+// failing or being unreachable, and from database failures.
+func imagingErrorStatus(err error) int {
+	if errors.Is(err, dicomweb.InvalidUIDError) || errors.Is(err, dicomweb.InvalidFileError) {
+		return http.StatusBadRequest
+	}
+
+	if errors.Is(err, dicomweb.NotFoundError) || errors.Is(err, radiology.NoStudyLinkedError) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, radiology.StudyAlreadyLinkedError) ||
+		errors.Is(err, radiology.ConcurrentUpdateError) ||
+		errors.Is(err, radiology.StudyPatientMismatchError) ||
+		errors.Is(err, radiology.StudyPatientUnknownError) ||
+		errors.Is(err, radiology.MultipleStudiesError) {
+		return http.StatusConflict
+	}
+
+	var serverError *dicomweb.ServerError
+	if errors.As(err, &serverError) || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusBadGateway
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
+
+// findRadiologyData loads a radiology document with its confidential data
+// decrypted. Without the patient's consent only documents of the user's own
+// client are found.
+func (radiologyController *RadiologyController) findRadiologyData(c *gin.Context) (*radiology.RadiologyData, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("Id"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":    id,
+		"no_ihs": c.Param("noIHS"),
+	}
+	if !c.GetBool("patientConsent") {
+		filter["client_id"] = c.GetString("userClient")
+	}
+
+	var data radiology.RadiologyData
+	if err := radiologyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	signature := data.Signature
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	if err != nil {
+		logger.LogPanic.Panicf("Failed to marshal json data")
+	}
+
+	if signature == nil {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+	} else if _, err = utils.VerifySignature(string(dataByte), *signature); err != nil {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", id.Hex())
+	}
+
+	utils.Decrypt(
+		data.ConfidentialEncrypted,
+		radiologyController.ClientEncryption,
+	).Unmarshal(&data.ConfidentialData)
+
+	data.Signature = signature
+	data.ID = id
+
+	return &data, nil
+}
+
+// sealRadiologyData encrypts the confidential data again and signs the
+// document the same way it was signed on creation.
+func (radiologyController *RadiologyController) sealRadiologyData(data *radiology.RadiologyData) error {
+	data.Index(radiologyController.BlindIndex)
+	data.ConfidentialEncrypted = utils.EncryptRandom(
+		data.ConfidentialData,
+		radiologyController.ClientEncryption,
+		radiologyController.EncryptionOpts,
+	)
+	data.ConfidentialData = nil
+
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	signature := utils.GenerateSignature(string(dataByte))
+	data.Signature = &signature
+	data.ID = id
+
+	return nil
+}
+
+// updateRadiologyData writes a sealed document back, failing when it was
+// changed since it was read.
+func (radiologyController *RadiologyController) updateRadiologyData(data *radiology.RadiologyData, previousUpdate *time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":        data.ID,
+		"updated_at": previousUpdate,
+	}
+
+	id := data.ID
+	data.ID = primitive.NilObjectID
+	result, err := radiologyController.FaskesCollection.UpdateOne(context.Background(), filter, bson.M{"$set": data})
+	data.ID = id
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+type orderReferences struct {
+	IDKunjungan           *primitive.ObjectID           `bson:"id_kunjungan"`
+	AccessionNumber       string                        `bson:"accession_number"`
+	Jadwal                *radiology.ScheduledProcedure `bson:"jadwal"`
+	StudyInstanceUID      string                        `bson:"study_instance_uid"`
+	ConfidentialEncrypted *primitive.Binary             `bson:"encrypted_confidential"`
+
+	Laporan  *radiology.RadiologyReport `bson:"-"`
+	Skrining *radiology.SafetyScreening `bson:"-"`
+}
+
+// orderReferences returns the encounter, worklist entry, study, report and
+// safety screening of a document, which the generic update keeps as they are.
+func (radiologyController *RadiologyController) orderReferences(filter bson.M) (*orderReferences, error) {
+	var references orderReferences
+
+	opts := options.FindOne().SetProjection(bson.M{"id_kunjungan": 1, "accession_number": 1, "jadwal": 1, "study_instance_uid": 1, "encrypted_confidential": 1})
+	if err := radiologyController.FaskesCollection.FindOne(context.Background(), filter, opts).Decode(&references); err != nil {
+		return nil, err
+	}
+
+	if references.ConfidentialEncrypted != nil {
+		var confidential radiology.ConfidentialRadiologyData
+		utils.Decrypt(
+			references.ConfidentialEncrypted,
+			radiologyController.ClientEncryption,
+		).Unmarshal(&confidential)
+
+		references.Laporan = confidential.HasilPemeriksaan.Laporan
+		references.Skrining = confidential.Skrining
+		references.ConfidentialEncrypted = nil
+	}
+
+	return &references, nil
+}
+
+// lookupStudies finds the linked studies in the PACS with a single search.
+// The documents are still shown when the PACS cannot be reached.
+func (radiologyController *RadiologyController) lookupStudies(ctx context.Context, uids []string) map[string]radiology.ImagingStudy {
+	studies := map[string]radiology.ImagingStudy{}
+
+	valid := []string{}
+	for i := 0; i < len(uids); i++ {
+		if dicomweb.ValidUID(uids[i]) {
+			valid = append(valid, uids[i])
+		}
+	}
+
+	if len(valid) == 0 {
+		return studies
+	}
+
+	found, err := radiologyController.DICOMWeb.SearchStudies(ctx, url.Values{dicomweb.TagStudyInstanceUID: {strings.Join(valid, "\\")}})
+	if err != nil {
+		logger.LogWarning.Printf("Failed to look up studies in the PACS: %v\n", err)
+		return studies
+	}
+
+	for i := 0; i < len(found); i++ {
+		study := dicomweb.StudyFromSearch(found[i])
+		studies[study.StudyInstanceUID] = study
+	}
+
+	return studies
+}
+
+// checkStudyPatient refuses studies that do not name the patient of the
+// document. A study without a patient ID must carry the accession number of
+// the order instead.
+func checkStudyPatient(dataset dicomweb.Dataset, data *radiology.RadiologyData) error {
+	patientID := strings.TrimSpace(dataset.String(dicomweb.TagPatientID))
+	if patientID != "" {
+		if patientID != data.NoIHS {
+			return radiology.StudyPatientMismatchError
+		}
+		return nil
+	}
+
+	accessionNumber := strings.TrimSpace(dataset.String(dicomweb.TagAccessionNumber))
+	if accessionNumber == "" || accessionNumber != data.AccessionNumber {
+		return radiology.StudyPatientUnknownError
+	}
+
+	return nil
+}
+
+// checkUpload reads the header of every uploaded file and makes sure they
+// make up one study the document can be linked to, before anything is
+// stored in the PACS.
+func checkUpload(headers []*multipart.FileHeader, data *radiology.RadiologyData) error {
+	studyUID := ""
+	for i := 0; i < len(headers); i++ {
+		file, err := headers[i].Open()
+		if err != nil {
+			return err
+		}
+
+		dataset, err := dicomweb.ReadHeader(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", headers[i].Filename, err)
+		}
+
+		uid := dataset.String(dicomweb.TagStudyInstanceUID)
+		if !dicomweb.ValidUID(uid) {
+			return fmt.Errorf("%s: %w", headers[i].Filename, dicomweb.InvalidUIDError)
+		}
+
+		if studyUID != "" && uid != studyUID {
+			return radiology.MultipleStudiesError
+		}
+		studyUID = uid
+
+		if err := checkStudyPatient(dataset, data); err != nil {
+			return fmt.Errorf("%s: %w", headers[i].Filename, err)
+		}
+	}
+
+	if data.StudyInstanceUID != "" && data.StudyInstanceUID != studyUID {
+		return radiology.StudyAlreadyLinkedError
+	}
+
+	return nil
+}
+
+// linkStudy checks the study against the document and the PACS, then links
+// and saves the document.
+func (radiologyController *RadiologyController) linkStudy(c *gin.Context, data *radiology.RadiologyData, studyUID string) (*radiology.ImagingStudy, error) {
+	if data.StudyInstanceUID != "" && data.StudyInstanceUID != studyUID {
+		return nil, radiology.StudyAlreadyLinkedError
+	}
+
+	dataset, err := radiologyController.DICOMWeb.FindStudy(c.Request.Context(), studyUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStudyPatient(dataset, data); err != nil {
+		return nil, err
+	}
+
+	if err := radiologyController.saveStudyLink(data, studyUID); err != nil {
+		return nil, err
+	}
+
+	study := dicomweb.StudyFromSearch(dataset)
+	return &study, nil
+}
+
+// LinkStudyHandler links a radiology document to a study already held by
+// the PACS.
+func (radiologyController *RadiologyController) LinkStudyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		var body radiology.LinkStudyBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !dicomweb.ValidUID(body.StudyInstanceUID) {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": dicomweb.InvalidUIDError.Error()})
+			return
+		}
+
+		data, err := radiologyController.findRadiologyData(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		study, err := radiologyController.linkStudy(c, data, body.StudyInstanceUID)
+		if err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, study)
+	}
+}
+
+// UploadStudyHandler stores the DICOM files sent in the "file" fields in the
+// PACS through STOW-RS and links the document to their study. The files are
+// checked first, so a refused upload stores nothing.
+func (radiologyController *RadiologyController) UploadStudyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		headers := form.File["file"]
+		if len(headers) == 0 {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "at least one dicom file is required in the file field"})
+			return
+		}
+
+		data, err := radiologyController.findRadiologyData(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := checkUpload(headers, data); err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		files := []io.Reader{}
+		for i := 0; i < len(headers); i++ {
+			file, err := headers[i].Open()
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer file.Close()
+
+			files = append(files, file)
+		}
+
+		response, err := radiologyController.DICOMWeb.Store(c.Request.Context(), files)
+		if err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		studies, failed := dicomweb.StoredStudies(response)
+		if len(studies) == 0 {
+			utils.JSON(c, http.StatusBadGateway, gin.H{"error": dicomweb.NothingStoredError.Error(), "jumlah_gagal": failed})
+			return
+		}
+
+		if len(studies) > 1 {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.MultipleStudiesError.Error(), "study_instance_uid": studies})
+			return
+		}
+
+		study, err := radiologyController.linkStudy(c, data, studies[0])
+		if err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, StudyUploadResult{Studi: *study, JumlahGagal: failed})
+	}
+}
+
+// GetStudyHandler shows the series and instances of the linked study.
+func (radiologyController *RadiologyController) GetStudyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := radiologyController.findRadiologyData(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if data.StudyInstanceUID == "" {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": radiology.NoStudyLinkedError.Error()})
+			return
+		}
+
+		metadata, err := radiologyController.DICOMWeb.StudyMetadata(c.Request.Context(), data.StudyInstanceUID)
+		if err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		study := dicomweb.StudyFromMetadata(metadata)
+		if study == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": dicomweb.NotFoundError.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, study)
+	}
+}
+
+// RenderedInstanceHandler proxies an instance of the linked study rendered
+// as JPEG, or PNG when asked for, so images are only reachable through the
+// same consent check as the document.
+func (radiologyController *RadiologyController) RenderedInstanceHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := radiologyController.findRadiologyData(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if data.StudyInstanceUID == "" {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": radiology.NoStudyLinkedError.Error()})
+			return
+		}
+
+		accept := "image/jpeg"
+		if strings.Contains(c.GetHeader("Accept"), "image/png") {
+			accept = "image/png"
+		}
+
+		query := url.Values{}
+		for _, key := range []string{"quality", "viewport"} {
+			if value := c.Query(key); value != "" {
+				query.Set(key, value)
+			}
+		}
+
+		resp, err := radiologyController.DICOMWeb.Rendered(
+			c.Request.Context(),
+			data.StudyInstanceUID,
+			c.Param("seriesUID"),
+			c.Param("instanceUID"),
+			accept,
+			query,
+		)
+		if err != nil {
+			utils.JSON(c, imagingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		defer resp.Body.Close()
+
+		c.DataFromReader(http.StatusOK, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, map[string]string{
+			"Cache-Control": "private, no-store",
+		})
+	}
+}
@@ -6,11 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"service-radiology/blindindex"
+	"service-radiology/config"
 	specialityexamination "service-radiology/datastruct/outpatient"
 	"service-radiology/datastruct/radiology"
 	"service-radiology/datastruct/user"
 	"service-radiology/db/csfle"
+	"service-radiology/dicomweb"
+	"service-radiology/document"
 	"service-radiology/logger"
+	"service-radiology/pagination"
+	"service-radiology/signing"
 	"service-radiology/utils"
 	"time"
 
@@ -22,20 +28,46 @@ import (
 )
 
 type RadiologyController struct {
-	FaskesCollection  *mongo.Collection
-	ConsentCollection *mongo.Collection
+	FaskesCollection     *mongo.Collection
+	ConsentCollection    *mongo.Collection
+	CounterCollection    *mongo.Collection
+	TemplateCollection   *mongo.Collection
+	RuleCollection       *mongo.Collection
+	AttachmentCollection *mongo.Collection
+	Letterhead           document.Letterhead
 
 	ClientEncryption *mongo.ClientEncryption
 	EncryptionOpts   *options.EncryptOptions
+
+	DICOMWeb   *dicomweb.Client
+	Signing    *signing.Client
+	BlindIndex *blindindex.Index
 }
 
 func InitRadiologyController(client *mongo.Client, csfle *csfle.CSFLE) *RadiologyController {
 	return &RadiologyController{
-		FaskesCollection:  client.Database("fasyankes").Collection("radiologi"),
-		ConsentCollection: client.Database("emr").Collection("consent"),
+		FaskesCollection:     client.Database("fasyankes").Collection("radiologi"),
+		ConsentCollection:    client.Database("emr").Collection("consent"),
+		CounterCollection:    client.Database("fasyankes").Collection("nomor_akses"),
+		TemplateCollection:   client.Database("fasyankes").Collection("template_laporan_radiologi"),
+		RuleCollection:       client.Database("fasyankes").Collection("aturan_skrining_radiologi"),
+		AttachmentCollection: client.Database("emr").Collection("lampiran"),
+		Letterhead:           loadLetterhead(),
 
 		ClientEncryption: csfle.ClientEncryption,
 		EncryptionOpts:   options.Encrypt().SetKeyID(*csfle.DEK), //
+
+		DICOMWeb: dicomweb.New(
+			config.DICOMWebURL,
+			config.DICOMWebUsername,
+			config.DICOMWebPassword,
+			time.Duration(config.DICOMWebTimeout)*time.Second,
+		),
+		Signing: signing.New(
+			config.AuthServiceURL,
+			time.Duration(config.AuthServiceTimeout)*time.Second,
+		),
+		BlindIndex: loadBlindIndex(),
 	}
 }
 
@@ -107,6 +139,12 @@ func (radiologyController *RadiologyController) GetRadiologyDataById() gin.Handl
 		radiologyrequest.Signature = signature
 		radiologyrequest.ID = id
 
+		if uid := radiologyrequest.StudyInstanceUID; uid != "" {
+			if study, ok := radiologyController.lookupStudies(c.Request.Context(), []string{uid})[uid]; ok {
+				radiologyrequest.Studi = &study
+			}
+		}
+
 		utils.JSON(c, http.StatusOK, radiologyrequest)
 	}
 }
@@ -121,9 +159,39 @@ func (radiologyController *RadiologyController) CreateRadiologyRequest() gin.Han
 
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 
+		// studies are linked once the pacs holds them, and reported on by
+		// the radiologist
+		radiologyrequest.StudyInstanceUID = ""
+		radiologyrequest.ConfidentialData.HasilPemeriksaan.Laporan = nil
+		radiologyrequest.ConfidentialData.HasilPemeriksaan.LampiranFoto = nil
+		radiologyrequest.Lampiran = nil
+
+		if err := radiologyController.scheduleOrder(&radiologyrequest, now); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// orders blocked by the safety screening stay off the worklist
+		// until a radiologist overrides them
+		rules, err := radiologyController.screeningRules(c.GetString("userClient"))
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		confidential := radiologyrequest.ConfidentialData
+		confidential.Skrining = radiology.Screen(rules, radiology.ScreeningSubject{
+			StatusKehamilan:   confidential.StatusKehamilan,
+			StatusAlergi:      confidential.StatusAlergi,
+			JenisBahanKontras: confidential.JenisBahanKontras,
+			Modalitas:         screeningModality(radiologyrequest.Jadwal, radiologyrequest.JenisPemeriksaan),
+			Pasien:            confidential.Pasien,
+		}, nil, now)
+
 		radiologyrequest.CreatedAt = &now
 		radiologyrequest.UpdatedAt = &now
 
+		radiologyrequest.Index(radiologyController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			radiologyrequest.ConfidentialData,
 			radiologyController.ClientEncryption,
@@ -178,6 +246,15 @@ func (radiologyController *RadiologyController) GetAllRadiologyDataHandler() gin
 			filter["nama_pemeriksaan"] = regex
 		}
 
+		if idKunjungan := c.Query("id_kunjungan"); idKunjungan != "" {
+			encounterID, err := primitive.ObjectIDFromHex(idKunjungan)
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": radiology.InvalidEncounterError.Error()})
+				return
+			}
+			filter["id_kunjungan"] = encounterID
+		}
+
 		if !c.GetBool("patientConsent") {
 			filter["$or"] = bson.A{
 				bson.M{"client_id": c.GetString("userClient")},
@@ -185,21 +262,62 @@ func (radiologyController *RadiologyController) GetAllRadiologyDataHandler() gin
 			}
 		}
 
-		// Query all radiology data
-		cursor, err := radiologyController.FaskesCollection.Find(context.Background(), filter)
+		// the examination time is encrypted, its range is searched by its
+		// tokens
+		from, to := c.Query("pemeriksaan_from"), c.Query("pemeriksaan_to")
+		if from != "" || to != "" {
+			start, end, err := blindindex.ParseRange(from, to, time.Now())
+			if err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			tokens, err := radiologyController.BlindIndex.DateQuery(radiology.ExaminationTimeField, start, end)
+			if err != nil {
+				utils.JSON(c, searchErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			filter["indeks_waktu_pemeriksaan"] = bson.M{"$in": tokens}
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := radiologyController.FaskesCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		// Query a page of radiology data
+		cursor, err := radiologyController.FaskesCollection.Find(context.Background(), filter, params.FindOptions())
 		if err != nil {
 			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer cursor.Close(context.Background())
 
-		var radiologyData []radiology.RadiologyData
+		radiologyData := []radiology.RadiologyData{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
 		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
 			var data radiology.RadiologyData
 			if err := cursor.Decode(&data); err != nil {
 				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			last = data.ID
 
 			signature := data.Signature
 			id := data.ID
@@ -234,7 +352,21 @@ func (radiologyController *RadiologyController) GetAllRadiologyDataHandler() gin
 			return
 		}
 
-		utils.JSON(c, http.StatusOK, radiologyData)
+		uids := []string{}
+		for i := 0; i < len(radiologyData); i++ {
+			if radiologyData[i].StudyInstanceUID != "" {
+				uids = append(uids, radiologyData[i].StudyInstanceUID)
+			}
+		}
+
+		studies := radiologyController.lookupStudies(c.Request.Context(), uids)
+		for i := 0; i < len(radiologyData); i++ {
+			if study, ok := studies[radiologyData[i].StudyInstanceUID]; ok {
+				radiologyData[i].Studi = &study
+			}
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(radiologyData, total, last, more))
 	}
 }
 
@@ -255,6 +387,38 @@ func (radiologyController *RadiologyController) CreateRadiologyDataHandler() gin
 
 		radiologydata.ClientID = c.GetString("userClient")
 
+		// only orders from doctors are put on the worklist, and studies
+		// are linked once the pacs holds them
+		radiologydata.AccessionNumber = ""
+		radiologydata.Jadwal = nil
+		radiologydata.StudyInstanceUID = ""
+		radiologydata.Studi = nil
+
+		// reports are written through the report endpoints
+		radiologydata.ConfidentialData.HasilPemeriksaan.Laporan = nil
+
+		// the id is given up front for the attachments to be linked to
+		id := primitive.NewObjectID()
+
+		lampiran, err := referAttachments(
+			radiologyController.AttachmentCollection,
+			radiologydata.NoIHS,
+			radiologydata.ClientID,
+			id,
+			radiologydata.ConfidentialData.HasilPemeriksaan.Attachments()...,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		radiologydata.Lampiran = lampiran
+
+		if err := radiologyController.screenRadiologyData(&radiologydata, nil, now); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		radiologydata.Index(radiologyController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			radiologydata.ConfidentialData,
 			radiologyController.ClientEncryption,
@@ -263,6 +427,7 @@ func (radiologyController *RadiologyController) CreateRadiologyDataHandler() gin
 
 		radiologydata.ConfidentialEncrypted = confidentialEncryptedField
 		radiologydata.ConfidentialData = nil
+		radiologydata.ID = primitive.NilObjectID
 
 		json, err := json.Marshal(radiologydata)
 		if err != nil {
@@ -272,6 +437,7 @@ func (radiologyController *RadiologyController) CreateRadiologyDataHandler() gin
 
 		signature := utils.GenerateSignature(string(json))
 		radiologydata.Signature = &signature
+		radiologydata.ID = id
 
 		// Insert the new radiology data
 		_, err = radiologyController.FaskesCollection.InsertOne(context.Background(), radiologydata)
@@ -280,6 +446,8 @@ func (radiologyController *RadiologyController) CreateRadiologyDataHandler() gin
 			return
 		}
 
+		linkAttachments(radiologyController.AttachmentCollection, id, radiologydata.Lampiran)
+
 		// Return a success message
 		utils.JSON(c, http.StatusCreated, gin.H{"message": "Radiology data created successfully"})
 	}
@@ -318,9 +486,55 @@ func (radiologyController *RadiologyController) UpdateRadiologyDataHandler() gin
 			"no_ihs": noIHS,
 		}
 
+		// the order's encounter, worklist entry and study are kept as they are
+		references, err := radiologyController.orderReferences(filter)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "No data matched the parameter"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		newData.IDKunjungan = references.IDKunjungan
+		newData.AccessionNumber = references.AccessionNumber
+		newData.Jadwal = references.Jadwal
+		newData.StudyInstanceUID = references.StudyInstanceUID
+		newData.Studi = nil
+
+		// reports are written through the report endpoints, and a document
+		// with a signed off report can only be amended with an addendum
+		if report := references.Laporan; report != nil && report.Locked() {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ReportLockedError.Error()})
+			return
+		}
+		newData.ConfidentialData.HasilPemeriksaan.Laporan = references.Laporan
+
+		lampiran, err := referAttachments(
+			radiologyController.AttachmentCollection,
+			noIHS,
+			c.GetString("userClient"),
+			id,
+			newData.ConfidentialData.HasilPemeriksaan.Attachments()...,
+		)
+		if err != nil {
+			utils.JSON(c, attachmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		newData.Lampiran = lampiran
+
 		now := time.Now().Truncate(time.Duration(time.Millisecond))
 		newData.UpdatedAt = &now
 
+		// the order is screened again on the new data, keeping the renal
+		// function and overrides recorded before
+		newData.ClientID = c.GetString("userClient")
+		if err := radiologyController.screenRadiologyData(&newData, references.Skrining, now); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		newData.Index(radiologyController.BlindIndex)
 		confidentialEncryptedField := utils.EncryptRandom(
 			newData.ConfidentialData,
 			radiologyController.ClientEncryption,
@@ -330,7 +544,6 @@ func (radiologyController *RadiologyController) UpdateRadiologyDataHandler() gin
 		newData.ConfidentialEncrypted = confidentialEncryptedField
 		newData.ConfidentialData = nil
 
-		newData.ClientID = c.GetString("userClient")
 		json, err := json.Marshal(newData)
 		if err != nil {
 			utils.AbortWithStatusJSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -342,6 +555,10 @@ func (radiologyController *RadiologyController) UpdateRadiologyDataHandler() gin
 
 		// Create an update document
 		update := bson.M{"$set": newData}
+		if len(newData.Lampiran) == 0 {
+			// attachments dropped from the document leave its signature too
+			update["$unset"] = bson.M{"lampiran": ""}
+		}
 
 		// Update the document in the Collection
 		result, err := radiologyController.FaskesCollection.UpdateOne(context.Background(), filter, update)
@@ -355,6 +572,8 @@ func (radiologyController *RadiologyController) UpdateRadiologyDataHandler() gin
 			return
 		}
 
+		linkAttachments(radiologyController.AttachmentCollection, id, newData.Lampiran)
+
 		// Return a success message
 		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d radiology data updated successfully", result.ModifiedCount)})
 	}
@@ -0,0 +1,230 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-radiology/config"
+	"service-radiology/datastruct/radiology"
+	"service-radiology/document"
+	"service-radiology/logger"
+	"service-radiology/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const radiologyReportTitle = "Hasil Pemeriksaan Radiologi"
+
+// renderRadiologyReport lays the result out along its structured report.
+// Results written before reports were structured print their free-text
+// interpretation instead.
+func renderRadiologyReport(letterhead document.Letterhead, data *radiology.RadiologyData, now time.Time) (*document.Document, error) {
+	confidential := data.ConfidentialData
+	result := &confidential.HasilPemeriksaan
+	report := result.Laporan
+
+	number := data.AccessionNumber
+	if number == "" {
+		number = data.ID.Hex()
+	}
+
+	pdf := document.New(letterhead, radiologyReportTitle, number, now)
+
+	pdf.Section("Identitas Pasien")
+	if confidential.Pasien != nil {
+		pdf.Field("Nama pasien", confidential.Pasien.NamaPasien)
+	}
+	pdf.Field("No. IHS", data.NoIHS)
+	if confidential.Pasien != nil {
+		pdf.Field("Tanggal lahir", document.FormatDate(confidential.Pasien.TanggalLahir))
+		pdf.Field("Jenis kelamin", confidential.Pasien.SexString())
+	}
+
+	pdf.Section("Permintaan Pemeriksaan")
+	pdf.Field("Dokter pengirim", confidential.DokterPengirim)
+	pdf.Field("Fasyankes pengirim", confidential.NamaFasyankesPengirimPermintaan)
+	pdf.Field("Unit pengirim", confidential.UnitPengirimPermintaan)
+	pdf.Field("Waktu permintaan", document.FormatTime(confidential.WaktuPermintaan))
+	pdf.Field("Prioritas", data.PriorityString())
+	pdf.Field("Diagnosis", confidential.Diagnosis)
+	pdf.Field("Catatan", confidential.CatatanPermintaan)
+
+	pdf.Section("Pemeriksaan")
+	pdf.Field("Pemeriksaan", data.NamaPemeriksaan)
+	pdf.Field("Jenis pemeriksaan", string(data.JenisPemeriksaan))
+	pdf.Field("Waktu pemeriksaan", document.FormatTime(confidential.WaktuPemeriksaan))
+	pdf.Field("Bahan kontras", confidential.JenisBahanKontras)
+	pdf.Field("Study Instance UID", data.StudyInstanceUID)
+
+	role := "Dokter Penginterpretasi"
+	signer := result.DokterPenginterpretasiPemeriksaan
+	signedAt := confidential.WaktuPemeriksaan
+
+	if report == nil {
+		pdf.Section("Interpretasi")
+		pdf.Paragraph(result.InterpretasiRadiologi)
+	} else {
+		pdf.Section("Laporan")
+		pdf.Field("Template", report.NamaTemplate)
+		pdf.Field("Status laporan", radiology.ReportStatusString(report.Status))
+
+		for i := 0; i < len(report.Bagian); i++ {
+			section := report.Bagian[i]
+			if section.Empty() {
+				continue
+			}
+
+			findings := []string{}
+			for j := 0; j < len(section.Temuan); j++ {
+				finding := section.Temuan[j]
+				if finding.Catatan != "" {
+					findings = append(findings, fmt.Sprintf("%s (%s)", finding.Deskripsi, finding.Catatan))
+				} else {
+					findings = append(findings, finding.Deskripsi)
+				}
+			}
+			if teks := strings.TrimSpace(section.Teks); teks != "" {
+				findings = append(findings, teks)
+			}
+
+			pdf.Section(section.Judul)
+			pdf.List(findings)
+		}
+
+		pdf.Section("Kesan")
+		pdf.Paragraph(report.Kesan)
+
+		for i := 0; i < len(report.Adendum); i++ {
+			addendum := report.Adendum[i]
+			pdf.Section(fmt.Sprintf("Adendum %d", i+1))
+			pdf.Field("Radiolog", addendum.Radiolog)
+			pdf.Field("Waktu", document.FormatTime(addendum.Waktu))
+			pdf.Paragraph(addendum.Teks)
+		}
+
+		// a preliminary report is still the interpreting doctor's
+		if report.Locked() {
+			role = "Radiolog"
+			signer = report.Radiolog
+			if report.WaktuTandaTangan != nil {
+				signedAt = *report.WaktuTandaTangan
+			}
+		}
+	}
+
+	if signature := data.TandaTanganDigital; signature != nil {
+		printDigitalSignature(pdf, signature)
+		signer = signature.Penandatangan
+		signedAt = signature.Waktu
+	}
+
+	if err := pdf.Sign(
+		role,
+		signer,
+		signedAt,
+		document.VerificationURL(config.DocumentVerifyURL, data.ID.Hex(), *data.Signature),
+	); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
+
+// RadiologyReportHandler prints the result of an examination. Documents
+// failing their signature are not printed, as the printout would claim a
+// signature the document no longer has.
+func (radiologyController *RadiologyController) RadiologyReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		objID, err := primitive.ObjectIDFromHex(c.Param("Id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":    objID,
+			"no_ihs": c.Param("noIHS"),
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		var data radiology.RadiologyData
+		err = radiologyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !verified(&data) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+			utils.JSON(c, http.StatusConflict, gin.H{"error": documentTamperedError.Error()})
+			return
+		}
+
+		utils.Decrypt(
+			data.ConfidentialEncrypted,
+			radiologyController.ClientEncryption,
+		).Unmarshal(&data.ConfidentialData)
+
+		pdf, err := renderRadiologyReport(radiologyController.Letterhead, &data, time.Now())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sendPDF(c, pdf, fmt.Sprintf("hasil-radiologi-%s", objID.Hex()))
+	}
+}
+
+// VerifyRadiologyReportHandler tells the holder of a printed result whether
+// it is genuine and still the document on record.
+func (radiologyController *RadiologyController) VerifyRadiologyReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint := c.Query("fingerprint")
+		if fingerprint == "" {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": fingerprintRequiredError.Error()})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var data radiology.RadiologyData
+		err = radiologyController.FaskesCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&data)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		valid := verified(&data)
+		if !valid {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", objID.Hex())
+		}
+
+		utils.JSON(c, http.StatusOK, document.NewVerification(
+			objID.Hex(),
+			radiologyReportTitle,
+			radiologyController.Letterhead.Nama,
+			document.Check(data.Signature, valid, fingerprint),
+			data.UpdatedAt,
+		))
+	}
+}
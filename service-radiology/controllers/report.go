@@ -0,0 +1,540 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"service-radiology/datastruct/radiology"
+	"service-radiology/datastruct/user"
+	"service-radiology/logger"
+	"service-radiology/pagination"
+	"service-radiology/signing"
+	"service-radiology/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var templateRequiredError = errors.New("kode_template is required to write a new report")
+
+// reportErrorStatus tells reports not matching their template and steps
+// taken out of order apart from database failures.
+func reportErrorStatus(err error) int {
+	if errors.Is(err, radiology.ReportTemplateNotFoundError) || errors.Is(err, radiology.NoReportError) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, radiology.InvalidReportTransitionError) ||
+		errors.Is(err, radiology.ReportLockedError) ||
+		errors.Is(err, radiology.ReportNotLockedError) ||
+		errors.Is(err, radiology.ConcurrentUpdateError) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, radiology.NotReportRadiologistError) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, templateRequiredError) ||
+		errors.Is(err, radiology.TemplateMismatchError) ||
+		errors.Is(err, radiology.UnknownSectionError) ||
+		errors.Is(err, radiology.UnknownFindingError) ||
+		errors.Is(err, radiology.SectionDuplicateError) ||
+		errors.Is(err, radiology.SectionRequiredError) ||
+		errors.Is(err, radiology.ImpressionRequiredError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// findReportTemplate looks the template up among those of the facility.
+func (radiologyController *RadiologyController) findReportTemplate(clientID, code string) (*radiology.ReportTemplate, error) {
+	var template radiology.ReportTemplate
+	err := radiologyController.TemplateCollection.FindOne(context.Background(), bson.M{"client_id": clientID, "kode": code}).Decode(&template)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%s: %w", code, radiology.ReportTemplateNotFoundError)
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// reportStep loads the document, applies a step to its report and saves it.
+// The text of the report is kept as the interpretation of the result.
+func (radiologyController *RadiologyController) reportStep(c *gin.Context, step func(data *radiology.RadiologyData, by string, now time.Time) error) {
+	if !c.GetBool("patientConsent") {
+		utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+		return
+	}
+
+	data, err := radiologyController.findRadiologyData(c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return
+		}
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+	if err := step(data, c.GetString("userIdentification"), now); err != nil {
+		utils.JSON(c, reportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	result := &data.ConfidentialData.HasilPemeriksaan
+	result.InterpretasiRadiologi = result.Laporan.Text()
+	report := *result.Laporan
+
+	previousUpdate := data.UpdatedAt
+	data.UpdatedAt = &now
+
+	if err := radiologyController.sealRadiologyData(data); err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := radiologyController.updateRadiologyData(data, previousUpdate)
+	if err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !updated {
+		utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ConcurrentUpdateError.Error()})
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, report)
+}
+
+// WriteReportHandler writes the preliminary report along a template of the
+// examination type. It can be rewritten until it is signed off.
+func (radiologyController *RadiologyController) WriteReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.ReportBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		radiologyController.reportStep(c, func(data *radiology.RadiologyData, by string, now time.Time) error {
+			result := &data.ConfidentialData.HasilPemeriksaan
+			if result.Laporan == nil {
+				result.Laporan = &radiology.RadiologyReport{}
+			}
+
+			if result.Laporan.Locked() {
+				return radiology.ReportLockedError
+			}
+
+			code := body.KodeTemplate
+			if code == "" {
+				code = result.Laporan.KodeTemplate
+			}
+			if code == "" {
+				return templateRequiredError
+			}
+
+			template, err := radiologyController.findReportTemplate(c.GetString("userClient"), code)
+			if err != nil {
+				return err
+			}
+
+			if template.JenisPemeriksaan != data.JenisPemeriksaan {
+				return fmt.Errorf("%s: %w", template.Kode, radiology.TemplateMismatchError)
+			}
+
+			return result.Laporan.Draft(template, body, by, now)
+		})
+	}
+}
+
+// SignReportHandler signs the report off as final on behalf of the
+// radiologist, who becomes the interpreting doctor of the result.
+func (radiologyController *RadiologyController) SignReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		radiologyController.reportStep(c, func(data *radiology.RadiologyData, by string, now time.Time) error {
+			result := &data.ConfidentialData.HasilPemeriksaan
+			if result.Laporan == nil {
+				return radiology.NoReportError
+			}
+
+			template, err := radiologyController.findReportTemplate(c.GetString("userClient"), result.Laporan.KodeTemplate)
+			if err != nil {
+				return err
+			}
+
+			if err := result.Laporan.SignOff(template, by, now); err != nil {
+				return err
+			}
+
+			result.DokterPenginterpretasiPemeriksaan = by
+			return nil
+		})
+	}
+}
+
+// AmendReportHandler adds an addendum to a signed off report.
+func (radiologyController *RadiologyController) AmendReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.AddendumBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		radiologyController.reportStep(c, func(data *radiology.RadiologyData, by string, now time.Time) error {
+			report := data.ConfidentialData.HasilPemeriksaan.Laporan
+			if report == nil {
+				return radiology.NoReportError
+			}
+
+			return report.Amend(body.Teks, by, now)
+		})
+	}
+}
+
+// findSignedData loads a document for its digital signature. Documents
+// failing their seal are refused, as the signature would cover content the
+// service can no longer vouch for.
+func (radiologyController *RadiologyController) findSignedData(c *gin.Context, filter bson.M, tampered error) (*radiology.RadiologyData, bool) {
+	var data radiology.RadiologyData
+	err := radiologyController.FaskesCollection.FindOne(context.Background(), filter).Decode(&data)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return nil, false
+		}
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if !verified(&data) {
+		logger.LogWarning.Printf("Data with ID [%s] was tampered\n", data.ID.Hex())
+		utils.JSON(c, http.StatusConflict, gin.H{"error": tampered.Error()})
+		return nil, false
+	}
+
+	utils.Decrypt(
+		data.ConfidentialEncrypted,
+		radiologyController.ClientEncryption,
+	).Unmarshal(&data.ConfidentialData)
+
+	return &data, true
+}
+
+// DigitalSignReportHandler signs the signed off report with the key of the
+// radiologist, who confirms with their password. Only the digest of the
+// report is sent to the auth service.
+func (radiologyController *RadiologyController) DigitalSignReportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.SignBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("Id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":    objID,
+			"no_ihs": c.Param("noIHS"),
+		}
+
+		data, ok := radiologyController.findSignedData(c, filter, signTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital != nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": alreadySignedError.Error()})
+			return
+		}
+
+		if err := data.CanBeSignedBy(c.GetString("userIdentification")); err != nil {
+			utils.JSON(c, reportErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		digest, err := signing.Digest(data.SignedContent())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		signature, err := radiologyController.Signing.Sign(context.Background(), c.GetHeader("Authorization"), body.Password, digest)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previousUpdate := data.UpdatedAt
+
+		data.TandaTanganDigital = signature
+		data.UpdatedAt = &now
+
+		if err := radiologyController.sealRadiologyData(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := radiologyController.updateRadiologyData(data, previousUpdate)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !updated {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ConcurrentUpdateError.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, signature)
+	}
+}
+
+// ReportSignatureHandler shows who signed the report and whether the
+// signature still holds for the report on record.
+func (radiologyController *RadiologyController) ReportSignatureHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		objID, err := primitive.ObjectIDFromHex(c.Param("Id"))
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{
+			"_id":    objID,
+			"no_ihs": c.Param("noIHS"),
+		}
+		if !c.GetBool("patientConsent") {
+			filter["client_id"] = c.GetString("userClient")
+		}
+
+		data, ok := radiologyController.findSignedData(c, filter, checkTamperedError)
+		if !ok {
+			return
+		}
+
+		if data.TandaTanganDigital == nil {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": notSignedError.Error()})
+			return
+		}
+
+		check, err := radiologyController.Signing.Check(
+			context.Background(),
+			c.GetHeader("Authorization"),
+			data.TandaTanganDigital,
+			data.SignedContent(),
+		)
+		if err != nil {
+			signingError(c, err)
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, check)
+	}
+}
+
+func (radiologyController *RadiologyController) GetReportTemplatesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"client_id": c.GetString("userClient")}
+
+		if q := c.Query("q"); q != "" {
+			regex := primitive.Regex{
+				Pattern: regexp.QuoteMeta(q),
+				Options: "i",
+			}
+
+			filter["$or"] = bson.A{
+				bson.M{"nama": regex},
+				bson.M{"kode": regex},
+			}
+		}
+
+		if examinationType := c.Query("jenis_pemeriksaan"); examinationType != "" {
+			filter["jenis_pemeriksaan"] = examinationType
+		}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Filter(filter)
+
+		total, err := radiologyController.TemplateCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+
+		cursor, err := radiologyController.TemplateCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		templates := []radiology.ReportTemplate{}
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var template radiology.ReportTemplate
+			if err := cursor.Decode(&template); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = template.ID
+			templates = append(templates, template)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(templates, total, last, more))
+	}
+}
+
+func (radiologyController *RadiologyController) GetReportTemplateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		template, err := radiologyController.findReportTemplate(c.GetString("userClient"), c.Param("kode"))
+		if err != nil {
+			utils.JSON(c, reportErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, template)
+	}
+}
+
+func (radiologyController *RadiologyController) CreateReportTemplateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var template radiology.ReportTemplate
+		if err := c.ShouldBindJSON(&template); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := template.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := radiologyController.findReportTemplate(c.GetString("userClient"), template.Kode)
+		if err == nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ReportTemplateDuplicateError.Error()})
+			return
+		} else if !errors.Is(err, radiology.ReportTemplateNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		template.ID = primitive.NilObjectID
+		template.ClientID = c.GetString("userClient")
+		template.CreatedAt = &now
+		template.UpdatedAt = &now
+
+		if _, err := radiologyController.TemplateCollection.InsertOne(context.Background(), template); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ReportTemplateDuplicateError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{"message": "Report template created successfully"})
+	}
+}
+
+// UpdateReportTemplateHandler changes a template. Reports already written
+// are checked against the new template when they are signed off.
+func (radiologyController *RadiologyController) UpdateReportTemplateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var template radiology.ReportTemplate
+		if err := c.ShouldBindJSON(&template); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := template.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		code := c.Param("kode")
+		if template.Kode != code {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "kode cannot be changed"})
+			return
+		}
+
+		existing, err := radiologyController.findReportTemplate(c.GetString("userClient"), code)
+		if err != nil {
+			utils.JSON(c, reportErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		template.ID = primitive.NilObjectID
+		template.ClientID = existing.ClientID
+		template.CreatedAt = existing.CreatedAt
+		template.UpdatedAt = &now
+
+		result, err := radiologyController.TemplateCollection.UpdateOne(context.Background(), bson.M{"_id": existing.ID}, bson.M{"$set": template})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d report template updated successfully", result.ModifiedCount)})
+	}
+}
+
+// DeleteReportTemplateHandler removes a template. Signed off reports keep
+// the titles and descriptions they were written with; preliminary reports
+// have to be rewritten along another template.
+func (radiologyController *RadiologyController) DeleteReportTemplateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := radiologyController.TemplateCollection.DeleteOne(context.Background(), bson.M{"client_id": c.GetString("userClient"), "kode": c.Param("kode")})
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d report template deleted successfully", result.DeletedCount)})
+	}
+}
@@ -0,0 +1,492 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-radiology/datastruct"
+	"service-radiology/datastruct/radiology"
+	"service-radiology/datastruct/user"
+	"service-radiology/pagination"
+	"service-radiology/utils"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func screeningErrorStatus(err error) int {
+	if errors.Is(err, radiology.ScreeningRuleNotFoundError) || errors.Is(err, radiology.ScreeningFindingNotFoundError) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, radiology.ConcurrentUpdateError) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, radiology.RenalFunctionInputError) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// findRegisteredScreeningRule finds a rule the facility registered.
+func (radiologyController *RadiologyController) findRegisteredScreeningRule(clientID, code string) (*radiology.ScreeningRule, error) {
+	var rule radiology.ScreeningRule
+	err := radiologyController.RuleCollection.FindOne(context.Background(), bson.M{"client_id": clientID, "kode": code}).Decode(&rule)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%s: %w", code, radiology.ScreeningRuleNotFoundError)
+		}
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// findScreeningRule finds a rule of the facility, falling back to the
+// default rule with the same kode.
+func (radiologyController *RadiologyController) findScreeningRule(clientID, code string) (*radiology.ScreeningRule, error) {
+	rule, err := radiologyController.findRegisteredScreeningRule(clientID, code)
+	if !errors.Is(err, radiology.ScreeningRuleNotFoundError) {
+		return rule, err
+	}
+
+	defaults := radiology.DefaultScreeningRules()
+	for i := 0; i < len(defaults); i++ {
+		if defaults[i].Kode == code {
+			return &defaults[i], nil
+		}
+	}
+
+	return nil, err
+}
+
+// screeningRules returns the default rules merged with the rules the
+// facility registered. A registered rule replaces the default rule with the
+// same kode.
+func (radiologyController *RadiologyController) screeningRules(clientID string) ([]radiology.ScreeningRule, error) {
+	cursor, err := radiologyController.RuleCollection.Find(context.Background(), bson.M{"client_id": clientID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	registered := []radiology.ScreeningRule{}
+	if err := cursor.All(context.Background(), &registered); err != nil {
+		return nil, err
+	}
+
+	codes := map[string]bool{}
+	for i := 0; i < len(registered); i++ {
+		codes[registered[i].Kode] = true
+	}
+
+	rules := registered
+	defaults := radiology.DefaultScreeningRules()
+	for i := 0; i < len(defaults); i++ {
+		if !codes[defaults[i].Kode] {
+			rules = append(rules, defaults[i])
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Kode < rules[j].Kode
+	})
+
+	return rules, nil
+}
+
+// screeningModality is the modality of the station the order is scheduled
+// on, or the one guessed from the examination type.
+func screeningModality(scheduled *radiology.ScheduledProcedure, examinationType datastruct.RadiologyExaminationType) string {
+	if scheduled != nil && scheduled.Modalitas != "" {
+		return scheduled.Modalitas
+	}
+
+	return radiology.DefaultModality(examinationType)
+}
+
+// screenRadiologyData screens a document again, keeping what was recorded
+// on the previous screening.
+func (radiologyController *RadiologyController) screenRadiologyData(data *radiology.RadiologyData, previous *radiology.SafetyScreening, now time.Time) error {
+	rules, err := radiologyController.screeningRules(data.ClientID)
+	if err != nil {
+		return err
+	}
+
+	confidential := data.ConfidentialData
+	confidential.Skrining = radiology.Screen(rules, radiology.ScreeningSubject{
+		StatusKehamilan:   confidential.StatusKehamilan,
+		StatusAlergi:      confidential.StatusAlergi,
+		JenisBahanKontras: confidential.JenisBahanKontras,
+		Modalitas:         screeningModality(data.Jadwal, data.JenisPemeriksaan),
+		Pasien:            confidential.Pasien,
+	}, previous, now)
+
+	return nil
+}
+
+// screeningStep loads the document, applies a step to its safety screening
+// and saves it.
+func (radiologyController *RadiologyController) screeningStep(c *gin.Context, step func(data *radiology.RadiologyData, by string, now time.Time) error) {
+	if !c.GetBool("patientConsent") {
+		utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+		return
+	}
+
+	data, err := radiologyController.findRadiologyData(c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+			return
+		}
+		utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+	if err := step(data, c.GetString("userIdentification"), now); err != nil {
+		utils.JSON(c, screeningErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	screening := *data.ConfidentialData.Skrining
+
+	previousUpdate := data.UpdatedAt
+	data.UpdatedAt = &now
+
+	if err := radiologyController.sealRadiologyData(data); err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := radiologyController.updateRadiologyData(data, previousUpdate)
+	if err != nil {
+		utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !updated {
+		utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ConcurrentUpdateError.Error()})
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, screening)
+}
+
+// ScreenOrderHandler records what the radiology staff checked with the
+// patient, such as the renal function, and screens the order again.
+func (radiologyController *RadiologyController) ScreenOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.ScreeningBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if body.FungsiGinjal != nil {
+			if err := body.FungsiGinjal.Validate(); err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		radiologyController.screeningStep(c, func(data *radiology.RadiologyData, by string, now time.Time) error {
+			confidential := data.ConfidentialData
+			if body.StatusAlergi != nil {
+				confidential.StatusAlergi = *body.StatusAlergi
+			}
+			if body.StatusKehamilan != nil {
+				confidential.StatusKehamilan = *body.StatusKehamilan
+			}
+
+			previous := confidential.Skrining
+			if previous == nil {
+				previous = &radiology.SafetyScreening{}
+			}
+			if body.KategoriKontras != 0 {
+				previous.KategoriKontras = body.KategoriKontras
+				previous.KontrasDitetapkan = true
+			}
+			if body.FungsiGinjal != nil {
+				previous.FungsiGinjal = body.FungsiGinjal
+			}
+
+			return radiologyController.screenRadiologyData(data, previous, now)
+		})
+	}
+}
+
+// OverrideScreeningHandler documents the radiologist's decision to go ahead
+// despite a finding. A blocked order is put back on the worklist once every
+// blocking finding is overridden.
+func (radiologyController *RadiologyController) OverrideScreeningHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.ScreeningOverrideBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		radiologyController.screeningStep(c, func(data *radiology.RadiologyData, by string, now time.Time) error {
+			screening := data.ConfidentialData.Skrining
+			if screening == nil {
+				return fmt.Errorf("%s: %w", body.KodeAturan, radiology.ScreeningFindingNotFoundError)
+			}
+
+			return screening.Override(body.KodeAturan, body.Alasan, by, now)
+		})
+	}
+}
+
+// PreviewScreeningHandler screens an order before it is placed. Nothing is
+// stored.
+func (radiologyController *RadiologyController) PreviewScreeningHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body radiology.ScreeningPreviewBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		previous := &radiology.SafetyScreening{}
+		if body.FungsiGinjal != nil {
+			if err := body.FungsiGinjal.Validate(); err != nil {
+				utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			previous.FungsiGinjal = body.FungsiGinjal
+		}
+
+		rules, err := radiologyController.screeningRules(c.GetString("userClient"))
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		screening := radiology.Screen(rules, radiology.ScreeningSubject{
+			StatusKehamilan:   body.StatusKehamilan,
+			StatusAlergi:      body.StatusAlergi,
+			JenisBahanKontras: body.JenisBahanKontras,
+			Modalitas:         radiology.DefaultModality(body.JenisPemeriksaan),
+			Pasien:            body.Pasien,
+		}, previous, time.Now().Truncate(time.Duration(time.Millisecond)))
+
+		utils.JSON(c, http.StatusOK, screening)
+	}
+}
+
+// GetScreeningRulesHandler pages the rules the facility registered. The
+// default rules it did not replace are built in, so they come ahead of the
+// registered rules on the first page and are counted in the total.
+func (radiologyController *RadiologyController) GetScreeningRulesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID := c.GetString("userClient")
+		filter := bson.M{"client_id": clientID}
+
+		params, err := pagination.Parse(c.Request.URL.Query())
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		codes, err := radiologyController.RuleCollection.Distinct(context.Background(), "kode", filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		replaced := map[string]bool{}
+		for i := 0; i < len(codes); i++ {
+			if code, ok := codes[i].(string); ok {
+				replaced[code] = true
+			}
+		}
+
+		defaults := []radiology.ScreeningRule{}
+		all := radiology.DefaultScreeningRules()
+		for i := 0; i < len(all); i++ {
+			if !replaced[all[i].Kode] {
+				defaults = append(defaults, all[i])
+			}
+		}
+
+		params.Filter(filter)
+
+		total, err := radiologyController.RuleCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.PageFilter(filter)
+		total += int64(len(defaults))
+
+		cursor, err := radiologyController.RuleCollection.Find(context.Background(), filter, params.FindOptions())
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cursor.Close(context.Background())
+
+		rules := []radiology.ScreeningRule{}
+		if params.Cursor == nil {
+			rules = append(rules, defaults...)
+		}
+
+		var last primitive.ObjectID
+		read, more := int64(0), false
+		for cursor.Next(context.Background()) {
+			if read == params.Limit {
+				more = true
+				break
+			}
+			read++
+
+			var rule radiology.ScreeningRule
+			if err := cursor.Decode(&rule); err != nil {
+				utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			last = rule.ID
+			rules = append(rules, rule)
+		}
+
+		if err := cursor.Err(); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, params.Page(rules, total, last, more))
+	}
+}
+
+func (radiologyController *RadiologyController) GetScreeningRuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, err := radiologyController.findScreeningRule(c.GetString("userClient"), c.Param("kode"))
+		if err != nil {
+			utils.JSON(c, screeningErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, rule)
+	}
+}
+
+// CreateScreeningRuleHandler registers a rule of the facility. A rule with
+// the kode of a default rule replaces it.
+func (radiologyController *RadiologyController) CreateScreeningRuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule radiology.ScreeningRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := rule.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := radiologyController.findRegisteredScreeningRule(c.GetString("userClient"), rule.Kode)
+		if err == nil {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ScreeningRuleDuplicateError.Error()})
+			return
+		} else if !errors.Is(err, radiology.ScreeningRuleNotFoundError) {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		rule.ID = primitive.NilObjectID
+		rule.ClientID = c.GetString("userClient")
+		rule.CreatedAt = &now
+		rule.UpdatedAt = &now
+
+		if _, err := radiologyController.RuleCollection.InsertOne(context.Background(), rule); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ScreeningRuleDuplicateError.Error()})
+				return
+			}
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusCreated, gin.H{"message": "Screening rule created successfully"})
+	}
+}
+
+// UpdateScreeningRuleHandler changes a rule of the facility. Changing a
+// default rule registers the changed rule in its place.
+func (radiologyController *RadiologyController) UpdateScreeningRuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule radiology.ScreeningRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := rule.Validate(); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		code := c.Param("kode")
+		if rule.Kode != code {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": "kode cannot be changed"})
+			return
+		}
+
+		clientID := c.GetString("userClient")
+		existing, err := radiologyController.findScreeningRule(clientID, code)
+		if err != nil {
+			utils.JSON(c, screeningErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+
+		rule.ID = primitive.NilObjectID
+		rule.ClientID = clientID
+		rule.CreatedAt = existing.CreatedAt
+		if rule.CreatedAt == nil {
+			rule.CreatedAt = &now
+		}
+		rule.UpdatedAt = &now
+
+		opts := options.Update().SetUpsert(true)
+		filter := bson.M{"client_id": clientID, "kode": code}
+		result, err := radiologyController.RuleCollection.UpdateOne(context.Background(), filter, bson.M{"$set": rule}, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated := result.ModifiedCount + result.UpsertedCount
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d screening rule updated successfully", updated)})
+	}
+}
+
+// DeleteScreeningRuleHandler removes a rule of the facility; the default
+// rule with the same kode applies again. Orders keep the findings they were
+// screened with until they are screened again.
+func (radiologyController *RadiologyController) DeleteScreeningRuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"client_id": c.GetString("userClient"), "kode": c.Param("kode")}
+		result, err := radiologyController.RuleCollection.DeleteOne(context.Background(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, gin.H{"message": fmt.Sprintf("%d screening rule deleted successfully", result.DeletedCount)})
+	}
+}
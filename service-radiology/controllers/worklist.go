@@ -0,0 +1,450 @@
+package fasyankes_controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"service-radiology/datastruct"
+	specialityexamination "service-radiology/datastruct/outpatient"
+	"service-radiology/datastruct/radiology"
+	"service-radiology/datastruct/user"
+	"service-radiology/dicomweb"
+	"service-radiology/logger"
+	"service-radiology/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nextAccessionNumber hands out accession numbers per day, e.g.
+// R26101900042, short enough for the 16 characters DICOM allows.
+func (radiologyController *RadiologyController) nextAccessionNumber(now time.Time) (string, error) {
+	day := now.Format("060102")
+
+	var counter struct {
+		Urutan int `bson:"urutan"`
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{"$inc": bson.M{"urutan": 1}}
+
+	err := radiologyController.CounterCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": "radiologi-" + day}, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// two requests created the counter of the day at once
+		err = radiologyController.CounterCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": "radiologi-" + day}, update, opts).Decode(&counter)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("R%s%05d", day, counter.Urutan), nil
+}
+
+// scheduleOrder gives a new order its accession number and puts it on the
+// worklist with a study UID for the modality to use.
+func (radiologyController *RadiologyController) scheduleOrder(order *specialityexamination.RadiologyRequest, now time.Time) error {
+	accessionNumber, err := radiologyController.nextAccessionNumber(now)
+	if err != nil {
+		return err
+	}
+
+	studyUID, err := dicomweb.NewUID()
+	if err != nil {
+		return err
+	}
+
+	at := now
+	if confidential := order.ConfidentialData; confidential != nil {
+		if !confidential.WaktuPemeriksaan.IsZero() {
+			at = confidential.WaktuPemeriksaan
+		} else if !confidential.WaktuPermintaan.IsZero() {
+			at = confidential.WaktuPermintaan
+		}
+	}
+
+	order.AccessionNumber = accessionNumber
+	order.Jadwal = radiology.NewScheduledProcedure(studyUID, order.NamaPemeriksaan, order.JenisPemeriksaan, at)
+
+	return nil
+}
+
+// verified tells whether a document still carries a valid signature. Orders
+// failing it are left alone rather than signed again.
+func verified(data *radiology.RadiologyData) bool {
+	if data.Signature == nil {
+		return false
+	}
+
+	signature := data.Signature
+	id := data.ID
+	data.Signature = nil
+	data.ID = primitive.NilObjectID
+
+	dataByte, err := json.Marshal(data)
+	data.Signature = signature
+	data.ID = id
+	if err != nil {
+		return false
+	}
+
+	_, err = utils.VerifySignature(string(dataByte), *signature)
+	return err == nil
+}
+
+// consentedPatients returns which of the patients gave their consent to the
+// client.
+func (radiologyController *RadiologyController) consentedPatients(clientID string, patients []string) (map[string]bool, error) {
+	consented := map[string]bool{}
+	if len(patients) == 0 {
+		return consented, nil
+	}
+
+	filter := bson.M{
+		"no_ihs":               bson.M{"$in": patients},
+		"consent_to.client_id": clientID,
+	}
+
+	cursor, err := radiologyController.ConsentCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var consent user.PatientConsent
+		if err := cursor.Decode(&consent); err != nil {
+			return nil, err
+		}
+		consented[consent.NoIHS] = true
+	}
+
+	return consented, cursor.Err()
+}
+
+// saveStudyLink links an order to its study in the PACS, which completes its
+// worklist entry, and saves it.
+func (radiologyController *RadiologyController) saveStudyLink(data *radiology.RadiologyData, studyUID string) error {
+	now := time.Now().Truncate(time.Duration(time.Millisecond))
+	previousUpdate := data.UpdatedAt
+
+	data.StudyInstanceUID = studyUID
+	if data.Jadwal != nil {
+		data.Jadwal.Status = datastruct.WORKLIST_SELESAI
+	}
+	data.UpdatedAt = &now
+
+	if err := radiologyController.sealRadiologyData(data); err != nil {
+		return err
+	}
+
+	updated, err := radiologyController.updateRadiologyData(data, previousUpdate)
+	if err != nil {
+		return err
+	}
+
+	if !updated {
+		return radiology.ConcurrentUpdateError
+	}
+
+	return nil
+}
+
+// reconcileOrders looks the scheduled orders up in the PACS, by the study
+// UID handed out through the worklist and otherwise by accession number,
+// and links those whose images arrived.
+func (radiologyController *RadiologyController) reconcileOrders(ctx context.Context, filter bson.M) (*radiology.ReconcileResult, error) {
+	filter["jadwal.status"] = datastruct.WORKLIST_DIJADWALKAN
+	filter["study_instance_uid"] = bson.M{"$exists": false}
+
+	cursor, err := radiologyController.FaskesCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []radiology.RadiologyData
+	if err := cursor.All(context.Background(), &orders); err != nil {
+		return nil, err
+	}
+
+	result := radiology.ReconcileResult{
+		Diperiksa: len(orders),
+		Ditautkan: []radiology.ReconciledOrder{},
+	}
+
+	uids := []string{}
+	for i := 0; i < len(orders); i++ {
+		uids = append(uids, orders[i].Jadwal.StudyInstanceUID)
+	}
+	found := radiologyController.lookupStudies(ctx, uids)
+
+	for i := 0; i < len(orders); i++ {
+		order := &orders[i]
+
+		study, ok := found[order.Jadwal.StudyInstanceUID]
+		if !ok && order.AccessionNumber != "" {
+			datasets, err := radiologyController.DICOMWeb.SearchByAccession(ctx, order.AccessionNumber)
+			if err != nil {
+				logger.LogWarning.Printf("Failed to look up accession number [%s] in the PACS: %v\n", order.AccessionNumber, err)
+				continue
+			}
+
+			if len(datasets) > 1 {
+				logger.LogWarning.Printf("Accession number [%s] matches %d studies in the PACS\n", order.AccessionNumber, len(datasets))
+				continue
+			}
+
+			if len(datasets) == 1 {
+				study, ok = dicomweb.StudyFromSearch(datasets[0]), true
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if study.IDPasien != "" && study.IDPasien != order.NoIHS {
+			logger.LogWarning.Printf("Study [%s] of order [%s] belongs to another patient\n", study.StudyInstanceUID, order.ID.Hex())
+			continue
+		}
+
+		if !verified(order) {
+			logger.LogWarning.Printf("Data with ID [%s] was tampered\n", order.ID.Hex())
+			continue
+		}
+
+		utils.Decrypt(
+			order.ConfidentialEncrypted,
+			radiologyController.ClientEncryption,
+		).Unmarshal(&order.ConfidentialData)
+
+		if err := radiologyController.saveStudyLink(order, study.StudyInstanceUID); err != nil {
+			logger.LogError.Printf("Failed to link order [%s] to study [%s]: %v\n", order.ID.Hex(), study.StudyInstanceUID, err)
+			continue
+		}
+
+		result.Ditautkan = append(result.Ditautkan, radiology.ReconciledOrder{
+			ID:               order.ID.Hex(),
+			NoIHS:            order.NoIHS,
+			AccessionNumber:  order.AccessionNumber,
+			StudyInstanceUID: study.StudyInstanceUID,
+		})
+	}
+
+	return &result, nil
+}
+
+// GetWorklistHandler serves the modality worklist of a day, by default
+// today, in the DICOM JSON model. Only the orders of the client and those
+// not assigned to any client are listed, whatever the patient consented to.
+func (radiologyController *RadiologyController) GetWorklistHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day := c.Query("tanggal")
+		if day == "" {
+			day = time.Now().Format(time.DateOnly)
+		}
+
+		start, end, err := radiology.ParseWorklistDay(day, time.Local)
+		if err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientID := c.GetString("userClient")
+		filter := bson.M{
+			"jadwal.status":       datastruct.WORKLIST_DIJADWALKAN,
+			"jadwal.waktu_jadwal": bson.M{"$gte": start, "$lt": end},
+			"$or": bson.A{
+				bson.M{"client_id": clientID},
+				bson.M{"client_id": ""},
+			},
+		}
+
+		if modality := c.Query("modalitas"); modality != "" {
+			filter["jadwal.modalitas"] = modality
+		}
+
+		// entries without a station are shown to every station
+		if aeTitle := c.Query("ae_title"); aeTitle != "" {
+			filter["jadwal.ae_title_stasiun"] = bson.M{"$in": bson.A{aeTitle, ""}}
+		}
+
+		opts := options.Find().SetSort(bson.M{"jadwal.waktu_jadwal": 1})
+		cursor, err := radiologyController.FaskesCollection.Find(context.Background(), filter, opts)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var orders []radiology.RadiologyData
+		if err := cursor.All(context.Background(), &orders); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		patients := []string{}
+		for i := 0; i < len(orders); i++ {
+			if orders[i].ClientID != clientID {
+				patients = append(patients, orders[i].NoIHS)
+			}
+		}
+
+		consented, err := radiologyController.consentedPatients(clientID, patients)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		entries := []dicomweb.Dataset{}
+		for i := 0; i < len(orders); i++ {
+			order := &orders[i]
+			if order.ClientID != clientID && !consented[order.NoIHS] {
+				continue
+			}
+
+			if !verified(order) {
+				logger.LogWarning.Printf("Data with ID [%s] was tampered\n", order.ID.Hex())
+				continue
+			}
+
+			utils.Decrypt(
+				order.ConfidentialEncrypted,
+				radiologyController.ClientEncryption,
+			).Unmarshal(&order.ConfidentialData)
+
+			// blocked by the safety screening until a radiologist overrides it
+			if order.ConfidentialData != nil && order.ConfidentialData.Skrining.Blocked() {
+				continue
+			}
+
+			item := radiology.WorklistItem{
+				IDOrder:         order.ID.Hex(),
+				NoIHS:           order.NoIHS,
+				AccessionNumber: order.AccessionNumber,
+				NamaPemeriksaan: order.NamaPemeriksaan,
+				Jadwal:          *order.Jadwal,
+			}
+
+			if confidential := order.ConfidentialData; confidential != nil {
+				item.DokterPengirim = confidential.DokterPengirim
+				item.Prioritas = confidential.PrioritasPemeriksaan
+				item.BahanKontras = confidential.JenisBahanKontras
+				item.StatusKehamilan = confidential.StatusKehamilan
+				if confidential.Pasien != nil {
+					item.Pasien = *confidential.Pasien
+				}
+			}
+
+			entries = append(entries, dicomweb.WorklistDataset(item))
+		}
+
+		utils.JSON(c, http.StatusOK, entries)
+	}
+}
+
+// ScheduleOrderHandler moves an order on the worklist to a station and time.
+func (radiologyController *RadiologyController) ScheduleOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("patientConsent") {
+			utils.AbortWithStatusJSON(c, http.StatusUnauthorized, gin.H{"forbidden": user.NotAuthorizedError.Error()})
+			return
+		}
+
+		var body radiology.ScheduleBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, err := radiologyController.findRadiologyData(c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				utils.JSON(c, http.StatusNotFound, gin.H{"error": "Data not found"})
+				return
+			}
+			utils.JSON(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if data.Jadwal == nil || data.Jadwal.Status != datastruct.WORKLIST_DIJADWALKAN {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.NotScheduledError.Error()})
+			return
+		}
+
+		now := time.Now().Truncate(time.Duration(time.Millisecond))
+		previousUpdate := data.UpdatedAt
+
+		data.Jadwal.Reschedule(body)
+		data.UpdatedAt = &now
+
+		// the station decides whether the examination is ionizing
+		if err := radiologyController.screenRadiologyData(data, data.ConfidentialData.Skrining, now); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scheduled := *data.Jadwal
+
+		if err := radiologyController.sealRadiologyData(data); err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := radiologyController.updateRadiologyData(data, previousUpdate)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !updated {
+			utils.JSON(c, http.StatusConflict, gin.H{"error": radiology.ConcurrentUpdateError.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, scheduled)
+	}
+}
+
+// ReconcileWorklistHandler links the client's scheduled orders whose images
+// arrived in the PACS without waiting for the periodic reconciliation.
+func (radiologyController *RadiologyController) ReconcileWorklistHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{
+			"$or": bson.A{
+				bson.M{"client_id": c.GetString("userClient")},
+				bson.M{"client_id": ""},
+			},
+		}
+
+		result, err := radiologyController.reconcileOrders(c.Request.Context(), filter)
+		if err != nil {
+			utils.JSON(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		utils.JSON(c, http.StatusOK, result)
+	}
+}
+
+// RunReconciliation periodically links scheduled orders to the studies the
+// modalities sent to the PACS.
+func (radiologyController *RadiologyController) RunReconciliation(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := radiologyController.reconcileOrders(context.Background(), bson.M{})
+		if err != nil {
+			logger.LogError.Printf("Failed to reconcile the worklist: %v\n", err)
+			continue
+		}
+
+		if len(result.Ditautkan) > 0 {
+			logger.LogInfo.Printf("Linked %d of %d scheduled orders to their studies\n", len(result.Ditautkan), result.Diperiksa)
+		}
+	}
+}
@@ -12,6 +12,12 @@ type RadiologyExaminationType string
 type TreatmentType uint8
 type RoleType string
 type PatientConsent bool
+type WorklistStatus uint8
+type ReportStatus uint8
+type ContrastCategory uint8
+type ScreeningCondition uint8
+type ScreeningOutcome uint8
+type VerificationStatus uint8
 
 const (
 	UNKNOWN SexType = iota
@@ -97,3 +103,39 @@ const (
 	OPTIN  PatientConsent = true
 	OPTOUT PatientConsent = false
 )
+
+const (
+	WORKLIST_DIJADWALKAN WorklistStatus = iota + 1
+	WORKLIST_SELESAI
+)
+
+const (
+	LAPORAN_PRELIMINER ReportStatus = iota + 1
+	LAPORAN_FINAL
+	LAPORAN_ADENDUM
+)
+
+const (
+	TANPA_KONTRAS ContrastCategory = iota + 1
+	KONTRAS_IODINASI
+	KONTRAS_GADOLINIUM
+	KONTRAS_BARIUM
+)
+
+const (
+	SKRINING_KEHAMILAN ScreeningCondition = iota + 1
+	SKRINING_ALERGI
+	SKRINING_FUNGSI_GINJAL
+	SKRINING_DATA_GINJAL
+)
+
+const (
+	SKRINING_PERINGATAN ScreeningOutcome = iota + 1
+	SKRINING_BLOKIR
+)
+
+const (
+	DOKUMEN_ASLI VerificationStatus = iota + 1
+	DOKUMEN_DIPERBARUI
+	DOKUMEN_TIDAK_VALID
+)
@@ -1,7 +1,10 @@
 package specialityexamination
 
 import (
+	"service-radiology/attachment"
+	"service-radiology/blindindex"
 	"service-radiology/datastruct"
+	"service-radiology/datastruct/radiology"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,6 +14,9 @@ type RadiologyExaminationResult struct {
 	URLFotoHasilPemeriksaan           string `json:"url_foto_hasil_pemeriksaan" bson:"url_foto_hasil_pemeriksaan"`
 	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" bson:"dokter_penginterpretasi_pemeriksaan"`
 	InterpretasiRadiologi             string `json:"interpretasi_radiologi" bson:"interpretasi_radiologi"`
+
+	Laporan      *radiology.RadiologyReport `json:"laporan,omitempty" bson:"laporan,omitempty"`
+	LampiranFoto []attachment.Reference     `json:"lampiran_foto,omitempty" bson:"lampiran_foto,omitempty"`
 }
 
 type ConfidentialRadiologyRequestData struct {
@@ -30,6 +36,12 @@ type ConfidentialRadiologyRequestData struct {
 	WaktuPemeriksaan  time.Time                  `json:"waktu_pemeriksaan" bson:"waktu_pemeriksaan"`
 	JenisBahanKontras string                     `json:"jenis_bahan_kontras" bson:"jenis_bahan_kontras"`
 	HasilPemeriksaan  RadiologyExaminationResult `json:"hasil_pemeriksaan" bson:"hasil_pemeriksaan"`
+
+	// Pasien pre-populates the modality through the worklist.
+	Pasien *radiology.WorklistPatient `json:"pasien,omitempty" bson:"pasien,omitempty"`
+
+	// Skrining is the contrast and radiation safety screening of the order.
+	Skrining *radiology.SafetyScreening `json:"skrining,omitempty" bson:"skrining,omitempty"`
 }
 
 type RadiologyRequest struct {
@@ -42,10 +54,32 @@ type RadiologyRequest struct {
 	JenisPemeriksaan datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan" binding:"required" bson:"jenis_pemeriksaan"`
 	// NoPermintaan     string                              `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
 
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	AccessionNumber string                        `json:"accession_number,omitempty" bson:"accession_number,omitempty"`
+	Jadwal          *radiology.ScheduledProcedure `json:"jadwal,omitempty" bson:"jadwal,omitempty"`
+
+	StudyInstanceUID string                  `json:"study_instance_uid,omitempty" bson:"study_instance_uid,omitempty"`
+	Studi            *radiology.ImagingStudy `json:"studi,omitempty" bson:"-"`
+
 	ConfidentialData      *ConfidentialRadiologyRequestData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary                 `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
+	IndeksWaktuPemeriksaan []string `json:"-" bson:"indeks_waktu_pemeriksaan,omitempty"`
+
+	Lampiran []attachment.Reference `json:"lampiran,omitempty" bson:"lampiran,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
 }
+
+// Index makes the tokens of the examination time, the same as
+// radiology.RadiologyData does.
+func (radiologyRequest *RadiologyRequest) Index(index *blindindex.Index) {
+	if radiologyRequest.ConfidentialData == nil {
+		return
+	}
+
+	radiologyRequest.IndeksWaktuPemeriksaan = index.DateTokens(radiology.ExaminationTimeField, radiologyRequest.ConfidentialData.WaktuPemeriksaan)
+}
@@ -0,0 +1,42 @@
+package radiology
+
+import "errors"
+
+var (
+	NoStudyLinkedError        = errors.New("no study is linked to the document")
+	StudyAlreadyLinkedError   = errors.New("the document is already linked to another study")
+	StudyPatientMismatchError = errors.New("the study in the pacs belongs to another patient")
+	StudyPatientUnknownError  = errors.New("the study names neither the patient nor the accession number of the order")
+	MultipleStudiesError      = errors.New("the uploaded instances belong to more than one study")
+	ConcurrentUpdateError     = errors.New("radiology data was modified by another request")
+)
+
+// ImagingSeries is a series of a study as held by the PACS.
+type ImagingSeries struct {
+	SeriesInstanceUID string   `json:"series_instance_uid"`
+	NomorSeri         int      `json:"nomor_seri"`
+	Modalitas         string   `json:"modalitas"`
+	Deskripsi         string   `json:"deskripsi"`
+	JumlahInstance    int      `json:"jumlah_instance"`
+	SOPInstanceUID    []string `json:"sop_instance_uid,omitempty"`
+}
+
+// ImagingStudy is the metadata of the study linked to a radiology document.
+// It is read from the PACS on every request and never stored.
+type ImagingStudy struct {
+	StudyInstanceUID string          `json:"study_instance_uid"`
+	AccessionNumber  string          `json:"accession_number"`
+	IDPasien         string          `json:"id_pasien"`
+	NamaPasien       string          `json:"nama_pasien"`
+	TanggalStudi     string          `json:"tanggal_studi"` // YYYYMMDD, as sent by the PACS
+	WaktuStudi       string          `json:"waktu_studi"`
+	Deskripsi        string          `json:"deskripsi"`
+	Modalitas        []string        `json:"modalitas"`
+	JumlahSeri       int             `json:"jumlah_seri"`
+	JumlahInstance   int             `json:"jumlah_instance"`
+	Seri             []ImagingSeries `json:"seri,omitempty"`
+}
+
+type LinkStudyBody struct {
+	StudyInstanceUID string `json:"study_instance_uid" binding:"required"`
+}
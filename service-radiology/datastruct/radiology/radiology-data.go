@@ -1,16 +1,31 @@
 package radiology
 
 import (
+	"errors"
+	"service-radiology/attachment"
+	"service-radiology/blindindex"
 	"service-radiology/datastruct"
+	"service-radiology/signing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var InvalidEncounterError = errors.New("id_kunjungan must be the ID of an encounter")
+
 type RadiologyExaminationResult struct {
-	URLFotoHasilPemeriksaan           string `json:"url_foto_hasil_pemeriksaan" binding:"required" bson:"url_foto_hasil_pemeriksaan"`
+	// URLFotoHasilPemeriksaan is kept for results recorded before studies
+	// were linked from the PACS.
+	URLFotoHasilPemeriksaan           string `json:"url_foto_hasil_pemeriksaan" bson:"url_foto_hasil_pemeriksaan"`
 	DokterPenginterpretasiPemeriksaan string `json:"dokter_penginterpretasi_pemeriksaan" binding:"required" bson:"dokter_penginterpretasi_pemeriksaan"`
 	InterpretasiRadiologi             string `json:"interpretasi_radiologi" binding:"required" bson:"interpretasi_radiologi"`
+
+	// Laporan is written through the report endpoints only.
+	Laporan *RadiologyReport `json:"laporan,omitempty" bson:"laporan,omitempty"`
+
+	// LampiranFoto holds images which are not kept in the PACS, e.g. photos
+	// of films read elsewhere.
+	LampiranFoto []attachment.Reference `json:"lampiran_foto,omitempty" binding:"dive" bson:"lampiran_foto,omitempty"`
 }
 
 type ConfidentialRadiologyData struct {
@@ -28,8 +43,18 @@ type ConfidentialRadiologyData struct {
 	WaktuPemeriksaan                time.Time                      `json:"waktu_pemeriksaan" binding:"required" bson:"waktu_pemeriksaan"`
 	JenisBahanKontras               string                         `json:"jenis_bahan_kontras" binding:"required" bson:"jenis_bahan_kontras"`
 	HasilPemeriksaan                RadiologyExaminationResult     `json:"hasil_pemeriksaan" binding:"required" bson:"hasil_pemeriksaan"`
+
+	// Pasien pre-populates the modality through the worklist.
+	Pasien *WorklistPatient `json:"pasien,omitempty" bson:"pasien,omitempty"`
+
+	// Skrining is the contrast and radiation safety screening of the order.
+	Skrining *SafetyScreening `json:"skrining,omitempty" bson:"skrining,omitempty"`
 }
 
+// ExaminationTimeField is the field of the blind index of the examination
+// time.
+const ExaminationTimeField = "waktu_pemeriksaan"
+
 type RadiologyData struct {
 	ID primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 
@@ -40,10 +65,77 @@ type RadiologyData struct {
 	JenisPemeriksaan datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan" binding:"required" bson:"jenis_pemeriksaan"`
 	// NoPermintaan     string                              `json:"no_permintaan" binding:"required" bson:"no_permintaan"`
 
+	// IDKunjungan is the encounter the order was placed in, if any.
+	IDKunjungan *primitive.ObjectID `json:"id_kunjungan,omitempty" bson:"id_kunjungan,omitempty"`
+
+	// AccessionNumber and Jadwal are given to orders by the doctor, which
+	// then show up on the modality worklist.
+	AccessionNumber string              `json:"accession_number,omitempty" bson:"accession_number,omitempty"`
+	Jadwal          *ScheduledProcedure `json:"jadwal,omitempty" bson:"jadwal,omitempty"`
+
+	// StudyInstanceUID links the document to its images in the PACS. It is
+	// only set once the PACS confirmed the study.
+	StudyInstanceUID string        `json:"study_instance_uid,omitempty" bson:"study_instance_uid,omitempty"`
+	Studi            *ImagingStudy `json:"studi,omitempty" bson:"-"`
+
 	ConfidentialData      *ConfidentialRadiologyData `json:"confidential_data" binding:"required" bson:"confidential_data,omitempty"`
 	ConfidentialEncrypted *primitive.Binary          `json:"encrypted_confidential" bson:"encrypted_confidential"`
 
+	// IndeksWaktuPemeriksaan searches the encrypted examination time by its
+	// tokens.
+	IndeksWaktuPemeriksaan []string `json:"-" bson:"indeks_waktu_pemeriksaan,omitempty"`
+
+	// Lampiran records the hash of every attachment of the result, so the
+	// signature of the document covers them.
+	Lampiran []attachment.Reference `json:"lampiran,omitempty" bson:"lampiran,omitempty"`
+
+	// TandaTanganDigital is the signature of the radiologist over the signed
+	// off report, made with their own key.
+	TandaTanganDigital *signing.Signature `json:"tanda_tangan_digital,omitempty" bson:"tanda_tangan_digital,omitempty"`
+
 	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"-" bson:"deleted_at"`
 }
+
+// Attachments lists the attachments the result refers to.
+func (result *RadiologyExaminationResult) Attachments() []*attachment.Reference {
+	references := []*attachment.Reference{}
+	for i := 0; i < len(result.LampiranFoto); i++ {
+		references = append(references, &result.LampiranFoto[i])
+	}
+
+	return references
+}
+
+func (radiologyData *RadiologyData) PriorityString() string {
+	switch radiologyData.ConfidentialData.PrioritasPemeriksaan {
+	case datastruct.CITO:
+		return "CITO"
+	case datastruct.NON_CITO:
+		return "Non CITO"
+	default:
+		return ""
+	}
+}
+
+func (radiologyData *RadiologyData) SendingMethodString() string {
+	switch radiologyData.ConfidentialData.MetodePengiriman {
+	case datastruct.PENYERAHAN_LANGSUNG:
+		return "Penyerahan langsung"
+	case datastruct.VIA_SUREL:
+		return "Dikirim via surel"
+	default:
+		return ""
+	}
+}
+
+// Index makes the tokens of the examination time. It must be called before
+// the confidential data is encrypted.
+func (radiologyData *RadiologyData) Index(index *blindindex.Index) {
+	if radiologyData.ConfidentialData == nil {
+		return
+	}
+
+	radiologyData.IndeksWaktuPemeriksaan = index.DateTokens(ExaminationTimeField, radiologyData.ConfidentialData.WaktuPemeriksaan)
+}
@@ -0,0 +1,168 @@
+package radiology
+
+import (
+	"errors"
+	"fmt"
+	"service-radiology/datastruct"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ReportTemplateNotFoundError  = errors.New("report template is not registered")
+	ReportTemplateDuplicateError = errors.New("report template with the same kode already exists")
+	ExaminationTypeError         = errors.New("jenis_pemeriksaan is not a known radiology examination type")
+	SectionDuplicateError        = errors.New("the kode of a section must be unique within the template")
+	FindingOptionDuplicateError  = errors.New("the kode of a finding must be unique within its section")
+	TemplateMismatchError        = errors.New("the report template is meant for another examination type")
+	UnknownSectionError          = errors.New("the section is not part of the report template")
+	UnknownFindingError          = errors.New("the finding is not offered by its section of the report template")
+	SectionRequiredError         = errors.New("the section is required by the report template")
+)
+
+var examinationTypes = []datastruct.RadiologyExaminationType{
+	datastruct.CRANIUM,
+	datastruct.GIGI_GELIGI,
+	datastruct.VERTEBRA,
+	datastruct.BADAN,
+	datastruct.EKSTREMITAS_ATAS,
+	datastruct.EKSTREMITAS_BAWAH,
+	datastruct.KONTRAS_SALURAN_CERNA,
+	datastruct.KONTRAS_SALURAN_KENCING,
+}
+
+// FindingOption is a coded finding offered by a section, e.g. a RadLex term.
+type FindingOption struct {
+	Kode      string `json:"kode" binding:"required" bson:"kode"`
+	Sistem    string `json:"sistem" bson:"sistem"`
+	Deskripsi string `json:"deskripsi" binding:"required" bson:"deskripsi"`
+}
+
+// ReportSectionTemplate is a section of the report, e.g. "Teknik" or
+// "Temuan". Sections without finding options take free text only.
+type ReportSectionTemplate struct {
+	Kode          string          `json:"kode" binding:"required" bson:"kode"`
+	Judul         string          `json:"judul" binding:"required" bson:"judul"`
+	Wajib         bool            `json:"wajib" bson:"wajib"`
+	PilihanTemuan []FindingOption `json:"pilihan_temuan" binding:"dive" bson:"pilihan_temuan"`
+}
+
+// ReportTemplate lays out the reports of an examination type. Reports copy
+// the titles and descriptions they were written with, so a template can be
+// changed without changing the reports already written.
+type ReportTemplate struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	Kode             string                              `json:"kode" binding:"required" bson:"kode"`
+	Nama             string                              `json:"nama" binding:"required" bson:"nama"`
+	JenisPemeriksaan datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan" binding:"required" bson:"jenis_pemeriksaan"`
+	Bagian           []ReportSectionTemplate             `json:"bagian" binding:"required,min=1,dive" bson:"bagian"`
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+func ValidExaminationType(examinationType datastruct.RadiologyExaminationType) bool {
+	for i := 0; i < len(examinationTypes); i++ {
+		if examinationTypes[i] == examinationType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (template *ReportTemplate) Validate() error {
+	if !ValidExaminationType(template.JenisPemeriksaan) {
+		return ExaminationTypeError
+	}
+
+	sections := map[string]bool{}
+	for i := 0; i < len(template.Bagian); i++ {
+		section := template.Bagian[i]
+		if sections[section.Kode] {
+			return fmt.Errorf("%s: %w", section.Kode, SectionDuplicateError)
+		}
+		sections[section.Kode] = true
+
+		findings := map[string]bool{}
+		for j := 0; j < len(section.PilihanTemuan); j++ {
+			if findings[section.PilihanTemuan[j].Kode] {
+				return fmt.Errorf("%s/%s: %w", section.Kode, section.PilihanTemuan[j].Kode, FindingOptionDuplicateError)
+			}
+			findings[section.PilihanTemuan[j].Kode] = true
+		}
+	}
+
+	return nil
+}
+
+func (template *ReportTemplate) Section(code string) *ReportSectionTemplate {
+	for i := 0; i < len(template.Bagian); i++ {
+		if template.Bagian[i].Kode == code {
+			return &template.Bagian[i]
+		}
+	}
+
+	return nil
+}
+
+func (section *ReportSectionTemplate) Finding(code string) *FindingOption {
+	for i := 0; i < len(section.PilihanTemuan); i++ {
+		if section.PilihanTemuan[i].Kode == code {
+			return &section.PilihanTemuan[i]
+		}
+	}
+
+	return nil
+}
+
+// Apply checks the sections of a report against the template and lays them
+// out in the order of the template, with the titles and descriptions of the
+// template. A complete report must fill every required section.
+func (template *ReportTemplate) Apply(sections []ReportSection, complete bool) ([]ReportSection, error) {
+	written := map[string]*ReportSection{}
+	for i := 0; i < len(sections); i++ {
+		section := &sections[i]
+		if template.Section(section.Kode) == nil {
+			return nil, fmt.Errorf("%s: %w", section.Kode, UnknownSectionError)
+		}
+		if _, ok := written[section.Kode]; ok {
+			return nil, fmt.Errorf("%s: %w", section.Kode, SectionDuplicateError)
+		}
+		written[section.Kode] = section
+	}
+
+	applied := []ReportSection{}
+	for i := 0; i < len(template.Bagian); i++ {
+		sectionTemplate := &template.Bagian[i]
+
+		section, ok := written[sectionTemplate.Kode]
+		if !ok || section.Empty() {
+			if complete && sectionTemplate.Wajib {
+				return nil, fmt.Errorf("%s: %w", sectionTemplate.Kode, SectionRequiredError)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		for j := 0; j < len(section.Temuan); j++ {
+			option := sectionTemplate.Finding(section.Temuan[j].Kode)
+			if option == nil {
+				return nil, fmt.Errorf("%s/%s: %w", section.Kode, section.Temuan[j].Kode, UnknownFindingError)
+			}
+
+			section.Temuan[j].Sistem = option.Sistem
+			section.Temuan[j].Deskripsi = option.Deskripsi
+		}
+
+		section.Judul = sectionTemplate.Judul
+		applied = append(applied, *section)
+	}
+
+	return applied, nil
+}
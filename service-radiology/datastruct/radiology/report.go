@@ -0,0 +1,307 @@
+package radiology
+
+import (
+	"errors"
+	"fmt"
+	"service-radiology/datastruct"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidReportTransitionError = errors.New("report cannot move to this status from its current status")
+	NoReportError                = errors.New("no report has been written for the document")
+	ImpressionRequiredError      = errors.New("kesan is required to sign the report off")
+	ReportLockedError            = errors.New("the report has been signed off and can only be amended with an addendum")
+	ReportNotLockedError         = errors.New("the report must be signed off before it is signed")
+	NotReportRadiologistError    = errors.New("only the radiologist who signed the report off can sign it")
+)
+
+// reportTransitions lists for every status the statuses it can be reached
+// from. A preliminary report can be rewritten until it is signed off, after
+// which it can only be amended.
+var reportTransitions = map[datastruct.ReportStatus][]datastruct.ReportStatus{
+	datastruct.LAPORAN_PRELIMINER: {0, datastruct.LAPORAN_PRELIMINER},
+	datastruct.LAPORAN_FINAL:      {datastruct.LAPORAN_PRELIMINER},
+	datastruct.LAPORAN_ADENDUM:    {datastruct.LAPORAN_FINAL, datastruct.LAPORAN_ADENDUM},
+}
+
+// Finding is a coded finding written in a section. The system and the
+// description are copied from the template.
+type Finding struct {
+	Kode      string `json:"kode" binding:"required" bson:"kode"`
+	Sistem    string `json:"sistem" bson:"sistem"`
+	Deskripsi string `json:"deskripsi" bson:"deskripsi"`
+	Catatan   string `json:"catatan" bson:"catatan"`
+}
+
+type ReportSection struct {
+	Kode   string    `json:"kode" binding:"required" bson:"kode"`
+	Judul  string    `json:"judul" bson:"judul"`
+	Temuan []Finding `json:"temuan" binding:"dive" bson:"temuan"`
+	Teks   string    `json:"teks" bson:"teks"`
+}
+
+type ReportAddendum struct {
+	Teks     string    `json:"teks" bson:"teks"`
+	Radiolog string    `json:"radiolog" bson:"radiolog"`
+	Waktu    time.Time `json:"waktu" bson:"waktu"`
+}
+
+type ReportStatusChange struct {
+	Dari    datastruct.ReportStatus `json:"dari" bson:"dari"`
+	Ke      datastruct.ReportStatus `json:"ke" bson:"ke"`
+	Petugas string                  `json:"petugas" bson:"petugas"`
+	Waktu   time.Time               `json:"waktu" bson:"waktu"`
+}
+
+// RadiologyReport is the structured report of an examination, written
+// along a template. Its text is kept in InterpretasiRadiologi for readers
+// of the free-text result.
+type RadiologyReport struct {
+	KodeTemplate string                  `json:"kode_template" bson:"kode_template"`
+	NamaTemplate string                  `json:"nama_template" bson:"nama_template"`
+	Status       datastruct.ReportStatus `json:"status" bson:"status"`
+	Bagian       []ReportSection         `json:"bagian" bson:"bagian"`
+	Kesan        string                  `json:"kesan" bson:"kesan"`
+
+	// the radiologist signing the report off
+	Radiolog         string     `json:"radiolog" bson:"radiolog"`
+	WaktuTandaTangan *time.Time `json:"waktu_tanda_tangan" bson:"waktu_tanda_tangan"`
+
+	Adendum       []ReportAddendum     `json:"adendum" bson:"adendum"`
+	RiwayatStatus []ReportStatusChange `json:"riwayat_status" bson:"riwayat_status"`
+}
+
+// ReportBody writes a preliminary report. The template of the report is
+// kept when kode_template is left empty.
+type ReportBody struct {
+	KodeTemplate string          `json:"kode_template"`
+	Bagian       []ReportSection `json:"bagian" binding:"dive"`
+	Kesan        string          `json:"kesan"`
+}
+
+type AddendumBody struct {
+	Teks string `json:"teks" binding:"required"`
+}
+
+type SignBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SignedReport is what the radiologist signs: the report as it was signed
+// off, without the addenda written after it.
+type SignedReport struct {
+	ID               string                              `json:"_id"`
+	NoIHS            string                              `json:"no_ihs"`
+	AccessionNumber  string                              `json:"accession_number"`
+	NamaPemeriksaan  string                              `json:"nama_pemeriksaan"`
+	JenisPemeriksaan datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan"`
+	StudyInstanceUID string                              `json:"study_instance_uid"`
+	WaktuPemeriksaan time.Time                           `json:"waktu_pemeriksaan"`
+
+	KodeTemplate     string          `json:"kode_template"`
+	Bagian           []ReportSection `json:"bagian"`
+	Kesan            string          `json:"kesan"`
+	Radiolog         string          `json:"radiolog"`
+	WaktuTandaTangan *time.Time      `json:"waktu_tanda_tangan"`
+}
+
+func ReportStatusString(status datastruct.ReportStatus) string {
+	switch status {
+	case datastruct.LAPORAN_PRELIMINER:
+		return "preliminer"
+	case datastruct.LAPORAN_FINAL:
+		return "final"
+	case datastruct.LAPORAN_ADENDUM:
+		return "adendum"
+	default:
+		return ""
+	}
+}
+
+func CheckReportTransition(from, to datastruct.ReportStatus) error {
+	for i := 0; i < len(reportTransitions[to]); i++ {
+		if reportTransitions[to][i] == from {
+			return nil
+		}
+	}
+
+	if from >= datastruct.LAPORAN_FINAL && to == datastruct.LAPORAN_PRELIMINER {
+		return ReportLockedError
+	}
+
+	return fmt.Errorf("%s to %s: %w", ReportStatusString(from), ReportStatusString(to), InvalidReportTransitionError)
+}
+
+func (section *ReportSection) Empty() bool {
+	return len(section.Temuan) == 0 && strings.TrimSpace(section.Teks) == ""
+}
+
+// Locked reports whether the report has been signed off.
+func (report *RadiologyReport) Locked() bool {
+	return report.Status >= datastruct.LAPORAN_FINAL
+}
+
+func (report *RadiologyReport) advance(to datastruct.ReportStatus, by string, at time.Time) error {
+	if err := CheckReportTransition(report.Status, to); err != nil {
+		return err
+	}
+
+	report.RiwayatStatus = append(report.RiwayatStatus, ReportStatusChange{
+		Dari:    report.Status,
+		Ke:      to,
+		Petugas: by,
+		Waktu:   at,
+	})
+	report.Status = to
+
+	return nil
+}
+
+// Draft writes the report as preliminary. Sections may still be missing.
+func (report *RadiologyReport) Draft(template *ReportTemplate, body ReportBody, by string, at time.Time) error {
+	if err := CheckReportTransition(report.Status, datastruct.LAPORAN_PRELIMINER); err != nil {
+		return err
+	}
+
+	sections, err := template.Apply(body.Bagian, false)
+	if err != nil {
+		return err
+	}
+
+	if err := report.advance(datastruct.LAPORAN_PRELIMINER, by, at); err != nil {
+		return err
+	}
+
+	report.KodeTemplate = template.Kode
+	report.NamaTemplate = template.Nama
+	report.Bagian = sections
+	report.Kesan = strings.TrimSpace(body.Kesan)
+
+	return nil
+}
+
+// SignOff makes the report final once it fills its template, which may
+// have changed since the report was drafted.
+func (report *RadiologyReport) SignOff(template *ReportTemplate, by string, at time.Time) error {
+	if err := CheckReportTransition(report.Status, datastruct.LAPORAN_FINAL); err != nil {
+		return err
+	}
+
+	sections, err := template.Apply(report.Bagian, true)
+	if err != nil {
+		return err
+	}
+
+	if report.Kesan == "" {
+		return ImpressionRequiredError
+	}
+
+	if err := report.advance(datastruct.LAPORAN_FINAL, by, at); err != nil {
+		return err
+	}
+
+	report.NamaTemplate = template.Nama
+	report.Bagian = sections
+	report.Radiolog = by
+	report.WaktuTandaTangan = &at
+
+	return nil
+}
+
+// Amend adds an addendum to a signed off report, leaving the report itself
+// as it was signed.
+func (report *RadiologyReport) Amend(text, by string, at time.Time) error {
+	if err := report.advance(datastruct.LAPORAN_ADENDUM, by, at); err != nil {
+		return err
+	}
+
+	report.Adendum = append(report.Adendum, ReportAddendum{
+		Teks:     strings.TrimSpace(text),
+		Radiolog: by,
+		Waktu:    at,
+	})
+
+	return nil
+}
+
+// Text lays the report out as plain text, with its addenda below it.
+func (report *RadiologyReport) Text() string {
+	var text strings.Builder
+
+	for i := 0; i < len(report.Bagian); i++ {
+		section := report.Bagian[i]
+		if section.Empty() {
+			continue
+		}
+
+		fmt.Fprintf(&text, "%s:\n", strings.ToUpper(section.Judul))
+		for j := 0; j < len(section.Temuan); j++ {
+			finding := section.Temuan[j]
+			if finding.Catatan != "" {
+				fmt.Fprintf(&text, "- %s (%s)\n", finding.Deskripsi, finding.Catatan)
+			} else {
+				fmt.Fprintf(&text, "- %s\n", finding.Deskripsi)
+			}
+		}
+		if teks := strings.TrimSpace(section.Teks); teks != "" {
+			fmt.Fprintf(&text, "%s\n", teks)
+		}
+		text.WriteString("\n")
+	}
+
+	if report.Kesan != "" {
+		fmt.Fprintf(&text, "KESAN:\n%s\n", report.Kesan)
+	}
+
+	for i := 0; i < len(report.Adendum); i++ {
+		addendum := report.Adendum[i]
+		fmt.Fprintf(&text, "\nADENDUM (%s, %s):\n%s\n", addendum.Waktu.Format("2006-01-02 15:04"), addendum.Radiolog, addendum.Teks)
+	}
+
+	return strings.TrimSpace(text.String())
+}
+
+// SignedContent returns the part of the document the radiologist signs. The
+// confidential data must be decrypted.
+func (radiologyData *RadiologyData) SignedContent() SignedReport {
+	confidential := radiologyData.ConfidentialData
+	content := SignedReport{
+		ID:               radiologyData.ID.Hex(),
+		NoIHS:            radiologyData.NoIHS,
+		AccessionNumber:  radiologyData.AccessionNumber,
+		NamaPemeriksaan:  radiologyData.NamaPemeriksaan,
+		JenisPemeriksaan: radiologyData.JenisPemeriksaan,
+		StudyInstanceUID: radiologyData.StudyInstanceUID,
+		WaktuPemeriksaan: confidential.WaktuPemeriksaan,
+	}
+
+	if report := confidential.HasilPemeriksaan.Laporan; report != nil {
+		content.KodeTemplate = report.KodeTemplate
+		content.Bagian = report.Bagian
+		content.Kesan = report.Kesan
+		content.Radiolog = report.Radiolog
+		content.WaktuTandaTangan = report.WaktuTandaTangan
+	}
+
+	return content
+}
+
+// CanBeSignedBy checks the report was signed off by the user signing it.
+func (radiologyData *RadiologyData) CanBeSignedBy(by string) error {
+	report := radiologyData.ConfidentialData.HasilPemeriksaan.Laporan
+	if report == nil {
+		return NoReportError
+	}
+
+	if !report.Locked() {
+		return ReportNotLockedError
+	}
+
+	if report.Radiolog != by {
+		return NotReportRadiologistError
+	}
+
+	return nil
+}
@@ -0,0 +1,472 @@
+package radiology
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"service-radiology/datastruct"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ScreeningRuleNotFoundError    = errors.New("screening rule is not registered")
+	ScreeningRuleDuplicateError   = errors.New("screening rule with the same kode already exists")
+	InvalidScreeningRuleError     = errors.New("kondisi, hasil and kategori_kontras of the screening rule must be known values")
+	EGFRThresholdRequiredError    = errors.New("batas_egfr is required for renal function rules")
+	RenalRuleContrastError        = errors.New("renal function rules must name the contrast categories they apply to")
+	RenalFunctionInputError       = errors.New("fungsi_ginjal needs kreatinin_serum or egfr")
+	ScreeningFindingNotFoundError = errors.New("the safety screening of the order has no finding for this rule")
+)
+
+// nonIonizingModalities are the modalities examining without ionizing
+// radiation. Every other modality is screened as ionizing.
+var nonIonizingModalities = map[string]bool{
+	"MR": true,
+	"US": true,
+}
+
+// contrastKeywords recognize the category of a contrast agent written as
+// free text, by its class or by common generic and brand names.
+var contrastKeywords = []struct {
+	category datastruct.ContrastCategory
+	keywords []string
+}{
+	{datastruct.KONTRAS_GADOLINIUM, []string{"gado", "gd-", "dotarem", "magnevist", "omniscan", "prohance", "multihance", "clariscan"}},
+	{datastruct.KONTRAS_IODINASI, []string{"iod", "iohexol", "iopamidol", "iopromide", "ioversol", "iomeprol", "omnipaque", "visipaque", "ultravist", "optiray", "iopamiro", "urografin"}},
+	{datastruct.KONTRAS_BARIUM, []string{"barium", "bariumsulfat", "baso4"}},
+}
+
+var noContrast = []string{"", "-", "tidak ada", "tidak", "tanpa", "tanpa kontras", "none", "non kontras", "nonkontras"}
+
+// ScreeningRule raises a finding when an order meets its condition. A rule
+// naming neither radiation nor contrast categories applies to every order;
+// otherwise it applies to ionizing procedures when Radiasi is set, and to
+// orders with a contrast agent of one of its categories.
+type ScreeningRule struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	Kode            string                        `json:"kode" binding:"required" bson:"kode"`
+	Nama            string                        `json:"nama" binding:"required" bson:"nama"`
+	Kondisi         datastruct.ScreeningCondition `json:"kondisi" binding:"required" bson:"kondisi"`
+	Radiasi         bool                          `json:"radiasi" bson:"radiasi"`
+	KategoriKontras []datastruct.ContrastCategory `json:"kategori_kontras" bson:"kategori_kontras"`
+	Hasil           datastruct.ScreeningOutcome   `json:"hasil" binding:"required" bson:"hasil"`
+	Deskripsi       string                        `json:"deskripsi" binding:"required" bson:"deskripsi"`
+	Rekomendasi     string                        `json:"rekomendasi" bson:"rekomendasi"`
+
+	// renal function rules only
+	BatasEGFR       float64 `json:"batas_egfr" bson:"batas_egfr"`               // raised below it, in mL/min/1.73 m²
+	MasaBerlakuHari int     `json:"masa_berlaku_hari" bson:"masa_berlaku_hari"` // how old the creatinine may be
+
+	CreatedAt *time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+// RenalFunction is recorded by the radiology staff before iodinated or
+// gadolinium contrast is given. The eGFR is worked out from the serum
+// creatinine when it is not given.
+type RenalFunction struct {
+	KreatininSerum     float64   `json:"kreatinin_serum" bson:"kreatinin_serum"` // mg/dL
+	TanggalPemeriksaan time.Time `json:"tanggal_pemeriksaan" binding:"required" bson:"tanggal_pemeriksaan"`
+	TinggiBadan        float64   `json:"tinggi_badan" bson:"tinggi_badan"` // cm, for children
+	EGFR               float64   `json:"egfr" bson:"egfr"`
+}
+
+// ScreeningOverride documents the radiologist's decision to go ahead with
+// the procedure despite a finding.
+type ScreeningOverride struct {
+	Radiolog string    `json:"radiolog" bson:"radiolog"`
+	Alasan   string    `json:"alasan" bson:"alasan"`
+	Waktu    time.Time `json:"waktu" bson:"waktu"`
+}
+
+type ScreeningFinding struct {
+	KodeAturan  string                        `json:"kode_aturan" bson:"kode_aturan"`
+	Kondisi     datastruct.ScreeningCondition `json:"kondisi" bson:"kondisi"`
+	Hasil       datastruct.ScreeningOutcome   `json:"hasil" bson:"hasil"`
+	Deskripsi   string                        `json:"deskripsi" bson:"deskripsi"`
+	Rekomendasi string                        `json:"rekomendasi" bson:"rekomendasi"`
+	Override    *ScreeningOverride            `json:"override" bson:"override,omitempty"`
+}
+
+// SafetyScreening is the outcome of the contrast and radiation safety
+// screening of an order. The order stays off the worklist while it is
+// blocked.
+type SafetyScreening struct {
+	KategoriKontras   datastruct.ContrastCategory `json:"kategori_kontras" bson:"kategori_kontras"`
+	KontrasDitetapkan bool                        `json:"kontras_ditetapkan" bson:"kontras_ditetapkan"` // set by the radiology staff rather than read from jenis_bahan_kontras
+	Radiasi           bool                        `json:"radiasi" bson:"radiasi"`
+	FungsiGinjal      *RenalFunction              `json:"fungsi_ginjal" bson:"fungsi_ginjal,omitempty"`
+	Temuan            []ScreeningFinding          `json:"temuan" bson:"temuan"`
+	Diblokir          bool                        `json:"diblokir" bson:"diblokir"`
+	WaktuSkrining     time.Time                   `json:"waktu_skrining" bson:"waktu_skrining"`
+}
+
+// ScreeningSubject is what an order is screened on.
+type ScreeningSubject struct {
+	StatusKehamilan   bool
+	StatusAlergi      bool
+	JenisBahanKontras string
+	Modalitas         string
+	Pasien            *WorklistPatient
+}
+
+// ScreeningBody records the inputs of the screening the radiology staff
+// checked with the patient.
+type ScreeningBody struct {
+	KategoriKontras datastruct.ContrastCategory `json:"kategori_kontras"`
+	StatusAlergi    *bool                       `json:"status_alergi"`
+	StatusKehamilan *bool                       `json:"status_kehamilan"`
+	FungsiGinjal    *RenalFunction              `json:"fungsi_ginjal"`
+}
+
+type ScreeningOverrideBody struct {
+	KodeAturan string `json:"kode_aturan" binding:"required"`
+	Alasan     string `json:"alasan" binding:"required"`
+}
+
+// ScreeningPreviewBody lets the doctor screen an order before placing it.
+type ScreeningPreviewBody struct {
+	JenisPemeriksaan  datastruct.RadiologyExaminationType `json:"jenis_pemeriksaan" binding:"required"`
+	JenisBahanKontras string                              `json:"jenis_bahan_kontras"`
+	StatusAlergi      bool                                `json:"status_alergi"`
+	StatusKehamilan   bool                                `json:"status_kehamilan"`
+	Pasien            *WorklistPatient                    `json:"pasien"`
+	FungsiGinjal      *RenalFunction                      `json:"fungsi_ginjal"`
+}
+
+// DefaultScreeningRules apply to every facility unless it registers a rule
+// with the same kode. They follow the contrast media guidelines of the ACR
+// and ESUR.
+func DefaultScreeningRules() []ScreeningRule {
+	return []ScreeningRule{
+		{
+			Kode:        "KEHAMILAN-RADIASI",
+			Nama:        "Kehamilan pada pemeriksaan dengan radiasi pengion",
+			Kondisi:     datastruct.SKRINING_KEHAMILAN,
+			Radiasi:     true,
+			Hasil:       datastruct.SKRINING_BLOKIR,
+			Deskripsi:   "Pasien hamil dijadwalkan untuk pemeriksaan dengan radiasi pengion",
+			Rekomendasi: "Pertimbangkan USG atau MRI; bila tetap dilakukan, radiolog menjustifikasi pemeriksaan dan membatasi dosis",
+		},
+		{
+			Kode:            "KEHAMILAN-GADOLINIUM",
+			Nama:            "Kehamilan pada pemeriksaan dengan kontras gadolinium",
+			Kondisi:         datastruct.SKRINING_KEHAMILAN,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_GADOLINIUM},
+			Hasil:           datastruct.SKRINING_BLOKIR,
+			Deskripsi:       "Pasien hamil dijadwalkan untuk pemeriksaan dengan kontras gadolinium",
+			Rekomendasi:     "Hindari gadolinium kecuali manfaatnya jelas melebihi risikonya",
+		},
+		{
+			Kode:            "ALERGI-KONTRAS",
+			Nama:            "Riwayat alergi pada pemberian kontras",
+			Kondisi:         datastruct.SKRINING_ALERGI,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_IODINASI, datastruct.KONTRAS_GADOLINIUM},
+			Hasil:           datastruct.SKRINING_PERINGATAN,
+			Deskripsi:       "Pasien memiliki riwayat alergi dan akan menerima kontras",
+			Rekomendasi:     "Tanyakan riwayat reaksi terhadap kontras; pertimbangkan premedikasi atau agen lain",
+		},
+		{
+			Kode:            "GINJAL-IODINASI-30",
+			Nama:            "eGFR di bawah 30 pada kontras iodinasi",
+			Kondisi:         datastruct.SKRINING_FUNGSI_GINJAL,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_IODINASI},
+			Hasil:           datastruct.SKRINING_BLOKIR,
+			Deskripsi:       "Fungsi ginjal pasien berisiko untuk kontras iodinasi",
+			Rekomendasi:     "Pertimbangkan pemeriksaan tanpa kontras; bila tetap dilakukan, berikan hidrasi dan dosis kontras serendah mungkin",
+			BatasEGFR:       30,
+		},
+		{
+			Kode:            "GINJAL-IODINASI-45",
+			Nama:            "eGFR di bawah 45 pada kontras iodinasi",
+			Kondisi:         datastruct.SKRINING_FUNGSI_GINJAL,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_IODINASI},
+			Hasil:           datastruct.SKRINING_PERINGATAN,
+			Deskripsi:       "Fungsi ginjal pasien menurun untuk kontras iodinasi",
+			Rekomendasi:     "Berikan hidrasi sebelum dan sesudah pemeriksaan",
+			BatasEGFR:       45,
+		},
+		{
+			Kode:            "GINJAL-GADOLINIUM-30",
+			Nama:            "eGFR di bawah 30 pada kontras gadolinium",
+			Kondisi:         datastruct.SKRINING_FUNGSI_GINJAL,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_GADOLINIUM},
+			Hasil:           datastruct.SKRINING_BLOKIR,
+			Deskripsi:       "Fungsi ginjal pasien berisiko untuk kontras gadolinium",
+			Rekomendasi:     "Gunakan agen gadolinium grup II dengan dosis serendah mungkin",
+			BatasEGFR:       30,
+		},
+		{
+			Kode:            "DATA-GINJAL-IODINASI",
+			Nama:            "Fungsi ginjal belum diperiksa pada kontras iodinasi",
+			Kondisi:         datastruct.SKRINING_DATA_GINJAL,
+			KategoriKontras: []datastruct.ContrastCategory{datastruct.KONTRAS_IODINASI},
+			Hasil:           datastruct.SKRINING_PERINGATAN,
+			Deskripsi:       "Kreatinin serum belum diperiksa dalam 30 hari terakhir",
+			Rekomendasi:     "Periksa kreatinin serum sebelum pemberian kontras",
+			MasaBerlakuHari: 30,
+		},
+	}
+}
+
+func validContrastCategory(category datastruct.ContrastCategory) bool {
+	return category >= datastruct.TANPA_KONTRAS && category <= datastruct.KONTRAS_BARIUM
+}
+
+func (rule *ScreeningRule) Validate() error {
+	if rule.Kondisi < datastruct.SKRINING_KEHAMILAN || rule.Kondisi > datastruct.SKRINING_DATA_GINJAL {
+		return InvalidScreeningRuleError
+	}
+
+	if rule.Hasil != datastruct.SKRINING_PERINGATAN && rule.Hasil != datastruct.SKRINING_BLOKIR {
+		return InvalidScreeningRuleError
+	}
+
+	for i := 0; i < len(rule.KategoriKontras); i++ {
+		if !validContrastCategory(rule.KategoriKontras[i]) {
+			return InvalidScreeningRuleError
+		}
+	}
+
+	if rule.Kondisi == datastruct.SKRINING_FUNGSI_GINJAL || rule.Kondisi == datastruct.SKRINING_DATA_GINJAL {
+		if len(rule.KategoriKontras) == 0 {
+			return RenalRuleContrastError
+		}
+	}
+
+	if rule.Kondisi == datastruct.SKRINING_FUNGSI_GINJAL && rule.BatasEGFR <= 0 {
+		return EGFRThresholdRequiredError
+	}
+
+	return nil
+}
+
+// ContrastCategoryOf reads the category of a contrast agent written as free
+// text. Zero is returned for an agent that is not recognized.
+func ContrastCategoryOf(agent string) datastruct.ContrastCategory {
+	agent = strings.ToLower(strings.TrimSpace(agent))
+	for i := 0; i < len(noContrast); i++ {
+		if agent == noContrast[i] {
+			return datastruct.TANPA_KONTRAS
+		}
+	}
+
+	for i := 0; i < len(contrastKeywords); i++ {
+		for j := 0; j < len(contrastKeywords[i].keywords); j++ {
+			if strings.Contains(agent, contrastKeywords[i].keywords[j]) {
+				return contrastKeywords[i].category
+			}
+		}
+	}
+
+	return 0
+}
+
+func Ionizing(modality string) bool {
+	return !nonIonizingModalities[strings.ToUpper(strings.TrimSpace(modality))]
+}
+
+func ageInYears(birth, at time.Time) int {
+	years := at.Year() - birth.Year()
+	if at.Month() < birth.Month() || (at.Month() == birth.Month() && at.Day() < birth.Day()) {
+		years--
+	}
+
+	return years
+}
+
+// EstimateEGFR works out the eGFR in mL/min/1.73 m² from the serum
+// creatinine in mg/dL, with the CKD-EPI 2021 equation for adults and the
+// bedside Schwartz equation for children. Zero is returned when the patient
+// data the equation needs is missing.
+func EstimateEGFR(creatinine float64, birth time.Time, sex datastruct.SexType, height float64, at time.Time) float64 {
+	if creatinine <= 0 || birth.IsZero() || at.Before(birth) {
+		return 0
+	}
+
+	age := ageInYears(birth, at)
+	if age < 18 {
+		if height <= 0 {
+			return 0
+		}
+		return math.Round(0.413*height/creatinine*10) / 10
+	}
+
+	var kappa, alpha, factor float64
+	switch sex {
+	case datastruct.FEMALE:
+		kappa, alpha, factor = 0.7, -0.241, 1.012
+	case datastruct.MALE:
+		kappa, alpha, factor = 0.9, -0.302, 1
+	default:
+		return 0
+	}
+
+	ratio := creatinine / kappa
+	egfr := 142 * math.Pow(math.Min(ratio, 1), alpha) * math.Pow(math.Max(ratio, 1), -1.2) * math.Pow(0.9938, float64(age)) * factor
+
+	return math.Round(egfr*10) / 10
+}
+
+func (renal *RenalFunction) Validate() error {
+	if renal.KreatininSerum <= 0 && renal.EGFR <= 0 {
+		return RenalFunctionInputError
+	}
+
+	return nil
+}
+
+// Estimate fills in the eGFR from the serum creatinine when it was not
+// given.
+func (renal *RenalFunction) Estimate(patient *WorklistPatient) {
+	if renal.EGFR > 0 || patient == nil {
+		return
+	}
+
+	renal.EGFR = EstimateEGFR(renal.KreatininSerum, patient.TanggalLahir, patient.JenisKelamin, renal.TinggiBadan, renal.TanggalPemeriksaan)
+}
+
+func (rule *ScreeningRule) appliesTo(category datastruct.ContrastCategory, ionizing bool) bool {
+	if !rule.Radiasi && len(rule.KategoriKontras) == 0 {
+		return true
+	}
+
+	if rule.Radiasi && ionizing {
+		return true
+	}
+
+	// an agent that is not recognized is screened against every category
+	for i := 0; i < len(rule.KategoriKontras); i++ {
+		if rule.KategoriKontras[i] == category || (category == 0 && rule.KategoriKontras[i] != datastruct.TANPA_KONTRAS) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check tells whether the rule raises a finding, and its description.
+func (rule *ScreeningRule) check(subject ScreeningSubject, renal *RenalFunction, at time.Time) (bool, string) {
+	switch rule.Kondisi {
+	case datastruct.SKRINING_KEHAMILAN:
+		return subject.StatusKehamilan, rule.Deskripsi
+	case datastruct.SKRINING_ALERGI:
+		return subject.StatusAlergi, rule.Deskripsi
+	case datastruct.SKRINING_FUNGSI_GINJAL:
+		if renal == nil || renal.EGFR <= 0 || renal.EGFR >= rule.BatasEGFR {
+			return false, ""
+		}
+		return true, fmt.Sprintf("%s (eGFR %s)", rule.Deskripsi, strconv.FormatFloat(renal.EGFR, 'f', -1, 64))
+	case datastruct.SKRINING_DATA_GINJAL:
+		if renal == nil || renal.EGFR <= 0 {
+			return true, rule.Deskripsi
+		}
+		if rule.MasaBerlakuHari > 0 && at.Sub(renal.TanggalPemeriksaan) > time.Duration(rule.MasaBerlakuHari)*24*time.Hour {
+			return true, rule.Deskripsi
+		}
+		return false, ""
+	default:
+		return false, ""
+	}
+}
+
+// Screen checks an order against the rules. The inputs recorded by the
+// radiology staff are taken from the previous screening, as are the
+// overrides of findings raised again.
+func Screen(rules []ScreeningRule, subject ScreeningSubject, previous *SafetyScreening, at time.Time) *SafetyScreening {
+	screening := &SafetyScreening{
+		Radiasi:       Ionizing(subject.Modalitas),
+		Temuan:        []ScreeningFinding{},
+		WaktuSkrining: at,
+	}
+
+	overrides := map[string]*ScreeningOverride{}
+	if previous != nil {
+		screening.FungsiGinjal = previous.FungsiGinjal
+		if previous.KontrasDitetapkan {
+			screening.KategoriKontras = previous.KategoriKontras
+			screening.KontrasDitetapkan = true
+		}
+
+		for i := 0; i < len(previous.Temuan); i++ {
+			if previous.Temuan[i].Override != nil {
+				overrides[previous.Temuan[i].KodeAturan] = previous.Temuan[i].Override
+			}
+		}
+	}
+
+	if !screening.KontrasDitetapkan {
+		screening.KategoriKontras = ContrastCategoryOf(subject.JenisBahanKontras)
+	}
+
+	if screening.FungsiGinjal != nil {
+		screening.FungsiGinjal.Estimate(subject.Pasien)
+	}
+
+	for i := 0; i < len(rules); i++ {
+		rule := &rules[i]
+		if !rule.appliesTo(screening.KategoriKontras, screening.Radiasi) {
+			continue
+		}
+
+		raised, description := rule.check(subject, screening.FungsiGinjal, at)
+		if !raised {
+			continue
+		}
+
+		screening.Temuan = append(screening.Temuan, ScreeningFinding{
+			KodeAturan:  rule.Kode,
+			Kondisi:     rule.Kondisi,
+			Hasil:       rule.Hasil,
+			Deskripsi:   description,
+			Rekomendasi: rule.Rekomendasi,
+			Override:    overrides[rule.Kode],
+		})
+	}
+
+	screening.settle()
+
+	return screening
+}
+
+func (screening *SafetyScreening) settle() {
+	screening.Diblokir = false
+	for i := 0; i < len(screening.Temuan); i++ {
+		if screening.Temuan[i].Hasil == datastruct.SKRINING_BLOKIR && screening.Temuan[i].Override == nil {
+			screening.Diblokir = true
+		}
+	}
+}
+
+// Blocked tells whether the order may not be examined yet. Orders never
+// screened are not blocked.
+func (screening *SafetyScreening) Blocked() bool {
+	return screening != nil && screening.Diblokir
+}
+
+// Override records the radiologist's decision on a finding.
+func (screening *SafetyScreening) Override(code, reason, by string, at time.Time) error {
+	for i := 0; i < len(screening.Temuan); i++ {
+		if screening.Temuan[i].KodeAturan != code {
+			continue
+		}
+
+		screening.Temuan[i].Override = &ScreeningOverride{
+			Radiolog: by,
+			Alasan:   strings.TrimSpace(reason),
+			Waktu:    at,
+		}
+		screening.settle()
+
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", code, ScreeningFindingNotFoundError)
+}
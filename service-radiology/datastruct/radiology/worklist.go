@@ -0,0 +1,144 @@
+package radiology
+
+import (
+	"errors"
+	"service-radiology/datastruct"
+	"time"
+)
+
+var (
+	NotScheduledError       = errors.New("the document is not an order on the worklist")
+	InvalidWorklistDayError = errors.New("tanggal must be written as YYYY-MM-DD")
+)
+
+// WorklistPatient holds the demographics a modality is pre-populated with.
+// It is sent by the ordering service along with the order.
+type WorklistPatient struct {
+	NamaPasien   string             `json:"nama_pasien" bson:"nama_pasien"`
+	TanggalLahir time.Time          `json:"tanggal_lahir" bson:"tanggal_lahir"`
+	JenisKelamin datastruct.SexType `json:"jenis_kelamin" bson:"jenis_kelamin"`
+}
+
+// ScheduledProcedure is the worklist entry of an order. It holds no patient
+// data, so the worklist can be searched without decrypting every order.
+type ScheduledProcedure struct {
+	// StudyInstanceUID is handed to the modality through the worklist, so
+	// the images it sends carry it and are linked to the order.
+	StudyInstanceUID  string                    `json:"study_instance_uid" bson:"study_instance_uid"`
+	KodeProsedur      string                    `json:"kode_prosedur" bson:"kode_prosedur"`
+	DeskripsiProsedur string                    `json:"deskripsi_prosedur" bson:"deskripsi_prosedur"`
+	Modalitas         string                    `json:"modalitas" bson:"modalitas"`
+	AETitleStasiun    string                    `json:"ae_title_stasiun" bson:"ae_title_stasiun"` // empty for any station
+	NamaStasiun       string                    `json:"nama_stasiun" bson:"nama_stasiun"`
+	WaktuJadwal       time.Time                 `json:"waktu_jadwal" bson:"waktu_jadwal"`
+	Status            datastruct.WorklistStatus `json:"status" bson:"status"`
+}
+
+type ScheduleBody struct {
+	Modalitas         string    `json:"modalitas" binding:"required"`
+	AETitleStasiun    string    `json:"ae_title_stasiun"`
+	NamaStasiun       string    `json:"nama_stasiun"`
+	WaktuJadwal       time.Time `json:"waktu_jadwal" binding:"required"`
+	KodeProsedur      string    `json:"kode_prosedur"`
+	DeskripsiProsedur string    `json:"deskripsi_prosedur"`
+}
+
+// WorklistItem gathers what a worklist entry is made of from an order.
+type WorklistItem struct {
+	IDOrder         string
+	NoIHS           string
+	Pasien          WorklistPatient
+	AccessionNumber string
+	DokterPengirim  string
+	Prioritas       datastruct.ExaminationPriority
+	NamaPemeriksaan string
+	BahanKontras    string
+	StatusKehamilan bool
+	Jadwal          ScheduledProcedure
+}
+
+type ReconciledOrder struct {
+	ID               string `json:"id"`
+	NoIHS            string `json:"no_ihs"`
+	AccessionNumber  string `json:"accession_number"`
+	StudyInstanceUID string `json:"study_instance_uid"`
+}
+
+type ReconcileResult struct {
+	Diperiksa int               `json:"diperiksa"`
+	Ditautkan []ReconciledOrder `json:"ditautkan"`
+}
+
+// DefaultModality guesses the modality of an examination until the order is
+// scheduled on a station.
+func DefaultModality(examinationType datastruct.RadiologyExaminationType) string {
+	switch examinationType {
+	case datastruct.GIGI_GELIGI:
+		return "PX"
+	case datastruct.KONTRAS_SALURAN_CERNA, datastruct.KONTRAS_SALURAN_KENCING:
+		return "RF"
+	default:
+		return "DX"
+	}
+}
+
+// NewScheduledProcedure puts an order on the worklist at the time the
+// examination was requested for.
+func NewScheduledProcedure(studyUID, examination string, examinationType datastruct.RadiologyExaminationType, at time.Time) *ScheduledProcedure {
+	return &ScheduledProcedure{
+		StudyInstanceUID:  studyUID,
+		DeskripsiProsedur: examination,
+		Modalitas:         DefaultModality(examinationType),
+		WaktuJadwal:       scheduleTime(at),
+		Status:            datastruct.WORKLIST_DIJADWALKAN,
+	}
+}
+
+// Reschedule moves the entry to a station and time. The study UID stays, as
+// modalities may already have fetched it.
+func (procedure *ScheduledProcedure) Reschedule(body ScheduleBody) {
+	procedure.Modalitas = body.Modalitas
+	procedure.AETitleStasiun = body.AETitleStasiun
+	procedure.NamaStasiun = body.NamaStasiun
+	procedure.WaktuJadwal = scheduleTime(body.WaktuJadwal)
+
+	if body.KodeProsedur != "" {
+		procedure.KodeProsedur = body.KodeProsedur
+	}
+	if body.DeskripsiProsedur != "" {
+		procedure.DeskripsiProsedur = body.DeskripsiProsedur
+	}
+}
+
+// scheduleTime keeps the time as the database gives it back, so the
+// signature of the order still matches once it is read again.
+func scheduleTime(at time.Time) time.Time {
+	return at.Truncate(time.Millisecond).UTC()
+}
+
+// ParseWorklistDay returns the first moment of the day and of the day after.
+func ParseWorklistDay(day string, location *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(time.DateOnly, day, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidWorklistDayError
+	}
+
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+func (patient *WorklistPatient) SexString() string {
+	switch patient.JenisKelamin {
+	case datastruct.UNKNOWN:
+		return "Tidak diketahui"
+	case datastruct.MALE:
+		return "Laki-laki"
+	case datastruct.FEMALE:
+		return "Perempuan"
+	case datastruct.UNDEFINED:
+		return "Tidak dapat ditentukan"
+	case datastruct.NOTFILLED:
+		return "Tidak mengisi"
+	default:
+		return ""
+	}
+}
@@ -53,3 +53,69 @@ func CreateKeyVaultIndex(keyVaultClient *mongo.Client, keyVaultNamespace string)
 	return nil
 
 }
+
+func CreateAccessionNumberIndex(client *mongo.Client) error {
+	accessionIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "accession_number", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{Key: "accession_number", Value: bson.D{
+					{Key: "$exists", Value: true},
+				}},
+			}),
+	}
+
+	_, err := client.Database("fasyankes").Collection("radiologi").Indexes().CreateOne(context.TODO(), accessionIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create accession number index: %v", err)
+	}
+
+	return nil
+}
+
+// CreatePatientListIndex serves the list of a patient, which is paged in
+// the order of the IDs.
+func CreatePatientListIndex(client *mongo.Client) error {
+	listIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "no_ihs", Value: 1}, {Key: "_id", Value: -1}},
+	}
+
+	_, err := client.Database("fasyankes").Collection("radiologi").Indexes().CreateOne(context.TODO(), listIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create patient list index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateScreeningRuleIndex keeps one rule per kode for each facility.
+func CreateScreeningRuleIndex(client *mongo.Client) error {
+	ruleIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "kode", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("aturan_skrining_radiologi").Indexes().CreateOne(context.TODO(), ruleIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create screening rule index: %v", err)
+	}
+
+	return nil
+}
+
+// CreateReportTemplateIndex keeps one report template per kode for each
+// facility.
+func CreateReportTemplateIndex(client *mongo.Client) error {
+	templateIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "kode", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := client.Database("fasyankes").Collection("template_laporan_radiologi").Indexes().CreateOne(context.TODO(), templateIndex)
+	if err != nil {
+		return fmt.Errorf("failed to create report template index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package dicomweb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidUIDError    = errors.New("uid must be a dicom uid made of digits and dots")
+	NotFoundError      = errors.New("the pacs has no such study, series or instance")
+	NothingStoredError = errors.New("the pacs stored none of the instances")
+)
+
+// ServerError is returned when the PACS answered with an error status.
+type ServerError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (serverError *ServerError) Error() string {
+	return fmt.Sprintf("dicomweb server responded with %s - %s", serverError.Status, serverError.Body)
+}
+
+// Client talks to a DICOMweb server, e.g. the dicom-web plugin of Orthanc,
+// through QIDO-RS, WADO-RS and STOW-RS.
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+func New(baseURL, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		URL:      strings.TrimRight(baseURL, "/"),
+		Username: username,
+		Password: password,
+		Client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (client *Client) request(ctx context.Context, method, path string, query url.Values, accept string, body io.Reader) (*http.Request, error) {
+	target := client.URL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Accept", accept)
+	if client.Username != "" {
+		req.SetBasicAuth(client.Username, client.Password)
+	}
+
+	return req, nil
+}
+
+// send runs the request and turns error statuses into errors. The caller
+// closes the body of a successful response.
+func (client *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, NotFoundError
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &ServerError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(respBody),
+		}
+	}
+
+	return resp, nil
+}
+
+func (client *Client) getDatasets(ctx context.Context, path string, query url.Values) ([]Dataset, error) {
+	req, err := client.request(ctx, http.MethodGet, path, query, "application/dicom+json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	datasets := []Dataset{}
+	if resp.StatusCode == http.StatusNoContent {
+		return datasets, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&datasets); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return datasets, nil
+}
+
+// SearchStudies runs a QIDO-RS study search. Several study UIDs can be
+// matched at once by joining them with a backslash.
+func (client *Client) SearchStudies(ctx context.Context, query url.Values) ([]Dataset, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	query.Add("includefield", TagModalitiesInStudy)
+	query.Add("includefield", TagStudyDescription)
+	query.Add("includefield", TagNumberOfStudyRelatedSeries)
+	query.Add("includefield", TagNumberOfStudyRelatedInstances)
+
+	return client.getDatasets(ctx, "/studies", query)
+}
+
+// FindStudy looks a study up by its UID.
+func (client *Client) FindStudy(ctx context.Context, studyUID string) (Dataset, error) {
+	if !ValidUID(studyUID) {
+		return nil, InvalidUIDError
+	}
+
+	studies, err := client.SearchStudies(ctx, url.Values{TagStudyInstanceUID: {studyUID}})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(studies) == 0 {
+		return nil, fmt.Errorf("%s: %w", studyUID, NotFoundError)
+	}
+
+	return studies[0], nil
+}
+
+// StudyMetadata retrieves the metadata of every instance of a study through
+// WADO-RS.
+func (client *Client) StudyMetadata(ctx context.Context, studyUID string) ([]Dataset, error) {
+	if !ValidUID(studyUID) {
+		return nil, InvalidUIDError
+	}
+
+	return client.getDatasets(ctx, fmt.Sprintf("/studies/%s/metadata", studyUID), nil)
+}
+
+// Rendered retrieves an instance rendered as an image of the accepted type.
+// The caller closes the body of the response.
+func (client *Client) Rendered(ctx context.Context, studyUID, seriesUID, instanceUID, accept string, query url.Values) (*http.Response, error) {
+	if !ValidUID(studyUID) || !ValidUID(seriesUID) || !ValidUID(instanceUID) {
+		return nil, InvalidUIDError
+	}
+
+	path := fmt.Sprintf("/studies/%s/series/%s/instances/%s/rendered", studyUID, seriesUID, instanceUID)
+	req, err := client.request(ctx, http.MethodGet, path, query, accept, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.send(req)
+}
+
+// Store sends DICOM files to the server through STOW-RS and returns its
+// response. The files are streamed as one multipart/related body.
+func (client *Client) Store(ctx context.Context, files []io.Reader) (Dataset, error) {
+	bodyReader, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(bodyWriter)
+
+	go func() {
+		for i := 0; i < len(files); i++ {
+			part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/dicom"}})
+			if err != nil {
+				bodyWriter.CloseWithError(err)
+				return
+			}
+
+			if _, err := io.Copy(part, files[i]); err != nil {
+				bodyWriter.CloseWithError(err)
+				return
+			}
+		}
+
+		bodyWriter.CloseWithError(writer.Close())
+	}()
+
+	req, err := client.request(ctx, http.MethodPost, "/studies", nil, "application/dicom+json", bodyReader)
+	if err != nil {
+		bodyReader.Close()
+		return nil, err
+	}
+	req.Header.Add("Content-Type", fmt.Sprintf(`multipart/related; type="application/dicom"; boundary=%s`, writer.Boundary()))
+
+	resp, err := client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response Dataset
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,224 @@
+package dicomweb
+
+import (
+	"encoding/json"
+	"regexp"
+	"service-radiology/datastruct/radiology"
+	"strconv"
+	"strings"
+)
+
+// Tags of the attributes read from the DICOM JSON model, written as the
+// eight hex digits used by DICOMweb.
+const (
+	TagSOPInstanceUID                 = "00080018"
+	TagStudyDate                      = "00080020"
+	TagStudyTime                      = "00080030"
+	TagAccessionNumber                = "00080050"
+	TagModality                       = "00080060"
+	TagModalitiesInStudy              = "00080061"
+	TagStudyDescription               = "00081030"
+	TagSeriesDescription              = "0008103E"
+	TagRetrieveURL                    = "00081190"
+	TagFailedSOPSequence              = "00081198"
+	TagReferencedSOPSequence          = "00081199"
+	TagPatientName                    = "00100010"
+	TagPatientID                      = "00100020"
+	TagStudyInstanceUID               = "0020000D"
+	TagSeriesInstanceUID              = "0020000E"
+	TagSeriesNumber                   = "00200011"
+	TagInstanceNumber                 = "00200013"
+	TagNumberOfStudyRelatedSeries     = "00201206"
+	TagNumberOfStudyRelatedInstances  = "00201208"
+	TagNumberOfSeriesRelatedInstances = "00201209"
+)
+
+var uidPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// ValidUID tells whether uid is a DICOM UID. UIDs are put in the path of
+// requests to the PACS, so anything else is refused.
+func ValidUID(uid string) bool {
+	return len(uid) <= 64 && uidPattern.MatchString(uid)
+}
+
+type Attribute struct {
+	VR    string            `json:"vr"`
+	Value []json.RawMessage `json:"Value,omitempty"`
+}
+
+// Dataset is an object of the DICOM JSON model, keyed by tag.
+type Dataset map[string]Attribute
+
+// Strings returns the values of an attribute as text. Person names give
+// their alphabetic form and numbers their decimal form.
+func (dataset Dataset) Strings(tag string) []string {
+	values := []string{}
+	raw := dataset[tag].Value
+	for i := 0; i < len(raw); i++ {
+		var text string
+		if err := json.Unmarshal(raw[i], &text); err == nil {
+			values = append(values, text)
+			continue
+		}
+
+		var name struct {
+			Alphabetic string `json:"Alphabetic"`
+		}
+		if err := json.Unmarshal(raw[i], &name); err == nil && name.Alphabetic != "" {
+			values = append(values, name.Alphabetic)
+			continue
+		}
+
+		var number json.Number
+		if err := json.Unmarshal(raw[i], &number); err == nil {
+			values = append(values, number.String())
+		}
+	}
+
+	return values
+}
+
+func (dataset Dataset) String(tag string) string {
+	values := dataset.Strings(tag)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (dataset Dataset) Int(tag string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(dataset.String(tag)))
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func (dataset Dataset) Sequence(tag string) []Dataset {
+	items := []Dataset{}
+	raw := dataset[tag].Value
+	for i := 0; i < len(raw); i++ {
+		var item Dataset
+		if err := json.Unmarshal(raw[i], &item); err == nil {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// StudyFromSearch reads a study found through QIDO-RS.
+func StudyFromSearch(dataset Dataset) radiology.ImagingStudy {
+	return radiology.ImagingStudy{
+		StudyInstanceUID: dataset.String(TagStudyInstanceUID),
+		AccessionNumber:  dataset.String(TagAccessionNumber),
+		IDPasien:         dataset.String(TagPatientID),
+		NamaPasien:       dataset.String(TagPatientName),
+		TanggalStudi:     dataset.String(TagStudyDate),
+		WaktuStudi:       dataset.String(TagStudyTime),
+		Deskripsi:        dataset.String(TagStudyDescription),
+		Modalitas:        dataset.Strings(TagModalitiesInStudy),
+		JumlahSeri:       dataset.Int(TagNumberOfStudyRelatedSeries),
+		JumlahInstance:   dataset.Int(TagNumberOfStudyRelatedInstances),
+	}
+}
+
+// StudyFromMetadata gathers the metadata of every instance of a study,
+// retrieved through WADO-RS, into the study and its series.
+func StudyFromMetadata(instances []Dataset) *radiology.ImagingStudy {
+	if len(instances) == 0 {
+		return nil
+	}
+
+	first := instances[0]
+	study := radiology.ImagingStudy{
+		StudyInstanceUID: first.String(TagStudyInstanceUID),
+		AccessionNumber:  first.String(TagAccessionNumber),
+		IDPasien:         first.String(TagPatientID),
+		NamaPasien:       first.String(TagPatientName),
+		TanggalStudi:     first.String(TagStudyDate),
+		WaktuStudi:       first.String(TagStudyTime),
+		Deskripsi:        first.String(TagStudyDescription),
+		Modalitas:        []string{},
+		Seri:             []radiology.ImagingSeries{},
+	}
+
+	seriesIndex := map[string]int{}
+	for i := 0; i < len(instances); i++ {
+		uid := instances[i].String(TagSeriesInstanceUID)
+
+		index, ok := seriesIndex[uid]
+		if !ok {
+			modality := instances[i].String(TagModality)
+			study.Seri = append(study.Seri, radiology.ImagingSeries{
+				SeriesInstanceUID: uid,
+				NomorSeri:         instances[i].Int(TagSeriesNumber),
+				Modalitas:         modality,
+				Deskripsi:         instances[i].String(TagSeriesDescription),
+				SOPInstanceUID:    []string{},
+			})
+			index = len(study.Seri) - 1
+			seriesIndex[uid] = index
+
+			if modality != "" && !contains(study.Modalitas, modality) {
+				study.Modalitas = append(study.Modalitas, modality)
+			}
+		}
+
+		series := &study.Seri[index]
+		series.SOPInstanceUID = append(series.SOPInstanceUID, instances[i].String(TagSOPInstanceUID))
+		series.JumlahInstance++
+	}
+
+	study.JumlahSeri = len(study.Seri)
+	study.JumlahInstance = len(instances)
+
+	return &study
+}
+
+// StoredStudies returns the studies of the instances accepted by STOW-RS,
+// read from their retrieve URLs, and the number of instances refused.
+func StoredStudies(response Dataset) ([]string, int) {
+	studies := []string{}
+	stored := response.Sequence(TagReferencedSOPSequence)
+	for i := 0; i < len(stored); i++ {
+		uid := studyOfURL(stored[i].String(TagRetrieveURL))
+		if uid != "" && !contains(studies, uid) {
+			studies = append(studies, uid)
+		}
+	}
+
+	if len(studies) == 0 {
+		if uid := studyOfURL(response.String(TagRetrieveURL)); uid != "" {
+			studies = append(studies, uid)
+		}
+	}
+
+	return studies, len(response.Sequence(TagFailedSOPSequence))
+}
+
+func studyOfURL(retrieveURL string) string {
+	_, after, found := strings.Cut(retrieveURL, "/studies/")
+	if !found {
+		return ""
+	}
+
+	uid, _, _ := strings.Cut(after, "/")
+	if !ValidUID(uid) {
+		return ""
+	}
+
+	return uid
+}
+
+func contains(values []string, value string) bool {
+	for i := 0; i < len(values); i++ {
+		if values[i] == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,296 @@
+package dicomweb
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	InvalidFileError = errors.New("the file is not a readable dicom part 10 file")
+)
+
+const (
+	transferImplicitLittle = "1.2.840.10008.1.2"
+	transferExplicitBig    = "1.2.840.10008.1.2.2"
+	transferDeflated       = "1.2.840.10008.1.2.1.99"
+
+	tagTransferSyntaxUID    = 0x00020010
+	tagItem                 = 0xFFFEE000
+	tagItemDelimitation     = 0xFFFEE00D
+	tagSequenceDelimitation = 0xFFFEE0DD
+
+	undefinedLength = 0xFFFFFFFF
+
+	// maxHeaderValue bounds the values read, the attributes kept are short
+	// strings
+	maxHeaderValue = 1024
+)
+
+// headerAttribute is an attribute ReadHeader keeps.
+type headerAttribute struct {
+	Tag string
+	VR  string
+}
+
+// headerAttributes are the attributes an upload is checked with. The
+// dataset is sorted by tag, so reading stops after the last of them.
+var headerAttributes = map[uint32]headerAttribute{
+	0x00080050: {Tag: TagAccessionNumber, VR: "SH"},
+	0x00100020: {Tag: TagPatientID, VR: "LO"},
+	0x0020000D: {Tag: TagStudyInstanceUID, VR: "UI"},
+}
+
+const lastHeaderTag = 0x0020000D
+
+// ReadHeader reads the accession number, patient ID and study of a DICOM
+// Part 10 file, so an upload can be checked before it is sent to the PACS.
+// Only the start of the dataset is read.
+func ReadHeader(file io.Reader) (Dataset, error) {
+	dataset, err := readHeader(bufio.NewReader(file))
+	if err != nil && !errors.Is(err, InvalidFileError) {
+		return nil, fmt.Errorf("%w: %v", InvalidFileError, err)
+	}
+
+	return dataset, err
+}
+
+func readHeader(file *bufio.Reader) (Dataset, error) {
+	preamble := make([]byte, 132)
+	if _, err := io.ReadFull(file, preamble); err != nil {
+		return nil, err
+	}
+
+	if string(preamble[128:]) != "DICM" {
+		return nil, InvalidFileError
+	}
+
+	// the file meta information is always explicit VR little endian
+	meta := &elementReader{r: file, order: binary.LittleEndian, explicit: true}
+	transferSyntax := ""
+	for {
+		group, err := file.Peek(2)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if binary.LittleEndian.Uint16(group) != 0x0002 {
+			break
+		}
+
+		tag, err := meta.readTag()
+		if err != nil {
+			return nil, err
+		}
+
+		vr, length, err := meta.readLength(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if tag != tagTransferSyntaxUID {
+			if err := meta.skip(vr, length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		transferSyntax, err = meta.readString(length)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	elements := &elementReader{r: file, order: binary.LittleEndian, explicit: true}
+	switch transferSyntax {
+	case transferImplicitLittle:
+		elements.explicit = false
+	case transferExplicitBig:
+		elements.order = binary.BigEndian
+	case transferDeflated:
+		elements.r = flate.NewReader(file)
+	}
+
+	dataset := Dataset{}
+	for {
+		tag, err := elements.readTag()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if tag > lastHeaderTag {
+			break
+		}
+
+		vr, length, err := elements.readLength(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		attribute, ok := headerAttributes[tag]
+		if !ok || length == undefinedLength {
+			if err := elements.skip(vr, length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		value, err := elements.readString(length)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		dataset[attribute.Tag] = Attribute{VR: attribute.VR, Value: []json.RawMessage{raw}}
+	}
+
+	return dataset, nil
+}
+
+type elementReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	explicit bool
+}
+
+func (reader *elementReader) readTag() (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(reader.r, buf[:]); err != nil {
+		return 0, err
+	}
+
+	return uint32(reader.order.Uint16(buf[0:2]))<<16 | uint32(reader.order.Uint16(buf[2:4])), nil
+}
+
+// readLength reads the VR, when the encoding is explicit, and the length of
+// the value following the tag. Items and delimiters never carry a VR.
+func (reader *elementReader) readLength(tag uint32) (string, uint32, error) {
+	if !reader.explicit || tag>>16 == 0xFFFE {
+		var buf [4]byte
+		if _, err := io.ReadFull(reader.r, buf[:]); err != nil {
+			return "", 0, err
+		}
+		return "", reader.order.Uint32(buf[:]), nil
+	}
+
+	var vr [2]byte
+	if _, err := io.ReadFull(reader.r, vr[:]); err != nil {
+		return "", 0, err
+	}
+
+	switch string(vr[:]) {
+	case "OB", "OD", "OF", "OL", "OV", "OW", "SQ", "SV", "UC", "UN", "UR", "UT", "UV":
+		var buf [6]byte
+		if _, err := io.ReadFull(reader.r, buf[:]); err != nil {
+			return "", 0, err
+		}
+		return string(vr[:]), reader.order.Uint32(buf[2:]), nil
+	default:
+		var buf [2]byte
+		if _, err := io.ReadFull(reader.r, buf[:]); err != nil {
+			return "", 0, err
+		}
+		return string(vr[:]), uint32(reader.order.Uint16(buf[:])), nil
+	}
+}
+
+// readString reads a text value and returns its first value, without the
+// padding.
+func (reader *elementReader) readString(length uint32) (string, error) {
+	if length > maxHeaderValue {
+		return "", InvalidFileError
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader.r, value); err != nil {
+		return "", err
+	}
+
+	text := strings.TrimRight(string(value), " \x00")
+	if i := strings.IndexByte(text, '\\'); i >= 0 {
+		text = text[:i]
+	}
+
+	return strings.TrimSpace(text), nil
+}
+
+// skip passes over a value. A value of undefined length is a sequence, which
+// is encoded as implicit VR little endian when its VR is UN.
+func (reader *elementReader) skip(vr string, length uint32) error {
+	if length != undefinedLength {
+		_, err := io.CopyN(io.Discard, reader.r, int64(length))
+		return err
+	}
+
+	items := reader
+	if vr == "UN" {
+		items = &elementReader{r: reader.r, order: binary.LittleEndian, explicit: false}
+	}
+
+	return items.skipSequence()
+}
+
+func (reader *elementReader) skipSequence() error {
+	for {
+		tag, err := reader.readTag()
+		if err != nil {
+			return err
+		}
+
+		_, length, err := reader.readLength(tag)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case tag == tagSequenceDelimitation:
+			return nil
+		case tag != tagItem:
+			return InvalidFileError
+		case length != undefinedLength:
+			if _, err := io.CopyN(io.Discard, reader.r, int64(length)); err != nil {
+				return err
+			}
+		default:
+			if err := reader.skipItem(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (reader *elementReader) skipItem() error {
+	for {
+		tag, err := reader.readTag()
+		if err != nil {
+			return err
+		}
+
+		vr, length, err := reader.readLength(tag)
+		if err != nil {
+			return err
+		}
+
+		if tag == tagItemDelimitation {
+			return nil
+		}
+
+		if err := reader.skip(vr, length); err != nil {
+			return err
+		}
+	}
+}
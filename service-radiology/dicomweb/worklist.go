@@ -0,0 +1,148 @@
+package dicomweb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"service-radiology/datastruct"
+	"service-radiology/datastruct/radiology"
+	"time"
+)
+
+// Tags of the modality worklist attributes.
+const (
+	TagReferringPhysicianName        = "00080090"
+	TagPatientBirthDate              = "00100030"
+	TagPatientSex                    = "00100040"
+	TagPregnancyStatus               = "001021C0"
+	TagRequestingPhysician           = "00321032"
+	TagRequestedProcedureDescription = "00321060"
+	TagRequestedContrastAgent        = "00321070"
+	TagScheduledStationAETitle       = "00400001"
+	TagScheduledStartDate            = "00400002"
+	TagScheduledStartTime            = "00400003"
+	TagScheduledStepDescription      = "00400007"
+	TagScheduledStepID               = "00400009"
+	TagScheduledStationName          = "00400010"
+	TagScheduledStepStatus           = "00400020"
+	TagScheduledStepSequence         = "00400100"
+	TagRequestedProcedureID          = "00401001"
+	TagRequestedProcedurePriority    = "00401003"
+)
+
+// NewUID makes a UID under the 2.25 root out of a random UUID, which needs no
+// registered organisation root.
+func NewUID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // variant RFC 4122
+
+	return "2.25." + new(big.Int).SetBytes(id).String(), nil
+}
+
+// Set replaces an attribute. Empty strings are left out, so an attribute
+// without values is sent with its VR only.
+func (dataset Dataset) Set(tag, vr string, values ...any) {
+	raw := []json.RawMessage{}
+	for i := 0; i < len(values); i++ {
+		if text, ok := values[i].(string); ok && text == "" {
+			continue
+		}
+
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			continue
+		}
+		raw = append(raw, value)
+	}
+
+	dataset[tag] = Attribute{VR: vr, Value: raw}
+}
+
+func (dataset Dataset) SetPersonName(tag, name string) {
+	if name == "" {
+		dataset.Set(tag, "PN")
+		return
+	}
+
+	dataset.Set(tag, "PN", map[string]string{"Alphabetic": name})
+}
+
+func sexCode(sex datastruct.SexType) string {
+	switch sex {
+	case datastruct.MALE:
+		return "M"
+	case datastruct.FEMALE:
+		return "F"
+	case datastruct.UNDEFINED:
+		return "O"
+	default:
+		return ""
+	}
+}
+
+func priorityCode(priority datastruct.ExaminationPriority) string {
+	if priority == datastruct.CITO {
+		return "STAT"
+	}
+
+	return "ROUTINE"
+}
+
+// WorklistDataset lays an order out as a modality worklist entry, as a
+// C-FIND SCP would return it, in the DICOM JSON model.
+func WorklistDataset(item radiology.WorklistItem) Dataset {
+	at := item.Jadwal.WaktuJadwal.In(time.Local)
+
+	step := Dataset{}
+	step.Set(TagModality, "CS", item.Jadwal.Modalitas)
+	step.Set(TagScheduledStationAETitle, "AE", item.Jadwal.AETitleStasiun)
+	step.Set(TagScheduledStationName, "SH", item.Jadwal.NamaStasiun)
+	step.Set(TagScheduledStartDate, "DA", at.Format("20060102"))
+	step.Set(TagScheduledStartTime, "TM", at.Format("150405"))
+	step.Set(TagScheduledStepDescription, "LO", item.Jadwal.DeskripsiProsedur)
+	step.Set(TagScheduledStepID, "SH", item.AccessionNumber)
+	step.Set(TagScheduledStepStatus, "CS", "SCHEDULED")
+
+	dataset := Dataset{}
+	dataset.SetPersonName(TagPatientName, item.Pasien.NamaPasien)
+	dataset.Set(TagPatientID, "LO", item.NoIHS)
+	if !item.Pasien.TanggalLahir.IsZero() {
+		dataset.Set(TagPatientBirthDate, "DA", item.Pasien.TanggalLahir.Format("20060102"))
+	} else {
+		dataset.Set(TagPatientBirthDate, "DA")
+	}
+	dataset.Set(TagPatientSex, "CS", sexCode(item.Pasien.JenisKelamin))
+
+	if item.Pasien.JenisKelamin == datastruct.FEMALE {
+		// 1 not pregnant, 3 definitely pregnant
+		pregnancy := 1
+		if item.StatusKehamilan {
+			pregnancy = 3
+		}
+		dataset.Set(TagPregnancyStatus, "US", pregnancy)
+	}
+
+	dataset.Set(TagAccessionNumber, "SH", item.AccessionNumber)
+	dataset.SetPersonName(TagReferringPhysicianName, item.DokterPengirim)
+	dataset.SetPersonName(TagRequestingPhysician, item.DokterPengirim)
+	dataset.Set(TagStudyInstanceUID, "UI", item.Jadwal.StudyInstanceUID)
+	dataset.Set(TagRequestedProcedureID, "SH", item.AccessionNumber)
+	dataset.Set(TagRequestedProcedureDescription, "LO", item.NamaPemeriksaan)
+	dataset.Set(TagRequestedProcedurePriority, "SH", priorityCode(item.Prioritas))
+	dataset.Set(TagRequestedContrastAgent, "LO", item.BahanKontras)
+	dataset.Set(TagScheduledStepSequence, "SQ", step)
+
+	return dataset
+}
+
+// SearchByAccession runs a QIDO-RS study search on the accession number.
+func (client *Client) SearchByAccession(ctx context.Context, accessionNumber string) ([]Dataset, error) {
+	return client.SearchStudies(ctx, url.Values{TagAccessionNumber: {accessionNumber}})
+}
@@ -21,6 +21,26 @@ func main() {
 		return
 	}
 
+	if err := db.CreateAccessionNumberIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreatePatientListIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateScreeningRuleIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
+	if err := db.CreateReportTemplateIndex(client); err != nil {
+		logger.LogError.Println(err)
+		return
+	}
+
 	csfle := csfle.InitCSFLE(&cfg, client)
 
 	err := csfle.CreateClientEncryption(keyVaultNamespace).GetKey()
@@ -0,0 +1,171 @@
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	InvalidLimitError  = errors.New("limit must be a number from 1 to 100")
+	InvalidCursorError = errors.New("cursor is not a valid next_cursor")
+	InvalidSortError   = errors.New("sort must be either asc or desc")
+	InvalidRangeError  = errors.New("from must not be after to")
+)
+
+// Queries are the query params every paginated list accepts, to be added
+// to the params the list filters on.
+var Queries = []string{"limit", "cursor", "sort", "from", "to"}
+
+// Params is the page of a list that was asked for. Documents are listed in
+// the order they were created, which is the order of their IDs, so the ID
+// of the last document read is the cursor of the next page.
+type Params struct {
+	Limit      int64
+	Descending bool
+	Cursor     *primitive.ObjectID
+
+	// the creation date range, to included
+	From *time.Time
+	To   *time.Time
+}
+
+// Page is one page of a list. Total counts every document matching the
+// filter, on every page.
+type Page struct {
+	Data       interface{} `json:"data"`
+	Total      int64       `json:"total"`
+	Limit      int64       `json:"limit"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Parse reads the page from the query. The newest documents come first
+// unless sort is asc.
+func Parse(query url.Values) (*Params, error) {
+	params := Params{
+		Limit:      DefaultLimit,
+		Descending: true,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || value < 1 || value > MaxLimit {
+			return nil, InvalidLimitError
+		}
+		params.Limit = value
+	}
+
+	switch query.Get("sort") {
+	case "", "desc":
+	case "asc":
+		params.Descending = false
+	default:
+		return nil, InvalidSortError
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		id, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return nil, InvalidCursorError
+		}
+		params.Cursor = &id
+	}
+
+	if from := query.Get("from"); from != "" {
+		date, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return nil, err
+		}
+		params.From = &date
+	}
+
+	if to := query.Get("to"); to != "" {
+		date, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return nil, err
+		}
+		params.To = &date
+	}
+
+	if params.From != nil && params.To != nil && params.From.After(*params.To) {
+		return nil, InvalidRangeError
+	}
+
+	return &params, nil
+}
+
+// and adds a condition to the ones the filter already has.
+func and(filter bson.M, condition bson.M) {
+	conditions, _ := filter["$and"].(bson.A)
+	filter["$and"] = append(conditions, condition)
+}
+
+// Filter narrows the filter down to the creation date range. The total is
+// counted with it.
+func (params *Params) Filter(filter bson.M) {
+	createdAt := bson.M{}
+	if params.From != nil {
+		createdAt["$gte"] = *params.From
+	}
+	if params.To != nil {
+		createdAt["$lt"] = params.To.AddDate(0, 0, 1)
+	}
+
+	if len(createdAt) > 0 {
+		and(filter, bson.M{"created_at": createdAt})
+	}
+}
+
+// PageFilter narrows the filter further down to the documents after the
+// cursor.
+func (params *Params) PageFilter(filter bson.M) {
+	if params.Cursor == nil {
+		return
+	}
+
+	if params.Descending {
+		and(filter, bson.M{"_id": bson.M{"$lt": *params.Cursor}})
+	} else {
+		and(filter, bson.M{"_id": bson.M{"$gt": *params.Cursor}})
+	}
+}
+
+// FindOptions sorts the documents and reads one past the limit, to tell
+// whether another page follows.
+func (params *Params) FindOptions() *options.FindOptions {
+	order := 1
+	if params.Descending {
+		order = -1
+	}
+
+	return options.Find().
+		SetSort(bson.D{{Key: "_id", Value: order}}).
+		SetLimit(params.Limit + 1)
+}
+
+// Page puts the data of the page in its envelope. last is the ID of the
+// last document read for the page, including the documents left out of the
+// data, e.g. for failing their signature.
+func (params *Params) Page(data interface{}, total int64, last primitive.ObjectID, more bool) *Page {
+	page := Page{
+		Data:  data,
+		Total: total,
+		Limit: params.Limit,
+	}
+
+	if more {
+		page.NextCursor = last.Hex()
+	}
+
+	return &page
+}
@@ -6,6 +6,7 @@ import (
 	"service-radiology/datastruct"
 	"service-radiology/db/csfle"
 	"service-radiology/middleware"
+	"service-radiology/pagination"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,16 +14,22 @@ import (
 )
 
 type RouterConfig struct {
-	Client              *mongo.Client
-	RadiologyController *fasyankes_controllers.RadiologyController
+	Client               *mongo.Client
+	RadiologyController  *fasyankes_controllers.RadiologyController
+	AttachmentController *fasyankes_controllers.AttachmentController
 }
 
 func InitRouter(client *mongo.Client, csfle *csfle.CSFLE) *gin.Engine {
 	routerConfig := RouterConfig{
-		Client:              client,
-		RadiologyController: fasyankes_controllers.InitRadiologyController(client, csfle),
+		Client:               client,
+		RadiologyController:  fasyankes_controllers.InitRadiologyController(client, csfle),
+		AttachmentController: fasyankes_controllers.InitAttachmentController(client, csfle),
 	}
 
+	go routerConfig.RadiologyController.RunReconciliation(
+		time.Duration(config.WorklistReconcileInterval) * time.Second,
+	)
+
 	return routerConfig.SetRouter()
 }
 
@@ -32,6 +39,18 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 
 	router.GET("/live", LivenessCheck())
 	router.GET("/ready", ReadinessCheck(routerConfig.Client))
+
+	// signed download links are opened without a token or timestamp, e.g.
+	// from an image tag
+	router.GET(fasyankes_controllers.AttachmentLinkPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"expires", "signature"}}),
+		routerConfig.AttachmentController.LinkedAttachmentHandler())
+
+	// printed documents are verified by scanning their QR code
+	router.GET(fasyankes_controllers.DocumentVerifyPath+"/:id",
+		middleware.Sanitize(middleware.AcceptableParams{Queries: []string{"fingerprint"}}),
+		routerConfig.RadiologyController.VerifyRadiologyReportHandler())
+
 	router.Use(middleware.CORS(), middleware.Timekeep(time.Duration(config.TimestampSkew)*time.Millisecond))
 
 	// Define routes
@@ -53,9 +72,84 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	}
 
 	ap2 := middleware.AcceptableParams{
-		Queries: []string{"jenis_pemeriksaan", "nama_pemeriksaan"},
+		Queries: append([]string{"jenis_pemeriksaan", "nama_pemeriksaan", "pemeriksaan_from", "pemeriksaan_to", "id_kunjungan"}, pagination.Queries...),
+	}
+
+	ap3 := middleware.AcceptableParams{
+		Queries: []string{"quality", "viewport"},
+	}
+
+	ap4 := middleware.AcceptableParams{
+		Queries: []string{"tanggal", "modalitas", "ae_title"},
+	}
+
+	resource.GET("/radiology/worklist",
+		middleware.Sanitize(ap4),
+		routerConfig.RadiologyController.GetWorklistHandler())
+
+	resource.POST("/radiology/worklist/reconcile",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.ReconcileWorklistHandler())
+
+	ap5 := middleware.AcceptableParams{
+		Queries: append([]string{"q", "jenis_pemeriksaan"}, pagination.Queries...),
+	}
+
+	kodeUpdateConfig := map[string]string{
+		"filterKey": "kode",
+		"paramKey":  "kode",
+	}
+
+	resource.GET("/radiology/template",
+		middleware.Sanitize(ap5),
+		routerConfig.RadiologyController.GetReportTemplatesHandler())
+
+	resource.GET("/radiology/template/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.GetReportTemplateHandler())
+
+	resource.POST("/radiology/template",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.CreateReportTemplateHandler())
+
+	resource.PUT("/radiology/template/:kode",
+		middleware.AuthorizationUpdate(kodeUpdateConfig, routerConfig.RadiologyController.TemplateCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.UpdateReportTemplateHandler())
+
+	resource.DELETE("/radiology/template/:kode",
+		middleware.AuthorizationDelete(kodeUpdateConfig, routerConfig.RadiologyController.TemplateCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.DeleteReportTemplateHandler())
+
+	ap6 := middleware.AcceptableParams{
+		Queries: pagination.Queries,
 	}
 
+	resource.GET("/radiology/screening/rule",
+		middleware.Sanitize(ap6),
+		routerConfig.RadiologyController.GetScreeningRulesHandler())
+
+	resource.GET("/radiology/screening/rule/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.GetScreeningRuleHandler())
+
+	resource.POST("/radiology/screening/rule",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.CreateScreeningRuleHandler())
+
+	resource.PUT("/radiology/screening/rule/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.UpdateScreeningRuleHandler())
+
+	resource.DELETE("/radiology/screening/rule/:kode",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.DeleteScreeningRuleHandler())
+
+	resource.POST("/radiology/screening",
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.PreviewScreeningHandler())
+
 	resource.GET("/radiology/:noIHS",
 		middleware.GetConsent(consentGetter),
 		middleware.Sanitize(ap2),
@@ -71,11 +165,114 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 		middleware.Sanitize(ap),
 		routerConfig.RadiologyController.UpdateRadiologyDataHandler())
 
+	resource.GET("/radiology/:noIHS/:Id/pdf",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.RadiologyReportHandler())
+
+	resource.GET("/radiology/:noIHS/:Id/study",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.GetStudyHandler())
+
+	resource.GET("/radiology/:noIHS/:Id/study/series/:seriesUID/instances/:instanceUID/rendered",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap3),
+		routerConfig.RadiologyController.RenderedInstanceHandler())
+
+	resource.PUT("/radiology/:noIHS/:Id/schedule",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.ScheduleOrderHandler())
+
+	resource.PUT("/radiology/:noIHS/:Id/study",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.LinkStudyHandler())
+
+	resource.POST("/radiology/:noIHS/:Id/study",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.UploadStudyHandler())
+
+	resource.PUT("/radiology/:noIHS/:Id/screening",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.ScreenOrderHandler())
+
+	resource.POST("/radiology/:noIHS/:Id/screening/override",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.OverrideScreeningHandler())
+
+	resource.PUT("/radiology/:noIHS/:Id/report",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.WriteReportHandler())
+
+	resource.POST("/radiology/:noIHS/:Id/report/sign",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.SignReportHandler())
+
+	resource.POST("/radiology/:noIHS/:Id/report/addendum",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.AmendReportHandler())
+
+	resource.POST("/radiology/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.AuthorizationUpdate(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.DigitalSignReportHandler())
+
+	resource.GET("/radiology/:noIHS/:Id/signature",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.RadiologyController.ReportSignatureHandler())
+
 	resource.DELETE("/radiology/:Id",
 		middleware.AuthorizationDelete(authUpdateConfig, routerConfig.RadiologyController.FaskesCollection),
 		middleware.Sanitize(ap),
 		routerConfig.RadiologyController.DeleteRadiologyDataHandler())
 
+	attachmentDeleteConfig := map[string]string{
+		"filterKey": "_id",
+		"paramKey":  "id",
+	}
+
+	resource.POST("/attachment/:noIHS",
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.UploadAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.GetAttachmentHandler())
+
+	resource.GET("/attachment/:noIHS/:id/content",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.DownloadAttachmentHandler())
+
+	resource.POST("/attachment/:noIHS/:id/link",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.AttachmentLinkHandler())
+
+	resource.DELETE("/attachment/:noIHS/:id",
+		middleware.AuthorizationDelete(attachmentDeleteConfig, routerConfig.AttachmentController.AttachmentCollection),
+		middleware.Sanitize(ap),
+		routerConfig.AttachmentController.DeleteAttachmentHandler())
+
 	resource.POST("/radiology/consent",
 		middleware.Sanitize(ap),
 		fasyankes_controllers.ConsentHandler(routerConfig.RadiologyController.ConsentCollection))
@@ -83,8 +280,17 @@ func (routerConfig *RouterConfig) SetRouter() *gin.Engine {
 	request := v1.Group("/request")
 	request.Use(middleware.Authorization(datastruct.DOKTER))
 
+	request.GET("/radiology/:noIHS", middleware.GetConsent(consentGetter), middleware.Sanitize(ap2), routerConfig.RadiologyController.GetAllRadiologyDataHandler())
 	request.GET("/radiology/:noIHS/:Id", middleware.GetConsent(consentGetter), routerConfig.RadiologyController.GetRadiologyDataById())
+	request.GET("/radiology/:noIHS/:Id/pdf", middleware.GetConsent(consentGetter), routerConfig.RadiologyController.RadiologyReportHandler())
+	request.GET("/radiology/:noIHS/:Id/signature", middleware.GetConsent(consentGetter), routerConfig.RadiologyController.ReportSignatureHandler())
+	request.GET("/radiology/:noIHS/:Id/study", middleware.GetConsent(consentGetter), routerConfig.RadiologyController.GetStudyHandler())
+	request.GET("/radiology/:noIHS/:Id/study/series/:seriesUID/instances/:instanceUID/rendered",
+		middleware.GetConsent(consentGetter),
+		middleware.Sanitize(ap3),
+		routerConfig.RadiologyController.RenderedInstanceHandler())
 	request.POST("/radiology", routerConfig.RadiologyController.CreateRadiologyRequest())
+	request.POST("/radiology/screening", routerConfig.RadiologyController.PreviewScreeningHandler())
 
 	return router
 }